@@ -36,10 +36,12 @@ type clientServer struct {
 
 // New returns a client/server to bidirectionally communicate with ACS
 // The returned struct should have both 'Connect' and 'Serve' called upon it
-// before being used.
-func New(url string, cfg *config.Config, credentialProvider *credentials.Credentials) wsclient.ClientServer {
+// before being used. The health of the connection is recorded in
+// connectionStats, which may be nil.
+func New(url string, cfg *config.Config, credentialProvider *credentials.Credentials, connectionStats *wsclient.ConnectionStats) wsclient.ClientServer {
 	cs := &clientServer{}
 	cs.URL = url
+	cs.Stats = connectionStats
 	cs.CredentialProvider = credentialProvider
 	cs.AgentConfig = cfg
 	cs.ServiceError = &acsError{}
@@ -192,7 +192,7 @@ func TestConnect(t *testing.T) {
 		t.Fatal(<-serverErr)
 	}()
 
-	cs := New(server.URL, testCfg, credentials.AnonymousCredentials)
+	cs := New(server.URL, testCfg, credentials.AnonymousCredentials, nil)
 	// Wait for up to a second for the mock server to launch
 	for i := 0; i < 100; i++ {
 		err = cs.Connect()
@@ -263,7 +263,7 @@ func TestConnectClientError(t *testing.T) {
 	}))
 	defer testServer.Close()
 
-	cs := New(testServer.URL, testCfg, credentials.AnonymousCredentials)
+	cs := New(testServer.URL, testCfg, credentials.AnonymousCredentials, nil)
 	err := cs.Connect()
 	_, ok := err.(*wsclient.WSError)
 	assert.True(t, ok)
@@ -272,7 +272,7 @@ func TestConnectClientError(t *testing.T) {
 
 func testCS(conn *mock_wsclient.MockWebsocketConn) wsclient.ClientServer {
 	testCreds := credentials.AnonymousCredentials
-	cs := New("localhost:443", testCfg, testCreds).(*clientServer)
+	cs := New("localhost:443", testCfg, testCreds, nil).(*clientServer)
 	cs.SetConnection(conn)
 	return cs
 }
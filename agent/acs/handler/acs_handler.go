@@ -16,10 +16,12 @@
 package handler
 
 import (
+	"errors"
 	"io"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -62,11 +64,22 @@ const (
 	// credentials for all tasks on establishing the connection
 	sendCredentialsURLParameterName = "sendCredentials"
 	inactiveInstanceExceptionPrefix = "InactiveInstanceException:"
+	// drainPollInterval is how often the payload handler checks whether the
+	// pending payloads and acks are done while draining
+	drainPollInterval = 100 * time.Millisecond
 )
 
+// errSessionDraining is returned instead of connecting once the session is
+// being drained
+var errSessionDraining = errors.New("acs session is being drained")
+
 // Session defines an interface for handler's long-lived connection with ACS.
 type Session interface {
 	Start() error
+	// Drain stops accepting payloads, waits for the pending ones to be
+	// handled and acked and closes the connection. It returns a description
+	// of the work that was left when the context is done.
+	Drain(ctx context.Context) []string
 }
 
 // session encapsulates all arguments needed by the handler to connect to ACS
@@ -82,6 +95,8 @@ type session struct {
 	stateManager                    statemanager.StateManager
 	credentialsManager              rolecredentials.Manager
 	taskHandler                     *eventhandler.TaskHandler
+	payloadLog                      *PayloadLog
+	connectionStats                 *wsclient.ConnectionStats
 	ctx                             context.Context
 	cancel                          context.CancelFunc
 	backoff                         utils.Backoff
@@ -89,6 +104,12 @@ type session struct {
 	_heartbeatTimeout               time.Duration
 	_heartbeatJitter                time.Duration
 	_inactiveInstanceReconnectDelay time.Duration
+	// drainLock guards draining and the client and payload handler of the
+	// current connection
+	drainLock      sync.Mutex
+	draining       bool
+	client         wsclient.ClientServer
+	payloadHandler *payloadRequestHandler
 }
 
 // sessionResources defines the resource creator interface for starting
@@ -109,6 +130,8 @@ type sessionResources interface {
 // for the same
 type acsSessionResources struct {
 	credentialsProvider *credentials.Credentials
+	// connectionStats tracks the health of the connections to ACS
+	connectionStats *wsclient.ConnectionStats
 	// sendCredentials is used to set the 'sendCredentials' URL parameter
 	// used to connect to ACS
 	// It is set to 'true' for the very first successful connection on
@@ -138,8 +161,10 @@ func NewSession(ctx context.Context,
 	stateManager statemanager.StateManager,
 	taskEngine engine.TaskEngine,
 	credentialsManager rolecredentials.Manager,
-	taskHandler *eventhandler.TaskHandler) Session {
-	resources := newSessionResources(credentialsProvider)
+	taskHandler *eventhandler.TaskHandler,
+	payloadLog *PayloadLog,
+	connectionStats *wsclient.ConnectionStats) Session {
+	resources := newSessionResources(credentialsProvider, connectionStats)
 	backoff := utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax,
 		connectionBackoffJitter, connectionBackoffMultiplier)
 	derivedContext, cancel := context.WithCancel(ctx)
@@ -154,6 +179,8 @@ func NewSession(ctx context.Context,
 		taskEngine:                      taskEngine,
 		credentialsManager:              credentialsManager,
 		taskHandler:                     taskHandler,
+		payloadLog:                      payloadLog,
+		connectionStats:                 connectionStats,
 		ctx:                             derivedContext,
 		cancel:                          cancel,
 		backoff:                         backoff,
@@ -188,6 +215,15 @@ func (acsSession *session) Start() error {
 			acsError := acsSession.startSessionOnce()
 			// Session with ACS was stopped with some error, start processing the error
 			isInactiveInstance := isInactiveInstanceError(acsError)
+			if isInactiveInstance {
+				acsSession.connectionStats.SetDisconnectReason(wsclient.DisconnectReasonInactiveInstance)
+			}
+			acsSession.connectionStats.Disconnected(acsError)
+			if acsSession.isDraining() {
+				seelog.Info("Not reconnecting to ACS, the agent is shutting down")
+				<-acsSession.ctx.Done()
+				return acsSession.ctx.Err()
+			}
 			if isInactiveInstance {
 				// If the instance was deregistered, send an event to the event stream
 				// for the same
@@ -231,10 +267,17 @@ func (acsSession *session) Start() error {
 // startSessionOnce creates a session with ACS and handles requests using the passed
 // in arguments
 func (acsSession *session) startSessionOnce() error {
-	acsEndpoint, err := acsSession.ecsClient.DiscoverPollEndpoint(acsSession.containerInstanceARN)
-	if err != nil {
-		seelog.Errorf("Unable to discover poll endpoint, err: %v", err)
-		return err
+	if acsSession.isDraining() {
+		return errSessionDraining
+	}
+	acsEndpoint := acsSession.agentConfig.ACSEndpointOverride
+	if acsEndpoint == "" {
+		var err error
+		acsEndpoint, err = acsSession.ecsClient.DiscoverPollEndpoint(acsSession.containerInstanceARN)
+		if err != nil {
+			seelog.Errorf("Unable to discover poll endpoint, err: %v", err)
+			return err
+		}
 	}
 
 	url := acsWsURL(acsEndpoint, acsSession.agentConfig.Cluster, acsSession.containerInstanceARN, acsSession.taskEngine, acsSession.resources)
@@ -242,7 +285,7 @@ func (acsSession *session) startSessionOnce() error {
 	defer client.Close()
 
 	// Start inactivity timer for closing the connection
-	timer := newDisconnectionTimer(client, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
+	timer := newDisconnectionTimer(client, acsSession.connectionStats, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
 	defer timer.Stop()
 
 	return acsSession.startACSSession(client, timer)
@@ -275,7 +318,9 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer, timer t
 		acsSession.stateManager,
 		refreshCredsHandler,
 		acsSession.credentialsManager,
-		acsSession.taskHandler)
+		acsSession.taskHandler,
+		acsSession.payloadLog,
+		cfg.AvailableLoggingDrivers)
 	// Clear the acks channel on return because acks of messageids don't have any value across sessions
 	defer payloadHandler.clearAcks()
 	payloadHandler.start()
@@ -294,6 +339,10 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer, timer t
 		return err
 	}
 	acsSession.resources.connectedToACS()
+	if !acsSession.setConnection(client, &payloadHandler) {
+		return errSessionDraining
+	}
+	defer acsSession.setConnection(nil, nil)
 
 	backoffResetTimer := time.AfterFunc(
 		utils.AddJitter(acsSession.heartbeatTimeout(), acsSession.heartbeatJitter()), func() {
@@ -325,6 +374,50 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer, timer t
 	}
 }
 
+// Drain stops the handling of new payloads and waits until the payloads that
+// were accepted are handled and acked, or the context is done. It then closes
+// the connection to ACS and stops the session from reconnecting.
+func (acsSession *session) Drain(ctx context.Context) []string {
+	acsSession.drainLock.Lock()
+	acsSession.draining = true
+	client, payloadHandler := acsSession.client, acsSession.payloadHandler
+	acsSession.drainLock.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	seelog.Info("Draining the session with ACS")
+	undelivered := payloadHandler.drain(ctx)
+	err := client.Shutdown()
+	if err != nil {
+		seelog.Warnf("Error closing the connection to ACS: %v", err)
+	}
+	return undelivered
+}
+
+// setConnection records the client and payload handler of the current
+// connection. It returns false if the session is being drained, in which case
+// the client must not connect.
+func (acsSession *session) setConnection(client wsclient.ClientServer, payloadHandler *payloadRequestHandler) bool {
+	acsSession.drainLock.Lock()
+	defer acsSession.drainLock.Unlock()
+
+	if acsSession.draining {
+		return false
+	}
+	acsSession.client = client
+	acsSession.payloadHandler = payloadHandler
+	return true
+}
+
+// isDraining returns true once Drain has been called.
+func (acsSession *session) isDraining() bool {
+	acsSession.drainLock.Lock()
+	defer acsSession.drainLock.Unlock()
+
+	return acsSession.draining
+}
+
 func (acsSession *session) computeReconnectDelay(isInactiveInstance bool) time.Duration {
 	if isInactiveInstance {
 		return acsSession._inactiveInstanceReconnectDelay
@@ -356,7 +449,7 @@ func (acsSession *session) heartbeatJitter() time.Duration {
 
 // createACSClient creates the ACS Client using the specified URL
 func (acsResources *acsSessionResources) createACSClient(url string, cfg *config.Config) wsclient.ClientServer {
-	return acsclient.New(url, cfg, acsResources.credentialsProvider)
+	return acsclient.New(url, cfg, acsResources.credentialsProvider, acsResources.connectionStats)
 }
 
 // connectedToACS records a successful connection to ACS
@@ -371,9 +464,10 @@ func (acsResources *acsSessionResources) getSendCredentialsURLParameter() string
 	return strconv.FormatBool(acsResources.sendCredentials)
 }
 
-func newSessionResources(credentialsProvider *credentials.Credentials) sessionResources {
+func newSessionResources(credentialsProvider *credentials.Credentials, connectionStats *wsclient.ConnectionStats) sessionResources {
 	return &acsSessionResources{
 		credentialsProvider: credentialsProvider,
+		connectionStats:     connectionStats,
 		sendCredentials:     true,
 	}
 }
@@ -400,9 +494,10 @@ func acsWsURL(endpoint, cluster, containerInstanceArn string, taskEngine engine.
 
 // newDisconnectionTimer creates a new time object, with a callback to
 // disconnect from ACS on inactivity
-func newDisconnectionTimer(client wsclient.ClientServer, timeout time.Duration, jitter time.Duration) ttime.Timer {
+func newDisconnectionTimer(client wsclient.ClientServer, connectionStats *wsclient.ConnectionStats, timeout time.Duration, jitter time.Duration) ttime.Timer {
 	timer := time.AfterFunc(utils.AddJitter(timeout, jitter), func() {
 		seelog.Warn("ACS Connection hasn't had any activity for too long; closing connection")
+		connectionStats.SetDisconnectReason(wsclient.DisconnectReasonHeartbeatTimeout)
 		closeErr := client.Close()
 		if closeErr != nil {
 			seelog.Warnf("Error disconnecting: %v", closeErr)
@@ -28,6 +28,7 @@ import (
 
 	"golang.org/x/net/context"
 
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/api/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/config"
@@ -41,10 +42,13 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/utils/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/version"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient/fake"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/golang/mock/gomock"
 )
@@ -64,7 +68,7 @@ const (
             "name": "name",
             "cpu": 1,
             "essential": true,
-            "memory": 1,
+            "memory": 128,
             "portMappings": [],
             "overrides": "{}",
             "image": "i",
@@ -113,6 +117,8 @@ const (
 }
 `
 	acsURL = "http://endpoint.tld"
+	// fakeACSTimeout bounds the waits on the fake ACS
+	fakeACSTimeout = 10 * time.Second
 )
 
 var testConfig = &config.Config{
@@ -214,6 +220,7 @@ func TestHandlerReconnectsOnConnectErrors(t *testing.T) {
 		ecsClient:            ecsClient,
 		stateManager:         statemanager,
 		taskHandler:          taskHandler,
+		payloadLog:           NewPayloadLog(),
 		backoff:              utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		ctx:                  ctx,
 		cancel:               cancel,
@@ -359,6 +366,7 @@ func TestHandlerReconnectsWithoutBackoffOnEOFError(t *testing.T) {
 		deregisterInstanceEventStream:   deregisterInstanceEventStream,
 		stateManager:                    statemanager,
 		taskHandler:                     taskHandler,
+		payloadLog:                      NewPayloadLog(),
 		backoff:                         mockBackoff,
 		ctx:                             ctx,
 		cancel:                          cancel,
@@ -422,6 +430,7 @@ func TestHandlerReconnectsWithBackoffOnNonEOFError(t *testing.T) {
 		deregisterInstanceEventStream: deregisterInstanceEventStream,
 		stateManager:                  statemanager,
 		taskHandler:                   taskHandler,
+		payloadLog:                    NewPayloadLog(),
 		backoff:                       mockBackoff,
 		ctx:                           ctx,
 		cancel:                        cancel,
@@ -481,6 +490,7 @@ func TestHandlerGeneratesDeregisteredInstanceEvent(t *testing.T) {
 		deregisterInstanceEventStream:   deregisterInstanceEventStream,
 		stateManager:                    statemanager,
 		taskHandler:                     taskHandler,
+		payloadLog:                      NewPayloadLog(),
 		backoff:                         utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		ctx:                             ctx,
 		cancel:                          cancel,
@@ -550,6 +560,7 @@ func TestHandlerReconnectDelayForInactiveInstanceError(t *testing.T) {
 		deregisterInstanceEventStream:   deregisterInstanceEventStream,
 		stateManager:                    statemanager,
 		taskHandler:                     taskHandler,
+		payloadLog:                      NewPayloadLog(),
 		backoff:                         utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		ctx:                             ctx,
 		cancel:                          cancel,
@@ -607,6 +618,7 @@ func TestHandlerReconnectsOnServeErrors(t *testing.T) {
 		ecsClient:            ecsClient,
 		stateManager:         statemanager,
 		taskHandler:          taskHandler,
+		payloadLog:           NewPayloadLog(),
 		backoff:              utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		ctx:                  ctx,
 		cancel:               cancel,
@@ -658,6 +670,7 @@ func TestHandlerStopsWhenContextIsCancelled(t *testing.T) {
 		ecsClient:            ecsClient,
 		stateManager:         statemanager,
 		taskHandler:          taskHandler,
+		payloadLog:           NewPayloadLog(),
 		backoff:              utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		ctx:                  ctx,
 		cancel:               cancel,
@@ -713,6 +726,7 @@ func TestHandlerReconnectsOnDiscoverPollEndpointError(t *testing.T) {
 		ecsClient:            ecsClient,
 		stateManager:         statemanager,
 		taskHandler:          taskHandler,
+		payloadLog:           NewPayloadLog(),
 		backoff:              utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		ctx:                  ctx,
 		cancel:               cancel,
@@ -784,6 +798,7 @@ func TestConnectionIsClosedOnIdle(t *testing.T) {
 		ecsClient:            ecsClient,
 		stateManager:         statemanager,
 		taskHandler:          taskHandler,
+		payloadLog:           NewPayloadLog(),
 		ctx:                  context.Background(),
 		backoff:              utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		resources:            &mockSessionResources{},
@@ -791,7 +806,7 @@ func TestConnectionIsClosedOnIdle(t *testing.T) {
 		_heartbeatJitter:     10 * time.Millisecond,
 	}
 	go func() {
-		timer := newDisconnectionTimer(mockWsClient, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
+		timer := newDisconnectionTimer(mockWsClient, nil, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
 		defer timer.Stop()
 		acsSession.startACSSession(mockWsClient, timer)
 	}()
@@ -841,10 +856,11 @@ func TestHandlerDoesntLeakGoroutines(t *testing.T) {
 			ecsClient:            ecsClient,
 			stateManager:         statemanager,
 			taskHandler:          taskHandler,
+			payloadLog:           NewPayloadLog(),
 			ctx:                  ctx,
 			_heartbeatTimeout:    1 * time.Second,
 			backoff:              utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
-			resources:            newSessionResources(credentials.AnonymousCredentials),
+			resources:            newSessionResources(credentials.AnonymousCredentials, nil),
 			credentialsManager:   rolecredentials.NewManager(),
 		}
 		acsSession.Start()
@@ -927,6 +943,8 @@ func TestStartSessionHandlesRefreshCredentialsMessages(t *testing.T) {
 			taskEngine,
 			credentialsManager,
 			taskHandler,
+			NewPayloadLog(),
+			nil,
 		)
 		acsSession.Start()
 		// StartSession should never return unless the context is canceled
@@ -985,7 +1003,7 @@ func TestStartSessionHandlesRefreshCredentialsMessages(t *testing.T) {
 // TestACSSessionResourcesCorrectlySetsSendCredentials tests if acsSessionResources
 // struct correctly sets 'sendCredentials'
 func TestACSSessionResourcesCorrectlySetsSendCredentials(t *testing.T) {
-	acsResources := newSessionResources(nil)
+	acsResources := newSessionResources(nil, nil)
 	// Validate that 'sendCredentials' is set to true on create
 	sendCredentials := acsResources.getSendCredentialsURLParameter()
 	if sendCredentials != "true" {
@@ -1018,7 +1036,7 @@ func TestHandlerReconnectsCorrectlySetsSendCredentialsURLParameter(t *testing.T)
 	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
 	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
 	mockWsClient.EXPECT().Serve().Return(io.EOF).AnyTimes()
-	resources := newSessionResources(credentials.AnonymousCredentials)
+	resources := newSessionResources(credentials.AnonymousCredentials, nil)
 	gomock.InOrder(
 		// When the websocket client connects to ACS for the first
 		// time, 'sendCredentials' should be set to true
@@ -1040,13 +1058,14 @@ func TestHandlerReconnectsCorrectlySetsSendCredentialsURLParameter(t *testing.T)
 		ecsClient:            ecsClient,
 		stateManager:         statemanager,
 		taskHandler:          taskHandler,
+		payloadLog:           NewPayloadLog(),
 		ctx:                  ctx,
 		resources:            resources,
 		backoff:              utils.NewSimpleBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
 		_heartbeatTimeout:    20 * time.Millisecond,
 		_heartbeatJitter:     10 * time.Millisecond,
 	}
-	timer := newDisconnectionTimer(mockWsClient, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
+	timer := newDisconnectionTimer(mockWsClient, nil, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
 	defer timer.Stop()
 	go func() {
 		for i := 0; i < 10; i++ {
@@ -1061,6 +1080,179 @@ func TestHandlerReconnectsCorrectlySetsSendCredentialsURLParameter(t *testing.T)
 	}
 }
 
+// TestSessionWithFakeACS tests a session against the fake ACS, from the
+// signed connection to the acks of payloads and credentials and the reconnection
+// after ACS closes the connection
+func TestSessionWithFakeACS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	// The poll endpoint is not discovered when it is overridden
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+
+	acs := fake.NewACSServer()
+	defer acs.Close()
+	creds := credentials.NewStaticCredentials("akid", "skid", "")
+	acs.VerifySignatures(creds, "us-west-2")
+	cfg := &config.Config{
+		Cluster:             "someCluster",
+		AWSRegion:           "us-west-2",
+		AcceptInsecureCert:  true,
+		ACSEndpointOverride: acs.URL(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ended := make(chan struct{})
+	go func() {
+		acsSession := NewSession(ctx, cfg, nil, "myArn", creds, ecsClient,
+			statemanager.NewNoopStateManager(), taskEngine, credentialsManager, eventhandler.NewTaskHandler(), NewPayloadLog(), nil)
+		acsSession.Start()
+		close(ended)
+	}()
+
+	request, err := acs.WaitForConnection(fakeACSTimeout)
+	require.NoError(t, err, "Session did not connect to the fake ACS")
+	assert.Equal(t, "someCluster", request.URL.Query().Get("clusterArn"))
+	assert.Equal(t, "myArn", request.URL.Query().Get("containerInstanceArn"))
+	assert.Equal(t, "true", request.URL.Query().Get("sendCredentials"))
+
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		assert.Equal(t, "t1", task.Arn)
+	}).Return(nil)
+	require.NoError(t, acs.SendPayload(&ecsacs.PayloadMessage{
+		MessageId:            aws.String("mid1"),
+		ClusterArn:           aws.String("someCluster"),
+		ContainerInstanceArn: aws.String("myArn"),
+		Tasks: []*ecsacs.Task{{
+			Arn:           aws.String("t1"),
+			Family:        aws.String("f"),
+			Version:       aws.String("1"),
+			DesiredStatus: aws.String("RUNNING"),
+		}},
+	}))
+	ack, err := acs.WaitForAck(fakeACSTimeout)
+	require.NoError(t, err, "Payload was not acked")
+	assert.Equal(t, "mid1", aws.StringValue(ack.MessageId))
+
+	gomock.InOrder(
+		taskEngine.EXPECT().GetTaskByArn("t1").Return(&api.Task{}, true),
+		credentialsManager.EXPECT().SetTaskCredentials(gomock.Any()).Return(nil),
+	)
+	require.NoError(t, acs.SendRefreshCredentials(&ecsacs.IAMRoleCredentialsMessage{
+		MessageId: aws.String("mid2"),
+		TaskArn:   aws.String("t1"),
+		RoleCredentials: &ecsacs.IAMRoleCredentials{
+			CredentialsId:   aws.String("credsId"),
+			AccessKeyId:     aws.String("newakid"),
+			SecretAccessKey: aws.String("newskid"),
+			SessionToken:    aws.String("newstkn"),
+			Expiration:      aws.String("later"),
+			RoleArn:         aws.String("r1"),
+		},
+	}))
+	credentialsAck, err := acs.WaitForCredentialsAck(fakeACSTimeout)
+	require.NoError(t, err, "Credentials were not acked")
+	assert.Equal(t, "mid2", aws.StringValue(credentialsAck.MessageId))
+	assert.Equal(t, "credsId", aws.StringValue(credentialsAck.CredentialsId))
+
+	// The session reconnects right away when ACS closes the connection
+	require.NoError(t, acs.CloseConnection(websocket.CloseNormalClosure, ""))
+	request, err = acs.WaitForConnection(fakeACSTimeout)
+	require.NoError(t, err, "Session did not reconnect to the fake ACS")
+	assert.Equal(t, "false", request.URL.Query().Get("sendCredentials"))
+	assert.Empty(t, acs.DecodeErrors())
+
+	cancel()
+	<-ended
+}
+
+// TestSessionWithFakeACSInactiveInstance tests that the session notifies the
+// deregister instance event stream when ACS rejects the connection with an
+// InactiveInstanceException
+func TestSessionWithFakeACSInactiveInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+
+	acs := fake.NewACSServer()
+	defer acs.Close()
+	require.NoError(t, acs.RejectInactiveInstance("instance is deregistered"))
+	cfg := &config.Config{
+		Cluster:             "someCluster",
+		AcceptInsecureCert:  true,
+		ACSEndpointOverride: acs.URL(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	deregistered := make(chan struct{})
+	deregisterInstanceEventStream := eventstream.NewEventStream("DeregisterContainerInstance", ctx)
+	err := deregisterInstanceEventStream.Subscribe("DeregisterContainerInstance", func(...interface{}) error {
+		close(deregistered)
+		cancel()
+		return nil
+	})
+	require.NoError(t, err)
+	deregisterInstanceEventStream.StartListening()
+
+	go NewSession(ctx, cfg, deregisterInstanceEventStream, "myArn", credentials.AnonymousCredentials, ecsClient,
+		statemanager.NewNoopStateManager(), taskEngine, credentialsManager, eventhandler.NewTaskHandler(), NewPayloadLog(), nil).Start()
+
+	select {
+	case <-deregistered:
+	case <-time.After(fakeACSTimeout):
+		t.Fatal("Timed out waiting for the deregister instance event")
+	}
+}
+
+func TestSessionDrainClosesConnectionWithoutReconnecting(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+
+	acs := fake.NewACSServer()
+	defer acs.Close()
+	cfg := &config.Config{
+		Cluster:             "someCluster",
+		AcceptInsecureCert:  true,
+		ACSEndpointOverride: acs.URL(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	acsSession := NewSession(ctx, cfg, nil, "myArn", credentials.AnonymousCredentials, ecsClient,
+		statemanager.NewNoopStateManager(), taskEngine, credentialsManager, eventhandler.NewTaskHandler(), NewPayloadLog(), nil)
+	ended := make(chan error, 1)
+	go func() {
+		ended <- acsSession.Start()
+	}()
+	_, err := acs.WaitForConnection(fakeACSTimeout)
+	require.NoError(t, err, "Session did not connect to the fake ACS")
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), fakeACSTimeout)
+	defer drainCancel()
+	assert.Empty(t, acsSession.Drain(drainCtx))
+	require.NoError(t, acs.WaitForDisconnection(fakeACSTimeout))
+	_, err = acs.WaitForConnection(100 * time.Millisecond)
+	assert.Equal(t, fake.ErrTimeout, err, "Expected the drained session not to reconnect")
+
+	cancel()
+	select {
+	case err := <-ended:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(fakeACSTimeout):
+		t.Fatal("Timed out waiting for the session to end")
+	}
+}
+
 // TODO: replace with gomock
 func startMockAcsServer(t *testing.T, closeWS <-chan bool) (*httptest.Server, chan<- string, <-chan string, <-chan error, error) {
 	serverChan := make(chan string, 1)
@@ -13,10 +13,19 @@
 
 package handler
 
+// UnrecognizedTaskErrorName is the reason code of tasks that could not be
+// loaded from a payload
+const UnrecognizedTaskErrorName = "UnrecognizedTask"
+
 type UnrecognizedTaskError struct {
 	err error
 }
 
 func (err UnrecognizedTaskError) Error() string {
-	return "UnrecogniedTaskError: Error loading task - " + err.err.Error()
+	return "UnrecognizedTaskError: Error loading task - " + err.err.Error()
+}
+
+// ErrorName is the name of the error
+func (err UnrecognizedTaskError) ErrorName() string {
+	return UnrecognizedTaskErrorName
 }
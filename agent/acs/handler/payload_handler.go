@@ -14,11 +14,16 @@ package handler
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dependencygraph"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
@@ -45,6 +50,20 @@ type payloadRequestHandler struct {
 	acsClient            wsclient.ClientServer
 	refreshHandler       refreshCredentialsHandler
 	credentialsManager   credentials.Manager
+	// payloadLog is used to skip the payloads and tasks that were already
+	// applied
+	payloadLog *PayloadLog
+	// availableLoggingDrivers are the log drivers tasks may use
+	availableLoggingDrivers []dockerclient.LoggingDriver
+	// drainLock guards draining and the accepting of payloads, so that no
+	// payload is counted once drain has started waiting
+	drainLock sync.Mutex
+	// draining is set once the handler stops accepting payloads
+	draining bool
+	// unhandledMessages is the number of payloads accepted but not handled yet
+	unhandledMessages int32
+	// unsentAcks is the number of acks queued but not sent yet
+	unsentAcks int32
 }
 
 // newPayloadRequestHandler returns a new payloadRequestHandler object
@@ -58,23 +77,27 @@ func newPayloadRequestHandler(
 	saver statemanager.Saver,
 	refreshHandler refreshCredentialsHandler,
 	credentialsManager credentials.Manager,
-	taskHandler *eventhandler.TaskHandler) payloadRequestHandler {
+	taskHandler *eventhandler.TaskHandler,
+	payloadLog *PayloadLog,
+	availableLoggingDrivers []dockerclient.LoggingDriver) payloadRequestHandler {
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return payloadRequestHandler{
-		messageBuffer:        make(chan *ecsacs.PayloadMessage, payloadMessageBufferSize),
-		ackRequest:           make(chan string, payloadMessageBufferSize),
-		taskEngine:           taskEngine,
-		ecsClient:            ecsClient,
-		saver:                saver,
-		taskHandler:          taskHandler,
-		ctx:                  derivedContext,
-		cancel:               cancel,
-		cluster:              cluster,
-		containerInstanceArn: containerInstanceArn,
-		acsClient:            acsClient,
-		refreshHandler:       refreshHandler,
-		credentialsManager:   credentialsManager,
+		messageBuffer:           make(chan *ecsacs.PayloadMessage, payloadMessageBufferSize),
+		ackRequest:              make(chan string, payloadMessageBufferSize),
+		taskEngine:              taskEngine,
+		ecsClient:               ecsClient,
+		saver:                   saver,
+		taskHandler:             taskHandler,
+		ctx:                     derivedContext,
+		cancel:                  cancel,
+		cluster:                 cluster,
+		containerInstanceArn:    containerInstanceArn,
+		acsClient:               acsClient,
+		refreshHandler:          refreshHandler,
+		credentialsManager:      credentialsManager,
+		payloadLog:              payloadLog,
+		availableLoggingDrivers: availableLoggingDrivers,
 	}
 }
 
@@ -82,10 +105,29 @@ func newPayloadRequestHandler(
 func (payloadHandler *payloadRequestHandler) handlerFunc() func(payload *ecsacs.PayloadMessage) {
 	// return a function that just enqueues PayloadMessages into the message buffer
 	return func(payload *ecsacs.PayloadMessage) {
+		if !payloadHandler.accept() {
+			// Without an ack, ACS sends the payload again once the agent
+			// has restarted
+			seelog.Infof("Not handling payload message, the agent is shutting down, message id: %s",
+				aws.StringValue(payload.MessageId))
+			return
+		}
 		payloadHandler.messageBuffer <- payload
 	}
 }
 
+// accept counts a payload as unhandled, unless the handler is being drained
+func (payloadHandler *payloadRequestHandler) accept() bool {
+	payloadHandler.drainLock.Lock()
+	defer payloadHandler.drainLock.Unlock()
+
+	if payloadHandler.draining {
+		return false
+	}
+	atomic.AddInt32(&payloadHandler.unhandledMessages, 1)
+	return true
+}
+
 // start invokes go routines to:
 // 1. handle messages in the payload message buffer
 // 2. handle ack requests to be sent to ACS
@@ -100,12 +142,56 @@ func (payloadHandler *payloadRequestHandler) stop() {
 	payloadHandler.cancel()
 }
 
+// drain stops accepting new payloads and waits until the accepted ones are
+// handled and their acks sent, or the context is done. It returns a
+// description of the work that was left.
+func (payloadHandler *payloadRequestHandler) drain(ctx context.Context) []string {
+	payloadHandler.drainLock.Lock()
+	payloadHandler.draining = true
+	payloadHandler.drainLock.Unlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		unhandledMessages := atomic.LoadInt32(&payloadHandler.unhandledMessages)
+		unsentAcks := atomic.LoadInt32(&payloadHandler.unsentAcks)
+		if unhandledMessages == 0 && unsentAcks == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			var undelivered []string
+			if unhandledMessages > 0 {
+				undelivered = append(undelivered, fmt.Sprintf("%d unhandled ACS payload messages", unhandledMessages))
+			}
+			if unsentAcks > 0 {
+				undelivered = append(undelivered, fmt.Sprintf("%d acks of ACS payload messages", unsentAcks))
+			}
+			return undelivered
+		}
+	}
+}
+
+// queueAck sends the ack of a message asynchronously, after sending the acks
+// of the credentials in the message
+func (payloadHandler *payloadRequestHandler) queueAck(messageID string, credentialsAcks []*ecsacs.IAMRoleCredentialsAckRequest) {
+	atomic.AddInt32(&payloadHandler.unsentAcks, 1)
+	go func() {
+		for _, credentialsAck := range credentialsAcks {
+			payloadHandler.refreshHandler.ackMessage(credentialsAck)
+		}
+		payloadHandler.ackRequest <- messageID
+	}()
+}
+
 // sendAcks sends ack requests to ACS
 func (payloadHandler *payloadRequestHandler) sendAcks() {
 	for {
 		select {
 		case mid := <-payloadHandler.ackRequest:
 			payloadHandler.ackMessageId(mid)
+			atomic.AddInt32(&payloadHandler.unsentAcks, -1)
 		case <-payloadHandler.ctx.Done():
 			return
 		}
@@ -131,6 +217,7 @@ func (payloadHandler *payloadRequestHandler) handleMessages() {
 		select {
 		case payload := <-payloadHandler.messageBuffer:
 			payloadHandler.handleSingleMessage(payload)
+			atomic.AddInt32(&payloadHandler.unhandledMessages, -1)
 		case <-payloadHandler.ctx.Done():
 			return
 		}
@@ -146,7 +233,17 @@ func (payloadHandler *payloadRequestHandler) handleSingleMessage(payload *ecsacs
 		return fmt.Errorf("Received a payload with no message id")
 	}
 	seelog.Debugf("Received payload message, message id: %s", aws.StringValue(payload.MessageId))
+	if payloadHandler.payloadLog.containsMessage(aws.StringValue(payload.MessageId)) {
+		// The payload was applied before, ACS probably didn't get the ack
+		seelog.Infof("Received duplicate payload message, acking it without applying it again, message id: %s",
+			aws.StringValue(payload.MessageId))
+		payloadHandler.queueAck(*payload.MessageId, nil)
+		return nil
+	}
 	credentialsAcks, allTasksHandled := payloadHandler.addPayloadTasks(payload)
+	if allTasksHandled {
+		payloadHandler.payloadLog.recordMessage(aws.StringValue(payload.MessageId))
+	}
 	// save the state of tasks we know about after passing them to the task engine
 	err := payloadHandler.saver.Save()
 	if err != nil {
@@ -158,13 +255,8 @@ func (payloadHandler *payloadRequestHandler) handleSingleMessage(payload *ecsacs
 		return fmt.Errorf("All tasks not handled")
 	}
 
-	go func() {
-		// Throw the ack in async; it doesn't really matter all that much and this is blocking handling more tasks.
-		for _, credentialsAck := range credentialsAcks {
-			payloadHandler.refreshHandler.ackMessage(credentialsAck)
-		}
-		payloadHandler.ackRequest <- *payload.MessageId
-	}()
+	// Throw the ack in async; it doesn't really matter all that much and this is blocking handling more tasks.
+	payloadHandler.queueAck(*payload.MessageId, credentialsAcks)
 
 	return nil
 }
@@ -185,10 +277,26 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 		}
 		apiTask, err := api.TaskFromACS(task, payload)
 		if err != nil {
-			payloadHandler.handleUnrecognizedTask(task, err, payload)
+			payloadHandler.handleUnrecognizedTask(task, UnrecognizedTaskError{err}, payload)
 			allTasksOK = false
 			continue
 		}
+		if validationErr := payloadHandler.validateNewTask(apiTask); validationErr != nil {
+			// The task is stopped instead of being added; that is all there
+			// is to do for it, so it doesn't prevent the payload from being
+			// acked
+			seelog.Warnf("Rejecting invalid task in payload, messageId: %s, task: %s, reason: %v",
+				aws.StringValue(payload.MessageId), apiTask.Arn, validationErr)
+			payloadHandler.handleUnrecognizedTask(task, validationErr, payload)
+			continue
+		}
+		if payloadHandler.payloadLog.isStale(apiTask, aws.Int64Value(payload.SeqNum)) {
+			// Applying the task would move it backward; there is nothing
+			// to do for it, so it doesn't prevent the payload from being acked
+			seelog.Warnf("Skipping stale task in payload, messageId: %s, seqnum: %d, task: %s, desired status: %s",
+				aws.StringValue(payload.MessageId), aws.Int64Value(payload.SeqNum), apiTask.Arn, apiTask.GetDesiredStatus().String())
+			continue
+		}
 		if task.RoleCredentials != nil {
 			// The payload from ACS for the task has credentials for the
 			// task. Add those to the credentials manager and set the
@@ -199,12 +307,28 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 			}
 			err = payloadHandler.credentialsManager.SetTaskCredentials(taskCredentials)
 			if err != nil {
-				payloadHandler.handleUnrecognizedTask(task, err, payload)
+				payloadHandler.handleUnrecognizedTask(task, UnrecognizedTaskError{err}, payload)
 				allTasksOK = false
 				continue
 			}
 			apiTask.SetCredentialsID(taskCredentials.IAMRoleCredentials.CredentialsID)
 		}
+		if task.ExecutionRoleCredentials != nil {
+			// The execution role credentials are only used by the agent on
+			// behalf of the task and are kept apart from the task role
+			// credentials
+			executionCredentials := credentials.TaskIAMRoleCredentials{
+				ARN:                aws.StringValue(task.Arn),
+				IAMRoleCredentials: credentials.IAMRoleCredentialsFromACS(task.ExecutionRoleCredentials),
+			}
+			err = payloadHandler.credentialsManager.SetTaskExecutionCredentials(executionCredentials)
+			if err != nil {
+				payloadHandler.handleUnrecognizedTask(task, UnrecognizedTaskError{err}, payload)
+				allTasksOK = false
+				continue
+			}
+			apiTask.SetExecutionCredentialsID(executionCredentials.IAMRoleCredentials.CredentialsID)
+		}
 		validTasks = append(validTasks, apiTask)
 	}
 	// Add 'stop' transitions first to allow seqnum ordering to work out
@@ -237,32 +361,47 @@ func (payloadHandler *payloadRequestHandler) addTasks(payload *ecsacs.PayloadMes
 			seelog.Warnf("Could not add task; taskengine probably disabled, err: %v", err)
 			// Don't ack
 			allTasksOK = false
+		} else {
+			payloadHandler.payloadLog.recordTask(task, aws.Int64Value(payload.SeqNum))
 		}
 
 		// Generate an ack request for the credentials in the task, if the
 		// task is associated with an IAM Role
 		taskCredentialsId := task.GetCredentialsID()
-		if taskCredentialsId == "" {
-			// CredentialsId not set for task, no need to ack.
-			continue
+		if taskCredentialsId != "" {
+			creds, ok := payloadHandler.credentialsManager.GetTaskCredentials(taskCredentialsId)
+			if !ok {
+				seelog.Errorf("Credentials could not be retrieved for task: %s", task.Arn)
+				allTasksOK = false
+			} else {
+				credentialsAcks = append(credentialsAcks, credentialsAck(payload, creds))
+			}
 		}
 
-		creds, ok := payloadHandler.credentialsManager.GetTaskCredentials(taskCredentialsId)
-		if !ok {
-			seelog.Errorf("Credentials could not be retrieved for task: %s", task.Arn)
-			allTasksOK = false
-		} else {
-			credentialsAcks = append(credentialsAcks, &ecsacs.IAMRoleCredentialsAckRequest{
-				MessageId:     payload.MessageId,
-				Expiration:    aws.String(creds.IAMRoleCredentials.Expiration),
-				CredentialsId: aws.String(creds.IAMRoleCredentials.CredentialsID),
-			})
+		// Likewise for the credentials of the task's execution role
+		executionCredentialsId := task.GetExecutionCredentialsID()
+		if executionCredentialsId != "" {
+			creds, ok := payloadHandler.credentialsManager.GetTaskExecutionCredentials(executionCredentialsId)
+			if !ok {
+				seelog.Errorf("Execution role credentials could not be retrieved for task: %s", task.Arn)
+				allTasksOK = false
+			} else {
+				credentialsAcks = append(credentialsAcks, credentialsAck(payload, creds))
+			}
 		}
-
 	}
 	return credentialsAcks, allTasksOK
 }
 
+// credentialsAck returns the ack request for credentials sent in the payload
+func credentialsAck(payload *ecsacs.PayloadMessage, creds credentials.TaskIAMRoleCredentials) *ecsacs.IAMRoleCredentialsAckRequest {
+	return &ecsacs.IAMRoleCredentialsAckRequest{
+		MessageId:     payload.MessageId,
+		Expiration:    aws.String(creds.IAMRoleCredentials.Expiration),
+		CredentialsId: aws.String(creds.IAMRoleCredentials.CredentialsID),
+	}
+}
+
 // skipAddTaskComparatorFunc defines the function pointer that accepts task status
 // and returns the boolean comparison result
 type skipAddTaskComparatorFunc func(api.TaskStatus) bool
@@ -277,9 +416,44 @@ func isTaskStatusNotStopped(status api.TaskStatus) bool {
 	return status != api.TaskStopped
 }
 
+// validateNewTask checks that a task that is new to the engine can be started
+// on this instance. Tasks that are desired stopped, or that the engine already
+// manages, are not validated; they go through the engine, which stops their
+// containers.
+func (payloadHandler *payloadRequestHandler) validateNewTask(task *api.Task) api.NamedError {
+	if task.GetDesiredStatus() == api.TaskStopped {
+		return nil
+	}
+	err := payloadHandler.validateTask(task)
+	if err == nil {
+		return nil
+	}
+	if _, ok := payloadHandler.taskEngine.GetTaskByArn(task.Arn); ok {
+		seelog.Warnf("Task managed by the engine fails validation, applying it anyway, task: %s, reason: %v",
+			task.Arn, err)
+		return nil
+	}
+	return err
+}
+
+// validateTask checks that the task can be started on this instance
+func (payloadHandler *payloadRequestHandler) validateTask(task *api.Task) api.NamedError {
+	if err := task.Validate(payloadHandler.availableLoggingDrivers); err != nil {
+		return err
+	}
+	if !dependencygraph.ValidDependencies(task) {
+		return &api.DefaultNamedError{
+			Name: api.CircularDependencyErrorName,
+			Err:  "the links and volumes of the containers form a cycle",
+		}
+	}
+	return nil
+}
+
 // handleUnrecognizedTask handles unrecognized tasks by sending 'stopped' with
-// a suitable reason to the backend
-func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs.Task, err error, payload *ecsacs.PayloadMessage) {
+// a suitable reason to the backend. The name of the error is the reason code
+// of the state change.
+func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs.Task, err api.NamedError, payload *ecsacs.PayloadMessage) {
 	if task.Arn == nil {
 		seelog.Criticalf("Recieved task with no arn, messageId: %s, task: %v", *payload.MessageId, task)
 		return
@@ -287,9 +461,10 @@ func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs
 
 	// Only need to stop the task; it brings down the containers too.
 	taskEvent := api.TaskStateChange{
-		TaskArn: *task.Arn,
-		Status:  api.TaskStopped,
-		Reason:  UnrecognizedTaskError{err}.Error(),
+		TaskArn:    *task.Arn,
+		Status:     api.TaskStopped,
+		Reason:     err.Error(),
+		ReasonCode: err.ErrorName(),
 	}
 
 	payloadHandler.taskHandler.AddStateChangeEvent(taskEvent, payloadHandler.ecsClient)
@@ -300,6 +475,7 @@ func (payloadHandler *payloadRequestHandler) clearAcks() {
 	for {
 		select {
 		case <-payloadHandler.ackRequest:
+			atomic.AddInt32(&payloadHandler.unsentAcks, -1)
 		default:
 			return
 		}
@@ -15,7 +15,9 @@ package handler
 import (
 	"fmt"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/agent/api"
@@ -60,7 +62,9 @@ func TestHandlePayloadMessageWithNoMessageId(t *testing.T) {
 		stateManager,
 		refreshCredentialsHandler{},
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	// test adding a payload message without the MessageId field
 	payloadMessage := &ecsacs.PayloadMessage{
@@ -110,7 +114,9 @@ func TestHandlePayloadMessageAddTaskError(t *testing.T) {
 		stateManager,
 		refreshCredentialsHandler{},
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	// Test AddTask error with RUNNING task
 	payloadMessage := &ecsacs.PayloadMessage{
@@ -174,7 +180,9 @@ func TestHandlePayloadMessageStateSaveError(t *testing.T) {
 		stateManager,
 		refreshCredentialsHandler{},
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	// Check if handleSingleMessage returns an error when state manager returns error on Save()
 	err := buffer.handleSingleMessage(&ecsacs.PayloadMessage{
@@ -231,7 +239,9 @@ func TestHandlePayloadMessageAckedWhenTaskAdded(t *testing.T) {
 		stateManager,
 		refreshCredentialsHandler{},
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	go buffer.start()
 
@@ -316,7 +326,9 @@ func TestHandlePayloadMessageCredentialsAckedWhenTaskAdded(t *testing.T) {
 		stateManager,
 		refreshCredsHandler,
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	go payloadHandler.start()
 
@@ -383,6 +395,99 @@ func TestHandlePayloadMessageCredentialsAckedWhenTaskAdded(t *testing.T) {
 	}
 }
 
+// TestHandlePayloadMessageExecutionCredentialsAckedWhenTaskAdded tests that the
+// execution role credentials of a task are added apart from the task role
+// credentials and acked
+func TestHandlePayloadMessageExecutionCredentialsAckedWhenTaskAdded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	stateManager := statemanager.NewNoopStateManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	credentialsManager := credentials.NewManager()
+	taskHandler := eventhandler.NewTaskHandler()
+
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	var addedTask *api.Task
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		addedTask = task
+	}).Times(1)
+
+	var credentialsAcksRequested []*ecsacs.IAMRoleCredentialsAckRequest
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	gomock.InOrder(
+		mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(ackRequest *ecsacs.IAMRoleCredentialsAckRequest) {
+			credentialsAcksRequested = append(credentialsAcksRequested, ackRequest)
+		}).Times(2),
+		mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(ackRequest *ecsacs.AckRequest) {
+			cancel()
+		}),
+	)
+
+	refreshCredsHandler := newRefreshCredentialsHandler(ctx, clusterName, containerInstanceArn, mockWsClient, credentialsManager, taskEngine)
+	defer refreshCredsHandler.clearAcks()
+	refreshCredsHandler.start()
+
+	payloadHandler := newPayloadRequestHandler(
+		ctx,
+		taskEngine,
+		ecsClient,
+		clusterName,
+		containerInstanceArn,
+		mockWsClient,
+		stateManager,
+		refreshCredsHandler,
+		credentialsManager,
+		taskHandler,
+		NewPayloadLog(),
+		nil)
+
+	go payloadHandler.start()
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn: aws.String("t1"),
+				RoleCredentials: &ecsacs.IAMRoleCredentials{
+					AccessKeyId:   aws.String("akid"),
+					Expiration:    aws.String("expiration"),
+					CredentialsId: aws.String("taskcredsid"),
+				},
+				ExecutionRoleCredentials: &ecsacs.IAMRoleCredentials{
+					AccessKeyId:   aws.String("execakid"),
+					Expiration:    aws.String("expiration"),
+					CredentialsId: aws.String("execcredsid"),
+				},
+			},
+		},
+		MessageId:            aws.String(payloadMessageId),
+		ClusterArn:           aws.String(cluster),
+		ContainerInstanceArn: aws.String(containerInstance),
+	}
+	err := payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err)
+
+	// Wait till we get an ack from the ackBuffer
+	select {
+	case <-ctx.Done():
+	}
+
+	assert.Equal(t, "taskcredsid", addedTask.GetCredentialsID())
+	assert.Equal(t, "execcredsid", addedTask.GetExecutionCredentialsID())
+
+	executionCredentials, ok := credentialsManager.GetTaskExecutionCredentials("execcredsid")
+	assert.True(t, ok)
+	assert.Equal(t, "execakid", executionCredentials.IAMRoleCredentials.AccessKeyID)
+	_, ok = credentialsManager.GetTaskCredentials("execcredsid")
+	assert.False(t, ok, "execution role credentials must not be served as task role credentials")
+
+	var ackedCredentialsIds []string
+	for _, ack := range credentialsAcksRequested {
+		ackedCredentialsIds = append(ackedCredentialsIds, aws.StringValue(ack.CredentialsId))
+	}
+	assert.Equal(t, []string{"taskcredsid", "execcredsid"}, ackedCredentialsIds)
+}
+
 // TestAddPayloadTaskAddsNonStoppedTasksAfterStoppedTasks tests if tasks with desired status
 // 'RUNNING' are added after tasks with desired status 'STOPPED'
 func TestAddPayloadTaskAddsNonStoppedTasksAfterStoppedTasks(t *testing.T) {
@@ -426,7 +531,9 @@ func TestAddPayloadTaskAddsNonStoppedTasksAfterStoppedTasks(t *testing.T) {
 		stateManager,
 		refreshCredentialsHandler{},
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	_, ok := buffer.addPayloadTasks(payloadMessage)
 	assert.True(t, ok)
@@ -476,7 +583,9 @@ func TestPayloadBufferHandler(t *testing.T) {
 		stateManager,
 		refreshCredentialsHandler{},
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	go buffer.start()
 	// Send a payload message to the payloadBufferChannel
@@ -567,7 +676,9 @@ func TestPayloadBufferHandlerWithCredentials(t *testing.T) {
 		stateManager,
 		refreshCredsHandler,
 		credentialsManager,
-		taskHandler)
+		taskHandler,
+		NewPayloadLog(),
+		nil)
 
 	go payloadHandler.start()
 
@@ -687,3 +798,265 @@ func validateTaskAndCredentials(taskCredentialsAck, expectedCredentialsAckForTas
 	}
 	return nil
 }
+
+// TestHandleDuplicatePayloadMessage tests that a payload that was already
+// applied is acked again without adding its tasks to the engine again
+func TestHandleDuplicatePayloadMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	stateManager := statemanager.NewNoopStateManager()
+	credentialsManager := credentials.NewManager()
+	taskHandler := eventhandler.NewTaskHandler()
+
+	taskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+
+	buffer := newPayloadRequestHandler(
+		context.Background(),
+		taskEngine,
+		ecsClient,
+		clusterName,
+		containerInstanceArn,
+		nil,
+		stateManager,
+		refreshCredentialsHandler{},
+		credentialsManager,
+		taskHandler,
+		NewPayloadLog(),
+		nil)
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("t1"),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+		SeqNum:    aws.Int64(1),
+	}
+	for i := 0; i < 2; i++ {
+		err := buffer.handleSingleMessage(payloadMessage)
+		assert.NoError(t, err)
+		select {
+		case messageID := <-buffer.ackRequest:
+			assert.Equal(t, payloadMessageId, messageID)
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for the ack request")
+		}
+	}
+}
+
+// TestStalePayloadDoesNotRestartTask tests that a task stopped by a payload
+// is not restarted by a replayed payload with an older sequence number, nor by
+// a payload with a newer one
+func TestStalePayloadDoesNotRestartTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	stateManager := statemanager.NewNoopStateManager()
+	credentialsManager := credentials.NewManager()
+	taskHandler := eventhandler.NewTaskHandler()
+
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		assert.Equal(t, api.TaskStopped, task.GetDesiredStatus())
+	}).Times(1)
+
+	buffer := newPayloadRequestHandler(
+		context.Background(),
+		taskEngine,
+		ecsClient,
+		clusterName,
+		containerInstanceArn,
+		nil,
+		stateManager,
+		refreshCredentialsHandler{},
+		credentialsManager,
+		taskHandler,
+		NewPayloadLog(),
+		nil)
+
+	payload := func(messageID string, seqNum int64, desiredStatus string) *ecsacs.PayloadMessage {
+		return &ecsacs.PayloadMessage{
+			Tasks: []*ecsacs.Task{
+				{
+					Arn:           aws.String("t1"),
+					DesiredStatus: aws.String(desiredStatus),
+				},
+			},
+			MessageId: aws.String(messageID),
+			SeqNum:    aws.Int64(seqNum),
+		}
+	}
+	_, ok := buffer.addPayloadTasks(payload("mid1", 2, "STOPPED"))
+	assert.True(t, ok)
+	// Stale tasks are skipped, the payloads can still be acked
+	_, ok = buffer.addPayloadTasks(payload("mid0", 1, "RUNNING"))
+	assert.True(t, ok)
+	_, ok = buffer.addPayloadTasks(payload("mid2", 3, "RUNNING"))
+	assert.True(t, ok)
+}
+
+// TestHandlePayloadMessageRejectsInvalidTask tests that a task failing
+// validation isn't added to the engine and is stopped with the reason code of
+// the failure
+func TestHandlePayloadMessageRejectsInvalidTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	taskHandler := eventhandler.NewTaskHandler()
+
+	stateChanges := make(chan api.TaskStateChange, 1)
+	ecsClient.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+		stateChanges <- change
+	}).Return(nil)
+
+	buffer := newPayloadRequestHandler(
+		context.Background(),
+		taskEngine,
+		ecsClient,
+		clusterName,
+		containerInstanceArn,
+		nil,
+		statemanager.NewNoopStateManager(),
+		refreshCredentialsHandler{},
+		credentials.NewManager(),
+		taskHandler,
+		NewPayloadLog(),
+		nil)
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("t1"),
+				DesiredStatus: aws.String("RUNNING"),
+				Containers: []*ecsacs.Container{
+					{Name: aws.String("web"), Memory: aws.Int64(128)},
+					{Name: aws.String("web"), Memory: aws.Int64(128)},
+				},
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+		SeqNum:    aws.Int64(1),
+	}
+	taskEngine.EXPECT().GetTaskByArn("t1").Return(nil, false)
+	err := buffer.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err, "Expected the payload with an invalid task to be acked")
+	assert.Equal(t, payloadMessageId, <-buffer.ackRequest)
+
+	select {
+	case change := <-stateChanges:
+		assert.Equal(t, "t1", change.TaskArn)
+		assert.Equal(t, api.TaskStopped, change.Status)
+		assert.Equal(t, api.DuplicateContainerNameErrorName, change.ReasonCode)
+		assert.Contains(t, change.Reason, api.DuplicateContainerNameErrorName+": ")
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the stopped state change of the invalid task")
+	}
+}
+
+// TestPayloadHandlerDrain tests that draining waits for the accepted payloads
+// to be acked and rejects the payloads received afterwards
+func TestPayloadHandlerDrain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	taskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+	mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(ackRequest *ecsacs.AckRequest) {
+		assert.Equal(t, payloadMessageId, aws.StringValue(ackRequest.MessageId))
+	}).Times(1)
+
+	handler := newPayloadRequestHandler(
+		ctx,
+		taskEngine,
+		ecsClient,
+		clusterName,
+		containerInstanceArn,
+		mockWsClient,
+		statemanager.NewNoopStateManager(),
+		refreshCredentialsHandler{},
+		credentials.NewManager(),
+		eventhandler.NewTaskHandler(),
+		NewPayloadLog(),
+		nil)
+	handler.start()
+	defer handler.stop()
+
+	handlePayload := handler.handlerFunc()
+	handlePayload(&ecsacs.PayloadMessage{
+		Tasks:     []*ecsacs.Task{{Arn: aws.String("t1")}},
+		MessageId: aws.String(payloadMessageId),
+	})
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	assert.Empty(t, handler.drain(drainCtx))
+
+	// Payloads received while draining are neither handled nor acked
+	handlePayload(&ecsacs.PayloadMessage{
+		Tasks:     []*ecsacs.Task{{Arn: aws.String("t2")}},
+		MessageId: aws.String("anotherMessageId"),
+	})
+	assert.Equal(t, int32(0), atomic.LoadInt32(&handler.unhandledMessages))
+	assert.Empty(t, handler.drain(drainCtx))
+}
+
+// TestAddPayloadTasksAppliesInvalidKnownOrStoppedTasks tests that tasks failing
+// validation are still added to the engine when they are desired stopped or
+// already managed by the engine, so that their containers are stopped
+func TestAddPayloadTasksAppliesInvalidKnownOrStoppedTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+
+	buffer := newPayloadRequestHandler(
+		context.Background(),
+		taskEngine,
+		mock_api.NewMockECSClient(ctrl),
+		clusterName,
+		containerInstanceArn,
+		nil,
+		statemanager.NewNoopStateManager(),
+		refreshCredentialsHandler{},
+		credentials.NewManager(),
+		eventhandler.NewTaskHandler(),
+		NewPayloadLog(),
+		nil)
+
+	invalidTask := func(arn, desiredStatus string) *ecsacs.Task {
+		return &ecsacs.Task{
+			Arn:           aws.String(arn),
+			DesiredStatus: aws.String(desiredStatus),
+			Containers: []*ecsacs.Container{
+				{Name: aws.String("web"), Memory: aws.Int64(128)},
+				{Name: aws.String("web"), Memory: aws.Int64(128)},
+			},
+		}
+	}
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			invalidTask("stopped", "STOPPED"),
+			invalidTask("running", "RUNNING"),
+		},
+		MessageId: aws.String(payloadMessageId),
+		SeqNum:    aws.Int64(1),
+	}
+
+	var addedTasks []string
+	taskEngine.EXPECT().GetTaskByArn("running").Return(&api.Task{Arn: "running"}, true)
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		addedTasks = append(addedTasks, task.Arn)
+	}).Times(2)
+
+	_, ok := buffer.addPayloadTasks(payloadMessage)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"stopped", "running"}, addedTasks)
+}
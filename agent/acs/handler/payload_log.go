@@ -0,0 +1,188 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+)
+
+const (
+	// maxPayloadLogMessages is the number of payload message ids remembered
+	maxPayloadLogMessages = 1000
+	// maxPayloadLogTasks is the number of tasks whose sequence number and
+	// desired status are remembered
+	maxPayloadLogTasks = 5000
+)
+
+// payloadLogTask is what the payload log remembers of a task.
+type payloadLogTask struct {
+	Arn           string
+	SeqNum        int64
+	DesiredStatus api.TaskStatus
+}
+
+// savedPayloadLog is the representation of the payload log in the state file.
+// Entries are ordered from the oldest to the newest.
+type savedPayloadLog struct {
+	MessageIDs []string
+	Tasks      []*payloadLogTask
+}
+
+// PayloadLog records the payload messages that were applied, along with the
+// sequence number and desired status of their tasks, so that duplicated or
+// replayed payloads are not applied again, even across reconnects and
+// restarts when the log is saved with the state manager. The log is bounded;
+// the oldest entries are forgotten first.
+type PayloadLog struct {
+	lock       sync.RWMutex
+	messageIDs []string
+	messages   map[string]struct{}
+	taskArns   []string
+	tasks      map[string]*payloadLogTask
+}
+
+// NewPayloadLog returns an empty payload log.
+func NewPayloadLog() *PayloadLog {
+	return &PayloadLog{
+		messages: make(map[string]struct{}),
+		tasks:    make(map[string]*payloadLogTask),
+	}
+}
+
+// containsMessage returns true if the payload message was already applied.
+func (payloadLog *PayloadLog) containsMessage(messageID string) bool {
+	payloadLog.lock.RLock()
+	defer payloadLog.lock.RUnlock()
+
+	_, ok := payloadLog.messages[messageID]
+	return ok
+}
+
+// isStale returns true if applying the task would move it backward, either
+// because a payload with a higher sequence number was applied for it or
+// because it was already stopped. Tasks are never restarted once stopped.
+func (payloadLog *PayloadLog) isStale(task *api.Task, seqNum int64) bool {
+	payloadLog.lock.RLock()
+	defer payloadLog.lock.RUnlock()
+
+	previous, ok := payloadLog.tasks[task.Arn]
+	if !ok {
+		return false
+	}
+	if seqNum < previous.SeqNum {
+		return true
+	}
+	return previous.DesiredStatus == api.TaskStopped && task.GetDesiredStatus() != api.TaskStopped
+}
+
+// recordTask remembers the sequence number and desired status of an applied
+// task.
+func (payloadLog *PayloadLog) recordTask(task *api.Task, seqNum int64) {
+	payloadLog.lock.Lock()
+	defer payloadLog.lock.Unlock()
+
+	desiredStatus := task.GetDesiredStatus()
+	previous, ok := payloadLog.tasks[task.Arn]
+	if !ok {
+		payloadLog.addTask(&payloadLogTask{
+			Arn:           task.Arn,
+			SeqNum:        seqNum,
+			DesiredStatus: desiredStatus,
+		})
+		return
+	}
+	if seqNum > previous.SeqNum {
+		previous.SeqNum = seqNum
+	}
+	if desiredStatus > previous.DesiredStatus {
+		previous.DesiredStatus = desiredStatus
+	}
+}
+
+// recordMessage remembers an applied payload message.
+func (payloadLog *PayloadLog) recordMessage(messageID string) {
+	payloadLog.lock.Lock()
+	defer payloadLog.lock.Unlock()
+
+	payloadLog.addMessage(messageID)
+}
+
+func (payloadLog *PayloadLog) addMessage(messageID string) {
+	if _, ok := payloadLog.messages[messageID]; ok {
+		return
+	}
+	payloadLog.messageIDs = append(payloadLog.messageIDs, messageID)
+	payloadLog.messages[messageID] = struct{}{}
+	for len(payloadLog.messageIDs) > maxPayloadLogMessages {
+		delete(payloadLog.messages, payloadLog.messageIDs[0])
+		payloadLog.messageIDs = payloadLog.messageIDs[1:]
+	}
+}
+
+func (payloadLog *PayloadLog) addTask(task *payloadLogTask) {
+	if _, ok := payloadLog.tasks[task.Arn]; ok {
+		return
+	}
+	payloadLog.taskArns = append(payloadLog.taskArns, task.Arn)
+	payloadLog.tasks[task.Arn] = task
+	for len(payloadLog.taskArns) > maxPayloadLogTasks {
+		delete(payloadLog.tasks, payloadLog.taskArns[0])
+		payloadLog.taskArns = payloadLog.taskArns[1:]
+	}
+}
+
+// MarshalJSON saves the entries of the log, from the oldest to the newest.
+func (payloadLog *PayloadLog) MarshalJSON() ([]byte, error) {
+	payloadLog.lock.RLock()
+	defer payloadLog.lock.RUnlock()
+
+	saved := savedPayloadLog{
+		MessageIDs: payloadLog.messageIDs,
+		Tasks:      make([]*payloadLogTask, 0, len(payloadLog.taskArns)),
+	}
+	for _, arn := range payloadLog.taskArns {
+		saved.Tasks = append(saved.Tasks, payloadLog.tasks[arn])
+	}
+	return json.Marshal(saved)
+}
+
+// UnmarshalJSON replaces the entries of the log with the saved ones.
+func (payloadLog *PayloadLog) UnmarshalJSON(data []byte) error {
+	var saved savedPayloadLog
+	err := json.Unmarshal(data, &saved)
+	if err != nil {
+		return err
+	}
+
+	payloadLog.lock.Lock()
+	defer payloadLog.lock.Unlock()
+
+	payloadLog.messageIDs = nil
+	payloadLog.messages = make(map[string]struct{})
+	payloadLog.taskArns = nil
+	payloadLog.tasks = make(map[string]*payloadLogTask)
+	for _, messageID := range saved.MessageIDs {
+		payloadLog.addMessage(messageID)
+	}
+	for _, task := range saved.Tasks {
+		if task == nil || task.Arn == "" {
+			continue
+		}
+		payloadLog.addTask(task)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPayloadLogTask(arn string, desiredStatus api.TaskStatus) *api.Task {
+	return &api.Task{Arn: arn, DesiredStatusUnsafe: desiredStatus}
+}
+
+func TestPayloadLogIsStale(t *testing.T) {
+	payloadLog := NewPayloadLog()
+	assert.False(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskRunning), 1))
+
+	payloadLog.recordTask(testPayloadLogTask("t1", api.TaskRunning), 2)
+	assert.True(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskRunning), 1), "Older sequence numbers should be stale")
+	assert.False(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskRunning), 2))
+	assert.False(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskStopped), 3))
+
+	payloadLog.recordTask(testPayloadLogTask("t1", api.TaskStopped), 3)
+	assert.True(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskRunning), 4), "Stopped tasks should never run again")
+	assert.False(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskStopped), 4))
+
+	// A replayed running task doesn't undo the stop
+	payloadLog.recordTask(testPayloadLogTask("t1", api.TaskRunning), 1)
+	assert.True(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskRunning), 4))
+}
+
+func TestPayloadLogIsBounded(t *testing.T) {
+	payloadLog := NewPayloadLog()
+	for i := 0; i <= maxPayloadLogMessages; i++ {
+		payloadLog.recordMessage(fmt.Sprintf("mid%d", i))
+	}
+	assert.False(t, payloadLog.containsMessage("mid0"), "Oldest message should have been forgotten")
+	assert.True(t, payloadLog.containsMessage("mid1"))
+	assert.True(t, payloadLog.containsMessage(fmt.Sprintf("mid%d", maxPayloadLogMessages)))
+
+	for i := 0; i <= maxPayloadLogTasks; i++ {
+		payloadLog.recordTask(testPayloadLogTask(fmt.Sprintf("t%d", i), api.TaskStopped), 1)
+	}
+	assert.False(t, payloadLog.isStale(testPayloadLogTask("t0", api.TaskRunning), 1), "Oldest task should have been forgotten")
+	assert.True(t, payloadLog.isStale(testPayloadLogTask("t1", api.TaskRunning), 1))
+}
+
+func TestPayloadLogJSON(t *testing.T) {
+	payloadLog := NewPayloadLog()
+	payloadLog.recordMessage("mid1")
+	payloadLog.recordTask(testPayloadLogTask("t1", api.TaskStopped), 2)
+	payloadLog.recordTask(testPayloadLogTask("t2", api.TaskRunning), 3)
+
+	data, err := json.Marshal(payloadLog)
+	require.NoError(t, err)
+	loaded := NewPayloadLog()
+	require.NoError(t, json.Unmarshal(data, loaded))
+
+	assert.True(t, loaded.containsMessage("mid1"))
+	assert.False(t, loaded.containsMessage("mid2"))
+	assert.True(t, loaded.isStale(testPayloadLogTask("t1", api.TaskRunning), 4))
+	assert.True(t, loaded.isStale(testPayloadLogTask("t2", api.TaskRunning), 2))
+	assert.False(t, loaded.isStale(testPayloadLogTask("t2", api.TaskStopped), 3))
+	assert.Equal(t, []string{"t1", "t2"}, loaded.taskArns)
+}
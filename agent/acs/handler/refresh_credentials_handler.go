@@ -131,12 +131,24 @@ func (refreshHandler *refreshCredentialsHandler) handleSingleMessage(message *ec
 		ARN:                taskArn,
 		IAMRoleCredentials: credentials.IAMRoleCredentialsFromACS(message.RoleCredentials),
 	}
-	err = refreshHandler.credentialsManager.SetTaskCredentials(taskCredentials)
-	if err != nil {
-		seelog.Errorf("Error updating credentials, err: %v messageId: %s", err, messageId)
-		return fmt.Errorf("Error updating credentials %v", err)
+	switch aws.StringValue(message.RoleType) {
+	case credentials.ExecutionRoleType:
+		err = refreshHandler.credentialsManager.SetTaskExecutionCredentials(taskCredentials)
+		if err != nil {
+			seelog.Errorf("Error updating execution role credentials, err: %v messageId: %s", err, messageId)
+			return fmt.Errorf("Error updating execution role credentials %v", err)
+		}
+		task.SetExecutionCredentialsID(aws.StringValue(message.RoleCredentials.CredentialsId))
+	default:
+		// Messages without a role type predate execution roles and are for
+		// the task role
+		err = refreshHandler.credentialsManager.SetTaskCredentials(taskCredentials)
+		if err != nil {
+			seelog.Errorf("Error updating credentials, err: %v messageId: %s", err, messageId)
+			return fmt.Errorf("Error updating credentials %v", err)
+		}
+		task.SetCredentialsID(aws.StringValue(message.RoleCredentials.CredentialsId))
 	}
-	task.SetCredentialsID(aws.StringValue(message.RoleCredentials.CredentialsId))
 
 	go func() {
 		response := &ecsacs.IAMRoleCredentialsAckRequest{
@@ -151,7 +163,8 @@ func (refreshHandler *refreshCredentialsHandler) handleSingleMessage(message *ec
 
 // validateIAMRoleCredentialsMessage validates fields in the IAMRoleCredentialsMessage
 // It returns an error if any of the following fields are not set in the message:
-// messageId, taskArn, roleCredentials
+// messageId, taskArn, roleCredentials. It also returns an error for a role type
+// other than the task role or the execution role.
 func validateIAMRoleCredentialsMessage(message *ecsacs.IAMRoleCredentialsMessage) error {
 	if message == nil {
 		return fmt.Errorf("Empty credentials message")
@@ -174,6 +187,12 @@ func validateIAMRoleCredentialsMessage(message *ecsacs.IAMRoleCredentialsMessage
 		return fmt.Errorf("Role Credentials ID not set in credentials message: messageId: %s", messageId)
 	}
 
+	switch roleType := aws.StringValue(message.RoleType); roleType {
+	case "", credentials.ApplicationRoleType, credentials.ExecutionRoleType:
+	default:
+		return fmt.Errorf("Unknown role type %q in credentials message: messageId: %s", roleType, messageId)
+	}
+
 	return nil
 }
 
@@ -155,6 +155,23 @@ func TestValidateRefreshMessageSuccess(t *testing.T) {
 	}
 }
 
+// TestValidateRefreshMessageWithUnknownRoleType tests if a validation error
+// is returned while validating a credentials message for an unknown role type
+func TestValidateRefreshMessageWithUnknownRoleType(t *testing.T) {
+	message := &ecsacs.IAMRoleCredentialsMessage{
+		MessageId: aws.String(messageId),
+		RoleCredentials: &ecsacs.IAMRoleCredentials{
+			CredentialsId: aws.String("id"),
+		},
+		RoleType: aws.String("SomeRole"),
+		TaskArn:  aws.String(taskArn),
+	}
+	err := validateIAMRoleCredentialsMessage(message)
+	if err == nil {
+		t.Error("Expected validation error validating credentials message with an unknown role type")
+	}
+}
+
 // TestInvalidCredentialsMessageNotAcked tests if invalid credential messages
 // are not acked
 func TestInvalidCredentialsMessageNotAcked(t *testing.T) {
@@ -270,6 +287,61 @@ func TestHandleRefreshMessageAckedWhenCredentialsUpdated(t *testing.T) {
 	}
 }
 
+// TestHandleRefreshMessageForExecutionRole tests that the credentials of an
+// execution role are updated apart from the task role credentials
+func TestHandleRefreshMessageForExecutionRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialsManager := credentials.NewManager()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var ackRequested *ecsacs.IAMRoleCredentialsAckRequest
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(ackRequest *ecsacs.IAMRoleCredentialsAckRequest) {
+		ackRequested = ackRequest
+		cancel()
+	}).Times(1)
+
+	task := &api.Task{}
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().GetTaskByArn(taskArn).Return(task, true)
+
+	handler := newRefreshCredentialsHandler(ctx, clusterName, containerInstanceArn, mockWsClient, credentialsManager, taskEngine)
+	go handler.sendAcks()
+
+	executionRoleMessage := *message
+	executionRoleMessage.RoleType = aws.String(credentials.ExecutionRoleType)
+	err := handler.handleSingleMessage(&executionRoleMessage)
+	if err != nil {
+		t.Errorf("Error updating credentials: %v", err)
+	}
+
+	// Wait till we get an ack from the ackBuffer
+	select {
+	case <-ctx.Done():
+	}
+
+	if !reflect.DeepEqual(ackRequested, expectedAck) {
+		t.Errorf("Message between expected and requested ack. Expected: %v, Requested: %v", expectedAck, ackRequested)
+	}
+
+	creds, exist := credentialsManager.GetTaskExecutionCredentials(credentialsId)
+	if !exist {
+		t.Errorf("Expected execution role credentials to exist for the task")
+	}
+	if !reflect.DeepEqual(creds, expectedCredentials) {
+		t.Errorf("Mismatch between expected credentials and credentials for task. Expected: %v, got: %v", expectedCredentials, creds)
+	}
+	if _, exist := credentialsManager.GetTaskCredentials(credentialsId); exist {
+		t.Errorf("Expected execution role credentials not to be task role credentials")
+	}
+	if task.GetExecutionCredentialsID() != credentialsId || task.GetCredentialsID() != "" {
+		t.Errorf("Expected the execution credentials id of the task to be set, got %q and %q",
+			task.GetExecutionCredentialsID(), task.GetCredentialsID())
+	}
+}
+
 // TestRefreshCredentialsHandler tests if a credential message is acked when
 // the message is sent to the messageBuffer channel
 func TestRefreshCredentialsHandler(t *testing.T) {
@@ -296,6 +296,8 @@ type IAMRoleCredentialsMessage struct {
 
 	RoleCredentials *IAMRoleCredentials `locationName:"roleCredentials" type:"structure"`
 
+	RoleType *string `locationName:"roleType" type:"string"`
+
 	TaskArn *string `locationName:"taskArn" type:"string"`
 }
 
@@ -496,6 +498,8 @@ type RegistryAuthenticationData struct {
 
 	EcrAuthData *ECRAuthData `locationName:"ecrAuthData" type:"structure"`
 
+	SsmAuthData *SSMAuthData `locationName:"ssmAuthData" type:"structure"`
+
 	Type *string `locationName:"type" type:"string" enum:"AuthenticationType"`
 }
 
@@ -509,6 +513,24 @@ func (s RegistryAuthenticationData) GoString() string {
 	return s.String()
 }
 
+type SSMAuthData struct {
+	_ struct{} `type:"structure"`
+
+	ParameterName *string `locationName:"parameterName" type:"string"`
+
+	Region *string `locationName:"region" type:"string"`
+}
+
+// String returns the string representation
+func (s SSMAuthData) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s SSMAuthData) GoString() string {
+	return s.String()
+}
+
 type ServerException struct {
 	_ struct{} `type:"structure"`
 
@@ -556,6 +578,8 @@ type Task struct {
 
 	DesiredStatus *string `locationName:"desiredStatus" type:"string"`
 
+	ExecutionRoleCredentials *IAMRoleCredentials `locationName:"executionRoleCredentials" type:"structure"`
+
 	Family *string `locationName:"family" type:"string"`
 
 	Overrides *string `locationName:"overrides" type:"string"`
@@ -85,7 +85,7 @@ func AddAgentUpdateHandlers(cs wsclient.ClientServer, cfg *config.Config, saver
 		acs:        cs,
 		config:     cfg,
 		fs:         os.Default,
-		httpclient: httpclient.New(updateDownloadTimeout, false),
+		httpclient: httpclient.New(updateDownloadTimeout, false, cfg),
 	}
 	cs.AddRequestHandler(singleUpdater.stageUpdateHandler())
 	cs.AddRequestHandler(singleUpdater.performUpdateHandler(saver, taskEngine))
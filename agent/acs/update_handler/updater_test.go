@@ -54,7 +54,7 @@ func mocks(t *testing.T, cfg *config.Config) (*updater, *gomock.Controller, *con
 	mockfs := mock_os.NewMockFileSystem(ctrl)
 	mockacs := mock_client.NewMockClientServer(ctrl)
 	mockhttp := mock_http.NewMockRoundTripper(ctrl)
-	httpClient := httpclient.New(updateDownloadTimeout, false)
+	httpClient := httpclient.New(updateDownloadTimeout, false, nil)
 	httpClient.Transport.(httpclient.OverridableTransport).SetTransport(mockhttp)
 
 	u := &updater{
@@ -17,6 +17,9 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
 )
 
 const (
@@ -47,6 +50,10 @@ type Container struct {
 	Image string
 	// ImageID is the local ID of the image used in the container
 	ImageID string
+	// ImageDigestUnsafe is the repo digest, as in "sha256:...", of the image
+	// pulled for the container. It is empty for images without a repo digest,
+	// such as images built locally.
+	ImageDigestUnsafe string `json:"ImageDigest,omitempty"`
 
 	Command                []string
 	CPU                    uint `json:"Cpu"`
@@ -86,6 +93,12 @@ type Container struct {
 	// is handled properly so that the state storage continues to work.
 	KnownStatusUnsafe ContainerStatus `json:"KnownStatus"`
 
+	// KnownStatusTimeUnsafe captures the time when the KnownStatusUnsafe was
+	// last updated.
+	// NOTE: Do not access KnownStatusTimeUnsafe directly. Instead, use
+	// `GetKnownStatusTime`.
+	KnownStatusTimeUnsafe time.Time `json:"KnownTime"`
+
 	// RunDependencies is a list of containers that must be run before
 	// this one is created
 	RunDependencies []string
@@ -99,6 +112,8 @@ type Container struct {
 	// ApplyingError is an error that occured trying to transition the container
 	// to its desired state. It is propagated to the backend in the form
 	// 'Name: ErrorString' as the 'reason' field.
+	// NOTE: Do not access ApplyingError directly. Instead, use
+	// `GetApplyingError` and `SetApplyingError`.
 	ApplyingError *DefaultNamedError
 
 	// SentStatusUnsafe represents the last KnownStatusUnsafe that was sent to the ECS
@@ -108,8 +123,18 @@ type Container struct {
 	// handled properly so that the state storage continues to work.
 	SentStatusUnsafe ContainerStatus `json:"SentStatus"`
 
-	knownExitCode     *int
+	knownExitCode *int
+	// KnownPortBindings are the host ports the container is bound to, as
+	// last inspected.
+	// NOTE: Do not access KnownPortBindings directly. Instead, use
+	// `GetKnownPortBindings` and `SetKnownPortBindings`.
 	KnownPortBindings []PortBinding
+
+	// IPAddressesUnsafe are the addresses of the container on the docker
+	// networks it is attached to, as last inspected.
+	// NOTE: Do not access IPAddressesUnsafe directly.  Instead, use
+	// `GetIPAddresses` and `SetIPAddresses`.
+	IPAddressesUnsafe []string `json:"IPAddresses,omitempty"`
 }
 
 // DockerContainer is a mapping between containers-as-docker-knows-them and
@@ -162,12 +187,23 @@ func (c *Container) GetKnownStatus() ContainerStatus {
 	return c.KnownStatusUnsafe
 }
 
-// SetKnownStatus sets the known status of the container
+// SetKnownStatus sets the known status of the container and records when it
+// changed
 func (c *Container) SetKnownStatus(status ContainerStatus) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
 	c.KnownStatusUnsafe = status
+	c.KnownStatusTimeUnsafe = ttime.Now()
+}
+
+// GetKnownStatusTime returns the time the known status of the container was
+// last updated
+func (c *Container) GetKnownStatusTime() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.KnownStatusTimeUnsafe
 }
 
 // GetDesiredStatus gets the desired status of the container
@@ -214,6 +250,66 @@ func (c *Container) GetKnownExitCode() *int {
 	return c.knownExitCode
 }
 
+// GetKnownPortBindings returns the host ports the container is bound to
+func (c *Container) GetKnownPortBindings() []PortBinding {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.KnownPortBindings
+}
+
+// SetKnownPortBindings sets the host ports the container is bound to
+func (c *Container) SetKnownPortBindings(bindings []PortBinding) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.KnownPortBindings = bindings
+}
+
+// GetApplyingError returns the error that occurred transitioning the
+// container to its desired state
+func (c *Container) GetApplyingError() *DefaultNamedError {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.ApplyingError
+}
+
+// SetApplyingError sets the error that occurred transitioning the container
+// to its desired state
+func (c *Container) SetApplyingError(err *DefaultNamedError) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ApplyingError = err
+}
+
+// GetImageDigest returns the repo digest of the container's image
+func (c *Container) GetImageDigest() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.ImageDigestUnsafe
+}
+
+// SetImageDigest sets the repo digest of the container's image
+func (c *Container) SetImageDigest(digest string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ImageDigestUnsafe = digest
+}
+
+// GetIPAddresses returns the addresses of the container on the docker
+// networks it is attached to
+func (c *Container) GetIPAddresses() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.IPAddressesUnsafe
+}
+
+// SetIPAddresses sets the addresses of the container on the docker networks
+// it is attached to
+func (c *Container) SetIPAddresses(ipAddresses []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.IPAddressesUnsafe = ipAddresses
+}
+
 // String returns a human readable string representation of this object
 func (c *Container) String() string {
 	ret := fmt.Sprintf("%s(%s) (%s->%s)", c.Name, c.Image, c.GetKnownStatus().String(), c.GetDesiredStatus().String())
@@ -13,11 +13,25 @@
 
 package api
 
-// RegistryAuthenticationData is the authentication data sent by the ECS backend.  Currently, the only supported
-// authentication data is for ECR.
+import (
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+)
+
+const (
+	// ECRAuthType is the type of the registry authentication data of images
+	// pulled from ECR
+	ECRAuthType = "ecr"
+	// SSMAuthType is the type of the registry authentication data of images
+	// pulled with credentials stored in the SSM Parameter Store
+	SSMAuthType = "ssm"
+)
+
+// RegistryAuthenticationData is the authentication data sent by the ECS backend. It
+// is either for ECR or a reference to credentials stored in the SSM Parameter Store.
 type RegistryAuthenticationData struct {
 	Type        string       `json:"type"`
 	ECRAuthData *ECRAuthData `json:"ecrAuthData"`
+	SSMAuthData *SSMAuthData `json:"ssmAuthData,omitempty"`
 }
 
 // ECRAuthData is the authentication details for ECR specifying the region, registryID, and possible endpoint override
@@ -25,4 +39,41 @@ type ECRAuthData struct {
 	EndpointOverride string `json:"endpointOverride"`
 	Region           string `json:"region"`
 	RegistryID       string `json:"registryId"`
+	// RoleCredentials are the credentials of the task's execution role, if it
+	// has one, to get the authorization token with instead of the instance's
+	// credentials. They are only set on the copy of the data passed to a
+	// pull, and are never saved.
+	RoleCredentials *credentials.IAMRoleCredentials `json:"-"`
+}
+
+// SSMAuthData references the registry credentials of a container, stored as a
+// SecureString parameter in the SSM Parameter Store. The parameter holds a JSON
+// object with a "username" and a "password", and is read with the credentials
+// of the task's execution role, or of the task's IAM role if it has no
+// execution role.
+type SSMAuthData struct {
+	ParameterName string `json:"parameterName"`
+	Region        string `json:"region"`
+	// RoleCredentials are the credentials the parameter is read with. They
+	// are only set on the copy of the data passed to a pull, and are never
+	// saved.
+	RoleCredentials *credentials.IAMRoleCredentials `json:"-"`
+}
+
+// WithRoleCredentials returns a copy of the authentication data that gets the
+// registry credentials, from ECR or the SSM Parameter Store, with the given
+// role credentials
+func (authData *RegistryAuthenticationData) WithRoleCredentials(roleCredentials credentials.IAMRoleCredentials) *RegistryAuthenticationData {
+	authDataCopy := *authData
+	if authData.ECRAuthData != nil {
+		ecrAuthData := *authData.ECRAuthData
+		ecrAuthData.RoleCredentials = &roleCredentials
+		authDataCopy.ECRAuthData = &ecrAuthData
+	}
+	if authData.SSMAuthData != nil {
+		ssmAuthData := *authData.SSMAuthData
+		ssmAuthData.RoleCredentials = &roleCredentials
+		authDataCopy.SSMAuthData = &ssmAuthData
+	}
+	return &authDataCopy
 }
@@ -0,0 +1,90 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskFromACSWithSSMAuthData(t *testing.T) {
+	taskFromACS := ecsacs.Task{
+		Arn: aws.String("myArn"),
+		Containers: []*ecsacs.Container{
+			{
+				Name: aws.String("myName"),
+				RegistryAuthentication: &ecsacs.RegistryAuthenticationData{
+					Type: aws.String("ssm"),
+					SsmAuthData: &ecsacs.SSMAuthData{
+						ParameterName: aws.String("/registry/creds"),
+						Region:        aws.String("us-west-2"),
+					},
+				},
+			},
+		},
+	}
+
+	task, err := TaskFromACS(&taskFromACS, &ecsacs.PayloadMessage{SeqNum: aws.Int64(1)})
+	require.NoError(t, err)
+	authData := task.Containers[0].RegistryAuthentication
+	require.NotNil(t, authData)
+	assert.Equal(t, SSMAuthType, authData.Type)
+	require.NotNil(t, authData.SSMAuthData)
+	assert.Equal(t, "/registry/creds", authData.SSMAuthData.ParameterName)
+	assert.Equal(t, "us-west-2", authData.SSMAuthData.Region)
+}
+
+func TestWithRoleCredentialsDoesNotModifyAuthData(t *testing.T) {
+	authData := &RegistryAuthenticationData{
+		Type: SSMAuthType,
+		SSMAuthData: &SSMAuthData{
+			ParameterName: "/registry/creds",
+			Region:        "us-west-2",
+		},
+	}
+
+	withCredentials := authData.WithRoleCredentials(credentials.IAMRoleCredentials{AccessKeyID: "akid"})
+	require.NotNil(t, withCredentials.SSMAuthData.RoleCredentials)
+	assert.Equal(t, "akid", withCredentials.SSMAuthData.RoleCredentials.AccessKeyID)
+	assert.Nil(t, authData.SSMAuthData.RoleCredentials)
+
+	marshalled, err := json.Marshal(withCredentials)
+	require.NoError(t, err)
+	assert.NotContains(t, string(marshalled), "akid")
+}
+
+func TestWithRoleCredentialsForECR(t *testing.T) {
+	authData := &RegistryAuthenticationData{
+		Type: ECRAuthType,
+		ECRAuthData: &ECRAuthData{
+			Region:     "us-west-2",
+			RegistryID: "123456789012",
+		},
+	}
+
+	withCredentials := authData.WithRoleCredentials(credentials.IAMRoleCredentials{AccessKeyID: "akid"})
+	require.NotNil(t, withCredentials.ECRAuthData.RoleCredentials)
+	assert.Equal(t, "akid", withCredentials.ECRAuthData.RoleCredentials.AccessKeyID)
+	assert.Nil(t, authData.ECRAuthData.RoleCredentials)
+
+	marshalled, err := json.Marshal(withCredentials)
+	require.NoError(t, err)
+	assert.NotContains(t, string(marshalled), "akid")
+}
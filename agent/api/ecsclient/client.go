@@ -22,6 +22,7 @@ import (
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/async"
+	"github.com/aws/amazon-ecs-agent/agent/cgroup"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/ec2"
 	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
@@ -58,7 +59,7 @@ func NewECSClient(credentialProvider *credentials.Credentials, config *config.Co
 	var ecsConfig aws.Config
 	ecsConfig.Credentials = credentialProvider
 	ecsConfig.Region = &config.AWSRegion
-	ecsConfig.HTTPClient = httpclient.New(RoundtripTimeout, config.AcceptInsecureCert)
+	ecsConfig.HTTPClient = httpclient.New(RoundtripTimeout, config.AcceptInsecureCert, config)
 	if config.APIEndpoint != "" {
 		ecsConfig.Endpoint = &config.APIEndpoint
 	}
@@ -260,9 +261,22 @@ func getCpuAndMemory() (int64, int64) {
 		log.Error("Unable to get memory info", "err", err)
 	}
 
-	cpu := runtime.NumCPU() * 1024
+	return int64(getNumCPU() * 1024), mem
+}
 
-	return int64(cpu), mem
+// getNumCPU returns the number of cpus available to containers. On a cgroup
+// v2 hierarchy the cpus available to containers are those in the root
+// cgroup's effective cpuset, which may differ from the cpus the agent itself
+// is allowed to run on.
+func getNumCPU() int {
+	if cgroup.Detect().Unified() {
+		cpus, err := cgroup.EffectiveCPUs()
+		if err == nil && cpus > 0 {
+			return cpus
+		}
+		seelog.Debugf("Unable to read effective cpuset, falling back to the number of usable cpus: %v", err)
+	}
+	return runtime.NumCPU()
 }
 
 func (client *APIECSClient) getAdditionalAttributes() []*ecs.Attribute {
@@ -303,6 +317,9 @@ func (client *APIECSClient) SubmitTaskStateChange(change api.TaskStateChange) er
 		Status:  aws.String(status),
 		Reason:  aws.String(change.Reason),
 	}
+	if change.ReasonCode != "" {
+		req.ReasonCode = aws.String(change.ReasonCode)
+	}
 
 	containerEvents := make([]*ecs.ContainerStateChange, len(change.Containers))
 	for i, containerEvent := range change.Containers {
@@ -343,6 +360,10 @@ func (client *APIECSClient) buildContainerStateChangePayload(change api.Containe
 
 	statechange.Status = aws.String(status.String())
 
+	if change.ImageDigest != "" {
+		statechange.ImageDigest = aws.String(change.ImageDigest)
+	}
+
 	if change.ExitCode != nil {
 		exitCode := int64(aws.IntValue(change.ExitCode))
 		statechange.ExitCode = aws.Int64(exitCode)
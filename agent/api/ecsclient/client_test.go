@@ -23,6 +23,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/api/mocks"
@@ -133,6 +134,44 @@ func TestSubmitContainerStateChange(t *testing.T) {
 	}
 }
 
+func TestSubmitTaskStateChangeWithImageDigest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client, _, mockSubmitStateClient := NewMockClient(mockCtrl, ec2.NewBlackholeEC2MetadataClient(), nil)
+	mockSubmitStateClient.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(req *ecs.SubmitTaskStateChangeInput) {
+		require.Len(t, req.Containers, 2)
+		assert.Equal(t, "sha256:abc", aws.StringValue(req.Containers[0].ImageDigest))
+		assert.Nil(t, req.Containers[1].ImageDigest)
+	}).Return(nil, nil)
+
+	err := client.SubmitTaskStateChange(api.TaskStateChange{
+		TaskArn: "arn",
+		Status:  api.TaskRunning,
+		Containers: []api.ContainerStateChange{
+			{TaskArn: "arn", ContainerName: "cont", Status: api.ContainerRunning, ImageDigest: "sha256:abc"},
+			{TaskArn: "arn", ContainerName: "local", Status: api.ContainerRunning},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestSubmitTaskStateChangeWithReasonCode(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client, _, mockSubmitStateClient := NewMockClient(mockCtrl, ec2.NewBlackholeEC2MetadataClient(), nil)
+	mockSubmitStateClient.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(req *ecs.SubmitTaskStateChangeInput) {
+		assert.Equal(t, "UnrecognizedTask", aws.StringValue(req.ReasonCode))
+	}).Return(nil, nil)
+
+	err := client.SubmitTaskStateChange(api.TaskStateChange{
+		TaskArn:    "arn",
+		Status:     api.TaskStopped,
+		Reason:     "UnrecognizedTaskError: Error loading task - invalid",
+		ReasonCode: "UnrecognizedTask",
+	})
+	assert.NoError(t, err)
+}
+
 func TestSubmitContainerStateChangeFull(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
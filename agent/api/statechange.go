@@ -36,6 +36,8 @@ type ContainerStateChange struct {
 	// PortBindings are the details of the host ports picked for the specified
 	// container ports
 	PortBindings []PortBinding
+	// ImageDigest is the repo digest of the container's image, if known
+	ImageDigest string
 
 	// Container is a pointer to the container involved in the state change that gives the event handler a hook into
 	// storing what status was sent.  This is used to ensure the same event is handled only once.
@@ -51,6 +53,9 @@ type TaskStateChange struct {
 	Status TaskStatus
 	// Reason may contain details of why the task stopped
 	Reason string
+	// ReasonCode is the machine-readable name of the reason, e.g.
+	// "HostPortConflict" for a task that was rejected before starting
+	ReasonCode string
 	// Containers holds the events generated by containers owned by this task
 	Containers []ContainerStateChange
 
@@ -71,6 +76,9 @@ func (c *ContainerStateChange) String() string {
 	if len(c.PortBindings) != 0 {
 		res += fmt.Sprintf(", Ports %v", c.PortBindings)
 	}
+	if c.ImageDigest != "" {
+		res += ", Digest " + c.ImageDigest
+	}
 	if c.Container != nil {
 		res += ", Known Sent: " + c.Container.GetSentStatus().String()
 	}
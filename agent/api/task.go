@@ -39,6 +39,14 @@ const (
 	// variable containers' config, which will be used by the AWS SDK to fetch
 	// credentials.
 	awsSDKCredentialsRelativeURIPathEnvironmentVariableName = "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"
+
+	// minimumCPUShares is the smallest value the kernel accepts for cpu.shares
+	minimumCPUShares = 2
+	// maximumCPUShares is the largest value the kernel accepts for cpu.shares.
+	// On a cgroup v2 hierarchy the runtime maps shares in [2, 262144] linearly
+	// onto cpu.weight in [1, 10000], so values outside of it cannot be
+	// represented either.
+	maximumCPUShares = 262144
 )
 
 // TaskOverrides are the overrides applied to a task
@@ -105,11 +113,22 @@ type Task struct {
 	StartSequenceNumber int64
 	StopSequenceNumber  int64
 
+	// Local is set on tasks started through the local control api. Their
+	// state changes are never submitted to the ECS backend.
+	Local bool `json:",omitempty"`
+
 	// credentialsID is used to set the CredentialsId field for the
 	// IAMRoleCredentials object associated with the task. This id can be
 	// used to look up the credentials for task in the credentials manager
 	credentialsID     string
 	credentialsIDLock sync.RWMutex
+
+	// executionCredentialsID is the id of the credentials of the task's
+	// execution role in the credentials manager. The agent uses them on
+	// behalf of the task, e.g. to pull images from ECR, and never exposes them
+	// to the task's containers.
+	executionCredentialsID     string
+	executionCredentialsIDLock sync.RWMutex
 }
 
 // PostUnmarshalTask is run after a task has been unmarshalled, but before it has been
@@ -347,10 +366,17 @@ func (task *Task) dockerConfig(container *Container) (*docker.Config, *DockerCli
 // Docker silently converts 0 to 1024 CPU shares, which is probably not what we
 // want.  Instead, we convert 0 to 2 to be closer to expected behavior. The
 // reason for 2 over 1 is that 1 is an invalid value (Linux's choice, not Docker's).
+// Values above the kernel maximum are capped, since they would otherwise be
+// rejected at container creation on cgroup v1 and overflow the cpu.weight
+// conversion on cgroup v2.
 func (task *Task) dockerCPUShares(containerCPU uint) int64 {
 	if containerCPU <= 1 {
 		log.Debug("Converting CPU shares to allowed minimum of 2", "task", task.Arn, "cpuShares", containerCPU)
-		return 2
+		return minimumCPUShares
+	}
+	if containerCPU > maximumCPUShares {
+		log.Debug("Capping CPU shares to allowed maximum of 262144", "task", task.Arn, "cpuShares", containerCPU)
+		return maximumCPUShares
 	}
 	return int64(containerCPU)
 }
@@ -630,6 +656,24 @@ func (task *Task) GetCredentialsID() string {
 	return task.credentialsID
 }
 
+// SetExecutionCredentialsID sets the id of the credentials of the task's
+// execution role
+func (task *Task) SetExecutionCredentialsID(id string) {
+	task.executionCredentialsIDLock.Lock()
+	defer task.executionCredentialsIDLock.Unlock()
+
+	task.executionCredentialsID = id
+}
+
+// GetExecutionCredentialsID gets the id of the credentials of the task's
+// execution role
+func (task *Task) GetExecutionCredentialsID() string {
+	task.executionCredentialsIDLock.RLock()
+	defer task.executionCredentialsIDLock.RUnlock()
+
+	return task.executionCredentialsID
+}
+
 // GetDesiredStatus gets the desired status of the task
 func (task *Task) GetDesiredStatus() TaskStatus {
 	task.desiredStatusLock.RLock()
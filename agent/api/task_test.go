@@ -139,6 +139,26 @@ func TestDockerConfigCPUShareUnchanged(t *testing.T) {
 	}
 }
 
+func TestDockerConfigCPUShareMaximum(t *testing.T) {
+	testTask := &Task{
+		Containers: []*Container{
+			{
+				Name: "c1",
+				CPU:  maximumCPUShares + 1,
+			},
+		},
+	}
+
+	config, err := testTask.DockerConfig(testTask.Containers[0])
+	if err != nil {
+		t.Error(err)
+	}
+
+	if config.CPUShares != maximumCPUShares {
+		t.Error("CPU shares not capped to the kernel maximum")
+	}
+}
+
 func TestDockerHostConfigPortBinding(t *testing.T) {
 	testTask := &Task{
 		Containers: []*Container{
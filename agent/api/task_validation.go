@@ -0,0 +1,126 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Names of the errors a task is rejected with when it fails validation. They
+// are sent as the prefix of the reason of the task's state change.
+const (
+	DuplicateContainerNameErrorName = "DuplicateContainerName"
+	UnknownLinkTargetErrorName      = "UnknownLinkTarget"
+	UnknownVolumeErrorName          = "UnknownVolume"
+	HostPortConflictErrorName       = "HostPortConflict"
+	InsufficientMemoryErrorName     = "InsufficientMemory"
+	InvalidDockerConfigErrorName    = "InvalidDockerConfig"
+	UnsupportedLogDriverErrorName   = "UnsupportedLogDriver"
+	CircularDependencyErrorName     = "CircularDependency"
+)
+
+func validationError(name string, format string, args ...interface{}) NamedError {
+	return &DefaultNamedError{Name: name, Err: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks that the task can be started on this instance. The returned
+// error names the first problem found, e.g. "HostPortConflict", so that the
+// reason a task is rejected can be reported to the user.
+// availableLoggingDrivers are the log drivers that may be used by containers.
+func (task *Task) Validate(availableLoggingDrivers []dockerclient.LoggingDriver) NamedError {
+	containers := make(map[string]*Container, len(task.Containers))
+	for _, container := range task.Containers {
+		if _, ok := containers[container.Name]; ok {
+			return validationError(DuplicateContainerNameErrorName, "container %s is defined more than once", container.Name)
+		}
+		containers[container.Name] = container
+	}
+	volumes := make(map[string]struct{}, len(task.Volumes))
+	for _, volume := range task.Volumes {
+		volumes[volume.Name] = struct{}{}
+	}
+	logDrivers := make(map[string]struct{}, len(availableLoggingDrivers))
+	for _, driver := range availableLoggingDrivers {
+		logDrivers[string(driver)] = struct{}{}
+	}
+
+	// Host ports used by the task, by protocol and port
+	hostPorts := make(map[string]string)
+	for _, container := range task.Containers {
+		for _, link := range container.Links {
+			linkParts := strings.Split(link, ":")
+			if _, ok := containers[linkParts[0]]; !ok || len(linkParts) > 2 {
+				return validationError(UnknownLinkTargetErrorName, "container %s links to %s, which is not a container of the task", container.Name, link)
+			}
+		}
+		for _, mountPoint := range container.MountPoints {
+			if _, ok := volumes[mountPoint.SourceVolume]; !ok {
+				return validationError(UnknownVolumeErrorName, "container %s mounts volume %s, which is not a volume of the task", container.Name, mountPoint.SourceVolume)
+			}
+		}
+		for _, volumeFrom := range container.VolumesFrom {
+			if _, ok := containers[volumeFrom.SourceContainer]; !ok {
+				return validationError(UnknownVolumeErrorName, "container %s uses the volumes of %s, which is not a container of the task", container.Name, volumeFrom.SourceContainer)
+			}
+		}
+		for _, port := range container.Ports {
+			if port.HostPort == 0 {
+				// Dynamic host ports can't conflict
+				continue
+			}
+			key := fmt.Sprintf("%d/%s", port.HostPort, port.Protocol.String())
+			if other, ok := hostPorts[key]; ok {
+				return validationError(HostPortConflictErrorName, "containers %s and %s both use host port %s", other, container.Name, key)
+			}
+			hostPorts[key] = container.Name
+		}
+		if container.Memory != 0 && int64(container.Memory)*1024*1024 < DockerContainerMinimumMemoryInBytes {
+			return validationError(InsufficientMemoryErrorName, "container %s has %d MiB of memory, the minimum is %d MiB",
+				container.Name, container.Memory, DockerContainerMinimumMemoryInBytes/(1024*1024))
+		}
+		if err := validateDockerConfig(container, logDrivers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDockerConfig checks that the docker config of the container can be
+// decoded and only uses available log drivers
+func validateDockerConfig(container *Container, logDrivers map[string]struct{}) NamedError {
+	if container.DockerConfig.Config != nil {
+		config := &docker.Config{}
+		if err := json.Unmarshal([]byte(*container.DockerConfig.Config), config); err != nil {
+			return validationError(InvalidDockerConfigErrorName, "container %s has an invalid docker config: %v", container.Name, err)
+		}
+	}
+	if container.DockerConfig.HostConfig == nil {
+		return nil
+	}
+	hostConfig := &docker.HostConfig{}
+	if err := json.Unmarshal([]byte(*container.DockerConfig.HostConfig), hostConfig); err != nil {
+		return validationError(InvalidDockerConfigErrorName, "container %s has an invalid docker host config: %v", container.Name, err)
+	}
+	if driver := hostConfig.LogConfig.Type; driver != "" {
+		if _, ok := logDrivers[driver]; !ok {
+			return validationError(UnsupportedLogDriverErrorName, "container %s uses log driver %s, which is not available on this instance", container.Name, driver)
+		}
+	}
+	return nil
+}
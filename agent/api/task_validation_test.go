@@ -0,0 +1,87 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskValidate(t *testing.T) {
+	logDrivers := []dockerclient.LoggingDriver{dockerclient.JSONFileDriver, dockerclient.SyslogDriver}
+	validTask := func() *Task {
+		return &Task{
+			Arn:     "arn",
+			Volumes: []TaskVolume{{Name: "data", Volume: &EmptyHostVolume{}}},
+			Containers: []*Container{
+				{
+					Name:        "db",
+					Memory:      256,
+					MountPoints: []MountPoint{{SourceVolume: "data", ContainerPath: "/data"}},
+					Ports:       []PortBinding{{ContainerPort: 5432, HostPort: 5432}},
+				},
+				{
+					Name:        "web",
+					Memory:      128,
+					Links:       []string{"db:database"},
+					VolumesFrom: []VolumeFrom{{SourceContainer: "db"}},
+					Ports: []PortBinding{
+						{ContainerPort: 80, HostPort: 80},
+						{ContainerPort: 5432, HostPort: 5432, Protocol: TransportProtocolUDP},
+						{ContainerPort: 8080},
+					},
+					DockerConfig: DockerConfig{
+						Config:     aws.String(`{"User":"web"}`),
+						HostConfig: aws.String(`{"LogConfig":{"Type":"syslog"}}`),
+					},
+				},
+			},
+		}
+	}
+
+	assert.Nil(t, validTask().Validate(logDrivers))
+
+	testCases := []struct {
+		name         string
+		modify       func(*Task)
+		expectedName string
+	}{
+		{"duplicate container", func(task *Task) { task.Containers[1].Name = "db" }, DuplicateContainerNameErrorName},
+		{"unknown link", func(task *Task) { task.Containers[1].Links = []string{"cache"} }, UnknownLinkTargetErrorName},
+		{"invalid link", func(task *Task) { task.Containers[1].Links = []string{"db:a:b"} }, UnknownLinkTargetErrorName},
+		{"unknown volume", func(task *Task) { task.Containers[0].MountPoints[0].SourceVolume = "logs" }, UnknownVolumeErrorName},
+		{"unknown volumes from", func(task *Task) { task.Containers[1].VolumesFrom[0].SourceContainer = "cache" }, UnknownVolumeErrorName},
+		{"host port conflict", func(task *Task) { task.Containers[1].Ports[0].HostPort = 5432 }, HostPortConflictErrorName},
+		{"insufficient memory", func(task *Task) { task.Containers[1].Memory = 3 }, InsufficientMemoryErrorName},
+		{"invalid config", func(task *Task) { task.Containers[1].DockerConfig.Config = aws.String(`{"User":`) }, InvalidDockerConfigErrorName},
+		{"invalid host config", func(task *Task) { task.Containers[1].DockerConfig.HostConfig = aws.String(`[]`) }, InvalidDockerConfigErrorName},
+		{"unsupported log driver", func(task *Task) {
+			task.Containers[1].DockerConfig.HostConfig = aws.String(`{"LogConfig":{"Type":"awslogs"}}`)
+		}, UnsupportedLogDriverErrorName},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			task := validTask()
+			testCase.modify(task)
+			err := task.Validate(logDrivers)
+			if assert.NotNil(t, err) {
+				assert.Equal(t, testCase.expectedName, err.ErrorName())
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@ package app
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"golang.org/x/net/context"
 
@@ -25,19 +26,26 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/aws/amazon-ecs-agent/agent/ecr"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
 	"github.com/aws/amazon-ecs-agent/agent/handlers"
+	controlhandler "github.com/aws/amazon-ecs-agent/agent/handlers/control"
 	credentialshandler "github.com/aws/amazon-ecs-agent/agent/handlers/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers"
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers/exitcodes"
+	"github.com/aws/amazon-ecs-agent/agent/standalone"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	tcsclient "github.com/aws/amazon-ecs-agent/agent/tcs/client"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/handler"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/amazon-ecs-agent/agent/version"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws"
 	aws_credentials "github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/defaults"
@@ -71,6 +79,9 @@ type ecsAgent struct {
 	cfg                   *config.Config
 	dockerClient          engine.DockerClient
 	containerInstanceARN  string
+	payloadLog            *acshandler.PayloadLog
+	ecrTokenStore         *ecr.TokenStore
+	connections           *wsclient.ConnectionRegistry
 	credentialProvider    *aws_credentials.Credentials
 	stateManagerFactory   factory.StateManager
 	saveableOptionFactory factory.SaveableOption
@@ -101,7 +112,8 @@ func newAgent(
 	}
 	log.Debugf("Loaded config: %s", cfg.String())
 
-	dockerClient, err := engine.NewDockerGoClient(dockerclient.NewFactory(cfg.DockerEndpoint), cfg)
+	ecrTokenStore := newECRTokenStore(cfg)
+	dockerClient, err := engine.NewDockerGoClient(ctx, dockerclient.NewFactory(cfg.DockerEndpoint), cfg, ecrTokenStore)
 	if err != nil {
 		// This is also non terminal in the current config
 		log.Criticalf("Error creating Docker client: %v", err)
@@ -113,6 +125,8 @@ func newAgent(
 		ec2MetadataClient: ec2MetadataClient,
 		cfg:               cfg,
 		dockerClient:      dockerClient,
+		ecrTokenStore:     ecrTokenStore,
+		connections:       wsclient.NewConnectionRegistry(),
 		// We instantiate our own credentialProvider for use in acs/tcs. This tries
 		// to mimic roughly the way it's instantiated by the SDK for a default
 		// session.
@@ -122,6 +136,23 @@ func newAgent(
 	}, nil
 }
 
+// newECRTokenStore returns the store of the ECR authorization tokens. The
+// tokens are only saved with the state when checkpointing is enabled and the
+// key they are encrypted with can be loaded from the data directory.
+func newECRTokenStore(cfg *config.Config) *ecr.TokenStore {
+	var key []byte
+	if cfg.Checkpoint {
+		var err error
+		key, err = ecr.LoadTokenKey(cfg.DataDir)
+		if err != nil {
+			log.Warnf("Unable to load the ecr token key, authorization tokens will not be saved: %v", err)
+		}
+	}
+	// The key is either nil or of the right size
+	ecrTokenStore, _ := ecr.NewTokenStore(key)
+	return ecrTokenStore
+}
+
 // printVersion prints the ECS Agent version string
 func (agent *ecsAgent) printVersion() int {
 	version.PrintVersion(agent.dockerClient)
@@ -136,7 +167,12 @@ func (agent *ecsAgent) start() int {
 	credentialsManager := credentials.NewManager()
 	state := dockerstate.NewTaskEngineState()
 	imageManager := engine.NewImageManager(agent.cfg, agent.dockerClient, state)
-	client := ecsclient.NewECSClient(agent.credentialProvider, agent.cfg, agent.ec2MetadataClient)
+	var client api.ECSClient
+	if agent.cfg.Standalone() {
+		client = standalone.NewStateChangeLogClient(agent.cfg)
+	} else {
+		client = ecsclient.NewECSClient(agent.credentialProvider, agent.cfg, agent.ec2MetadataClient)
+	}
 
 	return agent.doStart(containerChangeEventStream, credentialsManager, state, imageManager, client)
 }
@@ -159,23 +195,34 @@ func (agent *ecsAgent) doStart(containerChangeEventStream *eventstream.EventStre
 
 	// Initialize the state manager
 	stateManager, err := agent.newStateManager(taskEngine,
-		&agent.cfg.Cluster, &agent.containerInstanceARN, &currentEC2InstanceID)
+		&agent.cfg.Cluster, &agent.containerInstanceARN, &currentEC2InstanceID, agent.payloadLog, agent.ecrTokenStore)
 	if err != nil {
 		log.Criticalf("Error creating state manager: %v", err)
 		return exitcodes.ExitTerminal
 	}
 
-	// Register the container instance
-	err = agent.registerContainerInstance(taskEngine, stateManager, client)
-	if err != nil {
-		if isTranisent(err) {
-			return exitcodes.ExitError
+	// Register the container instance, there is nothing to register with in
+	// standalone mode
+	if agent.cfg.Standalone() {
+		log.Infof("Running in standalone mode with the task manifests in %s", agent.cfg.StandaloneManifestDir)
+	} else {
+		err = agent.registerContainerInstance(taskEngine, stateManager, client)
+		if err != nil {
+			if isTranisent(err) {
+				return exitcodes.ExitError
+			}
+			return exitcodes.ExitTerminal
 		}
-		return exitcodes.ExitTerminal
 	}
 
+	// The audit log records the requests for credentials and the images denied
+	// by the image admission policy
+	auditLogger := audit.NewAuditLogFromConfig(agent.containerInstanceARN, agent.cfg)
+	go audit.StartRotatedLogCleanup(agent.ctx, agent.cfg)
+
 	// Begin listening to the docker daemon and saving changes
 	taskEngine.SetSaver(stateManager)
+	taskEngine.SetAuditLogger(auditLogger)
 	imageManager.SetSaver(stateManager)
 	taskEngine.MustInit(agent.ctx)
 
@@ -183,13 +230,42 @@ func (agent *ecsAgent) doStart(containerChangeEventStream *eventstream.EventStre
 	deregisterInstanceEventStream := eventstream.NewEventStream(
 		deregisterContainerInstanceEventStreamName, agent.ctx)
 	deregisterInstanceEventStream.StartListening()
-	taskHandler := eventhandler.NewTaskHandler()
+	taskHandler := agent.newTaskHandler(state, client)
+	var acsSession acshandler.Session
+	if !agent.cfg.Standalone() {
+		acsSession = agent.newACSSession(credentialsManager, taskEngine, stateManager,
+			deregisterInstanceEventStream, client, taskHandler)
+	}
 	agent.startAsyncRoutines(containerChangeEventStream, credentialsManager, imageManager,
-		taskEngine, stateManager, deregisterInstanceEventStream, client, taskHandler)
+		taskEngine, state, stateManager, deregisterInstanceEventStream, client, taskHandler, acsSession, auditLogger)
+
+	if agent.cfg.Standalone() {
+		// Run the tasks from the manifests, which should block doStart
+		return agent.startStandaloneSession(taskEngine)
+	}
 
 	// Start the acs session, which should block doStart
-	return agent.startACSSession(credentialsManager, taskEngine, stateManager,
-		deregisterInstanceEventStream, client, taskHandler)
+	return agent.startACSSession(acsSession)
+}
+
+// newTaskHandler creates the handler that submits state changes to the
+// backend. When checkpointing is enabled, pending state changes are recorded
+// in the data directory and the ones left over by a previous run are queued
+// up again.
+func (agent *ecsAgent) newTaskHandler(state dockerstate.TaskEngineState, client api.ECSClient) *eventhandler.TaskHandler {
+	if !agent.cfg.Checkpoint {
+		return eventhandler.NewTaskHandler()
+	}
+	taskHandler, err := eventhandler.NewTaskHandlerWithJournal(filepath.Join(agent.cfg.DataDir, eventhandler.JournalDirName))
+	if err != nil {
+		log.Warnf("Error creating state change journal, pending state changes will not survive restarts: %v", err)
+		return eventhandler.NewTaskHandler()
+	}
+	err = taskHandler.ReplayJournal(state, client)
+	if err != nil {
+		log.Warnf("Error replaying state change journal: %v", err)
+	}
+	return taskHandler
 }
 
 // newTaskEngine creates a new docker task engine object. It tries to load the
@@ -200,6 +276,9 @@ func (agent *ecsAgent) newTaskEngine(containerChangeEventStream *eventstream.Eve
 	imageManager engine.ImageManager) (engine.TaskEngine, string, error) {
 
 	containerChangeEventStream.StartListening()
+	// The payloads applied by a previous run are only known when the state
+	// is restored
+	agent.payloadLog = acshandler.NewPayloadLog()
 
 	if !agent.cfg.Checkpoint {
 		log.Info("Checkpointing not enabled; a new container instance will be created each time the agent is run")
@@ -209,13 +288,14 @@ func (agent *ecsAgent) newTaskEngine(containerChangeEventStream *eventstream.Eve
 
 	// We try to set these values by loading the existing state file first
 	var previousCluster, previousEC2InstanceID, previousContainerInstanceArn string
+	previousPayloadLog := acshandler.NewPayloadLog()
 	previousTaskEngine := engine.NewTaskEngine(agent.cfg, agent.dockerClient,
 		credentialsManager, containerChangeEventStream, imageManager, state)
 
 	// previousState is used to verify that our current runtime configuration is
 	// compatible with our past configuration as reflected by our state-file
 	previousState, err := agent.newStateManager(previousTaskEngine, &previousCluster,
-		&previousContainerInstanceArn, &previousEC2InstanceID)
+		&previousContainerInstanceArn, &previousEC2InstanceID, previousPayloadLog, agent.ecrTokenStore)
 	if err != nil {
 		log.Criticalf("Error creating state manager: %v", err)
 		return nil, "", err
@@ -227,13 +307,18 @@ func (agent *ecsAgent) newTaskEngine(containerChangeEventStream *eventstream.Eve
 		return nil, "", err
 	}
 
-	currentEC2InstanceID := agent.getEC2InstanceID()
+	// Standalone hosts are not expected to be EC2 instances
+	var currentEC2InstanceID string
+	if !agent.cfg.Standalone() {
+		currentEC2InstanceID = agent.getEC2InstanceID()
+	}
 	if previousEC2InstanceID != "" && previousEC2InstanceID != currentEC2InstanceID {
 		log.Warnf(instanceIDMismatchErrorFormat,
 			previousEC2InstanceID, currentEC2InstanceID)
 
 		// Reset agent state as a new container instance
 		state.Reset()
+		agent.ecrTokenStore.Reset()
 		// Reset taskEngine; all the other values are still default
 		return engine.NewTaskEngine(agent.cfg, agent.dockerClient, credentialsManager,
 			containerChangeEventStream, imageManager, state), currentEC2InstanceID, nil
@@ -247,6 +332,7 @@ func (agent *ecsAgent) newTaskEngine(containerChangeEventStream *eventstream.Eve
 
 	// Use the values we loaded if there's no issue
 	agent.containerInstanceARN = previousContainerInstanceArn
+	agent.payloadLog = previousPayloadLog
 	return previousTaskEngine, currentEC2InstanceID, nil
 }
 
@@ -291,7 +377,9 @@ func (agent *ecsAgent) newStateManager(
 	taskEngine engine.TaskEngine,
 	cluster *string,
 	containerInstanceArn *string,
-	savedInstanceID *string) (statemanager.StateManager, error) {
+	savedInstanceID *string,
+	payloadLog *acshandler.PayloadLog,
+	ecrTokenStore *ecr.TokenStore) (statemanager.StateManager, error) {
 
 	if !agent.cfg.Checkpoint {
 		return statemanager.NewNoopStateManager(), nil
@@ -305,6 +393,8 @@ func (agent *ecsAgent) newStateManager(
 		agent.saveableOptionFactory.AddSaveable("Cluster", cluster),
 		// This is for making testing easier as we can mock this
 		agent.saveableOptionFactory.AddSaveable("EC2InstanceID", savedInstanceID),
+		agent.saveableOptionFactory.AddSaveable("PayloadLog", payloadLog),
+		agent.saveableOptionFactory.AddSaveable("ECRTokens", ecrTokenStore),
 	)
 }
 
@@ -371,26 +461,97 @@ func (agent *ecsAgent) startAsyncRoutines(
 	credentialsManager credentials.Manager,
 	imageManager engine.ImageManager,
 	taskEngine engine.TaskEngine,
+	state dockerstate.TaskEngineState,
 	stateManager statemanager.StateManager,
 	deregisterInstanceEventStream *eventstream.EventStream,
 	client api.ECSClient,
-	taskHandler *eventhandler.TaskHandler) {
+	taskHandler *eventhandler.TaskHandler,
+	acsSession acshandler.Session,
+	auditLogger audit.AuditLogger) {
 
 	// Start of the periodic image cleanup process
 	if !agent.cfg.ImageCleanupDisabled {
 		go imageManager.StartImageCleanupProcess(agent.ctx)
 	}
 
-	go sighandlers.StartTerminationHandler(stateManager, taskEngine)
+	// On termination, stop accepting payloads from ACS first, then submit the
+	// pending state changes and publish the last metrics
+	var shutdownDrainers []sighandlers.Drainer
+	if acsSession != nil {
+		shutdownDrainers = append(shutdownDrainers, acsSession)
+	}
+	shutdownDrainers = append(shutdownDrainers, sighandlers.DrainerFunc(func(ctx context.Context) []string {
+		return taskHandler.Drain(ctx, client)
+	}))
+	tcsDrainer := tcshandler.NewSessionDrainer()
+	if !agent.cfg.Standalone() {
+		shutdownDrainers = append(shutdownDrainers, tcsDrainer)
+	}
+	if agent.cfg.ShutdownDrainDisabled {
+		shutdownDrainers = nil
+	}
+	go sighandlers.StartTerminationHandler(stateManager, taskEngine, agent.cfg.ShutdownDrainTimeout, shutdownDrainers...)
+
+	// Local consumers of state changes subscribe to the broadcaster through
+	// webhooks or the introspection api
+	broadcaster := eventhandler.NewBroadcaster()
+	eventhandler.StartWebhooks(agent.ctx, broadcaster, agent.cfg.StateChangeWebhooks)
+
+	// The stats engine gathers container utilization for both metrics
+	// publishing and task accounting
+	var statsEngine *stats.DockerStatsEngine
+	var taskUsage handlers.TaskUsageResolver
+	if !agent.cfg.DisableMetrics || agent.cfg.TaskAccountingEnabled {
+		statsEngine = stats.NewDockerStatsEngine(agent.cfg, agent.dockerClient, containerChangeEventStream)
+		err := statsEngine.MustInit(taskEngine, agent.cfg.Cluster, agent.containerInstanceARN)
+		if err != nil {
+			log.Warnf("Error initializing stats engine: %v", err)
+			statsEngine = nil
+		} else {
+			taskUsage = statsEngine
+			// Task usage reports are finalized once the task stops
+			broadcaster.AddListener(statsEngine.HandleStateChange)
+		}
+	}
+
+	// Warn about the credentials ACS is late refreshing
+	credentialsExpiry := credentials.NewExpiryMonitor(credentialsManager, agent.cfg.CredentialsRefreshMargin)
+	go credentialsExpiry.Start(agent.ctx)
+
+	// Metrics that cannot be published are kept across telemetry sessions
+	metricsBuffer := tcsclient.NewMetricsBuffer(tcsclient.DefaultMetricsBufferSize)
 
 	// Agent introspection api
-	go handlers.ServeHttp(&agent.containerInstanceARN, taskEngine, agent.cfg)
+	go handlers.ServeHttp(&agent.containerInstanceARN, taskEngine, handlers.Dependencies{
+		TaskUsage:             taskUsage,
+		StateChangeQueue:      taskHandler,
+		StateChangeSubscriber: broadcaster,
+		Connections:           agent.connections,
+		MetricsBuffer:         metricsBuffer,
+		CredentialsExpiry:     credentialsExpiry,
+		ECRTokens:             agent.ecrTokenStore,
+	}, agent.cfg)
+
+	// Start serving the endpoint to fetch IAM Role credentials, optionally
+	// only to the containers of the task owning them
+	var credentialsTaskResolver credentialshandler.TaskResolver
+	if agent.cfg.CredentialsRequestBindingEnabled {
+		credentialsTaskResolver = state
+	}
+	go credentialshandler.ServeHTTP(credentialsManager, auditLogger, credentialsTaskResolver)
 
-	// Start serving the endpoint to fetch IAM Role credentials
-	go credentialshandler.ServeHTTP(credentialsManager, agent.containerInstanceARN, agent.cfg)
+	// Start serving the local control api, to run tasks outside of ECS
+	if agent.cfg.LocalControlEnabled {
+		go controlhandler.ServeHTTP(taskEngine, agent.cfg)
+	}
 
 	// Start sending events to the backend
-	go eventhandler.HandleEngineEvents(taskEngine, client, stateManager, taskHandler)
+	go eventhandler.HandleEngineEvents(taskEngine, client, stateManager, taskHandler, broadcaster)
+
+	if agent.cfg.Standalone() {
+		// There is no telemetry service to publish metrics to
+		return
+	}
 
 	telemetrySessionParams := tcshandler.TelemetrySessionParams{
 		CredentialProvider:            agent.credentialProvider,
@@ -401,23 +562,40 @@ func (agent *ecsAgent) startAsyncRoutines(
 		DockerClient:                  agent.dockerClient,
 		ECSClient:                     client,
 		TaskEngine:                    taskEngine,
+		ConnectionStats:               agent.connections.Register("TCS"),
+		Drainer:                       tcsDrainer,
+		MetricsBuffer:                 metricsBuffer,
+	}
+	if statsEngine != nil {
+		telemetrySessionParams.StatsEngine = statsEngine
 	}
 
 	// Start metrics session in a go routine
 	go tcshandler.StartMetricsSession(telemetrySessionParams)
 }
 
-// startACSSession starts a session with ECS's Agent Communication service. This
-// is a blocking call and only returns when the handler returns
-func (agent *ecsAgent) startACSSession(
+// startStandaloneSession runs the tasks from the local task manifests. This is
+// a blocking call and only returns when the agent's context is cancelled
+func (agent *ecsAgent) startStandaloneSession(taskEngine engine.TaskEngine) int {
+	watcher := standalone.NewManifestWatcher(agent.cfg.StandaloneManifestDir, taskEngine)
+	err := watcher.Start(agent.ctx)
+	if err != nil {
+		log.Criticalf("Unable to read the task manifests in %s: %v", agent.cfg.StandaloneManifestDir, err)
+		return exitcodes.ExitTerminal
+	}
+	return exitcodes.ExitSuccess
+}
+
+// newACSSession creates the session with ECS's Agent Communication service
+func (agent *ecsAgent) newACSSession(
 	credentialsManager credentials.Manager,
 	taskEngine engine.TaskEngine,
 	stateManager statemanager.StateManager,
 	deregisterInstanceEventStream *eventstream.EventStream,
 	client api.ECSClient,
-	taskHandler *eventhandler.TaskHandler) int {
+	taskHandler *eventhandler.TaskHandler) acshandler.Session {
 
-	acsSession := acshandler.NewSession(
+	return acshandler.NewSession(
 		agent.ctx,
 		agent.cfg,
 		deregisterInstanceEventStream,
@@ -428,7 +606,14 @@ func (agent *ecsAgent) startACSSession(
 		taskEngine,
 		credentialsManager,
 		taskHandler,
+		agent.payloadLog,
+		agent.connections.Register("ACS"),
 	)
+}
+
+// startACSSession starts a session with ECS's Agent Communication service. This
+// is a blocking call and only returns when the handler returns
+func (agent *ecsAgent) startACSSession(acsSession acshandler.Session) int {
 	log.Info("Beginning Polling for updates")
 	err := acsSession.Start()
 	if err != nil {
@@ -0,0 +1,169 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package cgroup detects the cgroup hierarchy in use on the host and reads
+// resource accounting files that differ between cgroup v1 and cgroup v2.
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version identifies the cgroup hierarchy mounted on the host.
+type Version int
+
+const (
+	// VersionUnknown is returned when the hierarchy could not be determined,
+	// for example on platforms without cgroups.
+	VersionUnknown Version = iota
+	// V1 is the legacy hierarchy with one mount per controller.
+	V1
+	// V2 is the unified hierarchy mounted at a single location.
+	V2
+)
+
+func (v Version) String() string {
+	switch v {
+	case V1:
+		return "v1"
+	case V2:
+		return "v2"
+	}
+	return "unknown"
+}
+
+// Info describes the cgroup hierarchy and controllers available on the host.
+type Info struct {
+	Version     Version
+	Controllers []string
+}
+
+// Unified returns true if the host runs the cgroup v2 unified hierarchy.
+func (info Info) Unified() bool {
+	return info.Version == V2
+}
+
+// CPUStat holds the fields of a cgroup v2 cpu.stat file that the agent
+// uses for accounting. All values are in microseconds.
+type CPUStat struct {
+	UsageUsec  uint64
+	UserUsec   uint64
+	SystemUsec uint64
+}
+
+// UsageNanos returns the total cpu time consumed in nanoseconds, which is
+// the unit cgroup v1 reports in cpuacct.usage.
+func (stat CPUStat) UsageNanos() uint64 {
+	return stat.UsageUsec * 1000
+}
+
+// ParseCPUStat parses the flat keyed contents of a cgroup v2 cpu.stat file.
+func ParseCPUStat(r io.Reader) (CPUStat, error) {
+	stat := CPUStat{}
+	found := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return stat, fmt.Errorf("cgroup: unable to parse cpu.stat field %s: %v", fields[0], err)
+		}
+		switch fields[0] {
+		case "usage_usec":
+			stat.UsageUsec = value
+			found = true
+		case "user_usec":
+			stat.UserUsec = value
+		case "system_usec":
+			stat.SystemUsec = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stat, err
+	}
+	if !found {
+		return stat, fmt.Errorf("cgroup: usage_usec not found in cpu.stat")
+	}
+	return stat, nil
+}
+
+// parseControllers parses the space separated list of controllers found in
+// a cgroup v2 cgroup.controllers file.
+func parseControllers(data string) []string {
+	controllers := strings.Fields(data)
+	sort.Strings(controllers)
+	return controllers
+}
+
+// parseProcCgroups parses /proc/cgroups and returns the enabled cgroup v1
+// controllers.
+func parseProcCgroups(r io.Reader) ([]string, error) {
+	var controllers []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		// subsys_name hierarchy num_cgroups enabled
+		if len(fields) != 4 {
+			continue
+		}
+		if fields[3] == "1" {
+			controllers = append(controllers, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(controllers)
+	return controllers, nil
+}
+
+// parseCPUList returns the number of cpus in a cpuset list such as
+// "0-3,8,10-11".
+func parseCPUList(data string) (int, error) {
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return 0, nil
+	}
+	count := 0
+	for _, part := range strings.Split(data, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return 0, fmt.Errorf("cgroup: invalid cpu list %q: %v", data, err)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return 0, fmt.Errorf("cgroup: invalid cpu list %q: %v", data, err)
+			}
+		}
+		if end < start {
+			return 0, fmt.Errorf("cgroup: invalid cpu range %q", part)
+		}
+		count += end - start + 1
+	}
+	return count, nil
+}
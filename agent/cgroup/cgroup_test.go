@@ -0,0 +1,80 @@
+// +build !integration
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cgroup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUStat(t *testing.T) {
+	stat, err := ParseCPUStat(strings.NewReader(`usage_usec 2500
+user_usec 2000
+system_usec 500
+nr_periods 0
+nr_throttled 0
+throttled_usec 0
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2500), stat.UsageUsec)
+	assert.Equal(t, uint64(2000), stat.UserUsec)
+	assert.Equal(t, uint64(500), stat.SystemUsec)
+	assert.Equal(t, uint64(2500000), stat.UsageNanos())
+}
+
+func TestParseCPUStatMissingUsage(t *testing.T) {
+	_, err := ParseCPUStat(strings.NewReader("user_usec 2000\n"))
+	assert.Error(t, err)
+}
+
+func TestParseCPUStatInvalidValue(t *testing.T) {
+	_, err := ParseCPUStat(strings.NewReader("usage_usec abc\n"))
+	assert.Error(t, err)
+}
+
+func TestParseProcCgroups(t *testing.T) {
+	controllers, err := parseProcCgroups(strings.NewReader(`#subsys_name	hierarchy	num_cgroups	enabled
+cpuset	3	1	1
+memory	4	10	1
+cpu	1	1	1
+rdma	0	1	0
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu", "cpuset", "memory"}, controllers)
+}
+
+func TestParseCPUList(t *testing.T) {
+	testCases := []struct {
+		list  string
+		count int
+	}{
+		{"", 0},
+		{"0", 1},
+		{"0-3", 4},
+		{"0-3,8,10-11\n", 7},
+	}
+	for _, tc := range testCases {
+		count, err := parseCPUList(tc.list)
+		assert.NoError(t, err, tc.list)
+		assert.Equal(t, tc.count, count, tc.list)
+	}
+
+	_, err := parseCPUList("3-1")
+	assert.Error(t, err)
+	_, err = parseCPUList("a-b")
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+// +build !windows
+
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cihub/seelog"
+)
+
+// These are variables so that tests can point them at a fake hierarchy.
+var (
+	// cgroupRoot is where the cgroup filesystem is mounted.
+	cgroupRoot = "/sys/fs/cgroup"
+	// procCgroups lists the cgroup v1 controllers known to the kernel.
+	procCgroups = "/proc/cgroups"
+)
+
+var (
+	detectOnce sync.Once
+	detected   Info
+)
+
+// Detect returns the cgroup hierarchy of the host. The result is computed
+// once and cached, since the hierarchy cannot change while the agent runs.
+func Detect() Info {
+	detectOnce.Do(func() {
+		detected = detect()
+		seelog.Infof("Detected cgroup %s hierarchy, controllers: %v", detected.Version, detected.Controllers)
+	})
+	return detected
+}
+
+func detect() Info {
+	// cgroup.controllers only exists at the root of a unified hierarchy. On
+	// hybrid hosts it exists under the "unified" mount instead, where no
+	// controllers are usually delegated, and v1 semantics still apply.
+	data, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err == nil {
+		return Info{Version: V2, Controllers: parseControllers(string(data))}
+	}
+
+	file, err := os.Open(procCgroups)
+	if err != nil {
+		seelog.Debugf("Unable to determine cgroup hierarchy: %v", err)
+		return Info{Version: VersionUnknown}
+	}
+	defer file.Close()
+	controllers, err := parseProcCgroups(file)
+	if err != nil {
+		seelog.Warnf("Unable to parse %s: %v", procCgroups, err)
+	}
+	return Info{Version: V1, Controllers: controllers}
+}
+
+// EffectiveCPUs returns the number of cpus available to cgroups under the
+// root of a unified hierarchy, as reported by cpuset.cpus.effective.
+func EffectiveCPUs() (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cpuset.cpus.effective"))
+	if err != nil {
+		return 0, err
+	}
+	return parseCPUList(string(data))
+}
+
+// ContainerCPUStat reads cpu.stat for a docker container on a unified
+// hierarchy. Both the systemd and the cgroupfs cgroup drivers are supported.
+func ContainerCPUStat(dockerID string) (CPUStat, error) {
+	candidates := []string{
+		filepath.Join(cgroupRoot, "system.slice", "docker-"+dockerID+".scope", "cpu.stat"),
+		filepath.Join(cgroupRoot, "docker", dockerID, "cpu.stat"),
+	}
+	for _, path := range candidates {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		stat, err := ParseCPUStat(file)
+		file.Close()
+		return stat, err
+	}
+	return CPUStat{}, fmt.Errorf("cgroup: cpu.stat not found for container %s", dockerID)
+}
@@ -0,0 +1,97 @@
+// +build !windows,!integration
+
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeHierarchy(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "cgroup-test")
+	require.NoError(t, err)
+	origRoot, origProc := cgroupRoot, procCgroups
+	cgroupRoot = dir
+	procCgroups = filepath.Join(dir, "proc-cgroups")
+	return dir, func() {
+		cgroupRoot, procCgroups = origRoot, origProc
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDetectUnified(t *testing.T) {
+	dir, cleanup := fakeHierarchy(t)
+	defer cleanup()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("memory cpuset cpu io pids\n"), 0644)
+	require.NoError(t, err)
+
+	info := detect()
+	assert.Equal(t, V2, info.Version)
+	assert.True(t, info.Unified())
+	assert.Equal(t, []string{"cpu", "cpuset", "io", "memory", "pids"}, info.Controllers)
+}
+
+func TestDetectLegacy(t *testing.T) {
+	dir, cleanup := fakeHierarchy(t)
+	defer cleanup()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "proc-cgroups"), []byte("#subsys_name\thierarchy\tnum_cgroups\tenabled\nmemory\t4\t10\t1\n"), 0644)
+	require.NoError(t, err)
+
+	info := detect()
+	assert.Equal(t, V1, info.Version)
+	assert.False(t, info.Unified())
+	assert.Equal(t, []string{"memory"}, info.Controllers)
+}
+
+func TestDetectUnknown(t *testing.T) {
+	_, cleanup := fakeHierarchy(t)
+	defer cleanup()
+
+	assert.Equal(t, VersionUnknown, detect().Version)
+}
+
+func TestContainerCPUStat(t *testing.T) {
+	dir, cleanup := fakeHierarchy(t)
+	defer cleanup()
+
+	_, err := ContainerCPUStat("abc")
+	assert.Error(t, err)
+
+	scope := filepath.Join(dir, "system.slice", "docker-abc.scope")
+	require.NoError(t, os.MkdirAll(scope, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(scope, "cpu.stat"), []byte("usage_usec 42\n"), 0644))
+
+	stat, err := ContainerCPUStat("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), stat.UsageUsec)
+}
+
+func TestEffectiveCPUs(t *testing.T) {
+	dir, cleanup := fakeHierarchy(t)
+	defer cleanup()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpuset.cpus.effective"), []byte("0-1,4\n"), 0644))
+	cpus, err := EffectiveCPUs()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cpus)
+}
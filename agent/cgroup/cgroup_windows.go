@@ -0,0 +1,35 @@
+// +build windows
+
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cgroup
+
+import "errors"
+
+var errUnsupported = errors.New("cgroup: not supported on windows")
+
+// Detect always returns VersionUnknown on windows.
+func Detect() Info {
+	return Info{Version: VersionUnknown}
+}
+
+// EffectiveCPUs is not supported on windows.
+func EffectiveCPUs() (int, error) {
+	return 0, errUnsupported
+}
+
+// ContainerCPUStat is not supported on windows.
+func ContainerCPUStat(dockerID string) (CPUStat, error) {
+	return CPUStat{}, errUnsupported
+}
@@ -19,8 +19,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -54,6 +57,35 @@ const (
 	// DefaultDockerStopTimeout specifies the value for container stop timeout duration
 	DefaultDockerStopTimeout = 30 * time.Second
 
+	// DefaultShutdownDrainTimeout specifies the default time given to the agent
+	// on termination to deliver its pending work
+	DefaultShutdownDrainTimeout = 15 * time.Second
+
+	// shutdownDrainTimeoutDisabled stands for a shutdown drain timeout that is
+	// explicitly 0 until the config sources are merged, as merging replaces
+	// zero values with the defaults
+	shutdownDrainTimeoutDisabled = -1
+
+	// DefaultCredentialsRefreshMargin specifies the default time before the
+	// credentials of a task expire by which they are expected to be refreshed
+	DefaultCredentialsRefreshMargin = 15 * time.Minute
+
+	// AuditLogFormatText is the format of the audit log entries made of
+	// space separated fields
+	AuditLogFormatText = "text"
+
+	// AuditLogFormatJSON is the format of the audit log entries made of one
+	// json object per line
+	AuditLogFormatJSON = "json"
+
+	// DefaultCredentialsAuditLogMaxAge specifies the default time the rotated
+	// credentials audit logs are kept for
+	DefaultCredentialsAuditLogMaxAge = 24 * time.Hour
+
+	// DefaultCredentialsAuditLogMaxRolls specifies the default number of
+	// credentials audit logs kept when they are rotated by size
+	DefaultCredentialsAuditLogMaxRolls = 24
+
 	// DefaultImageCleanupTimeInterval specifies the default value for image cleanup duration. It is used to
 	// remove the images pulled by agent.
 	DefaultImageCleanupTimeInterval = 30 * time.Minute
@@ -131,6 +163,11 @@ func (cfg *Config) checkMissingAndDepreciated() error {
 			case "warn":
 				seelog.Warnf("Configuration key not set, key: %v", cfgStructField.Field(i).Name)
 			case "fatal":
+				if cfg.Standalone() {
+					// Required fields are only needed to reach the backend
+					seelog.Warnf("Configuration key not set, key: %v", cfgStructField.Field(i).Name)
+					continue
+				}
 				seelog.Criticalf("Configuration key not set, key: %v", cfgStructField.Field(i).Name)
 				fatalFields = append(fatalFields, cfgStructField.Field(i).Name)
 			default:
@@ -203,6 +240,19 @@ func fileConfig() (Config, error) {
 	if utils.ZeroOrNil(config.Cluster) && !utils.ZeroOrNil(config.ClusterArn) {
 		config.Cluster = config.ClusterArn
 	}
+
+	// An explicit 0 turns draining off, a missing key keeps the default
+	if config.ShutdownDrainTimeout < 0 {
+		seelog.Warnf("Discarded invalid value for shutdown drain timeout, parsed as: %v", config.ShutdownDrainTimeout)
+		config.ShutdownDrainTimeout = 0
+	} else if config.ShutdownDrainTimeout == 0 {
+		var shutdownDrain struct {
+			ShutdownDrainTimeout *time.Duration
+		}
+		if json.Unmarshal(data, &shutdownDrain) == nil && shutdownDrain.ShutdownDrainTimeout != nil {
+			config.ShutdownDrainTimeout = shutdownDrainTimeoutDisabled
+		}
+	}
 	return config, nil
 }
 
@@ -271,6 +321,25 @@ func environmentConfig() (Config, error) {
 	}
 
 	taskCleanupWaitDuration := parseEnvVariableDuration("ECS_ENGINE_TASK_CLEANUP_WAIT_DURATION")
+
+	shutdownDrainTimeout := parseEnvVariableDuration("ECS_SHUTDOWN_DRAIN_TIMEOUT")
+	if shutdownDrainTimeout < 0 {
+		seelog.Warnf("Discarded invalid value for shutdown drain timeout, parsed as: %v", shutdownDrainTimeout)
+		shutdownDrainTimeout = 0
+	} else if shutdownDrainTimeout == 0 {
+		// An explicit 0 turns draining off, an empty or unparseable value
+		// keeps the default
+		if _, err := time.ParseDuration(strings.TrimSpace(os.Getenv("ECS_SHUTDOWN_DRAIN_TIMEOUT"))); err == nil {
+			shutdownDrainTimeout = shutdownDrainTimeoutDisabled
+		}
+	}
+
+	credentialsRefreshMargin := parseEnvVariableDuration("ECS_CREDENTIALS_REFRESH_MARGIN")
+	if credentialsRefreshMargin < 0 {
+		seelog.Warnf("Discarded invalid value for credentials refresh margin, parsed as: %v", credentialsRefreshMargin)
+		credentialsRefreshMargin = 0
+	}
+
 	availableLoggingDriversEnv := os.Getenv("ECS_AVAILABLE_LOGGING_DRIVERS")
 	loggingDriverDecoder := json.NewDecoder(strings.NewReader(availableLoggingDriversEnv))
 	var availableLoggingDrivers []dockerclient.LoggingDriver
@@ -288,9 +357,72 @@ func environmentConfig() (Config, error) {
 	appArmorCapable := utils.ParseBool(os.Getenv("ECS_APPARMOR_CAPABLE"), false)
 	taskIAMRoleEnabled := utils.ParseBool(os.Getenv("ECS_ENABLE_TASK_IAM_ROLE"), false)
 	taskIAMRoleEnabledForNetworkHost := utils.ParseBool(os.Getenv("ECS_ENABLE_TASK_IAM_ROLE_NETWORK_HOST"), false)
+	credentialsRequestBindingEnabled := utils.ParseBool(os.Getenv("ECS_ENABLE_CREDENTIALS_REQUEST_BINDING"), false)
 
 	credentialsAuditLogFile := os.Getenv("ECS_AUDIT_LOGFILE")
 	credentialsAuditLogDisabled := utils.ParseBool(os.Getenv("ECS_AUDIT_LOGFILE_DISABLED"), false)
+	credentialsAuditLogFormat := os.Getenv("ECS_AUDIT_LOG_FORMAT")
+	credentialsAuditLogMaxSizeMB, err := strconv.Atoi(os.Getenv("ECS_AUDIT_LOG_MAX_SIZE_MB"))
+	if os.Getenv("ECS_AUDIT_LOG_MAX_SIZE_MB") != "" && (err != nil || credentialsAuditLogMaxSizeMB < 0) {
+		seelog.Warnf("Invalid format for \"ECS_AUDIT_LOG_MAX_SIZE_MB\", expected a positive integer. err %v", err)
+		credentialsAuditLogMaxSizeMB = 0
+	}
+	credentialsAuditLogMaxAge := parseEnvVariableDuration("ECS_AUDIT_LOG_MAX_AGE")
+	credentialsAuditLogMaxRolls, err := strconv.Atoi(os.Getenv("ECS_AUDIT_LOG_MAX_ROLLS"))
+	if os.Getenv("ECS_AUDIT_LOG_MAX_ROLLS") != "" && (err != nil || credentialsAuditLogMaxRolls < 0) {
+		seelog.Warnf("Invalid format for \"ECS_AUDIT_LOG_MAX_ROLLS\", expected a positive integer. err %v", err)
+		credentialsAuditLogMaxRolls = 0
+	}
+	credentialsAuditLogSyslog := os.Getenv("ECS_AUDIT_LOG_SYSLOG_ADDRESS")
+
+	taskAccountingEnabled := utils.ParseBool(os.Getenv("ECS_ENABLE_TASK_ACCOUNTING"), false)
+	taskAccountingLogFile := os.Getenv("ECS_TASK_ACCOUNTING_LOGFILE")
+
+	var stateChangeWebhooks []string
+	err = json.NewDecoder(strings.NewReader(os.Getenv("ECS_STATE_CHANGE_WEBHOOKS"))).Decode(&stateChangeWebhooks)
+	if err != io.EOF && err != nil {
+		err := fmt.Errorf("Invalid format for \"ECS_STATE_CHANGE_WEBHOOKS\" environment variable; expected a JSON array like [\"http://localhost:8080/events\"]. err %v", err)
+		seelog.Warn(err)
+	}
+
+	var imagePullRewriteRules []ImagePullRewriteRule
+	err = json.NewDecoder(strings.NewReader(os.Getenv("ECS_IMAGE_PULL_REWRITE_RULES"))).Decode(&imagePullRewriteRules)
+	if err != io.EOF && err != nil {
+		err := fmt.Errorf("Invalid format for \"ECS_IMAGE_PULL_REWRITE_RULES\" environment variable; expected a JSON array like [{\"match\":\"docker.io/library/*\",\"replace\":\"mirror.example.com/library/*\"}]. err %v", err)
+		seelog.Warn(err)
+	}
+
+	imageDigestPinningEnabled := utils.ParseBool(os.Getenv("ECS_ENABLE_IMAGE_DIGEST_PINNING"), false)
+
+	var imageAdmissionPolicy *ImageAdmissionPolicy
+	err = json.NewDecoder(strings.NewReader(os.Getenv("ECS_IMAGE_ADMISSION_POLICY"))).Decode(&imageAdmissionPolicy)
+	if err != io.EOF && err != nil {
+		err := fmt.Errorf("Invalid format for \"ECS_IMAGE_ADMISSION_POLICY\" environment variable; expected a JSON object like {\"allowed\":[\"*.dkr.ecr.*.amazonaws.com\"],\"denyLatestTag\":true}. err %v", err)
+		seelog.Warn(err)
+	}
+
+	localControlEnabled := utils.ParseBool(os.Getenv("ECS_ENABLE_LOCAL_CONTROL"), false)
+	localControlEndpoint := os.Getenv("ECS_LOCAL_CONTROL_ENDPOINT")
+	localControlToken := os.Getenv("ECS_LOCAL_CONTROL_TOKEN")
+
+	standaloneManifestDir := os.Getenv("ECS_STANDALONE_MANIFEST_DIR")
+	standaloneStateChangeLogFile := os.Getenv("ECS_STANDALONE_STATE_CHANGE_LOGFILE")
+
+	proxyURL := os.Getenv("ECS_PROXY_URL")
+	proxyUsername := os.Getenv("ECS_PROXY_USERNAME")
+	proxyPassword := os.Getenv("ECS_PROXY_PASSWORD")
+	proxyCABundle := os.Getenv("ECS_PROXY_CA_BUNDLE")
+	// Format: comma separated list, as in the NO_PROXY environment variable
+	var noProxy []string
+	for _, host := range strings.Split(os.Getenv("ECS_NO_PROXY"), ",") {
+		host = strings.TrimSpace(host)
+		if host != "" {
+			noProxy = append(noProxy, host)
+		}
+	}
+
+	acsEndpointOverride := os.Getenv("ECS_ACS_ENDPOINT_OVERRIDE")
+	tcsEndpointOverride := os.Getenv("ECS_TCS_ENDPOINT_OVERRIDE")
 
 	imageCleanupDisabled := utils.ParseBool(os.Getenv("ECS_DISABLE_IMAGE_CLEANUP"), false)
 	minimumImageDeletionAge := parseEnvVariableDuration("ECS_IMAGE_MINIMUM_CLEANUP_AGE")
@@ -344,11 +476,37 @@ func environmentConfig() (Config, error) {
 		DockerStopTimeout:                dockerStopTimeout,
 		CredentialsAuditLogFile:          credentialsAuditLogFile,
 		CredentialsAuditLogDisabled:      credentialsAuditLogDisabled,
+		CredentialsAuditLogFormat:        credentialsAuditLogFormat,
+		CredentialsAuditLogMaxSizeMB:     credentialsAuditLogMaxSizeMB,
+		CredentialsAuditLogMaxAge:        credentialsAuditLogMaxAge,
+		CredentialsAuditLogMaxRolls:      credentialsAuditLogMaxRolls,
+		CredentialsAuditLogSyslog:        credentialsAuditLogSyslog,
 		TaskIAMRoleEnabledForNetworkHost: taskIAMRoleEnabledForNetworkHost,
+		CredentialsRequestBindingEnabled: credentialsRequestBindingEnabled,
 		ImageCleanupDisabled:             imageCleanupDisabled,
 		MinimumImageDeletionAge:          minimumImageDeletionAge,
 		ImageCleanupInterval:             imageCleanupInterval,
 		NumImagesToDeletePerCycle:        numImagesToDeletePerCycle,
+		TaskAccountingEnabled:            taskAccountingEnabled,
+		TaskAccountingLogFile:            taskAccountingLogFile,
+		StateChangeWebhooks:              stateChangeWebhooks,
+		LocalControlEnabled:              localControlEnabled,
+		LocalControlEndpoint:             localControlEndpoint,
+		LocalControlToken:                localControlToken,
+		StandaloneManifestDir:            standaloneManifestDir,
+		StandaloneStateChangeLogFile:     standaloneStateChangeLogFile,
+		ProxyURL:                         proxyURL,
+		ProxyUsername:                    proxyUsername,
+		ProxyPassword:                    proxyPassword,
+		ProxyCABundle:                    proxyCABundle,
+		NoProxy:                          noProxy,
+		ShutdownDrainTimeout:             shutdownDrainTimeout,
+		CredentialsRefreshMargin:         credentialsRefreshMargin,
+		ACSEndpointOverride:              acsEndpointOverride,
+		TCSEndpointOverride:              tcsEndpointOverride,
+		ImagePullRewriteRules:            imagePullRewriteRules,
+		ImageDigestPinningEnabled:        imageDigestPinningEnabled,
+		ImageAdmissionPolicy:             imageAdmissionPolicy,
 		InstanceAttributes:               instanceAttributes,
 	}, err
 }
@@ -429,7 +587,7 @@ func NewConfig(ec2client ec2.EC2MetadataClient) (config *Config, err error) {
 	}
 	config.Merge(fcfg)
 
-	if config.AWSRegion == "" {
+	if config.AWSRegion == "" && !config.Standalone() {
 		// Get it from metadata only if we need to (network io)
 		config.Merge(ec2MetadataConfig(ec2client))
 	}
@@ -459,6 +617,34 @@ func (config *Config) validateAndOverrideBounds() error {
 		return errors.New("Invalid logging drivers: " + strings.Join(badDrivers, ", "))
 	}
 
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil || proxyURL.Scheme != "http" || proxyURL.Host == "" {
+			return fmt.Errorf("Invalid proxy url %q; expected an http url like http://proxy.example.com:3128", config.ProxyURL)
+		}
+	}
+
+	if config.CredentialsAuditLogFormat != AuditLogFormatText && config.CredentialsAuditLogFormat != AuditLogFormatJSON {
+		return fmt.Errorf("Invalid audit log format %q; expected %q or %q",
+			config.CredentialsAuditLogFormat, AuditLogFormatText, AuditLogFormatJSON)
+	}
+	if config.CredentialsAuditLogSyslog != "" {
+		syslogURL, err := url.Parse(config.CredentialsAuditLogSyslog)
+		if err != nil || (syslogURL.Scheme != "udp" && syslogURL.Scheme != "tcp") || syslogURL.Host == "" {
+			return fmt.Errorf("Invalid audit log syslog address %q; expected an address like udp://localhost:514",
+				config.CredentialsAuditLogSyslog)
+		}
+	}
+
+	for _, rule := range config.ImagePullRewriteRules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	if err := config.ImageAdmissionPolicy.validate(); err != nil {
+		return err
+	}
+
 	// If a value has been set for taskCleanupWaitDuration and the value is less than the minimum allowed cleanup duration,
 	// print a warning and override it
 	if config.TaskCleanupWaitDuration < minimumTaskCleanupWaitDuration {
@@ -471,6 +657,13 @@ func (config *Config) validateAndOverrideBounds() error {
 		config.ImageCleanupInterval = DefaultImageCleanupTimeInterval
 	}
 
+	// The shutdown drain timeout is only known to be explicitly 0 once the
+	// config sources are merged
+	if config.ShutdownDrainTimeout == shutdownDrainTimeoutDisabled {
+		config.ShutdownDrainTimeout = 0
+		config.ShutdownDrainDisabled = true
+	}
+
 	if config.NumImagesToDeletePerCycle < minimumNumImagesToDeletePerCycle {
 		seelog.Warnf("Invalid value for number of images to delete for image cleanup, will be overriden with the default value: %d. Parsed value: %d, minimum value: %d.", DefaultImageDeletionAge, config.NumImagesToDeletePerCycle, minimumNumImagesToDeletePerCycle)
 		config.NumImagesToDeletePerCycle = DefaultNumImagesToDeletePerCycle
@@ -481,6 +674,39 @@ func (config *Config) validateAndOverrideBounds() error {
 	return nil
 }
 
+func (rule ImagePullRewriteRule) validate() error {
+	if (rule.Match == "") == (rule.Regex == "") {
+		return fmt.Errorf("Invalid image pull rewrite rule %+v; exactly one of match and regex must be set", rule)
+	}
+	if rule.Replace == "" {
+		return fmt.Errorf("Invalid image pull rewrite rule %+v; replace must be set", rule)
+	}
+	if rule.Regex != "" {
+		if _, err := regexp.Compile(rule.Regex); err != nil {
+			return fmt.Errorf("Invalid regex in image pull rewrite rule %+v: %v", rule, err)
+		}
+	}
+	return nil
+}
+
+func (policy *ImageAdmissionPolicy) validate() error {
+	if policy == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, policy.Allowed...), policy.Denied...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid pattern %q in image admission policy: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Standalone returns true if the agent runs the tasks from local manifests
+// instead of the ECS backend.
+func (config *Config) Standalone() bool {
+	return config.StandaloneManifestDir != ""
+}
+
 // String returns a lossy string representation of the config suitable for human readable display.
 // Consequently, it *should not* return any sensitive information.
 func (config *Config) String() string {
@@ -27,6 +27,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMerge(t *testing.T) {
@@ -355,6 +356,196 @@ func TestCredentialsAuditLogDisabled(t *testing.T) {
 	}
 }
 
+func TestTaskAccounting(t *testing.T) {
+	dummyLocation := "/foo/accounting.log"
+	os.Setenv("ECS_ENABLE_TASK_ACCOUNTING", "true")
+	os.Setenv("ECS_TASK_ACCOUNTING_LOGFILE", dummyLocation)
+	defer os.Unsetenv("ECS_ENABLE_TASK_ACCOUNTING")
+	defer os.Unsetenv("ECS_TASK_ACCOUNTING_LOGFILE")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, cfg.TaskAccountingEnabled, "TaskAccountingEnabled not set")
+	assert.Equal(t, dummyLocation, cfg.TaskAccountingLogFile, "Wrong value for TaskAccountingLogFile")
+}
+
+func TestStateChangeWebhooks(t *testing.T) {
+	os.Setenv("ECS_STATE_CHANGE_WEBHOOKS", `["http://localhost:8080/events","unix:///var/run/app.sock?path=/events"]`)
+	defer os.Unsetenv("ECS_STATE_CHANGE_WEBHOOKS")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"http://localhost:8080/events", "unix:///var/run/app.sock?path=/events"}, cfg.StateChangeWebhooks)
+}
+
+func TestInvalidFormatStateChangeWebhooks(t *testing.T) {
+	os.Setenv("ECS_STATE_CHANGE_WEBHOOKS", `["malformed]`)
+	defer os.Unsetenv("ECS_STATE_CHANGE_WEBHOOKS")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, cfg.StateChangeWebhooks)
+}
+
+func TestLocalControl(t *testing.T) {
+	os.Setenv("ECS_ENABLE_LOCAL_CONTROL", "true")
+	os.Setenv("ECS_LOCAL_CONTROL_ENDPOINT", "tcp://127.0.0.1:9000")
+	os.Setenv("ECS_LOCAL_CONTROL_TOKEN", "secret")
+	defer os.Unsetenv("ECS_ENABLE_LOCAL_CONTROL")
+	defer os.Unsetenv("ECS_LOCAL_CONTROL_ENDPOINT")
+	defer os.Unsetenv("ECS_LOCAL_CONTROL_TOKEN")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, cfg.LocalControlEnabled, "LocalControlEnabled not set")
+	assert.Equal(t, "tcp://127.0.0.1:9000", cfg.LocalControlEndpoint)
+	assert.Equal(t, "secret", cfg.LocalControlToken)
+}
+
+func TestEndpointOverrides(t *testing.T) {
+	os.Setenv("ECS_ACS_ENDPOINT_OVERRIDE", " https://localhost:8443 ")
+	os.Setenv("ECS_TCS_ENDPOINT_OVERRIDE", "https://localhost:8444")
+	defer os.Unsetenv("ECS_ACS_ENDPOINT_OVERRIDE")
+	defer os.Unsetenv("ECS_TCS_ENDPOINT_OVERRIDE")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "https://localhost:8443", cfg.ACSEndpointOverride)
+	assert.Equal(t, "https://localhost:8444", cfg.TCSEndpointOverride)
+}
+
+func TestProxyConfig(t *testing.T) {
+	os.Setenv("ECS_PROXY_URL", " http://proxy.example.com:3128 ")
+	os.Setenv("ECS_PROXY_USERNAME", "user")
+	os.Setenv("ECS_PROXY_PASSWORD", "password")
+	os.Setenv("ECS_PROXY_CA_BUNDLE", "/etc/ecs/proxy-ca.pem")
+	os.Setenv("ECS_NO_PROXY", "internal.example.com, 10.0.0.0/8,,")
+	defer os.Unsetenv("ECS_PROXY_URL")
+	defer os.Unsetenv("ECS_PROXY_USERNAME")
+	defer os.Unsetenv("ECS_PROXY_PASSWORD")
+	defer os.Unsetenv("ECS_PROXY_CA_BUNDLE")
+	defer os.Unsetenv("ECS_NO_PROXY")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "http://proxy.example.com:3128", cfg.ProxyURL)
+	assert.Equal(t, "user", cfg.ProxyUsername)
+	assert.Equal(t, "password", cfg.ProxyPassword)
+	assert.Equal(t, "/etc/ecs/proxy-ca.pem", cfg.ProxyCABundle)
+	assert.Equal(t, []string{"internal.example.com", "10.0.0.0/8"}, cfg.NoProxy)
+}
+
+func TestInvalidProxyURL(t *testing.T) {
+	for _, proxyURL := range []string{"https://proxy.example.com", "proxy.example.com:3128", "http://"} {
+		os.Setenv("ECS_PROXY_URL", proxyURL)
+		_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+		assert.Error(t, err, "Expected an error for proxy url %s", proxyURL)
+	}
+	os.Unsetenv("ECS_PROXY_URL")
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	os.Setenv("ECS_SHUTDOWN_DRAIN_TIMEOUT", "1m")
+	defer os.Unsetenv("ECS_SHUTDOWN_DRAIN_TIMEOUT")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.ShutdownDrainTimeout)
+
+	// An invalid value falls back to the default
+	os.Setenv("ECS_SHUTDOWN_DRAIN_TIMEOUT", "-1s")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultShutdownDrainTimeout, cfg.ShutdownDrainTimeout)
+	assert.False(t, cfg.ShutdownDrainDisabled)
+
+	// 0 turns draining off
+	os.Setenv("ECS_SHUTDOWN_DRAIN_TIMEOUT", "0")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.ShutdownDrainDisabled)
+	assert.Zero(t, cfg.ShutdownDrainTimeout)
+}
+
+func TestCredentialsAuditLogSettings(t *testing.T) {
+	os.Setenv("ECS_AUDIT_LOG_FORMAT", "json")
+	defer os.Unsetenv("ECS_AUDIT_LOG_FORMAT")
+	os.Setenv("ECS_AUDIT_LOG_MAX_SIZE_MB", "50")
+	defer os.Unsetenv("ECS_AUDIT_LOG_MAX_SIZE_MB")
+	os.Setenv("ECS_AUDIT_LOG_MAX_ROLLS", "5")
+	defer os.Unsetenv("ECS_AUDIT_LOG_MAX_ROLLS")
+	os.Setenv("ECS_AUDIT_LOG_SYSLOG_ADDRESS", "tcp://localhost:514")
+	defer os.Unsetenv("ECS_AUDIT_LOG_SYSLOG_ADDRESS")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	assert.Equal(t, AuditLogFormatJSON, cfg.CredentialsAuditLogFormat)
+	assert.Equal(t, 50, cfg.CredentialsAuditLogMaxSizeMB)
+	assert.Equal(t, 5, cfg.CredentialsAuditLogMaxRolls)
+	assert.Equal(t, DefaultCredentialsAuditLogMaxAge, cfg.CredentialsAuditLogMaxAge)
+	assert.Equal(t, "tcp://localhost:514", cfg.CredentialsAuditLogSyslog)
+}
+
+func TestInvalidCredentialsAuditLogSettings(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CredentialsAuditLogFormat = "xml"
+	assert.Error(t, conf.validateAndOverrideBounds())
+
+	conf = DefaultConfig()
+	conf.CredentialsAuditLogSyslog = "localhost:514"
+	assert.Error(t, conf.validateAndOverrideBounds())
+}
+
+func TestCredentialsRequestBindingEnabled(t *testing.T) {
+	os.Setenv("ECS_ENABLE_CREDENTIALS_REQUEST_BINDING", "true")
+	defer os.Unsetenv("ECS_ENABLE_CREDENTIALS_REQUEST_BINDING")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.CredentialsRequestBindingEnabled)
+}
+
+func TestCredentialsRefreshMargin(t *testing.T) {
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCredentialsRefreshMargin, cfg.CredentialsRefreshMargin)
+
+	os.Setenv("ECS_CREDENTIALS_REFRESH_MARGIN", "30m")
+	defer os.Unsetenv("ECS_CREDENTIALS_REFRESH_MARGIN")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, cfg.CredentialsRefreshMargin)
+}
+
+func TestStandaloneWithoutRegion(t *testing.T) {
+	region, regionSet := os.LookupEnv("AWS_DEFAULT_REGION")
+	os.Unsetenv("AWS_DEFAULT_REGION")
+	if regionSet {
+		defer os.Setenv("AWS_DEFAULT_REGION", region)
+	}
+	os.Setenv("ECS_STANDALONE_MANIFEST_DIR", "/etc/ecs/tasks")
+	os.Setenv("ECS_STANDALONE_STATE_CHANGE_LOGFILE", "/foo/state-changes.log")
+	defer os.Unsetenv("ECS_STANDALONE_MANIFEST_DIR")
+	defer os.Unsetenv("ECS_STANDALONE_STATE_CHANGE_LOGFILE")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, cfg.Standalone(), "Expected standalone mode")
+	assert.Equal(t, "/etc/ecs/tasks", cfg.StandaloneManifestDir)
+	assert.Equal(t, "/foo/state-changes.log", cfg.StandaloneStateChangeLogFile)
+}
+
 func TestImageCleanupMinimumInterval(t *testing.T) {
 	os.Setenv("ECS_IMAGE_CLEANUP_INTERVAL", "1m")
 	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
@@ -378,3 +569,62 @@ func TestImageCleanupMinimumNumImagesToDeletePerCycle(t *testing.T) {
 		t.Errorf("Wrong value for NumImagesToDeletePerCycle: %v", cfg.NumImagesToDeletePerCycle)
 	}
 }
+
+func TestImagePullRewriteRules(t *testing.T) {
+	os.Setenv("ECS_IMAGE_PULL_REWRITE_RULES", `[{"match":"docker.io/library/*","replace":"mirror.example.com/dockerhub/*"},{"regex":"^quay\\.io/(.*)","replace":"mirror.example.com/quay/$1"}]`)
+	defer os.Unsetenv("ECS_IMAGE_PULL_REWRITE_RULES")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ImagePullRewriteRule{
+		{Match: "docker.io/library/*", Replace: "mirror.example.com/dockerhub/*"},
+		{Regex: `^quay\.io/(.*)`, Replace: "mirror.example.com/quay/$1"},
+	}, cfg.ImagePullRewriteRules)
+}
+
+func TestInvalidImagePullRewriteRules(t *testing.T) {
+	testCases := []string{
+		`[{"replace":"mirror.example.com/*"}]`,
+		`[{"match":"docker.io/*","regex":"^docker\\.io/","replace":"mirror.example.com/*"}]`,
+		`[{"match":"docker.io/*"}]`,
+		`[{"regex":"(unclosed","replace":"mirror.example.com/"}]`,
+	}
+
+	for _, rules := range testCases {
+		t.Run(rules, func(t *testing.T) {
+			os.Setenv("ECS_IMAGE_PULL_REWRITE_RULES", rules)
+			defer os.Unsetenv("ECS_IMAGE_PULL_REWRITE_RULES")
+			_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestImageDigestPinningEnabled(t *testing.T) {
+	os.Setenv("ECS_ENABLE_IMAGE_DIGEST_PINNING", "true")
+	defer os.Unsetenv("ECS_ENABLE_IMAGE_DIGEST_PINNING")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.ImageDigestPinningEnabled)
+}
+
+func TestImageAdmissionPolicy(t *testing.T) {
+	os.Setenv("ECS_IMAGE_ADMISSION_POLICY", `{"allowed":["*.dkr.ecr.*.amazonaws.com"],"denied":["docker.io"],"requireDigest":true,"denyLatestTag":true}`)
+	defer os.Unsetenv("ECS_IMAGE_ADMISSION_POLICY")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	require.NotNil(t, cfg.ImageAdmissionPolicy)
+	assert.Equal(t, &ImageAdmissionPolicy{
+		Allowed:       []string{"*.dkr.ecr.*.amazonaws.com"},
+		Denied:        []string{"docker.io"},
+		RequireDigest: true,
+		DenyLatestTag: true,
+	}, cfg.ImageAdmissionPolicy)
+}
+
+func TestInvalidImageAdmissionPolicy(t *testing.T) {
+	os.Setenv("ECS_IMAGE_ADMISSION_POLICY", `{"denied":["docker.io/[library"]}`)
+	defer os.Unsetenv("ECS_IMAGE_ADMISSION_POLICY")
+	_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.Error(t, err)
+}
@@ -19,26 +19,42 @@ import "github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 const (
 	// defaultAuditLogFile specifies the default audit log filename
 	defaultCredentialsAuditLogFile = "/log/audit.log"
+	// defaultTaskAccountingLogFile specifies the default task accounting log filename
+	defaultTaskAccountingLogFile = "/log/task-accounting.log"
+	// defaultStandaloneStateChangeLogFile specifies the default filename of
+	// the state change log in standalone mode
+	defaultStandaloneStateChangeLogFile = "/log/state-changes.log"
+	// defaultLocalControlEndpoint specifies the default unix socket of the
+	// local control api
+	defaultLocalControlEndpoint = "unix:///var/run/ecs/control.sock"
 )
 
 // DefaultConfig returns the default configuration for Linux
 func DefaultConfig() Config {
 	return Config{
-		DockerEndpoint:              "unix:///var/run/docker.sock",
-		ReservedPorts:               []uint16{SSHPort, DockerReservedPort, DockerReservedSSLPort, AgentIntrospectionPort, AgentCredentialsPort},
-		ReservedPortsUDP:            []uint16{},
-		DataDir:                     "/data/",
-		DisableMetrics:              false,
-		ReservedMemory:              0,
-		AvailableLoggingDrivers:     []dockerclient.LoggingDriver{dockerclient.JSONFileDriver},
-		TaskCleanupWaitDuration:     DefaultTaskCleanupWaitDuration,
-		DockerStopTimeout:           DefaultDockerStopTimeout,
-		CredentialsAuditLogFile:     defaultCredentialsAuditLogFile,
-		CredentialsAuditLogDisabled: false,
-		ImageCleanupDisabled:        false,
-		MinimumImageDeletionAge:     DefaultImageDeletionAge,
-		ImageCleanupInterval:        DefaultImageCleanupTimeInterval,
-		NumImagesToDeletePerCycle:   DefaultNumImagesToDeletePerCycle,
+		DockerEndpoint:               "unix:///var/run/docker.sock",
+		ReservedPorts:                []uint16{SSHPort, DockerReservedPort, DockerReservedSSLPort, AgentIntrospectionPort, AgentCredentialsPort},
+		ReservedPortsUDP:             []uint16{},
+		DataDir:                      "/data/",
+		DisableMetrics:               false,
+		ReservedMemory:               0,
+		AvailableLoggingDrivers:      []dockerclient.LoggingDriver{dockerclient.JSONFileDriver},
+		TaskCleanupWaitDuration:      DefaultTaskCleanupWaitDuration,
+		DockerStopTimeout:            DefaultDockerStopTimeout,
+		ShutdownDrainTimeout:         DefaultShutdownDrainTimeout,
+		CredentialsRefreshMargin:     DefaultCredentialsRefreshMargin,
+		CredentialsAuditLogFile:      defaultCredentialsAuditLogFile,
+		CredentialsAuditLogDisabled:  false,
+		CredentialsAuditLogFormat:    AuditLogFormatText,
+		CredentialsAuditLogMaxAge:    DefaultCredentialsAuditLogMaxAge,
+		CredentialsAuditLogMaxRolls:  DefaultCredentialsAuditLogMaxRolls,
+		ImageCleanupDisabled:         false,
+		MinimumImageDeletionAge:      DefaultImageDeletionAge,
+		ImageCleanupInterval:         DefaultImageCleanupTimeInterval,
+		NumImagesToDeletePerCycle:    DefaultNumImagesToDeletePerCycle,
+		TaskAccountingLogFile:        defaultTaskAccountingLogFile,
+		StandaloneStateChangeLogFile: defaultStandaloneStateChangeLogFile,
+		LocalControlEndpoint:         defaultLocalControlEndpoint,
 	}
 }
 
@@ -60,6 +60,11 @@ func TestConfigDefault(t *testing.T) {
 	assert.False(t, cfg.TaskIAMRoleEnabledForNetworkHost, "TaskIAMRoleEnabledForNetworkHost set incorrectly")
 	assert.False(t, cfg.CredentialsAuditLogDisabled, "CredentialsAuditLogDisabled set incorrectly")
 	assert.Equal(t, defaultCredentialsAuditLogFile, cfg.CredentialsAuditLogFile, "CredentialsAuditLogFile is set incorrectly")
+	assert.False(t, cfg.TaskAccountingEnabled, "TaskAccountingEnabled set incorrectly")
+	assert.Equal(t, defaultTaskAccountingLogFile, cfg.TaskAccountingLogFile, "TaskAccountingLogFile is set incorrectly")
+	assert.Equal(t, defaultStandaloneStateChangeLogFile, cfg.StandaloneStateChangeLogFile, "StandaloneStateChangeLogFile is set incorrectly")
+	assert.False(t, cfg.LocalControlEnabled, "LocalControlEnabled set incorrectly")
+	assert.Equal(t, defaultLocalControlEndpoint, cfg.LocalControlEndpoint, "LocalControlEndpoint is set incorrectly")
 	assert.False(t, cfg.ImageCleanupDisabled, "ImageCleanupDisabled default is set incorrectly")
 	assert.Equal(t, DefaultImageDeletionAge, cfg.MinimumImageDeletionAge, "MinimumImageDeletionAge default is set incorrectly")
 	assert.Equal(t, DefaultImageCleanupTimeInterval, cfg.ImageCleanupInterval, "ImageCleanupInterval default is set incorrectly")
@@ -140,6 +145,27 @@ func TestDockerAuthMergeFromFile(t *testing.T) {
 	assert.Equal(t, map[string]string{"attribute1": "value1"}, config.InstanceAttributes)
 }
 
+func TestShutdownDrainTimeoutFromFile(t *testing.T) {
+	configFile := setupDockerAuthConfiguration(t, `{"Cluster": "TestCluster", "ShutdownDrainTimeout": 0}`)
+	defer os.Remove(configFile)
+	os.Setenv("ECS_AGENT_CONFIG_FILE_PATH", configFile)
+	defer os.Unsetenv("ECS_AGENT_CONFIG_FILE_PATH")
+
+	// 0 in the config file turns draining off
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	assert.True(t, cfg.ShutdownDrainDisabled)
+	assert.Zero(t, cfg.ShutdownDrainTimeout)
+
+	// The environment takes precedence over the config file
+	os.Setenv("ECS_SHUTDOWN_DRAIN_TIMEOUT", "1m")
+	defer os.Unsetenv("ECS_SHUTDOWN_DRAIN_TIMEOUT")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+	assert.False(t, cfg.ShutdownDrainDisabled)
+	assert.Equal(t, time.Minute, cfg.ShutdownDrainTimeout)
+}
+
 // setupDockerAuthConfiguration create a temp file store the configuration
 func setupDockerAuthConfiguration(t *testing.T, configContent string) string {
 	configFile, err := ioutil.TempFile("", "ecs-test")
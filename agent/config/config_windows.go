@@ -23,7 +23,12 @@ import (
 )
 
 const (
-	defaultCredentialsAuditLogFile = `log\audit.log`
+	defaultCredentialsAuditLogFile      = `log\audit.log`
+	defaultTaskAccountingLogFile        = `log\task-accounting.log`
+	defaultStandaloneStateChangeLogFile = `log\state-changes.log`
+	// Unix sockets are not available on Windows, the local control api is
+	// served on the loopback interface instead
+	defaultLocalControlEndpoint = "tcp://127.0.0.1:51681"
 	// When using IAM roles for tasks on Windows, the credential proxy consumes port 80
 	httpPort = 80
 	// Remote Desktop / Terminal Services
@@ -61,17 +66,25 @@ func DefaultConfig() Config {
 		ReservedPortsUDP: []uint16{},
 		DataDir:          filepath.Join(ecsRoot, "data"),
 		// DisableMetrics is set to true on Windows as docker stats does not work
-		DisableMetrics:              true,
-		ReservedMemory:              0,
-		AvailableLoggingDrivers:     []dockerclient.LoggingDriver{dockerclient.JSONFileDriver},
-		TaskCleanupWaitDuration:     DefaultTaskCleanupWaitDuration,
-		DockerStopTimeout:           DefaultDockerStopTimeout,
-		CredentialsAuditLogFile:     filepath.Join(ecsRoot, defaultCredentialsAuditLogFile),
-		CredentialsAuditLogDisabled: false,
-		ImageCleanupDisabled:        false,
-		MinimumImageDeletionAge:     DefaultImageDeletionAge,
-		ImageCleanupInterval:        DefaultImageCleanupTimeInterval,
-		NumImagesToDeletePerCycle:   DefaultNumImagesToDeletePerCycle,
+		DisableMetrics:               true,
+		ReservedMemory:               0,
+		AvailableLoggingDrivers:      []dockerclient.LoggingDriver{dockerclient.JSONFileDriver},
+		TaskCleanupWaitDuration:      DefaultTaskCleanupWaitDuration,
+		DockerStopTimeout:            DefaultDockerStopTimeout,
+		ShutdownDrainTimeout:         DefaultShutdownDrainTimeout,
+		CredentialsRefreshMargin:     DefaultCredentialsRefreshMargin,
+		CredentialsAuditLogFile:      filepath.Join(ecsRoot, defaultCredentialsAuditLogFile),
+		CredentialsAuditLogDisabled:  false,
+		CredentialsAuditLogFormat:    AuditLogFormatText,
+		CredentialsAuditLogMaxAge:    DefaultCredentialsAuditLogMaxAge,
+		CredentialsAuditLogMaxRolls:  DefaultCredentialsAuditLogMaxRolls,
+		ImageCleanupDisabled:         false,
+		MinimumImageDeletionAge:      DefaultImageDeletionAge,
+		ImageCleanupInterval:         DefaultImageCleanupTimeInterval,
+		NumImagesToDeletePerCycle:    DefaultNumImagesToDeletePerCycle,
+		TaskAccountingLogFile:        filepath.Join(ecsRoot, defaultTaskAccountingLogFile),
+		StandaloneStateChangeLogFile: filepath.Join(ecsRoot, defaultStandaloneStateChangeLogFile),
+		LocalControlEndpoint:         defaultLocalControlEndpoint,
 	}
 }
 
@@ -57,6 +57,9 @@ func TestConfigDefault(t *testing.T) {
 	assert.False(t, cfg.TaskIAMRoleEnabledForNetworkHost, "TaskIAMRoleEnabledForNetworkHost set incorrectly")
 	assert.False(t, cfg.CredentialsAuditLogDisabled, "CredentialsAuditLogDisabled set incorrectly")
 	assert.Equal(t, `C:\ProgramData\Amazon\ECS\log\audit.log`, cfg.CredentialsAuditLogFile, "CredentialsAuditLogFile is set incorrectly")
+	assert.Equal(t, `C:\ProgramData\Amazon\ECS\log\task-accounting.log`, cfg.TaskAccountingLogFile, "TaskAccountingLogFile is set incorrectly")
+	assert.Equal(t, `C:\ProgramData\Amazon\ECS\log\state-changes.log`, cfg.StandaloneStateChangeLogFile, "StandaloneStateChangeLogFile is set incorrectly")
+	assert.Equal(t, "tcp://127.0.0.1:51681", cfg.LocalControlEndpoint, "LocalControlEndpoint is set incorrectly")
 	assert.False(t, cfg.ImageCleanupDisabled, "ImageCleanupDisabled default is set incorrectly")
 	assert.Equal(t, DefaultImageDeletionAge, cfg.MinimumImageDeletionAge, "MinimumImageDeletionAge default is set incorrectly")
 	assert.Equal(t, DefaultImageCleanupTimeInterval, cfg.ImageCleanupInterval, "ImageCleanupInterval default is set incorrectly")
@@ -115,10 +115,36 @@ type Config struct {
 	// CredentialsAuditLogEnabled specifies whether audit logging is disabled.
 	CredentialsAuditLogDisabled bool
 
+	// CredentialsAuditLogFormat is the format of the audit log entries, either
+	// AuditLogFormatText or AuditLogFormatJSON
+	CredentialsAuditLogFormat string
+
+	// CredentialsAuditLogMaxSizeMB, when set, rotates the audit log when it
+	// reaches this size instead of every hour
+	CredentialsAuditLogMaxSizeMB int
+
+	// CredentialsAuditLogMaxAge is how long the rotated audit logs are kept
+	// for
+	CredentialsAuditLogMaxAge time.Duration
+
+	// CredentialsAuditLogMaxRolls is the number of audit logs rotated by size
+	// that are kept
+	CredentialsAuditLogMaxRolls int
+
+	// CredentialsAuditLogSyslog is the address of a syslog server the audit
+	// log entries are also sent to, such as "udp://localhost:514"
+	CredentialsAuditLogSyslog string
+
 	// TaskIAMRoleEnabledForNetworkHost specifies if the Agent is capable of launching
 	// tasks with IAM Roles when networkMode is set to 'host'
 	TaskIAMRoleEnabledForNetworkHost bool
 
+	// CredentialsRequestBindingEnabled specifies whether the credentials
+	// endpoint only serves credentials to the containers of the task owning
+	// them, as resolved from the source IP address of the request. Containers
+	// on the host network can't be resolved and are refused credentials.
+	CredentialsRequestBindingEnabled bool
+
 	// ImageCleanupDisabled specifies whether the Agent will periodically perform
 	// automated image cleanup
 	ImageCleanupDisabled bool
@@ -135,6 +161,106 @@ type Config struct {
 	// when Agent performs cleanup
 	NumImagesToDeletePerCycle int
 
+	// TaskAccountingEnabled specifies whether the resource usage of each
+	// task is appended to the task accounting log when the task stops.
+	TaskAccountingEnabled bool
+
+	// TaskAccountingLogFile specifies the path/filename of the task
+	// accounting log.
+	TaskAccountingLogFile string
+
+	// StateChangeWebhooks specifies the local http urls or unix sockets, as
+	// in unix:///var/run/app.sock?path=/events, that task and container
+	// state changes are posted to.
+	StateChangeWebhooks []string
+
+	// LocalControlEnabled specifies whether the local control api, which
+	// runs and stops tasks outside of ECS, is served.
+	LocalControlEnabled bool
+
+	// LocalControlEndpoint specifies where the local control api is served,
+	// as a unix socket (unix:///path) or a local tcp address (tcp://host:port).
+	LocalControlEndpoint string
+
+	// LocalControlToken is the bearer token required by the local control
+	// api. A random token is generated and written to the data directory if
+	// it is not set.
+	LocalControlToken string
+
+	// StandaloneManifestDir specifies the directory of task manifests the
+	// agent runs in standalone mode. When set, the agent doesn't register
+	// with or take tasks from the ECS backend.
+	StandaloneManifestDir string
+
+	// StandaloneStateChangeLogFile specifies the path/filename of the log
+	// that state changes are written to in standalone mode.
+	StandaloneStateChangeLogFile string
+
+	// ProxyURL is the http proxy, as in "http://proxy.example.com:3128",
+	// that the connections to AWS are tunneled through with CONNECT. When it
+	// is not set, the proxy is taken from the HTTP_PROXY and HTTPS_PROXY
+	// environment variables.
+	ProxyURL string `trim:"true"`
+
+	// ProxyUsername and ProxyPassword are the basic auth credentials of the
+	// proxy, when it requires authentication.
+	ProxyUsername string
+	ProxyPassword string `json:"-"`
+
+	// ProxyCABundle is the path to a PEM file of certificate authorities
+	// trusted, in addition to the system ones, for the TLS connections to AWS,
+	// e.g. when the proxy intercepts TLS.
+	ProxyCABundle string `trim:"true"`
+
+	// NoProxy lists the hosts, domains and CIDR blocks reached directly
+	// instead of through the proxy. The instance metadata, task credentials
+	// and docker endpoints are always reached directly.
+	NoProxy []string
+
+	// ShutdownDrainTimeout is the time given to the agent on termination to
+	// deliver the pending state changes, acks and metrics before it saves its
+	// state and exits
+	ShutdownDrainTimeout time.Duration
+
+	// ShutdownDrainDisabled is set when the shutdown drain timeout is
+	// explicitly 0, in which case the agent saves its state and exits on
+	// termination without delivering its pending work. It is derived from
+	// ShutdownDrainTimeout once the config sources are merged.
+	ShutdownDrainDisabled bool `json:"-"`
+
+	// CredentialsRefreshMargin is the time before the credentials of a task
+	// expire by which ACS is expected to have refreshed them. The agent warns
+	// about the credentials that are not refreshed within this margin.
+	CredentialsRefreshMargin time.Duration
+
+	// ACSEndpointOverride is the ACS websocket endpoint, such as
+	// "https://localhost:8443", connected to instead of the endpoint
+	// discovered from ECS. It is meant for testing against a local server.
+	ACSEndpointOverride string `trim:"true"`
+
+	// TCSEndpointOverride is the TCS websocket endpoint connected to instead
+	// of the endpoint discovered from ECS. It is meant for testing against a
+	// local server.
+	TCSEndpointOverride string `trim:"true"`
+
+	// ImagePullRewriteRules rewrite the image references of containers to
+	// pull them from a mirror or pull-through cache instead. The first
+	// matching rule applies; if pulling the rewritten reference fails, the
+	// original reference is pulled.
+	ImagePullRewriteRules []ImagePullRewriteRule
+
+	// ImageDigestPinningEnabled pins the containers of a task to the image
+	// digest first resolved for their image in the task, so that later pulls
+	// and creations of the containers use the same image build even if the
+	// image's tag has moved.
+	ImageDigestPinningEnabled bool
+
+	// ImageAdmissionPolicy restricts the images of the containers the agent
+	// runs. Tasks with a container whose image the policy doesn't admit are
+	// stopped before any of their images are pulled. All images are admitted
+	// when it is nil.
+	ImageAdmissionPolicy *ImageAdmissionPolicy
+
 	// InstanceAttributes contains key/value pairs representing
 	// attributes to be associated with this instance within the
 	// ECS service and used to influence behavior such as launch
@@ -145,6 +271,30 @@ type Config struct {
 	AcceptInsecureCert bool `json:"-"`
 }
 
+// ImagePullRewriteRule rewrites an image reference before it is pulled. Rules
+// are matched against the fully qualified reference, as in
+// "docker.io/library/busybox:latest", with either a "*" suffixed prefix in
+// Match, whose "*" is substituted into Replace, or a regular expression in
+// Regex, whose submatches may be referenced in Replace as $1, $2, ...
+type ImagePullRewriteRule struct {
+	Match   string `json:"match,omitempty"`
+	Regex   string `json:"regex,omitempty"`
+	Replace string `json:"replace"`
+}
+
+// ImageAdmissionPolicy restricts the images containers may run. Patterns in
+// Allowed and Denied are matched with path.Match against the fully qualified
+// repository of the image, as in "docker.io/library/busybox", or, for patterns
+// without a "/", against its registry, as in "docker.io". Denied patterns take
+// precedence, and when Allowed is empty every repository not denied is
+// allowed.
+type ImageAdmissionPolicy struct {
+	Allowed       []string `json:"allowed,omitempty"`
+	Denied        []string `json:"denied,omitempty"`
+	RequireDigest bool     `json:"requireDigest,omitempty"`
+	DenyLatestTag bool     `json:"denyLatestTag,omitempty"`
+}
+
 // SensitiveRawMessage is a struct to store some data that should not be logged
 // or printed.
 // This struct is a Stringer which will not print its contents with 'String'.
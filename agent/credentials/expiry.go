@@ -0,0 +1,187 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package credentials
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+	"golang.org/x/net/context"
+)
+
+// expiryCheckInterval is how often the expiry monitor looks at the
+// expiration of the credentials in the credentials manager
+const expiryCheckInterval = time.Minute
+
+// ExpirationTime parses the expiration of the credentials, which ACS sends
+// as an RFC3339 timestamp
+func (roleCredentials *IAMRoleCredentials) ExpirationTime() (time.Time, error) {
+	return time.Parse(time.RFC3339, roleCredentials.Expiration)
+}
+
+// Expired returns true if the credentials have expired at the time now.
+// Credentials whose expiration can't be parsed are not considered expired,
+// the agent echoes whatever the backend sends.
+func (roleCredentials *IAMRoleCredentials) Expired(now time.Time) bool {
+	expiration, err := roleCredentials.ExpirationTime()
+	if err != nil {
+		return false
+	}
+	return !now.Before(expiration)
+}
+
+// CredentialsExpiry describes when the credentials of a task expire
+type CredentialsExpiry struct {
+	TaskARN         string
+	RoleType        string
+	RoleArn         string
+	Expiration      time.Time
+	SecondsToExpiry float64
+	// RefreshOverdue is true when ACS has not refreshed the credentials
+	// within the refresh margin of their expiration
+	RefreshOverdue bool
+	Expired        bool
+
+	credentialsID string
+}
+
+// ExpiryStats is the state of the credentials expiry monitor at a point in
+// time
+type ExpiryStats struct {
+	// RefreshesOverdue counts the credentials ACS has not refreshed within
+	// the refresh margin of their expiration since the agent started
+	RefreshesOverdue uint64
+	// Overdue and Expired are the number of credentials currently overdue
+	// for a refresh and already expired
+	Overdue     int
+	Expired     int
+	Credentials []CredentialsExpiry
+}
+
+// expiryWarnings records which warnings were logged for an expiration, so
+// that each is logged once until the credentials are refreshed
+type expiryWarnings struct {
+	expiration time.Time
+	overdue    bool
+	expired    bool
+}
+
+// ExpiryMonitor tracks the time left before the credentials in the
+// credentials manager expire. It warns when ACS has not refreshed them
+// within the refresh margin of their expiration, and when they expire.
+type ExpiryMonitor struct {
+	manager Manager
+	margin  time.Duration
+
+	lock             sync.RWMutex
+	warnings         map[string]*expiryWarnings
+	refreshesOverdue uint64
+	credentials      []CredentialsExpiry
+}
+
+// NewExpiryMonitor returns an ExpiryMonitor for the credentials in manager
+func NewExpiryMonitor(manager Manager, margin time.Duration) *ExpiryMonitor {
+	return &ExpiryMonitor{
+		manager:  manager,
+		margin:   margin,
+		warnings: make(map[string]*expiryWarnings),
+	}
+}
+
+// Start checks the expiration of the credentials periodically until the
+// context is cancelled
+func (monitor *ExpiryMonitor) Start(ctx context.Context) {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			monitor.check(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (monitor *ExpiryMonitor) check(now time.Time) {
+	expiries := monitor.manager.CredentialsExpiries()
+
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	seen := make(map[string]struct{}, len(expiries))
+	for i := range expiries {
+		expiry := &expiries[i]
+		seen[expiry.credentialsID] = struct{}{}
+		if expiry.Expiration.IsZero() {
+			continue
+		}
+
+		warnings, ok := monitor.warnings[expiry.credentialsID]
+		if !ok || !warnings.expiration.Equal(expiry.Expiration) {
+			// New or refreshed credentials
+			warnings = &expiryWarnings{expiration: expiry.Expiration}
+			monitor.warnings[expiry.credentialsID] = warnings
+		}
+
+		remaining := expiry.Expiration.Sub(now)
+		expiry.SecondsToExpiry = remaining.Seconds()
+		expiry.RefreshOverdue = remaining <= monitor.margin
+		expiry.Expired = remaining <= 0
+
+		if expiry.RefreshOverdue && !warnings.overdue {
+			warnings.overdue = true
+			monitor.refreshesOverdue++
+			if !expiry.Expired {
+				seelog.Warnf("Credentials of role %s for task %s have not been refreshed and expire in %s",
+					expiry.RoleArn, expiry.TaskARN, remaining)
+			}
+		}
+		if expiry.Expired && !warnings.expired {
+			warnings.expired = true
+			seelog.Warnf("Credentials of role %s for task %s have not been refreshed and expired at %s",
+				expiry.RoleArn, expiry.TaskARN, expiry.Expiration.Format(time.RFC3339))
+		}
+	}
+
+	// Forget the credentials removed from the manager
+	for credentialsID := range monitor.warnings {
+		if _, ok := seen[credentialsID]; !ok {
+			delete(monitor.warnings, credentialsID)
+		}
+	}
+	monitor.credentials = expiries
+}
+
+// Stats returns the state of the monitor as of its last check
+func (monitor *ExpiryMonitor) Stats() ExpiryStats {
+	monitor.lock.RLock()
+	defer monitor.lock.RUnlock()
+
+	stats := ExpiryStats{
+		RefreshesOverdue: monitor.refreshesOverdue,
+		Credentials:      make([]CredentialsExpiry, len(monitor.credentials)),
+	}
+	copy(stats.Credentials, monitor.credentials)
+	for _, expiry := range stats.Credentials {
+		if expiry.RefreshOverdue {
+			stats.Overdue++
+		}
+		if expiry.Expired {
+			stats.Expired++
+		}
+	}
+	return stats
+}
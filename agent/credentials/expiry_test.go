@@ -0,0 +1,124 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	credentials := IAMRoleCredentials{Expiration: "2017-03-01T12:00:00Z"}
+	assert.False(t, credentials.Expired(now.Add(-time.Second)))
+	assert.True(t, credentials.Expired(now))
+
+	// An expiration that can't be parsed is never considered expired
+	credentials.Expiration = "soon"
+	assert.False(t, credentials.Expired(now))
+}
+
+func TestCredentialsExpiries(t *testing.T) {
+	manager := NewManager()
+	require.NoError(t, manager.SetTaskCredentials(TaskIAMRoleCredentials{
+		ARN: "t1",
+		IAMRoleCredentials: IAMRoleCredentials{
+			CredentialsID: "c1",
+			RoleArn:       "r1",
+			Expiration:    "2017-03-01T12:00:00Z",
+		},
+	}))
+	require.NoError(t, manager.SetTaskExecutionCredentials(TaskIAMRoleCredentials{
+		ARN: "t1",
+		IAMRoleCredentials: IAMRoleCredentials{
+			CredentialsID: "c2",
+			RoleArn:       "r2",
+			Expiration:    "soon",
+		},
+	}))
+
+	expiries := manager.CredentialsExpiries()
+	assert.Len(t, expiries, 2)
+	assert.Contains(t, expiries, CredentialsExpiry{
+		TaskARN:       "t1",
+		RoleType:      ApplicationRoleType,
+		RoleArn:       "r1",
+		Expiration:    time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC),
+		credentialsID: "c1",
+	})
+	assert.Contains(t, expiries, CredentialsExpiry{
+		TaskARN:       "t1",
+		RoleType:      ExecutionRoleType,
+		RoleArn:       "r2",
+		credentialsID: "c2",
+	})
+}
+
+func TestExpiryMonitorCheck(t *testing.T) {
+	expiration := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	manager := NewManager()
+	setCredentials := func(expiration time.Time) {
+		require.NoError(t, manager.SetTaskCredentials(TaskIAMRoleCredentials{
+			ARN: "t1",
+			IAMRoleCredentials: IAMRoleCredentials{
+				CredentialsID: "c1",
+				RoleArn:       "r1",
+				Expiration:    expiration.Format(time.RFC3339),
+			},
+		}))
+	}
+	setCredentials(expiration)
+	monitor := NewExpiryMonitor(manager, 15*time.Minute)
+
+	monitor.check(expiration.Add(-time.Hour))
+	stats := monitor.Stats()
+	assert.Equal(t, uint64(0), stats.RefreshesOverdue)
+	require.Len(t, stats.Credentials, 1)
+	assert.Equal(t, time.Hour.Seconds(), stats.Credentials[0].SecondsToExpiry)
+	assert.False(t, stats.Credentials[0].RefreshOverdue)
+
+	// Within the margin, the refresh is overdue and counted once
+	monitor.check(expiration.Add(-10 * time.Minute))
+	monitor.check(expiration.Add(-5 * time.Minute))
+	stats = monitor.Stats()
+	assert.Equal(t, uint64(1), stats.RefreshesOverdue)
+	assert.Equal(t, 1, stats.Overdue)
+	assert.Equal(t, 0, stats.Expired)
+
+	monitor.check(expiration.Add(time.Minute))
+	stats = monitor.Stats()
+	assert.Equal(t, uint64(1), stats.RefreshesOverdue)
+	assert.Equal(t, 1, stats.Expired)
+	assert.True(t, stats.Credentials[0].Expired)
+
+	// A refresh resets the tracking of the credentials
+	expiration = expiration.Add(time.Hour)
+	setCredentials(expiration)
+	monitor.check(expiration.Add(-time.Hour + time.Minute))
+	stats = monitor.Stats()
+	assert.Equal(t, 0, stats.Overdue)
+	assert.Equal(t, 0, stats.Expired)
+
+	monitor.check(expiration.Add(-time.Minute))
+	assert.Equal(t, uint64(2), monitor.Stats().RefreshesOverdue)
+
+	// Removed credentials are forgotten
+	manager.RemoveCredentials("c1")
+	monitor.check(expiration)
+	assert.Empty(t, monitor.Stats().Credentials)
+	assert.Empty(t, monitor.warnings)
+}
@@ -15,9 +15,14 @@ package credentials
 
 // Manager is responsible for saving and retrieving credentials. A single
 // instance of the credentials manager is created in the agent, and shared
-// between the task engine, acs and credentials handlers
+// between the task engine, acs and credentials handlers. The credentials of
+// a task's execution role are only for the agent's own use on behalf of the
+// task, and are never served to the task's containers.
 type Manager interface {
 	SetTaskCredentials(TaskIAMRoleCredentials) error
 	GetTaskCredentials(string) (TaskIAMRoleCredentials, bool)
+	SetTaskExecutionCredentials(TaskIAMRoleCredentials) error
+	GetTaskExecutionCredentials(string) (TaskIAMRoleCredentials, bool)
 	RemoveCredentials(string)
+	CredentialsExpiries() []CredentialsExpiry
 }
@@ -16,6 +16,7 @@ package credentials
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	"github.com/aws/aws-sdk-go/aws"
@@ -38,6 +39,14 @@ const (
 
 	v1CredentialsEndpointRelativeURIFormat = "%s?" + CredentialsIDQueryParameterName + "=%s"
 	v2CredentialsEndpointRelativeURIFormat = "%s/%s"
+
+	// ApplicationRoleType is the role type of the credentials of a task's
+	// IAM role, which are served to its containers
+	ApplicationRoleType = "TaskApplication"
+
+	// ExecutionRoleType is the role type of the credentials of a task's
+	// execution role, which only the agent uses on behalf of the task
+	ExecutionRoleType = "TaskExecution"
 )
 
 // IAMRoleCredentials is used to save credentials sent by ACS
@@ -71,7 +80,11 @@ func (roleCredentials *IAMRoleCredentials) GenerateCredentialsEndpointRelativeUR
 type credentialsManager struct {
 	// idToTaskCredentials maps credentials id to its corresponding TaskIAMRoleCredentials object
 	idToTaskCredentials map[string]*TaskIAMRoleCredentials
-	taskCredentialsLock sync.RWMutex
+	// idToExecutionCredentials maps credentials id to the credentials of a
+	// task's execution role. They are kept apart from the task role
+	// credentials so that they are never served from the credentials endpoint.
+	idToExecutionCredentials map[string]*TaskIAMRoleCredentials
+	taskCredentialsLock      sync.RWMutex
 }
 
 // IAMRoleCredentialsFromACS translates ecsacs.IAMRoleCredentials object to
@@ -90,7 +103,8 @@ func IAMRoleCredentialsFromACS(roleCredentials *ecsacs.IAMRoleCredentials) IAMRo
 // NewManager creates a new credentials manager object
 func NewManager() Manager {
 	return &credentialsManager{
-		idToTaskCredentials: make(map[string]*TaskIAMRoleCredentials),
+		idToTaskCredentials:      make(map[string]*TaskIAMRoleCredentials),
+		idToExecutionCredentials: make(map[string]*TaskIAMRoleCredentials),
 	}
 }
 
@@ -99,6 +113,19 @@ func (manager *credentialsManager) SetTaskCredentials(taskCredentials TaskIAMRol
 	manager.taskCredentialsLock.Lock()
 	defer manager.taskCredentialsLock.Unlock()
 
+	return setCredentials(manager.idToTaskCredentials, taskCredentials)
+}
+
+// SetTaskExecutionCredentials adds or updates the credentials of a task's
+// execution role in the credentials manager
+func (manager *credentialsManager) SetTaskExecutionCredentials(taskCredentials TaskIAMRoleCredentials) error {
+	manager.taskCredentialsLock.Lock()
+	defer manager.taskCredentialsLock.Unlock()
+
+	return setCredentials(manager.idToExecutionCredentials, taskCredentials)
+}
+
+func setCredentials(idToCredentials map[string]*TaskIAMRoleCredentials, taskCredentials TaskIAMRoleCredentials) error {
 	credentials := taskCredentials.IAMRoleCredentials
 	// Validate that credentials id is not empty
 	if credentials.CredentialsID == "" {
@@ -111,13 +138,13 @@ func (manager *credentialsManager) SetTaskCredentials(taskCredentials TaskIAMRol
 	}
 
 	// Check if credentials exists for the given credentials id
-	taskCredentialsInMap, ok := manager.idToTaskCredentials[credentials.CredentialsID]
+	taskCredentialsInMap, ok := idToCredentials[credentials.CredentialsID]
 	if !ok {
 		// No existing credentials, create a new one
 		taskCredentialsInMap = &TaskIAMRoleCredentials{}
 	}
 	*taskCredentialsInMap = taskCredentials
-	manager.idToTaskCredentials[credentials.CredentialsID] = taskCredentialsInMap
+	idToCredentials[credentials.CredentialsID] = taskCredentialsInMap
 
 	return nil
 }
@@ -135,10 +162,54 @@ func (manager *credentialsManager) GetTaskCredentials(id string) (TaskIAMRoleCre
 	return *taskCredentials, ok
 }
 
-// RemoveCredentials removes credentials from the credentials manager
+// GetTaskExecutionCredentials retrieves the credentials of a task's execution
+// role for a given credentials id
+func (manager *credentialsManager) GetTaskExecutionCredentials(id string) (TaskIAMRoleCredentials, bool) {
+	manager.taskCredentialsLock.RLock()
+	defer manager.taskCredentialsLock.RUnlock()
+
+	taskCredentials, ok := manager.idToExecutionCredentials[id]
+
+	if !ok {
+		return TaskIAMRoleCredentials{}, ok
+	}
+	return *taskCredentials, ok
+}
+
+// RemoveCredentials removes credentials from the credentials manager, whether
+// they are for a task role or an execution role
 func (manager *credentialsManager) RemoveCredentials(id string) {
 	manager.taskCredentialsLock.Lock()
 	defer manager.taskCredentialsLock.Unlock()
 
 	delete(manager.idToTaskCredentials, id)
+	delete(manager.idToExecutionCredentials, id)
+}
+
+// CredentialsExpiries returns the expiration of all the credentials in the
+// credentials manager. The expiration is left zero when it can't be parsed.
+func (manager *credentialsManager) CredentialsExpiries() []CredentialsExpiry {
+	manager.taskCredentialsLock.RLock()
+	defer manager.taskCredentialsLock.RUnlock()
+
+	expiries := make([]CredentialsExpiry, 0, len(manager.idToTaskCredentials)+len(manager.idToExecutionCredentials))
+	expiries = appendExpiries(expiries, manager.idToTaskCredentials, ApplicationRoleType)
+	return appendExpiries(expiries, manager.idToExecutionCredentials, ExecutionRoleType)
+}
+
+func appendExpiries(expiries []CredentialsExpiry, idToCredentials map[string]*TaskIAMRoleCredentials, roleType string) []CredentialsExpiry {
+	for credentialsID, taskCredentials := range idToCredentials {
+		expiration, err := taskCredentials.IAMRoleCredentials.ExpirationTime()
+		if err != nil {
+			expiration = time.Time{}
+		}
+		expiries = append(expiries, CredentialsExpiry{
+			TaskARN:       taskCredentials.ARN,
+			RoleType:      roleType,
+			RoleArn:       taskCredentials.IAMRoleCredentials.RoleArn,
+			Expiration:    expiration,
+			credentialsID: credentialsID,
+		})
+	}
+	return expiries
 }
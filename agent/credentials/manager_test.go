@@ -165,3 +165,39 @@ func TestRemoveExistingCredentials(t *testing.T) {
 		t.Error("Expected GetTaskCredentials to return false for removed credentials")
 	}
 }
+
+// TestSetAndGetTaskExecutionCredentials tests that the credentials of an
+// execution role are only returned by GetTaskExecutionCredentials
+func TestSetAndGetTaskExecutionCredentials(t *testing.T) {
+	manager := NewManager()
+	credentials := TaskIAMRoleCredentials{
+		ARN: "t1",
+		IAMRoleCredentials: IAMRoleCredentials{
+			RoleArn:         "r1",
+			AccessKeyID:     "akid1",
+			SecretAccessKey: "skid1",
+			SessionToken:    "stkn",
+			Expiration:      "ts",
+			CredentialsID:   "cid1",
+		},
+	}
+	err := manager.SetTaskExecutionCredentials(credentials)
+	assert.NoError(t, err, "Error adding execution credentials")
+
+	credentialsFromManager, ok := manager.GetTaskExecutionCredentials("cid1")
+	assert.True(t, ok, "GetTaskExecutionCredentials returned false for existing credentials")
+	assert.Equal(t, credentials, credentialsFromManager, "Mismatch between added and retrieved credentials")
+
+	_, ok = manager.GetTaskCredentials("cid1")
+	assert.False(t, ok, "GetTaskCredentials returned execution credentials")
+
+	manager.RemoveCredentials("cid1")
+	_, ok = manager.GetTaskExecutionCredentials("cid1")
+	assert.False(t, ok, "GetTaskExecutionCredentials returned removed credentials")
+}
+
+func TestSetTaskExecutionCredentialsNoCredentialsId(t *testing.T) {
+	manager := NewManager()
+	err := manager.SetTaskExecutionCredentials(TaskIAMRoleCredentials{ARN: "t1"})
+	assert.Error(t, err, "Expected error adding execution credentials without credentials id")
+}
@@ -42,6 +42,16 @@ func (_m *MockManager) EXPECT() *_MockManagerRecorder {
 	return _m.recorder
 }
 
+func (_m *MockManager) CredentialsExpiries() []credentials.CredentialsExpiry {
+	ret := _m.ctrl.Call(_m, "CredentialsExpiries")
+	ret0, _ := ret[0].([]credentials.CredentialsExpiry)
+	return ret0
+}
+
+func (_mr *_MockManagerRecorder) CredentialsExpiries() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CredentialsExpiries")
+}
+
 func (_m *MockManager) GetTaskCredentials(_param0 string) (credentials.TaskIAMRoleCredentials, bool) {
 	ret := _m.ctrl.Call(_m, "GetTaskCredentials", _param0)
 	ret0, _ := ret[0].(credentials.TaskIAMRoleCredentials)
@@ -53,6 +63,17 @@ func (_mr *_MockManagerRecorder) GetTaskCredentials(arg0 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTaskCredentials", arg0)
 }
 
+func (_m *MockManager) GetTaskExecutionCredentials(_param0 string) (credentials.TaskIAMRoleCredentials, bool) {
+	ret := _m.ctrl.Call(_m, "GetTaskExecutionCredentials", _param0)
+	ret0, _ := ret[0].(credentials.TaskIAMRoleCredentials)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+func (_mr *_MockManagerRecorder) GetTaskExecutionCredentials(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTaskExecutionCredentials", arg0)
+}
+
 func (_m *MockManager) RemoveCredentials(_param0 string) {
 	_m.ctrl.Call(_m, "RemoveCredentials", _param0)
 }
@@ -70,3 +91,13 @@ func (_m *MockManager) SetTaskCredentials(_param0 credentials.TaskIAMRoleCredent
 func (_mr *_MockManagerRecorder) SetTaskCredentials(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetTaskCredentials", arg0)
 }
+
+func (_m *MockManager) SetTaskExecutionCredentials(_param0 credentials.TaskIAMRoleCredentials) error {
+	ret := _m.ctrl.Call(_m, "SetTaskExecutionCredentials", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockManagerRecorder) SetTaskExecutionCredentials(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetTaskExecutionCredentials", arg0)
+}
@@ -15,6 +15,7 @@ package ecr
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/async"
@@ -22,11 +23,21 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/aws-sdk-go/aws"
 	log "github.com/cihub/seelog"
+	"golang.org/x/net/context"
 )
 
 const (
 	MinimumJitterDuration = 30 * time.Minute
 	MaximumJitterDuration = 1 * time.Hour
+
+	// prefetchMargin is how long before a token could be considered expired
+	// by IsTokenValid it is refreshed in the background
+	prefetchMargin = 5 * time.Minute
+	// prefetchIdleTimeout is how long a registry is refreshed in the
+	// background without being used
+	prefetchIdleTimeout = 12 * time.Hour
+	prefetchRetryMin    = 30 * time.Second
+	prefetchRetryMax    = 15 * time.Minute
 )
 
 // ECRClient wrapper interface for mocking
@@ -42,9 +53,23 @@ type ECRSDK interface {
 	GetAuthorizationToken(*ecrapi.GetAuthorizationTokenInput) (*ecrapi.GetAuthorizationTokenOutput, error)
 }
 
+// lookupRecorder is implemented by the token caches that count the lookups
+// of the tokens
+type lookupRecorder interface {
+	recordLookup(registryId string, hit bool)
+}
+
 type ecrClient struct {
 	sdkClient  ECRSDK
 	tokenCache async.Cache
+
+	// prefetch is set for the clients whose tokens are refreshed in the
+	// background, from the first time a registry is used until it stays
+	// unused for prefetchIdleTimeout
+	prefetch       bool
+	prefetchCtx    context.Context
+	prefetchLock   sync.Mutex
+	prefetchedUsed map[string]time.Time
 }
 
 func NewECRClient(sdkClient ECRSDK, tokenCache async.Cache) ECRClient {
@@ -54,18 +79,47 @@ func NewECRClient(sdkClient ECRSDK, tokenCache async.Cache) ECRClient {
 	}
 }
 
+// newPrefetchingECRClient returns a client that refreshes the tokens of the
+// registries it was asked for before they expire, until ctx is cancelled.
+func newPrefetchingECRClient(ctx context.Context, sdkClient ECRSDK, tokenCache async.Cache) ECRClient {
+	return &ecrClient{
+		sdkClient:      sdkClient,
+		tokenCache:     tokenCache,
+		prefetch:       true,
+		prefetchCtx:    ctx,
+		prefetchedUsed: make(map[string]time.Time),
+	}
+}
+
 func (client *ecrClient) GetAuthorizationToken(registryId string) (*ecrapi.AuthorizationData, error) {
+	if client.prefetch {
+		client.usePrefetched(registryId)
+	}
+	recorder, _ := client.tokenCache.(lookupRecorder)
+
 	cachedToken, found := client.tokenCache.Get(registryId)
 	if found {
 		cachedAuthData := cachedToken.(*ecrapi.AuthorizationData)
 
 		if client.IsTokenValid(cachedAuthData) {
+			if recorder != nil {
+				recorder.recordLookup(registryId, true)
+			}
 			return cachedAuthData, nil
 		} else {
 			log.Debugf("Token found, but expires at %s", aws.TimeValue(cachedAuthData.ExpiresAt))
 		}
 	}
+	if recorder != nil {
+		recorder.recordLookup(registryId, false)
+	}
 
+	return client.fetchAuthorizationToken(registryId)
+}
+
+// fetchAuthorizationToken calls ECR for the token of the registry and caches
+// it.
+func (client *ecrClient) fetchAuthorizationToken(registryId string) (*ecrapi.AuthorizationData, error) {
 	log.Debugf("Calling GetAuthorizationToken for %q", registryId)
 
 	output, err := client.sdkClient.GetAuthorizationToken(&ecrapi.GetAuthorizationTokenInput{
@@ -99,3 +153,95 @@ func (client *ecrClient) IsTokenValid(authData *ecrapi.AuthorizationData) bool {
 func (client *ecrClient) expirationJitter() time.Duration {
 	return utils.AddJitter(MinimumJitterDuration, MaximumJitterDuration)
 }
+
+// usePrefetched records the use of a registry, starting to refresh its token
+// in the background on first use.
+func (client *ecrClient) usePrefetched(registryId string) {
+	client.prefetchLock.Lock()
+	defer client.prefetchLock.Unlock()
+
+	_, ok := client.prefetchedUsed[registryId]
+	client.prefetchedUsed[registryId] = time.Now()
+	if !ok {
+		go client.prefetchToken(registryId)
+	}
+}
+
+// prefetchIdle stops refreshing the token of a registry that was not used for
+// prefetchIdleTimeout. It returns true if the refresh should stop.
+func (client *ecrClient) prefetchIdle(registryId string) bool {
+	client.prefetchLock.Lock()
+	defer client.prefetchLock.Unlock()
+
+	if time.Since(client.prefetchedUsed[registryId]) < prefetchIdleTimeout {
+		return false
+	}
+	delete(client.prefetchedUsed, registryId)
+	return true
+}
+
+// prefetchToken refreshes the token of a registry before it expires until the
+// registry becomes idle or the context of the client is cancelled. Failed
+// refreshes are retried with a backoff; the next pull fetches the token
+// itself in the meantime.
+func (client *ecrClient) prefetchToken(registryId string) {
+	log.Debugf("Refreshing the authorization token of %q in the background", registryId)
+	backoff := utils.NewSimpleBackoff(prefetchRetryMin, prefetchRetryMax, 0.2, 2)
+	for {
+		if !client.prefetchWait(prefetchDelay(client.cachedAuthData(registryId), time.Now())) {
+			return
+		}
+		if client.prefetchIdle(registryId) {
+			log.Debugf("Stopped refreshing the authorization token of idle registry %q", registryId)
+			return
+		}
+		// The token may have been fetched by a pull in the meantime
+		if prefetchDelay(client.cachedAuthData(registryId), time.Now()) > prefetchRetryMin {
+			continue
+		}
+		_, err := client.fetchAuthorizationToken(registryId)
+		if err != nil {
+			log.Warnf("Unable to refresh the authorization token of %q: %v", registryId, err)
+			if !client.prefetchWait(backoff.Duration()) {
+				return
+			}
+			continue
+		}
+		backoff.Reset()
+	}
+}
+
+// prefetchWait waits for the delay to elapse. It returns false if the context
+// of the client was cancelled first.
+func (client *ecrClient) prefetchWait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-client.prefetchCtx.Done():
+		return false
+	}
+}
+
+func (client *ecrClient) cachedAuthData(registryId string) *ecrapi.AuthorizationData {
+	cachedToken, found := client.tokenCache.Get(registryId)
+	if !found {
+		return nil
+	}
+	return cachedToken.(*ecrapi.AuthorizationData)
+}
+
+// prefetchDelay returns how long to wait before refreshing a token, so that
+// it is replaced before IsTokenValid could consider it expired. Missing and
+// short lived tokens are refreshed after prefetchRetryMin.
+func prefetchDelay(authData *ecrapi.AuthorizationData, now time.Time) time.Duration {
+	if authData == nil || authData.ExpiresAt == nil {
+		return prefetchRetryMin
+	}
+	delay := aws.TimeValue(authData.ExpiresAt).Add(-MaximumJitterDuration - prefetchMargin).Sub(now)
+	if delay < prefetchRetryMin {
+		return prefetchRetryMin
+	}
+	return delay
+}
@@ -20,18 +20,25 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/async"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	ecrapi "github.com/aws/amazon-ecs-agent/agent/ecr/model/ecr"
 	"github.com/aws/amazon-ecs-agent/agent/httpclient"
 	"github.com/aws/aws-sdk-go/aws"
+	awscreds "github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"golang.org/x/net/context"
 )
 
 type ECRFactory interface {
 	GetClient(region, endpointOverride string) ECRClient
+	GetClientWithCredentials(region, endpointOverride string, creds credentials.IAMRoleCredentials) ECRClient
 }
 
 type ecrFactory struct {
+	ctx        context.Context
 	httpClient *http.Client
+	tokenStore *TokenStore
 
 	clientsLock sync.Mutex
 	clients     map[cacheKey]ECRClient
@@ -48,10 +55,14 @@ const (
 	tokenCacheTTL    = 12 * time.Hour
 )
 
-// NewECRFactory returns an ECRFactory capable of producing ECRSDK clients
-func NewECRFactory(acceptInsecureCert bool) ECRFactory {
+// NewECRFactory returns an ECRFactory capable of producing ECRSDK clients.
+// The clients returned by GetClient keep their tokens in tokenStore, and
+// refresh them before they expire until ctx is cancelled, when it is not nil.
+func NewECRFactory(ctx context.Context, cfg *config.Config, tokenStore *TokenStore) ECRFactory {
 	return &ecrFactory{
-		httpClient: httpclient.New(roundtripTimeout, acceptInsecureCert),
+		ctx:        ctx,
+		httpClient: httpclient.New(roundtripTimeout, cfg.AcceptInsecureCert, cfg),
+		tokenStore: tokenStore,
 		clients:    make(map[cacheKey]ECRClient),
 	}
 }
@@ -70,19 +81,45 @@ func (factory *ecrFactory) GetClient(region, endpointOverride string) ECRClient
 	if ok {
 		return client
 	}
-	client = factory.newClient(region, endpointOverride)
+	if factory.tokenStore != nil {
+		client = newPrefetchingECRClient(factory.ctx, factory.newSDKClient(region, endpointOverride, nil),
+			factory.tokenStore.cache(region, endpointOverride, ""))
+	} else {
+		client = factory.newClient(region, endpointOverride, nil)
+	}
 	factory.clients[key] = client
 	return client
 }
 
-func (factory *ecrFactory) newClient(region, endpointOverride string) ECRClient {
+// GetClientWithCredentials returns a new client acting on behalf of a task's
+// execution role for every call. These clients are not cached because the
+// role credentials are short lived. Their authorization tokens are kept in
+// the token store under the role credentials ID, so that the following pulls
+// of the task reuse them, but they are never shared with other roles nor
+// refreshed in the background.
+func (factory *ecrFactory) GetClientWithCredentials(region, endpointOverride string, creds credentials.IAMRoleCredentials) ECRClient {
+	roleCreds := awscreds.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken)
+	if factory.tokenStore == nil || creds.CredentialsID == "" {
+		return factory.newClient(region, endpointOverride, roleCreds)
+	}
+	return NewECRClient(factory.newSDKClient(region, endpointOverride, roleCreds),
+		factory.tokenStore.cache(region, endpointOverride, creds.CredentialsID))
+}
+
+func (factory *ecrFactory) newClient(region, endpointOverride string, creds *awscreds.Credentials) ECRClient {
+	tokenCache := async.NewLRUCache(tokenCacheSize, tokenCacheTTL)
+	return NewECRClient(factory.newSDKClient(region, endpointOverride, creds), tokenCache)
+}
+
+func (factory *ecrFactory) newSDKClient(region, endpointOverride string, creds *awscreds.Credentials) ECRSDK {
 	var ecrConfig aws.Config
 	ecrConfig.Region = &region
 	ecrConfig.HTTPClient = factory.httpClient
 	if endpointOverride != "" {
 		ecrConfig.Endpoint = &endpointOverride
 	}
-	sdkClient := ecrapi.New(session.New(&ecrConfig))
-	tokenCache := async.NewLRUCache(tokenCacheSize, tokenCacheTTL)
-	return NewECRClient(sdkClient, tokenCache)
+	if creds != nil {
+		ecrConfig.Credentials = creds
+	}
+	return ecrapi.New(session.New(&ecrConfig))
 }
@@ -15,6 +15,8 @@ package ecr
 
 import (
 	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
 )
 
 func TestClientTokenCacheSet(t *testing.T) {
@@ -71,3 +73,49 @@ func TestClientCachingDifferentClients(t *testing.T) {
 		t.Errorf("Should be the different, but was %v, %v, and %v", sdk1, sdk2, sdk3)
 	}
 }
+
+func TestClientWithCredentialsNotCached(t *testing.T) {
+	region := "us-west-2"
+	endpoint := ""
+	factory := &ecrFactory{
+		clients: make(map[cacheKey]ECRClient),
+	}
+	creds := credentials.IAMRoleCredentials{
+		AccessKeyID:     "akid",
+		SecretAccessKey: "skid",
+		SessionToken:    "stkn",
+	}
+
+	sdk1 := factory.GetClientWithCredentials(region, endpoint, creds)
+	sdk2 := factory.GetClientWithCredentials(region, endpoint, creds)
+	instanceSDK := factory.GetClient(region, endpoint)
+
+	if sdk1 == nil || sdk2 == nil {
+		t.Error("Should not be nil")
+	}
+	if sdk1 == sdk2 || sdk1 == instanceSDK || sdk2 == instanceSDK {
+		t.Errorf("Should be different, but was %v, %v, and %v", sdk1, sdk2, instanceSDK)
+	}
+}
+
+func TestClientTokenStore(t *testing.T) {
+	store, _ := NewTokenStore(nil)
+	factory := &ecrFactory{
+		clients:    make(map[cacheKey]ECRClient),
+		tokenStore: store,
+	}
+
+	client := factory.GetClient("us-west-2", "").(*ecrClient)
+	if _, ok := client.tokenCache.(*tokenStoreCache); !ok || !client.prefetch {
+		t.Error("Instance client should keep its tokens in the token store and prefetch them")
+	}
+
+	creds := credentials.IAMRoleCredentials{CredentialsID: "role-credentials", AccessKeyID: "akid"}
+	roleClient := factory.GetClientWithCredentials("us-west-2", "", creds).(*ecrClient)
+	roleCache, ok := roleClient.tokenCache.(*tokenStoreCache)
+	if !ok || roleClient.prefetch {
+		t.Error("Role client should keep its tokens in the token store without prefetching them")
+	} else if roleCache.credentialsID != "role-credentials" {
+		t.Errorf("Role client tokens should be keyed by the role credentials ID, was %q", roleCache.credentialsID)
+	}
+}
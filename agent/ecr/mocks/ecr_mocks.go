@@ -17,6 +17,7 @@
 package mock_ecr
 
 import (
+	credentials "github.com/aws/amazon-ecs-agent/agent/credentials"
 	ecr "github.com/aws/amazon-ecs-agent/agent/ecr"
 	ecr0 "github.com/aws/amazon-ecs-agent/agent/ecr/model/ecr"
 	gomock "github.com/golang/mock/gomock"
@@ -85,6 +86,16 @@ func (_mr *_MockECRFactoryRecorder) GetClient(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetClient", arg0, arg1)
 }
 
+func (_m *MockECRFactory) GetClientWithCredentials(_param0 string, _param1 string, _param2 credentials.IAMRoleCredentials) ecr.ECRClient {
+	ret := _m.ctrl.Call(_m, "GetClientWithCredentials", _param0, _param1, _param2)
+	ret0, _ := ret[0].(ecr.ECRClient)
+	return ret0
+}
+
+func (_mr *_MockECRFactoryRecorder) GetClientWithCredentials(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetClientWithCredentials", arg0, arg1, arg2)
+}
+
 // Mock of ECRClient interface
 type MockECRClient struct {
 	ctrl     *gomock.Controller
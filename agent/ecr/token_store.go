@@ -0,0 +1,391 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/async"
+	ecrapi "github.com/aws/amazon-ecs-agent/agent/ecr/model/ecr"
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// TokenKeyFileName is the name of the file in the data directory holding
+	// the key the saved authorization tokens are encrypted with
+	TokenKeyFileName = "ecr_token_key"
+	// tokenKeySize is the size of the AES-256 key
+	tokenKeySize = 32
+)
+
+// storedToken is an authorization token of a registry along with the lookups
+// of that registry. Only the tokens are saved; the counts start over with
+// the agent. CredentialsID is set for the tokens fetched with the
+// credentials of a task's execution role.
+type storedToken struct {
+	Region            string
+	EndpointOverride  string
+	RegistryID        string
+	CredentialsID     string `json:",omitempty"`
+	AuthorizationData *ecrapi.AuthorizationData
+	FetchedAt         time.Time
+	hits              uint64
+	misses            uint64
+}
+
+// savedTokenStore is the representation of the token store in the state
+// file. Tokens holds the encrypted json list of the stored tokens.
+type savedTokenStore struct {
+	Nonce  []byte
+	Tokens []byte
+}
+
+// TokenStore holds the authorization tokens fetched by the ECR clients, keyed
+// by region, endpoint and registry, and by the role credentials ID for the
+// clients that act on behalf of a task's execution role.
+// When it has a key, the store is saved with the state manager with the
+// tokens encrypted, so that a restarted agent does not have to fetch them
+// again. Tokens that can't be decrypted, or that have expired, are dropped.
+type TokenStore struct {
+	key    []byte
+	lock   sync.RWMutex
+	tokens map[string]*storedToken
+}
+
+// TokenInfo describes a stored authorization token, without the token.
+// ExecutionRole is set for the tokens of a task's execution role.
+type TokenInfo struct {
+	Region           string
+	EndpointOverride string `json:",omitempty"`
+	RegistryID       string
+	ExecutionRole    bool `json:",omitempty"`
+	FetchedAt        time.Time
+	ExpiresAt        time.Time
+	AgeSeconds       int64
+	Hits             uint64
+	Misses           uint64
+}
+
+// TokenStats is a snapshot of the token store for introspection.
+type TokenStats struct {
+	Hits   uint64
+	Misses uint64
+	Tokens []TokenInfo
+}
+
+// NewTokenStore returns an empty token store. Tokens are encrypted with key
+// when the store is saved; without a key the tokens are kept in memory only.
+func NewTokenStore(key []byte) (*TokenStore, error) {
+	if key != nil && len(key) != tokenKeySize {
+		return nil, errors.New("ecr token store: invalid key size")
+	}
+	return &TokenStore{
+		key:    key,
+		tokens: make(map[string]*storedToken),
+	}, nil
+}
+
+// LoadTokenKey returns the key in the data directory, generating it on first
+// use.
+func LoadTokenKey(dataDir string) ([]byte, error) {
+	keyFile := filepath.Join(dataDir, TokenKeyFileName)
+	key, err := ioutil.ReadFile(keyFile)
+	if err == nil && len(key) == tokenKeySize {
+		return key, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, tokenKeySize)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dataDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(keyFile, key, 0600)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Generated the ecr token key in %s", keyFile)
+	return key, nil
+}
+
+func tokenStoreKey(region, endpointOverride, registryID, credentialsID string) string {
+	return region + "|" + endpointOverride + "|" + registryID + "|" + credentialsID
+}
+
+// cache returns the view of the store used as the token cache of the client
+// of a region and endpoint. credentialsID is the ID of the role credentials
+// of the client, which is empty for the clients of the instance.
+func (store *TokenStore) cache(region, endpointOverride, credentialsID string) async.Cache {
+	return &tokenStoreCache{
+		store:            store,
+		region:           region,
+		endpointOverride: endpointOverride,
+		credentialsID:    credentialsID,
+	}
+}
+
+func (store *TokenStore) get(region, endpointOverride, registryID, credentialsID string) (*ecrapi.AuthorizationData, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	token, ok := store.tokens[tokenStoreKey(region, endpointOverride, registryID, credentialsID)]
+	if !ok || token.AuthorizationData == nil {
+		return nil, false
+	}
+	return token.AuthorizationData, true
+}
+
+func (store *TokenStore) set(region, endpointOverride, registryID, credentialsID string, authData *ecrapi.AuthorizationData) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	token := store.token(region, endpointOverride, registryID, credentialsID)
+	token.AuthorizationData = authData
+	token.FetchedAt = time.Now()
+	if credentialsID != "" {
+		store.removeExpiredRoleTokens(token.FetchedAt)
+	}
+}
+
+// removeExpiredRoleTokens drops the expired tokens of execution roles, which
+// are only used by the tasks of the role and are not refreshed. The caller
+// must hold the write lock.
+func (store *TokenStore) removeExpiredRoleTokens(now time.Time) {
+	for key, token := range store.tokens {
+		if token.CredentialsID == "" || token.AuthorizationData == nil {
+			continue
+		}
+		if !now.Before(aws.TimeValue(token.AuthorizationData.ExpiresAt)) {
+			delete(store.tokens, key)
+		}
+	}
+}
+
+// recordLookup counts a lookup of the token of a registry.
+func (store *TokenStore) recordLookup(region, endpointOverride, registryID, credentialsID string, hit bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	token := store.token(region, endpointOverride, registryID, credentialsID)
+	if hit {
+		token.hits++
+	} else {
+		token.misses++
+	}
+}
+
+// token returns the entry of a registry, adding it if needed. The caller must
+// hold the write lock.
+func (store *TokenStore) token(region, endpointOverride, registryID, credentialsID string) *storedToken {
+	key := tokenStoreKey(region, endpointOverride, registryID, credentialsID)
+	token, ok := store.tokens[key]
+	if !ok {
+		token = &storedToken{
+			Region:           region,
+			EndpointOverride: endpointOverride,
+			RegistryID:       registryID,
+			CredentialsID:    credentialsID,
+		}
+		store.tokens[key] = token
+	}
+	return token
+}
+
+// Reset forgets all the tokens.
+func (store *TokenStore) Reset() {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.tokens = make(map[string]*storedToken)
+}
+
+// Stats returns the stored tokens, sorted by region, endpoint and registry,
+// and the lookup counts. The role credentials IDs are left out, as they give
+// access to the credentials of the tasks.
+func (store *TokenStore) Stats() TokenStats {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	now := time.Now()
+	stats := TokenStats{Tokens: []TokenInfo{}}
+	for _, token := range store.tokens {
+		stats.Hits += token.hits
+		stats.Misses += token.misses
+		info := TokenInfo{
+			Region:           token.Region,
+			EndpointOverride: token.EndpointOverride,
+			RegistryID:       token.RegistryID,
+			ExecutionRole:    token.CredentialsID != "",
+			Hits:             token.hits,
+			Misses:           token.misses,
+		}
+		if token.AuthorizationData != nil {
+			info.FetchedAt = token.FetchedAt
+			info.ExpiresAt = aws.TimeValue(token.AuthorizationData.ExpiresAt)
+			info.AgeSeconds = int64(now.Sub(token.FetchedAt).Seconds())
+		}
+		stats.Tokens = append(stats.Tokens, info)
+	}
+	sort.Sort(byRegistry(stats.Tokens))
+	return stats
+}
+
+// byRegistry sorts the token infos by region, endpoint and registry, with the
+// tokens of the instance first.
+type byRegistry []TokenInfo
+
+func (tokens byRegistry) Len() int      { return len(tokens) }
+func (tokens byRegistry) Swap(i, j int) { tokens[i], tokens[j] = tokens[j], tokens[i] }
+func (tokens byRegistry) Less(i, j int) bool {
+	keyI := tokenStoreKey(tokens[i].Region, tokens[i].EndpointOverride, tokens[i].RegistryID, "")
+	keyJ := tokenStoreKey(tokens[j].Region, tokens[j].EndpointOverride, tokens[j].RegistryID, "")
+	if keyI == keyJ {
+		return !tokens[i].ExecutionRole && tokens[j].ExecutionRole
+	}
+	return keyI < keyJ
+}
+
+// MarshalJSON encrypts the tokens that have not expired yet. Nothing is saved
+// when the store has no key.
+func (store *TokenStore) MarshalJSON() ([]byte, error) {
+	if store.key == nil {
+		return json.Marshal(nil)
+	}
+
+	store.lock.RLock()
+	now := time.Now()
+	tokens := []*storedToken{}
+	for _, token := range store.tokens {
+		if token.AuthorizationData == nil || !now.Before(aws.TimeValue(token.AuthorizationData.ExpiresAt)) {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	plaintext, err := json.Marshal(tokens)
+	store.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := store.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(savedTokenStore{
+		Nonce:  nonce,
+		Tokens: gcm.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// UnmarshalJSON decrypts the saved tokens. A store that can't be decrypted,
+// for instance because the key was replaced, is dropped instead of failing
+// the load of the whole state.
+func (store *TokenStore) UnmarshalJSON(data []byte) error {
+	var saved *savedTokenStore
+	err := json.Unmarshal(data, &saved)
+	if err != nil {
+		return err
+	}
+	if saved == nil || store.key == nil {
+		return nil
+	}
+
+	gcm, err := store.gcm()
+	if err != nil {
+		return err
+	}
+	if len(saved.Nonce) != gcm.NonceSize() {
+		log.Warn("Dropping the saved ecr authorization tokens: invalid nonce")
+		return nil
+	}
+	plaintext, err := gcm.Open(nil, saved.Nonce, saved.Tokens, nil)
+	if err != nil {
+		log.Warnf("Dropping the saved ecr authorization tokens: %v", err)
+		return nil
+	}
+	var tokens []*storedToken
+	err = json.Unmarshal(plaintext, &tokens)
+	if err != nil {
+		log.Warnf("Dropping the saved ecr authorization tokens: %v", err)
+		return nil
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	now := time.Now()
+	store.tokens = make(map[string]*storedToken)
+	for _, token := range tokens {
+		if token.AuthorizationData == nil || !now.Before(aws.TimeValue(token.AuthorizationData.ExpiresAt)) {
+			continue
+		}
+		store.tokens[tokenStoreKey(token.Region, token.EndpointOverride, token.RegistryID, token.CredentialsID)] = token
+	}
+	log.Infof("Restored %d ecr authorization tokens", len(store.tokens))
+	return nil
+}
+
+func (store *TokenStore) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(store.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// tokenStoreCache is the async.Cache of the tokens of a region, endpoint and
+// role credentials, keyed by registry.
+type tokenStoreCache struct {
+	store            *TokenStore
+	region           string
+	endpointOverride string
+	credentialsID    string
+}
+
+func (cache *tokenStoreCache) Get(key string) (async.Value, bool) {
+	authData, ok := cache.store.get(cache.region, cache.endpointOverride, key, cache.credentialsID)
+	if !ok {
+		return nil, false
+	}
+	return authData, true
+}
+
+func (cache *tokenStoreCache) Set(key string, value async.Value) {
+	cache.store.set(cache.region, cache.endpointOverride, key, cache.credentialsID, value.(*ecrapi.AuthorizationData))
+}
+
+func (cache *tokenStoreCache) recordLookup(registryID string, hit bool) {
+	cache.store.recordLookup(cache.region, cache.endpointOverride, registryID, cache.credentialsID, hit)
+}
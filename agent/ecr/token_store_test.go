@@ -0,0 +1,232 @@
+// +build !integration
+
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ecrapi "github.com/aws/amazon-ecs-agent/agent/ecr/model/ecr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// fakeECRSDK returns the same authorization data for every registry
+type fakeECRSDK struct {
+	authData *ecrapi.AuthorizationData
+	calls    int
+}
+
+func (sdk *fakeECRSDK) GetAuthorizationToken(*ecrapi.GetAuthorizationTokenInput) (*ecrapi.GetAuthorizationTokenOutput, error) {
+	sdk.calls++
+	if sdk.authData == nil {
+		return nil, errors.New("no token")
+	}
+	return &ecrapi.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecrapi.AuthorizationData{sdk.authData},
+	}, nil
+}
+
+func testTokenKey() []byte {
+	key := make([]byte, tokenKeySize)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func testAuthData(expiresIn time.Duration) *ecrapi.AuthorizationData {
+	return &ecrapi.AuthorizationData{
+		ProxyEndpoint:      aws.String("https://123456789012.dkr.ecr.us-west-2.amazonaws.com"),
+		AuthorizationToken: aws.String("token"),
+		ExpiresAt:          aws.Time(time.Now().Add(expiresIn)),
+	}
+}
+
+func TestNewTokenStoreInvalidKey(t *testing.T) {
+	_, err := NewTokenStore([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestTokenStoreRoundTrip(t *testing.T) {
+	store, err := NewTokenStore(testTokenKey())
+	require.NoError(t, err)
+	store.cache("us-west-2", "", "").Set("123456789012", testAuthData(12*time.Hour))
+	store.cache("us-west-2", "", "").Set("expired", testAuthData(-time.Minute))
+
+	data, err := json.Marshal(store)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "token", "Tokens should be encrypted")
+
+	restored, err := NewTokenStore(testTokenKey())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, restored))
+
+	value, ok := restored.cache("us-west-2", "", "").Get("123456789012")
+	require.True(t, ok)
+	assert.Equal(t, "token", aws.StringValue(value.(*ecrapi.AuthorizationData).AuthorizationToken))
+	_, ok = restored.cache("us-west-2", "", "").Get("expired")
+	assert.False(t, ok, "Expired tokens should not be saved")
+	_, ok = restored.cache("us-east-1", "", "").Get("123456789012")
+	assert.False(t, ok, "Tokens should be kept by region")
+}
+
+func TestTokenStoreWrongKeyDropsTokens(t *testing.T) {
+	store, _ := NewTokenStore(testTokenKey())
+	store.cache("us-west-2", "", "").Set("123456789012", testAuthData(12*time.Hour))
+	data, err := json.Marshal(store)
+	require.NoError(t, err)
+
+	otherKey := testTokenKey()
+	otherKey[0] = 0xff
+	restored, _ := NewTokenStore(otherKey)
+	require.NoError(t, json.Unmarshal(data, restored))
+	assert.Empty(t, restored.Stats().Tokens)
+}
+
+func TestTokenStoreWithoutKeyIsNotSaved(t *testing.T) {
+	store, _ := NewTokenStore(nil)
+	store.cache("us-west-2", "", "").Set("123456789012", testAuthData(12*time.Hour))
+
+	data, err := json.Marshal(store)
+	require.NoError(t, err)
+	assert.Equal(t, "null", string(data))
+	assert.NoError(t, json.Unmarshal(data, store))
+}
+
+func TestTokenStoreStats(t *testing.T) {
+	store, _ := NewTokenStore(nil)
+	sdk := &fakeECRSDK{authData: testAuthData(12 * time.Hour)}
+	client := NewECRClient(sdk, store.cache("us-west-2", "", ""))
+
+	_, err := client.GetAuthorizationToken("123456789012")
+	require.NoError(t, err)
+	_, err = client.GetAuthorizationToken("123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, 1, sdk.calls)
+
+	stats := store.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	require.Len(t, stats.Tokens, 1)
+	assert.Equal(t, "123456789012", stats.Tokens[0].RegistryID)
+	assert.Equal(t, "us-west-2", stats.Tokens[0].Region)
+	assert.False(t, stats.Tokens[0].FetchedAt.IsZero())
+
+	store.Reset()
+	assert.Empty(t, store.Stats().Tokens)
+}
+
+func TestTokenStoreRoleTokens(t *testing.T) {
+	store, _ := NewTokenStore(testTokenKey())
+	instanceSDK := &fakeECRSDK{authData: testAuthData(12 * time.Hour)}
+	roleSDK := &fakeECRSDK{authData: testAuthData(12 * time.Hour)}
+	instanceClient := NewECRClient(instanceSDK, store.cache("us-west-2", "", ""))
+	roleClient := NewECRClient(roleSDK, store.cache("us-west-2", "", "role-credentials"))
+
+	// Tokens are shared by the clients of a role, never across roles
+	_, err := instanceClient.GetAuthorizationToken("123456789012")
+	require.NoError(t, err)
+	_, err = roleClient.GetAuthorizationToken("123456789012")
+	require.NoError(t, err)
+	_, err = NewECRClient(roleSDK, store.cache("us-west-2", "", "role-credentials")).GetAuthorizationToken("123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, 1, instanceSDK.calls)
+	assert.Equal(t, 1, roleSDK.calls)
+
+	stats := store.Stats()
+	require.Len(t, stats.Tokens, 2)
+	assert.False(t, stats.Tokens[0].ExecutionRole)
+	assert.True(t, stats.Tokens[1].ExecutionRole)
+
+	// Role tokens are restored under their credentials ID
+	data, err := json.Marshal(store)
+	require.NoError(t, err)
+	restored, _ := NewTokenStore(testTokenKey())
+	require.NoError(t, json.Unmarshal(data, restored))
+	_, ok := restored.cache("us-west-2", "", "role-credentials").Get("123456789012")
+	assert.True(t, ok)
+
+	// Expired role tokens are dropped when another role token is stored
+	store.cache("us-west-2", "", "expired-credentials").Set("123456789012", testAuthData(-time.Minute))
+	store.cache("us-west-2", "", "other-credentials").Set("123456789012", testAuthData(12*time.Hour))
+	_, ok = store.cache("us-west-2", "", "expired-credentials").Get("123456789012")
+	assert.False(t, ok)
+	assert.Len(t, store.Stats().Tokens, 3)
+}
+
+func TestLoadTokenKey(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "ecr_token_key")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	key, err := LoadTokenKey(dataDir)
+	require.NoError(t, err)
+	assert.Len(t, key, tokenKeySize)
+	info, err := os.Stat(filepath.Join(dataDir, TokenKeyFileName))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	again, err := LoadTokenKey(dataDir)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+}
+
+func TestPrefetchDelay(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, prefetchRetryMin, prefetchDelay(nil, now))
+	assert.Equal(t, prefetchRetryMin, prefetchDelay(testAuthData(time.Hour), now))
+
+	authData := &ecrapi.AuthorizationData{ExpiresAt: aws.Time(now.Add(12 * time.Hour))}
+	assert.Equal(t, 12*time.Hour-MaximumJitterDuration-prefetchMargin, prefetchDelay(authData, now))
+}
+
+func TestPrefetchIdle(t *testing.T) {
+	client := newPrefetchingECRClient(context.TODO(), &fakeECRSDK{}, nil).(*ecrClient)
+	client.prefetchedUsed["recent"] = time.Now()
+	client.prefetchedUsed["idle"] = time.Now().Add(-prefetchIdleTimeout)
+
+	assert.False(t, client.prefetchIdle("recent"))
+	assert.True(t, client.prefetchIdle("idle"))
+	_, ok := client.prefetchedUsed["idle"]
+	assert.False(t, ok, "Idle registries should be prefetched again when used")
+}
+
+func TestPrefetchStopsWhenCancelled(t *testing.T) {
+	store, _ := NewTokenStore(nil)
+	ctx, cancel := context.WithCancel(context.TODO())
+	client := newPrefetchingECRClient(ctx, &fakeECRSDK{}, store.cache("us-west-2", "", "")).(*ecrClient)
+
+	done := make(chan struct{})
+	go func() {
+		client.prefetchToken("123456789012")
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Prefetch should stop when its context is cancelled")
+	}
+}
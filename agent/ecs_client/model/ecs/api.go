@@ -4103,6 +4103,8 @@ type ContainerStateChange struct {
 
 	ExitCode *int64 `locationName:"exitCode" type:"integer"`
 
+	ImageDigest *string `locationName:"imageDigest" type:"string"`
+
 	NetworkBindings []*NetworkBinding `locationName:"networkBindings" type:"list"`
 
 	Reason *string `locationName:"reason" type:"string"`
@@ -4132,6 +4134,12 @@ func (s *ContainerStateChange) SetExitCode(v int64) *ContainerStateChange {
 	return s
 }
 
+// SetImageDigest sets the ImageDigest field's value.
+func (s *ContainerStateChange) SetImageDigest(v string) *ContainerStateChange {
+	s.ImageDigest = &v
+	return s
+}
+
 // SetNetworkBindings sets the NetworkBindings field's value.
 func (s *ContainerStateChange) SetNetworkBindings(v []*NetworkBinding) *ContainerStateChange {
 	s.NetworkBindings = v
@@ -7636,6 +7644,8 @@ type SubmitTaskStateChangeInput struct {
 	// The reason for the state change request.
 	Reason *string `locationName:"reason" type:"string"`
 
+	ReasonCode *string `locationName:"reasonCode" type:"string"`
+
 	// The status of the state change request.
 	Status *string `locationName:"status" type:"string"`
 
@@ -7672,6 +7682,12 @@ func (s *SubmitTaskStateChangeInput) SetReason(v string) *SubmitTaskStateChangeI
 	return s
 }
 
+// SetReasonCode sets the ReasonCode field's value.
+func (s *SubmitTaskStateChangeInput) SetReasonCode(v string) *SubmitTaskStateChangeInput {
+	s.ReasonCode = &v
+	return s
+}
+
 // SetStatus sets the Status field's value.
 func (s *SubmitTaskStateChangeInput) SetStatus(v string) *SubmitTaskStateChangeInput {
 	s.Status = &v
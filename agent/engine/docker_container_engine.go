@@ -31,6 +31,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockeriface"
 	"github.com/aws/amazon-ecs-agent/agent/engine/emptyvolume"
+	"github.com/aws/amazon-ecs-agent/agent/ssm"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
 	"github.com/cihub/seelog"
 
@@ -52,6 +53,7 @@ const (
 	removeContainerTimeout  = 5 * time.Minute
 	inspectContainerTimeout = 30 * time.Second
 	removeImageTimeout      = 3 * time.Minute
+	tagImageTimeout         = 30 * time.Second
 
 	// dockerPullBeginTimeout is the timeout from when a 'pull' is called to when
 	// we expect to see output on the pull progress stream. This is to work
@@ -126,6 +128,10 @@ type DockerClient interface {
 	// RemoveImage removes the metadata associated with an image and may remove the underlying layer data. A timeout
 	// value should be provided for the request.
 	RemoveImage(string, time.Duration) error
+
+	// TagImage adds the target reference as a name of the source image. A timeout value should be provided for the
+	// request.
+	TagImage(source string, target string, timeout time.Duration) error
 }
 
 // DockerGoClient wraps the underlying go-dockerclient library.
@@ -148,6 +154,7 @@ type dockerGoClient struct {
 	version          dockerclient.DockerVersion
 	auth             dockerauth.DockerAuthProvider
 	ecrClientFactory ecr.ECRFactory
+	ssmClientFactory ssm.SSMFactory
 	config           *config.Config
 
 	_time     ttime.Time
@@ -156,18 +163,23 @@ type dockerGoClient struct {
 
 func (dg *dockerGoClient) WithVersion(version dockerclient.DockerVersion) DockerClient {
 	return &dockerGoClient{
-		clientFactory: dg.clientFactory,
-		version:       version,
-		auth:          dg.auth,
-		config:        dg.config,
+		clientFactory:    dg.clientFactory,
+		version:          version,
+		auth:             dg.auth,
+		ecrClientFactory: dg.ecrClientFactory,
+		ssmClientFactory: dg.ssmClientFactory,
+		config:           dg.config,
 	}
 }
 
 // scratchCreateLock guards against multiple 'scratch' image creations at once
 var scratchCreateLock sync.Mutex
 
-// NewDockerGoClient creates a new DockerGoClient
-func NewDockerGoClient(clientFactory dockerclient.Factory, cfg *config.Config) (DockerClient, error) {
+// NewDockerGoClient creates a new DockerGoClient. The authorization tokens of
+// the ECR registries pulled from on behalf of the instance are kept in
+// ecrTokenStore, and refreshed in the background until ctx is cancelled; each
+// ECR client keeps its own tokens when it is nil.
+func NewDockerGoClient(ctx context.Context, clientFactory dockerclient.Factory, cfg *config.Config, ecrTokenStore *ecr.TokenStore) (DockerClient, error) {
 	client, err := clientFactory.GetDefaultClient()
 	if err != nil {
 		log.Error("Unable to connect to docker daemon. Ensure docker is running.", "err", err)
@@ -189,7 +201,8 @@ func NewDockerGoClient(clientFactory dockerclient.Factory, cfg *config.Config) (
 	return &dockerGoClient{
 		clientFactory:    clientFactory,
 		auth:             dockerauth.NewDockerAuthProvider(cfg.EngineAuthType, dockerAuthData),
-		ecrClientFactory: ecr.NewECRFactory(cfg.AcceptInsecureCert),
+		ecrClientFactory: ecr.NewECRFactory(ctx, cfg, ecrTokenStore),
+		ssmClientFactory: ssm.NewSSMFactory(cfg),
 		config:           cfg,
 	}, nil
 }
@@ -365,15 +378,27 @@ func (dg *dockerGoClient) InspectImage(image string) (*docker.Image, error) {
 }
 
 func (dg *dockerGoClient) getAuthdata(image string, authData *api.RegistryAuthenticationData) (docker.AuthConfiguration, error) {
-	if authData == nil || authData.Type != "ecr" {
+	if authData == nil {
 		return dg.auth.GetAuthconfig(image)
 	}
-	provider := dockerauth.NewECRAuthProvider(authData.ECRAuthData, dg.ecrClientFactory)
-	authConfig, err := provider.GetAuthconfig(image)
-	if err != nil {
-		return authConfig, CannotPullECRContainerError{err}
+	switch authData.Type {
+	case api.ECRAuthType:
+		provider := dockerauth.NewECRAuthProvider(authData.ECRAuthData, dg.ecrClientFactory)
+		authConfig, err := provider.GetAuthconfig(image)
+		if err != nil {
+			return authConfig, CannotPullECRContainerError{err}
+		}
+		return authConfig, nil
+	case api.SSMAuthType:
+		provider := dockerauth.NewSSMAuthProvider(authData.SSMAuthData, dg.ssmClientFactory)
+		authConfig, err := provider.GetAuthconfig(image)
+		if err != nil {
+			return authConfig, CannotPullSSMContainerError{err}
+		}
+		return authConfig, nil
+	default:
+		return dg.auth.GetAuthconfig(image)
 	}
-	return authConfig, nil
 }
 
 func (dg *dockerGoClient) CreateContainer(config *docker.Config, hostConfig *docker.HostConfig, name string, timeout time.Duration) DockerContainerMetadata {
@@ -622,6 +647,7 @@ func (dg *dockerGoClient) containerMetadata(id string) DockerContainerMetadata {
 
 func metadataFromContainer(dockerContainer *docker.Container) DockerContainerMetadata {
 	var bindings []api.PortBinding
+	var ipAddresses []string
 	var err api.NamedError
 	if dockerContainer.NetworkSettings != nil {
 		// Convert port bindings into the format our container expects
@@ -630,11 +656,13 @@ func metadataFromContainer(dockerContainer *docker.Container) DockerContainerMet
 			log.Crit("Docker had network bindings we couldn't understand", "err", err)
 			return DockerContainerMetadata{Error: api.NamedError(err)}
 		}
+		ipAddresses = ipAddressesFromNetworkSettings(dockerContainer.NetworkSettings)
 	}
 	metadata := DockerContainerMetadata{
 		DockerID:     dockerContainer.ID,
 		PortBindings: bindings,
 		Volumes:      dockerContainer.Volumes,
+		IPAddresses:  ipAddresses,
 	}
 	// Workaround for https://github.com/docker/docker/issues/27601
 	// See https://github.com/docker/docker/blob/v1.12.2/daemon/inspect_unix.go#L38-L43
@@ -659,6 +687,27 @@ func metadataFromContainer(dockerContainer *docker.Container) DockerContainerMet
 	return metadata
 }
 
+// ipAddressesFromNetworkSettings returns the addresses of a container on the
+// default bridge and on the other networks it is attached to. The result is
+// empty, rather than nil, for a container without addresses, such as a stopped
+// container or one on the host network.
+func ipAddressesFromNetworkSettings(networkSettings *docker.NetworkSettings) []string {
+	ipAddresses := []string{}
+	seen := make(map[string]struct{})
+	add := func(ipAddress string) {
+		if _, ok := seen[ipAddress]; ipAddress == "" || ok {
+			return
+		}
+		seen[ipAddress] = struct{}{}
+		ipAddresses = append(ipAddresses, ipAddress)
+	}
+	add(networkSettings.IPAddress)
+	for _, network := range networkSettings.Networks {
+		add(network.IPAddress)
+	}
+	return ipAddresses
+}
+
 // Listen to the docker event stream for container changes and pass them up
 func (dg *dockerGoClient) ContainerEvents(ctx context.Context) (<-chan DockerContainerChangeEvent, error) {
 	client, err := dg.dockerClient()
@@ -887,3 +936,35 @@ func (dg *dockerGoClient) removeImage(imageName string) error {
 	}
 	return client.RemoveImage(imageName)
 }
+
+// TagImage adds the target reference as a name of the source image
+func (dg *dockerGoClient) TagImage(source string, target string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	response := make(chan error, 1)
+	go func() { response <- dg.tagImage(ctx, source, target) }()
+	select {
+	case resp := <-response:
+		return resp
+	case <-ctx.Done():
+		return &DockerTimeoutError{timeout, "tagging image"}
+	}
+}
+
+func (dg *dockerGoClient) tagImage(ctx context.Context, source string, target string) error {
+	client, err := dg.dockerClient()
+	if err != nil {
+		return err
+	}
+	repository, tag := parseRepositoryTag(target)
+	if tag == "" {
+		tag = dockerDefaultTag
+	}
+	return client.TagImage(source, docker.TagImageOptions{
+		Repo:    repository,
+		Tag:     tag,
+		Force:   true,
+		Context: ctx,
+	})
+}
@@ -28,10 +28,12 @@ import (
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/ec2"
 	"github.com/aws/amazon-ecs-agent/agent/ecr/mocks"
 	ecrapi "github.com/aws/amazon-ecs-agent/agent/ecr/model/ecr"
@@ -39,6 +41,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockeriface/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/emptyvolume"
+	"github.com/aws/amazon-ecs-agent/agent/ssm/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ttime/mocks"
 )
 
@@ -65,7 +68,7 @@ func dockerClientSetupWithConfig(t *testing.T, conf config.Config) (*mock_docker
 	mockTime := mock_ttime.NewMockTime(ctrl)
 
 	conf.EngineAuthData = config.NewSensitiveRawMessage([]byte{})
-	client, _ := NewDockerGoClient(factory, &conf)
+	client, _ := NewDockerGoClient(context.TODO(), factory, &conf, nil)
 	goClient, _ := client.(*dockerGoClient)
 	ecrClientFactory := mock_ecr.NewMockECRFactory(ctrl)
 	goClient.ecrClientFactory = ecrClientFactory
@@ -241,7 +244,7 @@ func TestPullImageECRSuccess(t *testing.T) {
 	mockDocker.EXPECT().Ping().AnyTimes().Return(nil)
 	factory := mock_dockerclient.NewMockFactory(ctrl)
 	factory.EXPECT().GetDefaultClient().AnyTimes().Return(mockDocker, nil)
-	client, _ := NewDockerGoClient(factory, defaultTestConfig())
+	client, _ := NewDockerGoClient(context.TODO(), factory, defaultTestConfig(), nil)
 	goClient, _ := client.(*dockerGoClient)
 	ecrClientFactory := mock_ecr.NewMockECRFactory(ctrl)
 	ecrClient := mock_ecr.NewMockECRClient(ctrl)
@@ -297,7 +300,7 @@ func TestPullImageECRAuthFail(t *testing.T) {
 	mockDocker.EXPECT().Ping().AnyTimes().Return(nil)
 	factory := mock_dockerclient.NewMockFactory(ctrl)
 	factory.EXPECT().GetDefaultClient().AnyTimes().Return(mockDocker, nil)
-	client, _ := NewDockerGoClient(factory, defaultTestConfig())
+	client, _ := NewDockerGoClient(context.TODO(), factory, defaultTestConfig(), nil)
 	goClient, _ := client.(*dockerGoClient)
 	ecrClientFactory := mock_ecr.NewMockECRFactory(ctrl)
 	ecrClient := mock_ecr.NewMockECRClient(ctrl)
@@ -330,6 +333,81 @@ func TestPullImageECRAuthFail(t *testing.T) {
 	}
 }
 
+func TestPullImageSSMAuth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockDocker := mock_dockeriface.NewMockClient(ctrl)
+	mockDocker.EXPECT().Ping().AnyTimes().Return(nil)
+	factory := mock_dockerclient.NewMockFactory(ctrl)
+	factory.EXPECT().GetDefaultClient().AnyTimes().Return(mockDocker, nil)
+	client, _ := NewDockerGoClient(context.TODO(), factory, defaultTestConfig(), nil)
+	goClient, _ := client.(*dockerGoClient)
+	ssmClientFactory := mock_ssm.NewMockSSMFactory(ctrl)
+	ssmClient := mock_ssm.NewMockSSMClient(ctrl)
+	mockTime := mock_ttime.NewMockTime(ctrl)
+	goClient.ssmClientFactory = ssmClientFactory
+	goClient._time = mockTime
+
+	mockTime.EXPECT().After(gomock.Any()).AnyTimes()
+
+	roleCredentials := credentials.IAMRoleCredentials{
+		AccessKeyID:     "akid",
+		SecretAccessKey: "skid",
+		SessionToken:    "token",
+	}
+	authData := (&api.RegistryAuthenticationData{
+		Type: "ssm",
+		SSMAuthData: &api.SSMAuthData{
+			ParameterName: "/registry/creds",
+			Region:        "eu-west-1",
+		},
+	}).WithRoleCredentials(roleCredentials)
+	image := "registry.example.com/myimage:tag"
+
+	ssmClientFactory.EXPECT().GetClient("eu-west-1", roleCredentials).Return(ssmClient)
+	ssmClient.EXPECT().GetParameter("/registry/creds").Return(`{"username":"username","password":"password"}`, nil)
+	mockDocker.EXPECT().PullImage(
+		&pullImageOptsMatcher{image},
+		docker.AuthConfiguration{Username: "username", Password: "password"},
+	).Return(nil)
+
+	metadata := client.PullImage(image, authData)
+	assert.NoError(t, metadata.Error, "Expected pull to succeed")
+}
+
+func TestPullImageSSMAuthFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockDocker := mock_dockeriface.NewMockClient(ctrl)
+	mockDocker.EXPECT().Ping().AnyTimes().Return(nil)
+	factory := mock_dockerclient.NewMockFactory(ctrl)
+	factory.EXPECT().GetDefaultClient().AnyTimes().Return(mockDocker, nil)
+	client, _ := NewDockerGoClient(context.TODO(), factory, defaultTestConfig(), nil)
+	goClient, _ := client.(*dockerGoClient)
+	ssmClientFactory := mock_ssm.NewMockSSMFactory(ctrl)
+	ssmClient := mock_ssm.NewMockSSMClient(ctrl)
+	mockTime := mock_ttime.NewMockTime(ctrl)
+	goClient.ssmClientFactory = ssmClientFactory
+	goClient._time = mockTime
+
+	mockTime.EXPECT().After(gomock.Any()).AnyTimes()
+
+	authData := (&api.RegistryAuthenticationData{
+		Type: "ssm",
+		SSMAuthData: &api.SSMAuthData{
+			ParameterName: "/registry/creds",
+			Region:        "eu-west-1",
+		},
+	}).WithRoleCredentials(credentials.IAMRoleCredentials{})
+
+	ssmClientFactory.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(ssmClient)
+	ssmClient.EXPECT().GetParameter(gomock.Any()).Return("", errors.New("test error"))
+
+	metadata := client.PullImage("registry.example.com/myimage:tag", authData)
+	require.Error(t, metadata.Error, "Expected pull to fail")
+	assert.Equal(t, "CannotPullContainerError", metadata.Error.ErrorName())
+}
+
 func TestCreateContainerTimeout(t *testing.T) {
 	mockDocker, client, _, done := dockerClientSetup(t)
 	defer done()
@@ -731,7 +809,7 @@ func TestPingFailError(t *testing.T) {
 	mockDocker.EXPECT().Ping().Return(errors.New("err"))
 	factory := mock_dockerclient.NewMockFactory(ctrl)
 	factory.EXPECT().GetDefaultClient().Return(mockDocker, nil)
-	_, err := NewDockerGoClient(factory, defaultTestConfig())
+	_, err := NewDockerGoClient(context.TODO(), factory, defaultTestConfig(), nil)
 	if err == nil {
 		t.Fatal("Expected ping error to result in constructor fail")
 	}
@@ -744,7 +822,7 @@ func TestUsesVersionedClient(t *testing.T) {
 	mockDocker.EXPECT().Ping().Return(nil)
 	factory := mock_dockerclient.NewMockFactory(ctrl)
 	factory.EXPECT().GetDefaultClient().Return(mockDocker, nil)
-	client, err := NewDockerGoClient(factory, defaultTestConfig())
+	client, err := NewDockerGoClient(context.TODO(), factory, defaultTestConfig(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -765,7 +843,7 @@ func TestUnavailableVersionError(t *testing.T) {
 	mockDocker.EXPECT().Ping().Return(nil)
 	factory := mock_dockerclient.NewMockFactory(ctrl)
 	factory.EXPECT().GetDefaultClient().Return(mockDocker, nil)
-	client, err := NewDockerGoClient(factory, defaultTestConfig())
+	client, err := NewDockerGoClient(context.TODO(), factory, defaultTestConfig(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -934,6 +1012,33 @@ func TestRemoveImage(t *testing.T) {
 	}
 }
 
+func TestTagImage(t *testing.T) {
+	mockDocker, client, _, done := dockerClientSetup(t)
+	defer done()
+
+	mockDocker.EXPECT().TagImage("mirror.example.com/dockerhub/busybox:1.26", gomock.Any()).Do(
+		func(name string, opts docker.TagImageOptions) {
+			assert.Equal(t, "busybox", opts.Repo)
+			assert.Equal(t, "1.26", opts.Tag)
+			assert.True(t, opts.Force)
+		}).Return(nil)
+	err := client.TagImage("mirror.example.com/dockerhub/busybox:1.26", "busybox:1.26", time.Second)
+	assert.NoError(t, err)
+}
+
+func TestTagImageDefaultTag(t *testing.T) {
+	mockDocker, client, _, done := dockerClientSetup(t)
+	defer done()
+
+	mockDocker.EXPECT().TagImage("mirror.example.com/dockerhub/busybox", gomock.Any()).Do(
+		func(name string, opts docker.TagImageOptions) {
+			assert.Equal(t, "busybox", opts.Repo)
+			assert.Equal(t, "latest", opts.Tag)
+		}).Return(nil)
+	err := client.TagImage("mirror.example.com/dockerhub/busybox", "busybox", time.Second)
+	assert.NoError(t, err)
+}
+
 func TestContainerMetadataWorkaroundIssue27601(t *testing.T) {
 	mockDocker, client, _, _ := dockerClientSetup(t)
 	mockDocker.EXPECT().InspectContainerWithContext("id", gomock.Any()).Return(&docker.Container{
@@ -948,3 +1053,25 @@ func TestContainerMetadataWorkaroundIssue27601(t *testing.T) {
 	metadata := client.containerMetadata("id")
 	assert.Equal(t, map[string]string{"destination1": "source1", "destination2": "source2"}, metadata.Volumes)
 }
+
+func TestMetadataFromContainerIPAddresses(t *testing.T) {
+	metadata := metadataFromContainer(&docker.Container{
+		ID: "cid",
+		NetworkSettings: &docker.NetworkSettings{
+			IPAddress: "172.17.0.2",
+			Networks: map[string]docker.ContainerNetwork{
+				"bridge": {IPAddress: "172.17.0.2"},
+				"user":   {IPAddress: "172.18.0.5"},
+				"none":   {},
+			},
+		},
+	})
+	assert.Len(t, metadata.IPAddresses, 2)
+	assert.Contains(t, metadata.IPAddresses, "172.17.0.2")
+	assert.Contains(t, metadata.IPAddresses, "172.18.0.5")
+
+	// A stopped container has no addresses left
+	metadata = metadataFromContainer(&docker.Container{ID: "cid", NetworkSettings: &docker.NetworkSettings{}})
+	assert.NotNil(t, metadata.IPAddresses)
+	assert.Empty(t, metadata.IPAddresses)
+}
@@ -115,6 +115,9 @@ func (imageManager *dockerImageManager) RecordContainerReference(container *api.
 	}
 
 	container.ImageID = imageInspected.ID
+	if digest := repoDigest(imageInspected.RepoDigests, container.Image); digest != "" {
+		container.SetImageDigest(digest)
+	}
 	added := imageManager.addContainerReferenceToExistingImageState(container)
 	if !added {
 		imageManager.addContainerReferenceToNewImageState(container, imageInspected.Size)
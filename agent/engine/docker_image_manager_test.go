@@ -157,6 +157,37 @@ func TestRecordContainerReferenceInspectError(t *testing.T) {
 	}
 }
 
+func TestRecordContainerReferenceSetsImageDigest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := NewMockDockerClient(ctrl)
+
+	imageManager := &dockerImageManager{
+		client: client,
+		state:  dockerstate.NewTaskEngineState(),
+		minimumAgeBeforeDeletion: config.DefaultImageDeletionAge,
+		numImagesToDelete:        config.DefaultNumImagesToDeletePerCycle,
+		imageCleanupTimeInterval: config.DefaultImageCleanupTimeInterval,
+	}
+	imageManager.SetSaver(statemanager.NewNoopStateManager())
+
+	container := &api.Container{
+		Name:  "testContainer",
+		Image: "busybox:1.26",
+	}
+	client.EXPECT().InspectImage(container.Image).Return(&docker.Image{
+		ID: "sha256:qwerty",
+		RepoDigests: []string{
+			"mirror.example.com/dockerhub/busybox@sha256:mirror",
+			"busybox@sha256:hub",
+		},
+	}, nil)
+	err := imageManager.RecordContainerReference(container)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:qwerty", container.ImageID)
+	assert.Equal(t, "sha256:hub", container.GetImageDigest())
+}
+
 func TestRecordContainerReferenceWithNoImageName(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
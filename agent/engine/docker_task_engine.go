@@ -17,18 +17,21 @@ package engine
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/cgroup"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dependencygraph"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/agent/statechange"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
@@ -45,6 +48,7 @@ const (
 	capabilityPrefix             = "com.amazonaws.ecs.capability."
 	capabilityTaskIAMRole        = "task-iam-role"
 	capabilityTaskIAMRoleNetHost = "task-iam-role-network-host"
+	capabilityCgroupV2           = "cgroup-v2"
 	labelPrefix                  = "com.amazonaws.ecs."
 )
 
@@ -93,6 +97,12 @@ type DockerTaskEngine struct {
 	_time                ttime.Time
 	_timeOnce            sync.Once
 	imageManager         ImageManager
+	imageRewriter        *imageRewriter
+	imageAdmission       *imageAdmission
+	auditLogger          audit.AuditLogger
+
+	// cgroupInfo describes the cgroup hierarchy of the host
+	cgroupInfo cgroup.Info
 }
 
 // NewDockerTaskEngine returns a created, but uninitialized, DockerTaskEngine.
@@ -116,6 +126,9 @@ func NewDockerTaskEngine(cfg *config.Config, client DockerClient, credentialsMan
 
 		containerChangeEventStream: containerChangeEventStream,
 		imageManager:               imageManager,
+		imageRewriter:              newImageRewriter(cfg.ImagePullRewriteRules),
+		imageAdmission:             newImageAdmission(cfg.ImageAdmissionPolicy),
+		cgroupInfo:                 cgroup.Detect(),
 	}
 
 	return dockerTaskEngine
@@ -197,6 +210,12 @@ func (engine *DockerTaskEngine) SetSaver(saver statemanager.Saver) {
 	engine.saver = saver
 }
 
+// SetAuditLogger sets the audit logger that records the images denied by the
+// image admission policy
+func (engine *DockerTaskEngine) SetAuditLogger(auditLogger audit.AuditLogger) {
+	engine.auditLogger = auditLogger
+}
+
 // Shutdown makes a best-effort attempt to cleanup after the task engine.
 // This should not be relied on for anything more complicated than testing.
 func (engine *DockerTaskEngine) Shutdown() {
@@ -246,7 +265,7 @@ func (engine *DockerTaskEngine) synchronizeState() {
 				if metadata.Error != nil {
 					currentState = api.ContainerStopped
 					if !cont.Container.KnownTerminal() {
-						cont.Container.ApplyingError = api.NewNamedError(&ContainerVanishedError{})
+						cont.Container.SetApplyingError(api.NewNamedError(&ContainerVanishedError{}))
 						log.Warn("Could not describe previously known container; assuming dead", "err", metadata.Error, "id", cont.DockerID, "name", cont.DockerName)
 						engine.imageManager.RemoveContainerReferenceFromImageState(cont.Container)
 					}
@@ -366,15 +385,16 @@ func (engine *DockerTaskEngine) emitContainerEvent(task *api.Task, cont *api.Con
 		return
 	}
 
-	if reason == "" && cont.ApplyingError != nil {
-		reason = cont.ApplyingError.Error()
+	if applyingError := cont.GetApplyingError(); reason == "" && applyingError != nil {
+		reason = applyingError.Error()
 	}
 	event := api.ContainerStateChange{
 		TaskArn:       task.Arn,
 		ContainerName: cont.Name,
 		Status:        contKnownStatus,
 		ExitCode:      cont.GetKnownExitCode(),
-		PortBindings:  cont.KnownPortBindings,
+		PortBindings:  cont.GetKnownPortBindings(),
+		ImageDigest:   cont.GetImageDigest(),
 		Reason:        reason,
 		Container:     cont,
 	}
@@ -540,17 +560,119 @@ func (engine *DockerTaskEngine) pullAndUpdateContainerReference(task *api.Task,
 		return DockerContainerMetadata{Error: TaskStoppedBeforePullBeginError{task.Arn}}
 	}
 
-	metadata := engine.client.PullImage(container.Image, container.RegistryAuthentication)
-	err := engine.imageManager.RecordContainerReference(container)
+	authData, err := engine.registryAuthData(task, container)
+	if err != nil {
+		seelog.Errorf("Unable to get registry authentication data for container %v, task %v: %v", container, task, err)
+		return DockerContainerMetadata{Error: CannotPullContainerError{err}}
+	}
+	pulledImage, metadata := engine.pullImage(task, container, authData)
+	err = engine.imageManager.RecordContainerReference(container)
 	if err != nil {
 		seelog.Errorf("Error adding container reference to image state: %v", err)
 	}
 	imageState := engine.imageManager.GetImageStateFromImageName(container.Image)
+	if imageState != nil && pulledImage != container.Image {
+		imageState.AddImageName(pulledImage)
+	}
 	engine.state.AddImageState(imageState)
 	engine.saver.Save()
 	return metadata
 }
 
+// pullImage pulls the container's image, from the reference given by the image
+// pull rewrite rules when one matches, falling back to the image itself if that
+// fails. The rewritten reference is pulled with the engine auth, since the
+// container's registry authentication is meant for the registry of its image,
+// and the pulled image is tagged with the container's image, which the
+// container is created and reported with. When image digest pinning is enabled,
+// the image is pulled by the digest first resolved for it in the task, as is;
+// the container's tag is shared with the other tasks on the host, so it isn't
+// moved. It returns the reference the image was pulled from.
+func (engine *DockerTaskEngine) pullImage(task *api.Task, container *api.Container, authData *api.RegistryAuthenticationData) (string, DockerContainerMetadata) {
+	image := container.Image
+	if pinnedImage := engine.pinnedImageReference(task, container); pinnedImage != "" {
+		seelog.Infof("Image %s of container %s is pinned to %s", container.Image, container.Name, pinnedImage)
+		image = pinnedImage
+	}
+	candidates := []string{image}
+	if image == container.Image {
+		if rewrittenImage := engine.rewrittenImage(image); rewrittenImage != "" {
+			seelog.Infof("Pulling image %s of container %s from %s", container.Image, container.Name, rewrittenImage)
+			candidates = []string{rewrittenImage, image}
+		}
+	}
+
+	var metadata DockerContainerMetadata
+	for _, candidate := range candidates {
+		candidateAuthData := authData
+		if candidate != image {
+			candidateAuthData = nil
+		}
+		metadata = engine.client.PullImage(candidate, candidateAuthData)
+		if metadata.Error == nil && candidate != image {
+			if err := engine.client.TagImage(candidate, container.Image, tagImageTimeout); err != nil {
+				metadata = DockerContainerMetadata{Error: CannotPullContainerError{err}}
+			}
+		}
+		if metadata.Error == nil {
+			return candidate, metadata
+		}
+		if candidate != image {
+			seelog.Warnf("Unable to pull image %s from %s, pulling %s instead: %v", container.Image, candidate, image, metadata.Error)
+		}
+	}
+	return image, metadata
+}
+
+// rewrittenImage returns the reference the image pull rewrite rules give for
+// the image, which is pulled before the image itself, or an empty string when
+// no rule applies. An image pulled for a reference by digest can't be tagged
+// with it, so those are only pulled as they are.
+func (engine *DockerTaskEngine) rewrittenImage(image string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+	if rewrittenImage := engine.imageRewriter.rewrite(image); rewrittenImage != image {
+		return rewrittenImage
+	}
+	return ""
+}
+
+// registryAuthData returns the authentication data to pull the container's
+// image with. ECR authorization tokens are requested with the credentials of
+// the task's execution role, if it has one. Registry credentials stored in the
+// SSM Parameter Store are read with the execution role credentials, or the
+// task's IAM role credentials if it has no execution role. Role credentials
+// are only attached to a copy of the authentication data so that they never
+// end up in the saved state.
+func (engine *DockerTaskEngine) registryAuthData(task *api.Task, container *api.Container) (*api.RegistryAuthenticationData, error) {
+	authData := container.RegistryAuthentication
+	if authData == nil {
+		return nil, nil
+	}
+
+	if executionCredentialsID := task.GetExecutionCredentialsID(); executionCredentialsID != "" {
+		executionCredentials, ok := engine.credentialsManager.GetTaskExecutionCredentials(executionCredentialsID)
+		if !ok {
+			return nil, fmt.Errorf("no execution role credentials found for task")
+		}
+		return authData.WithRoleCredentials(executionCredentials.IAMRoleCredentials), nil
+	}
+	if authData.Type != api.SSMAuthType {
+		return authData, nil
+	}
+
+	credentialsID := task.GetCredentialsID()
+	if credentialsID == "" {
+		return nil, fmt.Errorf("task has no IAM role to read registry credentials with")
+	}
+	taskCredentials, ok := engine.credentialsManager.GetTaskCredentials(credentialsID)
+	if !ok {
+		return nil, fmt.Errorf("no IAM role credentials found for task")
+	}
+	return authData.WithRoleCredentials(taskCredentials.IAMRoleCredentials), nil
+}
+
 func (engine *DockerTaskEngine) createContainer(task *api.Task, container *api.Container) DockerContainerMetadata {
 	log.Info("Creating container", "task", task, "container", container)
 	client := engine.client
@@ -576,6 +698,9 @@ func (engine *DockerTaskEngine) createContainer(task *api.Task, container *api.C
 	if err != nil {
 		return DockerContainerMetadata{Error: api.NamedError(err)}
 	}
+	if pinnedImage := engine.pinnedImageReference(task, container); pinnedImage != "" {
+		config.Image = pinnedImage
+	}
 
 	// Augment labels with some metadata from the agent. Explicitly do this last
 	// such that it will always override duplicates in the provided raw config
@@ -633,6 +758,9 @@ func (engine *DockerTaskEngine) startContainer(task *api.Task, container *api.Co
 			Error: CannotStartContainerError{fmt.Errorf("Container not recorded as created")},
 		}
 	}
+	if digest := container.GetImageDigest(); digest != "" {
+		seelog.Infof("Starting container %s of task %s with image %s, digest %s", container.Name, task.Arn, container.Image, digest)
+	}
 	return client.StartContainer(dockerContainer.DockerID, startContainerTimeout)
 }
 
@@ -771,6 +899,8 @@ func (engine *DockerTaskEngine) State() dockerstate.TaskEngineState {
 //    com.amazonaws.ecs.capability.ecr-auth
 //    com.amazonaws.ecs.capability.task-iam-role
 //    com.amazonaws.ecs.capability.task-iam-role-network-host
+//    com.amazonaws.ecs.capability.cgroup-v2
+//    com.amazonaws.ecs.capability.cgroup-v2.<controller>, for each enabled controller
 func (engine *DockerTaskEngine) Capabilities() []string {
 	capabilities := []string{}
 	if !engine.cfg.PrivilegedDisabled {
@@ -830,6 +960,13 @@ func (engine *DockerTaskEngine) Capabilities() []string {
 		}
 	}
 
+	if engine.cgroupInfo.Unified() {
+		capabilities = append(capabilities, capabilityPrefix+capabilityCgroupV2)
+		for _, controller := range engine.cgroupInfo.Controllers {
+			capabilities = append(capabilities, capabilityPrefix+capabilityCgroupV2+"."+controller)
+		}
+	}
+
 	return capabilities
 }
 
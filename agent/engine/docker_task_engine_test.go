@@ -23,11 +23,13 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/cgroup"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/credentials/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/engine/image"
 	"github.com/aws/amazon-ecs-agent/agent/engine/testdata"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager/mocks"
@@ -36,6 +38,7 @@ import (
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"golang.org/x/net/context"
 )
@@ -55,6 +58,7 @@ func mocks(t *testing.T, cfg *config.Config) (*gomock.Controller, *MockDockerCli
 	imageManager := NewMockImageManager(ctrl)
 	taskEngine := NewTaskEngine(cfg, client, credentialsManager, containerChangeEventStream, imageManager, dockerstate.NewTaskEngineState())
 	taskEngine.(*DockerTaskEngine)._time = mockTime
+	taskEngine.(*DockerTaskEngine).cgroupInfo = cgroup.Info{}
 	return ctrl, client, mockTime, taskEngine, credentialsManager, imageManager
 }
 
@@ -1009,6 +1013,29 @@ func TestCapabilities(t *testing.T) {
 	}
 }
 
+func TestCapabilitiesCgroupV2(t *testing.T) {
+	conf := &config.Config{}
+	ctrl, client, _, taskEngine, _, _ := mocks(t, conf)
+	defer ctrl.Finish()
+	taskEngine.(*DockerTaskEngine).cgroupInfo = cgroup.Info{
+		Version:     cgroup.V2,
+		Controllers: []string{"cpu", "memory"},
+	}
+
+	client.EXPECT().SupportedVersions().Return(nil)
+	client.EXPECT().KnownVersions().Return(nil)
+
+	capabilities := taskEngine.Capabilities()
+
+	expectedCapabilities := []string{
+		"com.amazonaws.ecs.capability.privileged-container",
+		"com.amazonaws.ecs.capability.cgroup-v2",
+		"com.amazonaws.ecs.capability.cgroup-v2.cpu",
+		"com.amazonaws.ecs.capability.cgroup-v2.memory",
+	}
+	assert.Equal(t, expectedCapabilities, capabilities)
+}
+
 func TestCapabilitiesECR(t *testing.T) {
 	conf := &config.Config{}
 	ctrl, client, _, taskEngine, _, _ := mocks(t, conf)
@@ -1203,3 +1230,317 @@ func TestTaskWithCircularDependency(t *testing.T) {
 	_, ok = taskEngine.(*DockerTaskEngine).managedTasks[task.Arn]
 	assert.False(t, ok, "Task should not be added to task manager for processing")
 }
+
+func TestPullSSMAuthUsesTaskRoleCredentials(t *testing.T) {
+	ctrl, client, _, taskEngine, credentialsManager, imageManager := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	authData := &api.RegistryAuthenticationData{
+		Type: "ssm",
+		SSMAuthData: &api.SSMAuthData{
+			ParameterName: "/registry/creds",
+			Region:        "us-west-2",
+		},
+	}
+	container := &api.Container{Name: "c1", Image: "registry.example.com/image", RegistryAuthentication: authData}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+	task.SetCredentialsID(credentialsID)
+	roleCredentials := credentials.TaskIAMRoleCredentials{
+		IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: credentialsID, AccessKeyID: "akid"},
+	}
+
+	credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(roleCredentials, true)
+	client.EXPECT().PullImage(container.Image, gomock.Any()).Do(
+		func(image string, pullAuthData *api.RegistryAuthenticationData) {
+			require.NotNil(t, pullAuthData.SSMAuthData.RoleCredentials)
+			assert.Equal(t, "akid", pullAuthData.SSMAuthData.RoleCredentials.AccessKeyID)
+		}).Return(DockerContainerMetadata{})
+	imageManager.EXPECT().RecordContainerReference(container).Return(nil)
+	imageManager.EXPECT().GetImageStateFromImageName(container.Image).Return(nil)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+	assert.Nil(t, container.RegistryAuthentication.SSMAuthData.RoleCredentials,
+		"Role credentials should not be stored on the container")
+}
+
+func TestPullSSMAuthWithoutTaskRoleCredentials(t *testing.T) {
+	ctrl, _, _, taskEngine, credentialsManager, _ := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	container := &api.Container{
+		Name:  "c1",
+		Image: "registry.example.com/image",
+		RegistryAuthentication: &api.RegistryAuthenticationData{
+			Type:        "ssm",
+			SSMAuthData: &api.SSMAuthData{ParameterName: "/registry/creds", Region: "us-west-2"},
+		},
+	}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+	task.SetCredentialsID(credentialsID)
+
+	credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(credentials.TaskIAMRoleCredentials{}, false)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	require.Error(t, metadata.Error)
+	assert.Equal(t, "CannotPullContainerError", metadata.Error.ErrorName())
+}
+
+func TestPullECRAuthUsesExecutionRoleCredentials(t *testing.T) {
+	ctrl, client, _, taskEngine, credentialsManager, imageManager := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	authData := &api.RegistryAuthenticationData{
+		Type: "ecr",
+		ECRAuthData: &api.ECRAuthData{
+			Region:     "us-west-2",
+			RegistryID: "123456789012",
+		},
+	}
+	container := &api.Container{Name: "c1", Image: "123456789012.dkr.ecr.us-west-2.amazonaws.com/image", RegistryAuthentication: authData}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+	task.SetExecutionCredentialsID("execCredsID")
+	executionCredentials := credentials.TaskIAMRoleCredentials{
+		IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: "execCredsID", AccessKeyID: "execakid"},
+	}
+
+	credentialsManager.EXPECT().GetTaskExecutionCredentials("execCredsID").Return(executionCredentials, true)
+	client.EXPECT().PullImage(container.Image, gomock.Any()).Do(
+		func(image string, pullAuthData *api.RegistryAuthenticationData) {
+			require.NotNil(t, pullAuthData.ECRAuthData.RoleCredentials)
+			assert.Equal(t, "execakid", pullAuthData.ECRAuthData.RoleCredentials.AccessKeyID)
+		}).Return(DockerContainerMetadata{})
+	imageManager.EXPECT().RecordContainerReference(container).Return(nil)
+	imageManager.EXPECT().GetImageStateFromImageName(container.Image).Return(nil)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+	assert.Nil(t, container.RegistryAuthentication.ECRAuthData.RoleCredentials,
+		"Role credentials should not be stored on the container")
+}
+
+func TestPullSSMAuthPrefersExecutionRoleCredentials(t *testing.T) {
+	ctrl, client, _, taskEngine, credentialsManager, imageManager := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	authData := &api.RegistryAuthenticationData{
+		Type: "ssm",
+		SSMAuthData: &api.SSMAuthData{
+			ParameterName: "/registry/creds",
+			Region:        "us-west-2",
+		},
+	}
+	container := &api.Container{Name: "c1", Image: "registry.example.com/image", RegistryAuthentication: authData}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+	task.SetCredentialsID(credentialsID)
+	task.SetExecutionCredentialsID("execCredsID")
+	executionCredentials := credentials.TaskIAMRoleCredentials{
+		IAMRoleCredentials: credentials.IAMRoleCredentials{CredentialsID: "execCredsID", AccessKeyID: "execakid"},
+	}
+
+	credentialsManager.EXPECT().GetTaskExecutionCredentials("execCredsID").Return(executionCredentials, true)
+	client.EXPECT().PullImage(container.Image, gomock.Any()).Do(
+		func(image string, pullAuthData *api.RegistryAuthenticationData) {
+			require.NotNil(t, pullAuthData.SSMAuthData.RoleCredentials)
+			assert.Equal(t, "execakid", pullAuthData.SSMAuthData.RoleCredentials.AccessKeyID)
+		}).Return(DockerContainerMetadata{})
+	imageManager.EXPECT().RecordContainerReference(container).Return(nil)
+	imageManager.EXPECT().GetImageStateFromImageName(container.Image).Return(nil)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+}
+
+func TestPullWithoutExecutionRoleCredentials(t *testing.T) {
+	ctrl, _, _, taskEngine, credentialsManager, _ := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	container := &api.Container{
+		Name:  "c1",
+		Image: "123456789012.dkr.ecr.us-west-2.amazonaws.com/image",
+		RegistryAuthentication: &api.RegistryAuthenticationData{
+			Type:        "ecr",
+			ECRAuthData: &api.ECRAuthData{Region: "us-west-2", RegistryID: "123456789012"},
+		},
+	}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+	task.SetExecutionCredentialsID("execCredsID")
+
+	credentialsManager.EXPECT().GetTaskExecutionCredentials("execCredsID").Return(credentials.TaskIAMRoleCredentials{}, false)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	require.Error(t, metadata.Error)
+	assert.Equal(t, "CannotPullContainerError", metadata.Error.ErrorName())
+}
+
+func TestPullRewrittenImage(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ImagePullRewriteRules = []config.ImagePullRewriteRule{
+		{Match: "docker.io/library/*", Replace: "mirror.example.com/dockerhub/*"},
+	}
+	ctrl, client, _, taskEngine, _, imageManager := mocks(t, &cfg)
+	defer ctrl.Finish()
+
+	container := &api.Container{Name: "c1", Image: "busybox"}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+	imageState := &image.ImageState{Image: &image.Image{ImageID: "sha256:busybox", Names: []string{"busybox"}}}
+
+	gomock.InOrder(
+		client.EXPECT().PullImage("mirror.example.com/dockerhub/busybox:latest", nil).Return(DockerContainerMetadata{}),
+		client.EXPECT().TagImage("mirror.example.com/dockerhub/busybox:latest", "busybox", tagImageTimeout).Return(nil),
+		imageManager.EXPECT().RecordContainerReference(container).Return(nil),
+		imageManager.EXPECT().GetImageStateFromImageName("busybox").Return(imageState),
+	)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+	assert.Equal(t, "busybox", container.Image, "Container should keep its original image")
+	assert.Equal(t, []string{"busybox", "mirror.example.com/dockerhub/busybox:latest"}, imageState.Image.Names)
+}
+
+func TestPullRewrittenImageFallsBackToOriginal(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ImagePullRewriteRules = []config.ImagePullRewriteRule{
+		{Match: "docker.io/library/*", Replace: "mirror.example.com/dockerhub/*"},
+	}
+	ctrl, client, _, taskEngine, _, imageManager := mocks(t, &cfg)
+	defer ctrl.Finish()
+
+	container := &api.Container{Name: "c1", Image: "busybox"}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+	imageState := &image.ImageState{Image: &image.Image{ImageID: "sha256:busybox", Names: []string{"busybox"}}}
+
+	gomock.InOrder(
+		client.EXPECT().PullImage("mirror.example.com/dockerhub/busybox:latest", nil).Return(
+			DockerContainerMetadata{Error: CannotPullContainerError{errors.New("mirror unavailable")}}),
+		client.EXPECT().PullImage("busybox", nil).Return(DockerContainerMetadata{}),
+		imageManager.EXPECT().RecordContainerReference(container).Return(nil),
+		imageManager.EXPECT().GetImageStateFromImageName("busybox").Return(imageState),
+	)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+	assert.Equal(t, []string{"busybox"}, imageState.Image.Names)
+}
+
+func TestPullRewrittenImageWithEngineAuth(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ImagePullRewriteRules = []config.ImagePullRewriteRule{
+		{Match: "123456789012.dkr.ecr.us-west-2.amazonaws.com/*", Replace: "mirror.example.com/ecr/*"},
+	}
+	ctrl, client, _, taskEngine, _, imageManager := mocks(t, &cfg)
+	defer ctrl.Finish()
+
+	authData := &api.RegistryAuthenticationData{
+		Type:        api.ECRAuthType,
+		ECRAuthData: &api.ECRAuthData{RegistryID: "123456789012", Region: "us-west-2"},
+	}
+	container := &api.Container{
+		Name:                   "c1",
+		Image:                  "123456789012.dkr.ecr.us-west-2.amazonaws.com/app:1",
+		RegistryAuthentication: authData,
+	}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+
+	gomock.InOrder(
+		// The mirror is pulled from with the engine auth
+		client.EXPECT().PullImage("mirror.example.com/ecr/app:1", nil).Return(
+			DockerContainerMetadata{Error: CannotPullContainerError{errors.New("mirror unavailable")}}),
+		client.EXPECT().PullImage(container.Image, authData).Return(DockerContainerMetadata{}),
+		imageManager.EXPECT().RecordContainerReference(container).Return(nil),
+		imageManager.EXPECT().GetImageStateFromImageName(container.Image).Return(nil),
+	)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+}
+
+func TestPullPinnedImageDigest(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ImageDigestPinningEnabled = true
+	ctrl, client, _, taskEngine, _, imageManager := mocks(t, &cfg)
+	defer ctrl.Finish()
+
+	resolved := &api.Container{Name: "c1", Image: "busybox:1.26", ImageDigestUnsafe: "sha256:abc"}
+	container := &api.Container{Name: "c2", Image: "busybox:1.26"}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{resolved, container}}
+
+	gomock.InOrder(
+		// The shared tag is left alone
+		client.EXPECT().PullImage("busybox@sha256:abc", nil).Return(DockerContainerMetadata{}),
+		imageManager.EXPECT().RecordContainerReference(container).Return(nil),
+		imageManager.EXPECT().GetImageStateFromImageName("busybox:1.26").Return(nil),
+	)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+}
+
+func TestPullPinnedImageDigestIsNotRewritten(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ImageDigestPinningEnabled = true
+	cfg.ImagePullRewriteRules = []config.ImagePullRewriteRule{
+		{Match: "docker.io/library/*", Replace: "mirror.example.com/dockerhub/*"},
+	}
+	ctrl, client, _, taskEngine, _, imageManager := mocks(t, &cfg)
+	defer ctrl.Finish()
+
+	container := &api.Container{Name: "c1", Image: "busybox:1.26", ImageDigestUnsafe: "sha256:abc"}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+
+	gomock.InOrder(
+		client.EXPECT().PullImage("busybox@sha256:abc", nil).Return(DockerContainerMetadata{}),
+		imageManager.EXPECT().RecordContainerReference(container).Return(nil),
+		imageManager.EXPECT().GetImageStateFromImageName("busybox:1.26").Return(nil),
+	)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+}
+
+func TestPullImageDigestNotPinnedByDefault(t *testing.T) {
+	ctrl, client, _, taskEngine, _, imageManager := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	container := &api.Container{Name: "c1", Image: "busybox:1.26", ImageDigestUnsafe: "sha256:abc"}
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+
+	client.EXPECT().PullImage("busybox:1.26", nil).Return(DockerContainerMetadata{})
+	imageManager.EXPECT().RecordContainerReference(container).Return(nil)
+	imageManager.EXPECT().GetImageStateFromImageName("busybox:1.26").Return(nil)
+
+	metadata := taskEngine.(*DockerTaskEngine).pullAndUpdateContainerReference(task, container)
+	assert.NoError(t, metadata.Error)
+}
+
+func TestCreateContainerWithPinnedImageDigest(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ImageDigestPinningEnabled = true
+	ctrl, client, _, taskEngine, _, _ := mocks(t, &cfg)
+	defer ctrl.Finish()
+
+	container := &api.Container{Name: "c1", Image: "busybox:1.26", ImageDigestUnsafe: "sha256:abc"}
+	task := &api.Task{Arn: "taskArn", Family: "myFamily", Version: "1", Containers: []*api.Container{container}}
+
+	client.EXPECT().CreateContainer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Do(
+		func(config *docker.Config, hostConfig *docker.HostConfig, name string, timeout time.Duration) {
+			assert.Equal(t, "busybox@sha256:abc", config.Image)
+		})
+	taskEngine.(*DockerTaskEngine).createContainer(task, container)
+	assert.Equal(t, "busybox:1.26", container.Image, "Container should keep its original image")
+}
+
+func TestContainerEventIncludesImageDigest(t *testing.T) {
+	ctrl, _, _, taskEngine, _, _ := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	container := &api.Container{Name: "c1", Image: "busybox:1.26", ImageDigestUnsafe: "sha256:abc"}
+	container.SetKnownStatus(api.ContainerRunning)
+	task := &api.Task{Arn: "taskArn", Containers: []*api.Container{container}}
+
+	go taskEngine.(*DockerTaskEngine).emitContainerEvent(task, container, "")
+	event := <-taskEngine.StateChangeEvents()
+	containerChange, ok := event.(api.ContainerStateChange)
+	require.True(t, ok, "Expected a container state change")
+	assert.Equal(t, "sha256:abc", containerChange.ImageDigest)
+}
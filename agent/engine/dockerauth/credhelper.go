@@ -0,0 +1,190 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/async"
+	"github.com/cihub/seelog"
+	docker "github.com/fsouza/go-dockerclient"
+	"golang.org/x/net/context"
+)
+
+const (
+	// CredentialHelperAuthType is the auth type of a Docker config.json whose
+	// credentials are retrieved with docker credential helpers
+	CredentialHelperAuthType = "credhelper"
+
+	// credentialHelperPrefix is prepended to the name of a helper to get the
+	// name of its binary
+	credentialHelperPrefix = "docker-credential-"
+	// credentialHelperTimeout is the maximum time a helper may take to return
+	// the credentials of a registry
+	credentialHelperTimeout = 30 * time.Second
+	// credentialHelperCacheTTL is how long the credentials returned by a helper
+	// are used before the helper is invoked again. It is kept well below the
+	// lifetime of the short-lived tokens that helpers usually return.
+	credentialHelperCacheTTL  = 10 * time.Minute
+	credentialHelperCacheSize = 100
+	// credentialHelperNotFoundCacheTTL is how long a helper having no
+	// credentials for a registry is remembered, so that anonymous pulls don't
+	// run the helper every time. It is short so that credentials added to the
+	// helper are picked up soon.
+	credentialHelperNotFoundCacheTTL = time.Minute
+
+	// credentialsNotFoundMessage is printed by helpers that have no
+	// credentials for a registry
+	credentialsNotFoundMessage = "credentials not found in native keychain"
+	// identityTokenUsername is returned as the username by helpers that
+	// return an identity token instead of a password
+	identityTokenUsername = "<token>"
+	// dockerHubServerURL is the server url docker uses for Docker Hub
+	dockerHubServerURL = "https://" + dockerRegistryKey
+)
+
+// dockerConfig is the part of a Docker config.json used to find the
+// credentials of a registry
+type dockerConfig struct {
+	Auths       dockercfgData     `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// credentialHelperResponse is printed by a helper for the get command
+type credentialHelperResponse struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// credentialHelperFunc runs the get command of a helper for a server url and
+// returns its output
+type credentialHelperFunc func(helper string, serverURL string) ([]byte, error)
+
+type credentialHelperAuthProvider struct {
+	// credHelpers maps registries, without schema, to the helper to use
+	credHelpers map[string]string
+	// credsStore is the helper to use for the other registries, if set
+	credsStore string
+	// staticAuths are the credentials stored in the config itself
+	staticAuths *dockerAuthProvider
+	cache       async.Cache
+	// notFoundCache holds the registries the helpers have no credentials for
+	notFoundCache async.Cache
+	runHelper     credentialHelperFunc
+}
+
+// newCredentialHelperAuthProvider returns a DockerAuthProvider for the
+// contents of a Docker config.json. The credentials of a registry are
+// retrieved, in order of precedence, from the helper set for it in
+// 'credHelpers', from the 'credsStore' helper or from 'auths'.
+func newCredentialHelperAuthProvider(authData json.RawMessage) DockerAuthProvider {
+	var config dockerConfig
+	if len(authData) > 0 {
+		err := json.Unmarshal(authData, &config)
+		if err != nil {
+			seelog.Warnf("Could not parse '%s' type auth config", CredentialHelperAuthType)
+		}
+	}
+
+	credHelpers := make(map[string]string)
+	for registry, helper := range config.CredHelpers {
+		credHelpers[stripRegistrySchema(registry)] = helper
+	}
+	return &credentialHelperAuthProvider{
+		credHelpers:   credHelpers,
+		credsStore:    config.CredsStore,
+		staticAuths:   &dockerAuthProvider{authMap: normalizeAuths(decodeDockercfgAuths(config.Auths))},
+		cache:         async.NewLRUCache(credentialHelperCacheSize, credentialHelperCacheTTL),
+		notFoundCache: async.NewLRUCache(credentialHelperCacheSize, credentialHelperNotFoundCacheTTL),
+		runHelper:     runCredentialHelper,
+	}
+}
+
+// GetAuthconfig retrieves the auth configuration for the registry of the
+// given image, invoking its credential helper if there is one
+func (authProvider *credentialHelperAuthProvider) GetAuthconfig(image string) (docker.AuthConfiguration, error) {
+	repository, _ := docker.ParseRepositoryTag(image)
+	indexName, _ := splitReposName(repository)
+
+	serverURL := indexName
+	if isDockerhubHostname(indexName) {
+		serverURL = dockerHubServerURL
+	}
+	helper, ok := authProvider.credHelpers[stripRegistrySchema(serverURL)]
+	if !ok {
+		helper = authProvider.credsStore
+	}
+	if helper == "" {
+		return authProvider.staticAuths.GetAuthconfig(image)
+	}
+
+	cacheKey := helper + " " + serverURL
+	if cached, found := authProvider.cache.Get(cacheKey); found {
+		return cached.(docker.AuthConfiguration), nil
+	}
+	if _, notFound := authProvider.notFoundCache.Get(cacheKey); notFound {
+		return docker.AuthConfiguration{}, nil
+	}
+
+	seelog.Debugf("Getting credentials of %s from credential helper %s", serverURL, helper)
+	output, err := authProvider.runHelper(helper, serverURL)
+	if err != nil {
+		if strings.Contains(string(output), credentialsNotFoundMessage) {
+			seelog.Debugf("Credential helper %s has no credentials for %s", helper, serverURL)
+			authProvider.notFoundCache.Set(cacheKey, struct{}{})
+			return docker.AuthConfiguration{}, nil
+		}
+		return docker.AuthConfiguration{}, fmt.Errorf("credential helper %s failed for %s: %v: %s",
+			helper, serverURL, err, strings.TrimSpace(string(output)))
+	}
+
+	var response credentialHelperResponse
+	err = json.Unmarshal(output, &response)
+	if err != nil {
+		return docker.AuthConfiguration{}, fmt.Errorf("could not parse the response of credential helper %s for %s: %v",
+			helper, serverURL, err)
+	}
+	if response.Username == identityTokenUsername {
+		return docker.AuthConfiguration{}, fmt.Errorf("credential helper %s returned an identity token for %s, which is not supported",
+			helper, serverURL)
+	}
+	authConfig := docker.AuthConfiguration{
+		Username:      response.Username,
+		Password:      response.Secret,
+		ServerAddress: serverURL,
+	}
+	authProvider.cache.Set(cacheKey, authConfig)
+	return authConfig, nil
+}
+
+// runCredentialHelper runs 'docker-credential-<helper> get' with the server
+// url on its standard input, and returns its standard output
+func runCredentialHelper(helper string, serverURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, credentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	return stdout.Bytes(), err
+}
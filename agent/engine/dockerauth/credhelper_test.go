@@ -0,0 +1,127 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerauth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const credentialHelperConfig = `{
+	"credHelpers": {"https://registry.example.com": "example"},
+	"credsStore": "store",
+	"auths": {"static.example.com": {"auth": "dXNlcjpzd29yZGZpc2g="}, "registry.example.com": {}}
+}`
+
+type helperCall struct {
+	helper    string
+	serverURL string
+}
+
+// fakeCredentialHelpers replaces the helper binaries of the provider and
+// records their invocations
+func fakeCredentialHelpers(provider DockerAuthProvider, output string, err error) *[]helperCall {
+	var calls []helperCall
+	provider.(*credentialHelperAuthProvider).runHelper = func(helper string, serverURL string) ([]byte, error) {
+		calls = append(calls, helperCall{helper, serverURL})
+		return []byte(output), err
+	}
+	return &calls
+}
+
+func TestCredentialHelperAuth(t *testing.T) {
+	provider := NewDockerAuthProvider(CredentialHelperAuthType, []byte(credentialHelperConfig))
+	calls := fakeCredentialHelpers(provider, `{"ServerURL":"registry.example.com","Username":"AWS","Secret":"token"}`, nil)
+
+	authConfig, err := provider.GetAuthconfig("registry.example.com/my/image:latest")
+	require.NoError(t, err)
+	assert.Equal(t, "AWS", authConfig.Username)
+	assert.Equal(t, "token", authConfig.Password)
+	assert.Equal(t, "registry.example.com", authConfig.ServerAddress)
+
+	// The credentials are cached
+	_, err = provider.GetAuthconfig("registry.example.com/other/image")
+	require.NoError(t, err)
+	assert.Equal(t, []helperCall{{"example", "registry.example.com"}}, *calls)
+}
+
+func TestCredentialHelperAuthFallsBackToCredsStore(t *testing.T) {
+	provider := NewDockerAuthProvider(CredentialHelperAuthType, []byte(credentialHelperConfig))
+	calls := fakeCredentialHelpers(provider, `{"ServerURL":"","Username":"user","Secret":"secret"}`, nil)
+
+	authConfig, err := provider.GetAuthconfig("mirror.example.com/image")
+	require.NoError(t, err)
+	assert.Equal(t, "user", authConfig.Username)
+	_, err = provider.GetAuthconfig("busybox")
+	require.NoError(t, err)
+	assert.Equal(t, []helperCall{
+		{"store", "mirror.example.com"},
+		{"store", dockerHubServerURL},
+	}, *calls)
+}
+
+func TestCredentialHelperAuthStaticAuths(t *testing.T) {
+	provider := NewDockerAuthProvider(CredentialHelperAuthType, []byte(`{
+		"credHelpers": {"registry.example.com": "example"},
+		"auths": {"static.example.com": {"auth": "dXNlcjpzd29yZGZpc2g="}}
+	}`))
+	calls := fakeCredentialHelpers(provider, "", errors.New("unexpected call"))
+
+	authConfig, err := provider.GetAuthconfig("static.example.com/image")
+	require.NoError(t, err)
+	assert.Equal(t, "user", authConfig.Username)
+	assert.Equal(t, "swordfish", authConfig.Password)
+	authConfig, err = provider.GetAuthconfig("other.example.com/image")
+	require.NoError(t, err)
+	assert.Empty(t, authConfig.Username)
+	assert.Empty(t, *calls)
+}
+
+func TestCredentialHelperAuthErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		output        string
+		err           error
+		expectedError bool
+		expectedCalls int
+	}{
+		// Missing credentials are cached, failures are not
+		{"credentials not found", "credentials not found in native keychain\n", errors.New("exit status 1"), false, 1},
+		{"helper failure", "cannot reach the registry\n", errors.New("exit status 1"), true, 2},
+		{"malformed response", "not json", nil, true, 2},
+		{"identity token", `{"Username":"<token>","Secret":"identity"}`, nil, true, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := NewDockerAuthProvider(CredentialHelperAuthType, []byte(credentialHelperConfig))
+			calls := fakeCredentialHelpers(provider, tc.output, tc.err)
+
+			authConfig, err := provider.GetAuthconfig("registry.example.com/image")
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Empty(t, authConfig.Username)
+
+			authConfig, err = provider.GetAuthconfig("registry.example.com/image")
+			assert.Equal(t, tc.expectedError, err != nil)
+			assert.Empty(t, authConfig.Username)
+			assert.Len(t, *calls, tc.expectedCalls)
+		})
+	}
+}
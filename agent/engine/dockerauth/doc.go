@@ -26,7 +26,7 @@ These keys may be set by either setting the environment variables
 
 Auth Types
 
-The two currently supported auth types are "docker" and "dockercfg".
+The currently supported auth types are "docker", "dockercfg" and "credhelper".
 
 Docker:
 
@@ -54,5 +54,45 @@ The auth type "dockercfg" is intended to allow easy use of an existing
 the "AuthData" to be a string containing the contents of that file. The contents
 of your ".dockercfg" will generally be a string of the following form:
 	'{"http://myregistry.com/v1/":{"auth":"dXNlcjpzd29yZGZpc2g=","email":"email"}}'
+
+Credhelper:
+
+The auth type "credhelper" is intended to allow the use of docker credential
+helpers for registries with short-lived tokens. This auth type expects the
+"AuthData" to be the contents of a Docker "config.json" file, such as:
+	{
+		"credHelpers": {
+			"registry.example.com": "example",
+			"gcr.io": "gcr"
+		},
+		"credsStore": "secretservice",
+		"auths": {
+			"https://myregistry.com": {"auth": "dXNlcjpzd29yZGZpc2g="}
+		}
+	}
+
+The credentials of a registry are retrieved with the helper set for it in
+"credHelpers", else with the "credsStore" helper, else from "auths". A helper
+named "example" is invoked as the "docker-credential-example" binary, which
+must be on the agent's PATH, using the "get" command of the docker credential
+helper protocol. Credentials returned by a helper are cached for 10 minutes.
+
+Per-container credentials
+
+ECR authorization tokens for a task with an execution role are requested with
+the credentials of that role instead of the instance's. Execution role
+credentials are only used by the agent and are never served to the task's
+containers.
+
+Independently of the agent-wide configuration, ECS may reference registry
+credentials for a single container. A reference of type "ssm" names a
+SecureString parameter in the SSM Parameter Store whose value is a JSON object
+of the form:
+	{"username": "myUsername", "password": "myPassword"}
+
+The parameter is read with the credentials of the task's execution role, or
+of the task's IAM role if it has no execution role, so tasks without either
+cannot use it. The registry credentials are only used for that container's
+pull and are neither cached nor saved to the agent's state.
 */
 package dockerauth
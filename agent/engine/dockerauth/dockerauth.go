@@ -25,6 +25,9 @@ import (
 )
 
 func NewDockerAuthProvider(authType string, authData json.RawMessage) DockerAuthProvider {
+	if authType == CredentialHelperAuthType {
+		return newCredentialHelperAuthProvider(authData)
+	}
 	return &dockerAuthProvider{
 		authMap: parseAuthData(authType, authData),
 	}
@@ -106,23 +109,7 @@ func parseAuthData(authType string, authData json.RawMessage) dockerAuths {
 			return dockerAuths{}
 		}
 
-		for registry, auth := range base64dAuthInfo {
-			data, err := base64.StdEncoding.DecodeString(auth.Auth)
-			if err != nil {
-				seelog.Warnf("Malformed auth data for registry %v", registry)
-				continue
-			}
-
-			usernamePass := strings.SplitN(string(data), ":", 2)
-			if len(usernamePass) != 2 {
-				seelog.Warnf("Malformed auth data for registry %v; must contain ':'", registry)
-				continue
-			}
-			intermediateAuthData[registry] = docker.AuthConfiguration{
-				Username: usernamePass[0],
-				Password: usernamePass[1],
-			}
-		}
+		intermediateAuthData = decodeDockercfgAuths(base64dAuthInfo)
 	case "":
 		// not set; no warn
 		return dockerAuths{}
@@ -131,9 +118,42 @@ func parseAuthData(authType string, authData json.RawMessage) dockerAuths {
 		return dockerAuths{}
 	}
 
-	// Normalize intermediate registry keys into not having a schema
+	return normalizeAuths(intermediateAuthData)
+}
+
+// decodeDockercfgAuths decodes the base64 encoded 'username:password' auths
+// of a .dockercfg. Malformed auths are logged and skipped.
+func decodeDockercfgAuths(base64dAuthInfo dockercfgData) dockerAuths {
+	auths := make(dockerAuths)
+	for registry, auth := range base64dAuthInfo {
+		if auth.Auth == "" {
+			// Registries listed without credentials, such as the ones
+			// using a credential helper in a Docker config.json
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			seelog.Warnf("Malformed auth data for registry %v", registry)
+			continue
+		}
+
+		usernamePass := strings.SplitN(string(data), ":", 2)
+		if len(usernamePass) != 2 {
+			seelog.Warnf("Malformed auth data for registry %v; must contain ':'", registry)
+			continue
+		}
+		auths[registry] = docker.AuthConfiguration{
+			Username: usernamePass[0],
+			Password: usernamePass[1],
+		}
+	}
+	return auths
+}
+
+// normalizeAuths normalizes the registry keys into not having a schema
+func normalizeAuths(auths dockerAuths) dockerAuths {
 	output := make(dockerAuths)
-	for key, val := range intermediateAuthData {
+	for key, val := range auths {
 		output[stripRegistrySchema(key)] = val
 	}
 	return output
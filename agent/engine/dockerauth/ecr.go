@@ -34,11 +34,20 @@ type ecrAuthProvider struct {
 const proxyEndpointScheme = "https://"
 
 // NewECRAuthProvider returns a DockerAuthProvider that can handle retrieve
-// credentials for pulling from Amazon EC2 Container Registry
+// credentials for pulling from Amazon EC2 Container Registry. The authorization
+// token is requested with the credentials of the task's execution role when
+// the auth data has them, and with the instance's credentials otherwise.
 func NewECRAuthProvider(authData *api.ECRAuthData, clientFactory ecr.ECRFactory) DockerAuthProvider {
 	if authData == nil {
 		return &ecrAuthProvider{}
 	}
+	if authData.RoleCredentials != nil {
+		log.Tracef("Getting client in %s with endpoint %s for the task's execution role", authData.Region, authData.EndpointOverride)
+		return &ecrAuthProvider{
+			authData: authData,
+			client:   clientFactory.GetClientWithCredentials(authData.Region, authData.EndpointOverride, *authData.RoleCredentials),
+		}
+	}
 	log.Tracef("Getting client in %s with endpoint %s", authData.Region, authData.EndpointOverride)
 	return &ecrAuthProvider{
 		authData: authData,
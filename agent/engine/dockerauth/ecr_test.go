@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/ecr/mocks"
 	ecrapi "github.com/aws/amazon-ecs-agent/agent/ecr/model/ecr"
 	"github.com/aws/aws-sdk-go/aws"
@@ -59,6 +60,27 @@ func TestNewAuthProviderECRAuth(t *testing.T) {
 	}
 }
 
+func TestNewAuthProviderECRAuthWithExecutionRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_ecr.NewMockECRFactory(ctrl)
+
+	roleCredentials := credentials.IAMRoleCredentials{AccessKeyID: "akid"}
+	authData := &api.ECRAuthData{
+		Region:          "us-west-2",
+		RegistryID:      "0123456789012",
+		RoleCredentials: &roleCredentials,
+	}
+
+	factory.EXPECT().GetClientWithCredentials(authData.Region, authData.EndpointOverride, roleCredentials)
+
+	provider := NewECRAuthProvider(authData, factory)
+	_, ok := provider.(*ecrAuthProvider)
+	if !ok {
+		t.Error("Should have returned ecrAuthProvider")
+	}
+}
+
 func TestGetAuthConfigSuccess(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,80 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerauth
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/ssm"
+	log "github.com/cihub/seelog"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+type ssmAuthProvider struct {
+	authData *api.SSMAuthData
+	factory  ssm.SSMFactory
+}
+
+// ssmRegistryCredentials is the format of the SSM parameter holding the
+// credentials of a private registry
+type ssmRegistryCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// NewSSMAuthProvider returns a DockerAuthProvider that reads the credentials
+// for a private registry from the SSM Parameter Store, using the credentials of
+// the task's IAM role. Nothing is cached, so the registry credentials are only
+// held in memory for the duration of a single pull.
+func NewSSMAuthProvider(authData *api.SSMAuthData, factory ssm.SSMFactory) DockerAuthProvider {
+	return &ssmAuthProvider{
+		authData: authData,
+		factory:  factory,
+	}
+}
+
+// GetAuthconfig retrieves the registry credentials for the given image
+func (authProvider *ssmAuthProvider) GetAuthconfig(image string) (docker.AuthConfiguration, error) {
+	if authProvider.authData == nil {
+		return docker.AuthConfiguration{}, fmt.Errorf("ssmAuthProvider cannot be used without AuthData")
+	}
+	if authProvider.authData.RoleCredentials == nil {
+		return docker.AuthConfiguration{}, fmt.Errorf("No task IAM role credentials to read parameter %s for %s",
+			authProvider.authData.ParameterName, image)
+	}
+
+	log.Debugf("Calling SSM.GetParameter for %s", image)
+	client := authProvider.factory.GetClient(authProvider.authData.Region, *authProvider.authData.RoleCredentials)
+	value, err := client.GetParameter(authProvider.authData.ParameterName)
+	if err != nil {
+		return docker.AuthConfiguration{}, err
+	}
+
+	var creds ssmRegistryCredentials
+	if err := json.Unmarshal([]byte(value), &creds); err != nil {
+		// Don't include the error, it may contain parts of the parameter value
+		return docker.AuthConfiguration{}, fmt.Errorf("Parameter %s is not a JSON object with a username and password",
+			authProvider.authData.ParameterName)
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return docker.AuthConfiguration{}, fmt.Errorf("Parameter %s is missing a username or password",
+			authProvider.authData.ParameterName)
+	}
+	return docker.AuthConfiguration{
+		Username: creds.Username,
+		Password: creds.Password,
+	}, nil
+}
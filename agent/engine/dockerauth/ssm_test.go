@@ -0,0 +1,114 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerauth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/ssm/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ssmAuthDataWithCredentials() (*api.SSMAuthData, credentials.IAMRoleCredentials) {
+	roleCredentials := credentials.IAMRoleCredentials{
+		AccessKeyID:     "akid",
+		SecretAccessKey: "skid",
+		SessionToken:    "token",
+	}
+	return &api.SSMAuthData{
+		ParameterName:   "/registry/creds",
+		Region:          "us-west-2",
+		RoleCredentials: &roleCredentials,
+	}, roleCredentials
+}
+
+func TestSSMAuthProviderGetAuthconfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_ssm.NewMockSSMFactory(ctrl)
+	client := mock_ssm.NewMockSSMClient(ctrl)
+
+	authData, roleCredentials := ssmAuthDataWithCredentials()
+	gomock.InOrder(
+		factory.EXPECT().GetClient("us-west-2", roleCredentials).Return(client),
+		client.EXPECT().GetParameter("/registry/creds").Return(`{"username":"user","password":"swordfish"}`, nil),
+	)
+
+	authConfig, err := NewSSMAuthProvider(authData, factory).GetAuthconfig("registry.example.com/image")
+	require.NoError(t, err)
+	assert.Equal(t, "user", authConfig.Username)
+	assert.Equal(t, "swordfish", authConfig.Password)
+}
+
+func TestSSMAuthProviderNoAuthData(t *testing.T) {
+	_, err := NewSSMAuthProvider(nil, nil).GetAuthconfig("image")
+	assert.Error(t, err)
+}
+
+func TestSSMAuthProviderNoRoleCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_ssm.NewMockSSMFactory(ctrl)
+
+	authData := &api.SSMAuthData{ParameterName: "/registry/creds", Region: "us-west-2"}
+	_, err := NewSSMAuthProvider(authData, factory).GetAuthconfig("image")
+	assert.Error(t, err)
+}
+
+func TestSSMAuthProviderGetParameterError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_ssm.NewMockSSMFactory(ctrl)
+	client := mock_ssm.NewMockSSMClient(ctrl)
+
+	authData, roleCredentials := ssmAuthDataWithCredentials()
+	factory.EXPECT().GetClient("us-west-2", roleCredentials).Return(client)
+	client.EXPECT().GetParameter("/registry/creds").Return("", errors.New("AccessDeniedException"))
+
+	_, err := NewSSMAuthProvider(authData, factory).GetAuthconfig("image")
+	assert.Error(t, err)
+}
+
+func TestSSMAuthProviderMalformedParameter(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+	}{
+		{"not json", "user:swordfish"},
+		{"missing password", `{"username":"user"}`},
+		{"missing username", `{"password":"swordfish"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			factory := mock_ssm.NewMockSSMFactory(ctrl)
+			client := mock_ssm.NewMockSSMClient(ctrl)
+
+			authData, roleCredentials := ssmAuthDataWithCredentials()
+			factory.EXPECT().GetClient("us-west-2", roleCredentials).Return(client)
+			client.EXPECT().GetParameter("/registry/creds").Return(tc.value, nil)
+
+			_, err := NewSSMAuthProvider(authData, factory).GetAuthconfig("image")
+			require.Error(t, err)
+			assert.NotContains(t, err.Error(), "swordfish")
+		})
+	}
+}
@@ -44,6 +44,9 @@ type TaskEngineState interface {
 	TaskByID(cid string) (*api.Task, bool)
 	// TaskByArn returns a task for a given ARN
 	TaskByArn(arn string) (*api.Task, bool)
+	// TaskByIPAddress returns the task of the running container with a given
+	// IP address
+	TaskByIPAddress(ipAddress string) (*api.Task, bool)
 	// AddTask adds a task to the state to be stored
 	AddTask(task *api.Task)
 	// AddContainer adds a container to the state to be stored for a given task
@@ -219,6 +222,26 @@ func (state *DockerTaskEngineState) TaskByArn(arn string) (*api.Task, bool) {
 	return state.taskByArn(arn)
 }
 
+// TaskByIPAddress returns the task of the running container with a given IP
+// address. Only running containers are considered, the address of a stopped
+// container may have been handed to another container since.
+func (state *DockerTaskEngineState) TaskByIPAddress(ipAddress string) (*api.Task, bool) {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	for id, dockerContainer := range state.idToContainer {
+		if dockerContainer.Container.GetKnownStatus() != api.ContainerRunning {
+			continue
+		}
+		for _, containerIPAddress := range dockerContainer.Container.GetIPAddresses() {
+			if containerIPAddress == ipAddress {
+				return state.taskByArn(state.idToTask[id])
+			}
+		}
+	}
+	return nil, false
+}
+
 func (state *DockerTaskEngineState) taskByArn(arn string) (*api.Task, bool) {
 	t, ok := state.tasks[arn]
 	return t, ok
@@ -170,6 +170,37 @@ func TestRemoveTask(t *testing.T) {
 	}
 }
 
+func TestTaskByIPAddress(t *testing.T) {
+	state := NewTaskEngineState()
+	runningContainer := &api.Container{
+		Name:              "c1",
+		KnownStatusUnsafe: api.ContainerRunning,
+		IPAddressesUnsafe: []string{"172.17.0.2", "172.18.0.2"},
+	}
+	stoppedContainer := &api.Container{
+		Name:              "c2",
+		KnownStatusUnsafe: api.ContainerStopped,
+		IPAddressesUnsafe: []string{"172.17.0.3"},
+	}
+	testTask := &api.Task{
+		Arn:        "t1",
+		Containers: []*api.Container{runningContainer, stoppedContainer},
+	}
+	state.AddTask(testTask)
+	state.AddContainer(&api.DockerContainer{DockerID: "did1", Container: runningContainer}, testTask)
+	state.AddContainer(&api.DockerContainer{DockerID: "did2", Container: stoppedContainer}, testTask)
+
+	task, ok := state.TaskByIPAddress("172.18.0.2")
+	assert.True(t, ok)
+	assert.Equal(t, testTask, task)
+
+	_, ok = state.TaskByIPAddress("172.17.0.3")
+	assert.False(t, ok, "stopped containers should not be resolved")
+
+	_, ok = state.TaskByIPAddress("172.17.0.4")
+	assert.False(t, ok)
+}
+
 func TestAddImageState(t *testing.T) {
 	state := NewTaskEngineState()
 
@@ -165,6 +165,17 @@ func (_mr *_MockTaskEngineStateRecorder) TaskByArn(arg0 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "TaskByArn", arg0)
 }
 
+func (_m *MockTaskEngineState) TaskByIPAddress(_param0 string) (*api.Task, bool) {
+	ret := _m.ctrl.Call(_m, "TaskByIPAddress", _param0)
+	ret0, _ := ret[0].(*api.Task)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+func (_mr *_MockTaskEngineStateRecorder) TaskByIPAddress(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TaskByIPAddress", arg0)
+}
+
 func (_m *MockTaskEngineState) TaskByID(_param0 string) (*api.Task, bool) {
 	ret := _m.ctrl.Call(_m, "TaskByID", _param0)
 	ret0, _ := ret[0].(*api.Task)
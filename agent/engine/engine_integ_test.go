@@ -74,7 +74,7 @@ func setup(cfg *config.Config, t *testing.T) (TaskEngine, func(), credentials.Ma
 		t.Skip("Docker not running")
 	}
 	clientFactory := dockerclient.NewFactory(dockerEndpoint)
-	dockerClient, err := NewDockerGoClient(clientFactory, cfg)
+	dockerClient, err := NewDockerGoClient(context.TODO(), clientFactory, cfg, nil)
 	if err != nil {
 		t.Fatalf("Error creating Docker client: %v", err)
 	}
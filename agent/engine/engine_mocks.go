@@ -22,6 +22,7 @@ import (
 	api "github.com/aws/amazon-ecs-agent/agent/api"
 	dockerclient "github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	image "github.com/aws/amazon-ecs-agent/agent/engine/image"
+	audit "github.com/aws/amazon-ecs-agent/agent/logger/audit"
 	statechange "github.com/aws/amazon-ecs-agent/agent/statechange"
 	statemanager "github.com/aws/amazon-ecs-agent/agent/statemanager"
 	go_dockerclient "github.com/fsouza/go-dockerclient"
@@ -129,6 +130,14 @@ func (_mr *_MockTaskEngineRecorder) MustInit(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "MustInit", arg0)
 }
 
+func (_m *MockTaskEngine) SetAuditLogger(_param0 audit.AuditLogger) {
+	_m.ctrl.Call(_m, "SetAuditLogger", _param0)
+}
+
+func (_mr *_MockTaskEngineRecorder) SetAuditLogger(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetAuditLogger", arg0)
+}
+
 func (_m *MockTaskEngine) SetSaver(_param0 statemanager.Saver) {
 	_m.ctrl.Call(_m, "SetSaver", _param0)
 }
@@ -334,6 +343,16 @@ func (_mr *_MockDockerClientRecorder) SupportedVersions() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SupportedVersions")
 }
 
+func (_m *MockDockerClient) TagImage(_param0 string, _param1 string, _param2 time.Duration) error {
+	ret := _m.ctrl.Call(_m, "TagImage", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDockerClientRecorder) TagImage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TagImage", arg0, arg1, arg2)
+}
+
 func (_m *MockDockerClient) Version() (string, error) {
 	ret := _m.ctrl.Call(_m, "Version")
 	ret0, _ := ret[0].(string)
@@ -204,6 +204,35 @@ func (err CannotPullECRContainerError) ErrorName() string {
 	return "CannotPullECRContainerError"
 }
 
+// CannotPullSSMContainerError indicates any error when trying to read the
+// registry credentials of a container image from the SSM Parameter Store
+type CannotPullSSMContainerError struct {
+	fromError error
+}
+
+func (err CannotPullSSMContainerError) Error() string {
+	return err.fromError.Error()
+}
+
+func (err CannotPullSSMContainerError) ErrorName() string {
+	return "CannotPullSSMContainerError"
+}
+
+// ImageAdmissionDeniedError indicates that the image admission policy doesn't
+// admit the image of a container
+type ImageAdmissionDeniedError struct {
+	image  string
+	reason string
+}
+
+func (err ImageAdmissionDeniedError) Error() string {
+	return "Image " + err.image + " is not admitted: " + err.reason
+}
+
+func (err ImageAdmissionDeniedError) ErrorName() string {
+	return "ImageAdmissionDeniedError"
+}
+
 // CannotCreateContainerError indicates any error when trying to create a container
 type CannotCreateContainerError struct {
 	fromError error
@@ -0,0 +1,80 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+)
+
+// imageAdmission applies the image admission policy to the images of
+// containers
+type imageAdmission struct {
+	policy *config.ImageAdmissionPolicy
+}
+
+func newImageAdmission(policy *config.ImageAdmissionPolicy) *imageAdmission {
+	return &imageAdmission{policy: policy}
+}
+
+// denialReason returns why the policy doesn't admit the image, which is empty
+// when the image is admitted
+func (admission *imageAdmission) denialReason(image string) string {
+	if admission == nil || admission.policy == nil {
+		return ""
+	}
+	policy := admission.policy
+
+	var repository, tag, digest string
+	if i := strings.Index(image, "@"); i >= 0 {
+		repository, _ = parseRepositoryTag(image[:i])
+		digest = image[i+1:]
+	} else {
+		repository, tag = parseRepositoryTag(image)
+	}
+	repository = qualifyRepository(repository)
+
+	if pattern, ok := matchRepository(policy.Denied, repository); ok {
+		return fmt.Sprintf("repository %s is denied by pattern %q", repository, pattern)
+	}
+	if _, ok := matchRepository(policy.Allowed, repository); len(policy.Allowed) > 0 && !ok {
+		return fmt.Sprintf("repository %s is not allowed", repository)
+	}
+	if digest == "" && policy.RequireDigest {
+		return "image is not referenced by digest"
+	}
+	if digest == "" && policy.DenyLatestTag && (tag == "" || tag == dockerDefaultTag) {
+		return "the latest tag is denied"
+	}
+	return ""
+}
+
+// matchRepository returns the first pattern matching the fully qualified
+// repository, or its registry for patterns without a "/"
+func matchRepository(patterns []string, repository string) (string, bool) {
+	registry := strings.SplitN(repository, "/", 2)[0]
+	for _, pattern := range patterns {
+		target := repository
+		if !strings.Contains(pattern, "/") {
+			target = registry
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,54 @@
+// +build !integration
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageAdmissionDenialReason(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy *config.ImageAdmissionPolicy
+		image  string
+		denied bool
+	}{
+		{"no policy", nil, "busybox", false},
+		{"empty policy", &config.ImageAdmissionPolicy{}, "busybox", false},
+		{"denied registry", &config.ImageAdmissionPolicy{Denied: []string{"docker.io"}}, "busybox:1.27", true},
+		{"denied index host", &config.ImageAdmissionPolicy{Denied: []string{"docker.io"}}, "index.docker.io/library/busybox:1.27", true},
+		{"denied repository", &config.ImageAdmissionPolicy{Denied: []string{"docker.io/library/*"}}, "busybox:1.27", true},
+		{"not denied repository", &config.ImageAdmissionPolicy{Denied: []string{"docker.io/library/*"}}, "amazon/amazon-ecs-agent:latest", false},
+		{"allowed registry", &config.ImageAdmissionPolicy{Allowed: []string{"*.dkr.ecr.*.amazonaws.com"}}, "123456789012.dkr.ecr.us-west-2.amazonaws.com/app:1", false},
+		{"not allowed registry", &config.ImageAdmissionPolicy{Allowed: []string{"*.dkr.ecr.*.amazonaws.com"}}, "busybox:1.27", true},
+		{"denied takes precedence", &config.ImageAdmissionPolicy{Allowed: []string{"docker.io"}, Denied: []string{"docker.io/library/*"}}, "busybox:1.27", true},
+		{"digest required", &config.ImageAdmissionPolicy{RequireDigest: true}, "busybox:1.27", true},
+		{"digest present", &config.ImageAdmissionPolicy{RequireDigest: true}, "busybox@sha256:0e6e8c5a1b1e2c5e0c0f7c3c8e9d1b8ea4b7f0a6f2b6d8d3c1e0e7f1b6a5d4c3", false},
+		{"implicit latest tag", &config.ImageAdmissionPolicy{DenyLatestTag: true}, "busybox", true},
+		{"explicit latest tag", &config.ImageAdmissionPolicy{DenyLatestTag: true}, "registry.example.com:5000/app:latest", true},
+		{"other tag", &config.ImageAdmissionPolicy{DenyLatestTag: true}, "registry.example.com:5000/app:1.0", false},
+		{"latest tag by digest", &config.ImageAdmissionPolicy{DenyLatestTag: true}, "busybox:latest@sha256:0e6e8c5a1b1e2c5e0c0f7c3c8e9d1b8ea4b7f0a6f2b6d8d3c1e0e7f1b6a5d4c3", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason := newImageAdmission(tc.policy).denialReason(tc.image)
+			assert.Equal(t, tc.denied, reason != "", "unexpected denial reason %q", reason)
+		})
+	}
+}
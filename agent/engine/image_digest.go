@@ -0,0 +1,73 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+)
+
+// repoDigest returns the digest, as in "sha256:...", of the image's own
+// repository out of the repo digests of an image. It is empty when the image
+// has no repo digest for its repository, as for images pulled from a rewritten
+// reference or only built locally, since the image can't be referenced by
+// digest in its repository then.
+func repoDigest(repoDigests []string, image string) string {
+	repository, _ := parseRepositoryTag(image)
+	repository = qualifyRepository(repository)
+
+	for _, repoDigest := range repoDigests {
+		parts := strings.SplitN(repoDigest, "@", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if qualifyRepository(parts[0]) == repository {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// digestReference returns the reference of the image by digest, as in
+// "busybox@sha256:..." for "busybox:latest"
+func digestReference(image string, digest string) string {
+	if strings.Contains(image, "@") {
+		return image
+	}
+	repository, _ := parseRepositoryTag(image)
+	return repository + "@" + digest
+}
+
+// pinnedImageReference returns the reference by digest the container's image
+// is pinned to, which is the digest first resolved for the image in the task.
+// It is empty when image digest pinning is disabled or no digest is known yet.
+func (engine *DockerTaskEngine) pinnedImageReference(task *api.Task, container *api.Container) string {
+	if !engine.cfg.ImageDigestPinningEnabled {
+		return ""
+	}
+	digest := container.GetImageDigest()
+	if digest == "" {
+		for _, taskContainer := range task.Containers {
+			if taskContainer.Image == container.Image && taskContainer.GetImageDigest() != "" {
+				digest = taskContainer.GetImageDigest()
+				break
+			}
+		}
+	}
+	if digest == "" {
+		return ""
+	}
+	return digestReference(container.Image, digest)
+}
@@ -0,0 +1,50 @@
+// +build !integration
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoDigest(t *testing.T) {
+	testCases := []struct {
+		name        string
+		repoDigests []string
+		image       string
+		expected    string
+	}{
+		{"no repo digests", nil, "busybox", ""},
+		{"own repository", []string{"busybox@sha256:hub"}, "busybox:1.26", "sha256:hub"},
+		{"qualified repository", []string{"docker.io/library/busybox@sha256:hub"}, "busybox", "sha256:hub"},
+		{"prefers own repository", []string{"mirror.example.com/busybox@sha256:mirror", "busybox@sha256:hub"}, "busybox", "sha256:hub"},
+		{"other repository", []string{"mirror.example.com/busybox@sha256:mirror"}, "busybox", ""},
+		{"malformed", []string{"busybox"}, "busybox", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, repoDigest(tc.repoDigests, tc.image))
+		})
+	}
+}
+
+func TestDigestReference(t *testing.T) {
+	assert.Equal(t, "busybox@sha256:abc", digestReference("busybox", "sha256:abc"))
+	assert.Equal(t, "busybox@sha256:abc", digestReference("busybox:1.26", "sha256:abc"))
+	assert.Equal(t, "registry.example.com:5000/app@sha256:abc", digestReference("registry.example.com:5000/app:stable", "sha256:abc"))
+	assert.Equal(t, "busybox@sha256:old", digestReference("busybox@sha256:old", "sha256:abc"))
+}
@@ -0,0 +1,126 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/cihub/seelog"
+)
+
+const (
+	dockerHubRegistry  = "docker.io"
+	dockerHubLibrary   = "library"
+	dockerHubIndexHost = "index.docker.io"
+)
+
+// imageRewriter applies the configured image pull rewrite rules to image
+// references
+type imageRewriter struct {
+	rules []imageRewriteRule
+}
+
+type imageRewriteRule struct {
+	prefix   string
+	wildcard bool
+	regex    *regexp.Regexp
+	replace  string
+}
+
+func newImageRewriter(rules []config.ImagePullRewriteRule) *imageRewriter {
+	rewriter := &imageRewriter{}
+	for _, rule := range rules {
+		if rule.Regex != "" {
+			regex, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				seelog.Warnf("Ignoring image pull rewrite rule with an invalid regex %q: %v", rule.Regex, err)
+				continue
+			}
+			rewriter.rules = append(rewriter.rules, imageRewriteRule{
+				regex:   regex,
+				replace: rule.Replace,
+			})
+			continue
+		}
+		rewriter.rules = append(rewriter.rules, imageRewriteRule{
+			prefix:   strings.TrimSuffix(rule.Match, "*"),
+			wildcard: strings.HasSuffix(rule.Match, "*"),
+			replace:  rule.Replace,
+		})
+	}
+	return rewriter
+}
+
+// rewrite returns the reference to pull the image from, which is the image
+// itself when no rule matches
+func (rewriter *imageRewriter) rewrite(image string) string {
+	if rewriter == nil || len(rewriter.rules) == 0 {
+		return image
+	}
+	reference := qualifyImageReference(image)
+	for _, rule := range rewriter.rules {
+		if rewritten, ok := rule.apply(reference); ok {
+			return rewritten
+		}
+	}
+	return image
+}
+
+func (rule imageRewriteRule) apply(reference string) (string, bool) {
+	if rule.regex != nil {
+		if !rule.regex.MatchString(reference) {
+			return "", false
+		}
+		return rule.regex.ReplaceAllString(reference, rule.replace), true
+	}
+	if !rule.wildcard {
+		return rule.replace, reference == rule.prefix
+	}
+	if !strings.HasPrefix(reference, rule.prefix) {
+		return "", false
+	}
+	return strings.Replace(rule.replace, "*", strings.TrimPrefix(reference, rule.prefix), 1), true
+}
+
+// qualifyImageReference expands an image reference to include its registry and
+// tag, as in "docker.io/library/busybox:latest" for "busybox"
+func qualifyImageReference(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return qualifyRepository(image[:i]) + image[i:]
+	}
+	repository, tag := parseRepositoryTag(image)
+	if tag == "" {
+		tag = dockerDefaultTag
+	}
+	return qualifyRepository(repository) + ":" + tag
+}
+
+// qualifyRepository expands a repository name to include its registry, as in
+// "docker.io/library/busybox" for "busybox"
+func qualifyRepository(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		// No registry host, the image is on Docker Hub
+		repository = dockerHubRegistry + "/" + repository
+	} else if parts[0] == dockerHubIndexHost {
+		repository = dockerHubRegistry + "/" + parts[1]
+	}
+	// Official Docker Hub images are in the library namespace
+	if path := strings.TrimPrefix(repository, dockerHubRegistry+"/"); path != repository && !strings.Contains(path, "/") {
+		repository = dockerHubRegistry + "/" + dockerHubLibrary + "/" + path
+	}
+	return repository
+}
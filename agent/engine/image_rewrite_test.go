@@ -0,0 +1,86 @@
+// +build !integration
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualifyImageReference(t *testing.T) {
+	testCases := map[string]string{
+		"busybox":                              "docker.io/library/busybox:latest",
+		"busybox:1.26":                         "docker.io/library/busybox:1.26",
+		"amazon/amazon-ecs-agent":              "docker.io/amazon/amazon-ecs-agent:latest",
+		"docker.io/busybox":                    "docker.io/library/busybox:latest",
+		"index.docker.io/amazon/ecs:v1":        "docker.io/amazon/ecs:v1",
+		"quay.io/coreos/etcd:v3":               "quay.io/coreos/etcd:v3",
+		"localhost/busybox":                    "localhost/busybox:latest",
+		"registry.example.com:5000/app":        "registry.example.com:5000/app:latest",
+		"registry.example.com:5000/app:stable": "registry.example.com:5000/app:stable",
+		"busybox@sha256:0123456789abcdef":      "docker.io/library/busybox@sha256:0123456789abcdef",
+	}
+
+	for image, expected := range testCases {
+		assert.Equal(t, expected, qualifyImageReference(image), "Wrong qualified reference for %s", image)
+	}
+}
+
+func TestImageRewriter(t *testing.T) {
+	rewriter := newImageRewriter([]config.ImagePullRewriteRule{
+		{Match: "docker.io/library/*", Replace: "mirror.example.com/dockerhub/*"},
+		{Regex: `^quay\.io/(.*)$`, Replace: "mirror.example.com/quay/$1"},
+		{Match: "registry.example.com/app:stable", Replace: "registry.example.com/app:1.0"},
+	})
+
+	testCases := map[string]string{
+		"busybox":                         "mirror.example.com/dockerhub/busybox:latest",
+		"docker.io/library/busybox:1.26":  "mirror.example.com/dockerhub/busybox:1.26",
+		"quay.io/coreos/etcd:v3":          "mirror.example.com/quay/coreos/etcd:v3",
+		"registry.example.com/app:stable": "registry.example.com/app:1.0",
+		"registry.example.com/app:beta":   "registry.example.com/app:beta",
+		"amazon/amazon-ecs-agent":         "amazon/amazon-ecs-agent",
+		"busybox@sha256:0123456789abcdef": "mirror.example.com/dockerhub/busybox@sha256:0123456789abcdef",
+	}
+
+	for image, expected := range testCases {
+		assert.Equal(t, expected, rewriter.rewrite(image), "Wrong rewritten reference for %s", image)
+	}
+}
+
+func TestImageRewriterFirstMatchingRuleApplies(t *testing.T) {
+	rewriter := newImageRewriter([]config.ImagePullRewriteRule{
+		{Match: "docker.io/library/busybox:*", Replace: "first.example.com/busybox:*"},
+		{Match: "docker.io/*", Replace: "second.example.com/*"},
+	})
+
+	assert.Equal(t, "first.example.com/busybox:latest", rewriter.rewrite("busybox"))
+	assert.Equal(t, "second.example.com/library/alpine:latest", rewriter.rewrite("alpine"))
+}
+
+func TestImageRewriterWithoutRules(t *testing.T) {
+	assert.Equal(t, "busybox", newImageRewriter(nil).rewrite("busybox"))
+}
+
+func TestImageRewriterSkipsInvalidRegex(t *testing.T) {
+	rewriter := newImageRewriter([]config.ImagePullRewriteRule{
+		{Regex: `^docker\.io/(.*$`, Replace: "broken.example.com/$1"},
+		{Match: "docker.io/*", Replace: "mirror.example.com/*"},
+	})
+
+	assert.Equal(t, "mirror.example.com/library/busybox:latest", rewriter.rewrite("busybox"))
+}
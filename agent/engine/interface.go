@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/agent/statechange"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"golang.org/x/net/context"
@@ -36,6 +37,7 @@ type TaskEngine interface {
 	// running or stopped, as well as providing portbinding and other metadata
 	StateChangeEvents() <-chan statechange.Event
 	SetSaver(statemanager.Saver)
+	SetAuditLogger(audit.AuditLogger)
 
 	// AddTask adds a new task to the task engine and manages its container's
 	// lifecycle. If it returns an error, the task was not added.
@@ -113,6 +113,10 @@ func (mtask *managedTask) overseeTask() {
 	// If this was a 'state restore', send all unsent statuses
 	mtask.emitCurrentStatus()
 
+	// Stop the task before pulling any images if the image admission policy
+	// doesn't admit them
+	mtask.enforceImageAdmissionPolicy()
+
 	// Wait for host resources required by this task to become available
 	mtask.waitForHostResources()
 
@@ -163,6 +167,53 @@ func (mtask *managedTask) emitCurrentStatus() {
 	mtask.engine.emitTaskEvent(mtask.Task, "")
 }
 
+// enforceImageAdmissionPolicy moves the task to stopped if the image admission
+// policy doesn't admit the image of any of its containers that are yet to be
+// pulled, or the reference the image pull rewrite rules pull it from. The
+// containers whose images are denied record the reason as their applying
+// error, and each denial is written to the audit log.
+func (mtask *managedTask) enforceImageAdmissionPolicy() {
+	if mtask.GetDesiredStatus().Terminal() {
+		return
+	}
+	admitted := true
+	for _, container := range mtask.Containers {
+		if container.IsInternal || container.GetKnownStatus() >= api.ContainerPulled {
+			continue
+		}
+		image, reason := mtask.imageDenialReason(container)
+		if reason == "" {
+			continue
+		}
+		admitted = false
+		err := ImageAdmissionDeniedError{image: image, reason: reason}
+		seelog.Warnf("Stopping task %s; container %s: %v", mtask.Arn, container.Name, err)
+		container.SetApplyingError(api.NewNamedError(err))
+		if mtask.engine.auditLogger != nil {
+			mtask.engine.auditLogger.LogImageAdmissionDenied(mtask.Arn, image, reason)
+		}
+	}
+	if !admitted {
+		mtask.handleDesiredStatusChange(api.TaskStopped, 0)
+	}
+}
+
+// imageDenialReason returns the first of the references the container's image
+// may be pulled from that the image admission policy doesn't admit, and why.
+// The reason is empty when all of them are admitted.
+func (mtask *managedTask) imageDenialReason(container *api.Container) (string, string) {
+	images := []string{container.Image}
+	if rewrittenImage := mtask.engine.rewrittenImage(container.Image); rewrittenImage != "" {
+		images = []string{rewrittenImage, container.Image}
+	}
+	for _, image := range images {
+		if reason := mtask.engine.imageAdmission.denialReason(image); reason != "" {
+			return image, reason
+		}
+	}
+	return "", ""
+}
+
 // waitForHostResources waits for host resources to become available to start
 // the task. This involves waiting for previous stops to complete so the
 // resources become free.
@@ -207,12 +258,17 @@ func (mtask *managedTask) waitSteady() {
 	}
 }
 
-// cleanupCredentials removes credentials for a stopped task
+// cleanupCredentials removes the task role and execution role credentials for
+// a stopped task
 func (mtask *managedTask) cleanupCredentials() {
 	taskCredentialsID := mtask.GetCredentialsID()
 	if taskCredentialsID != "" {
 		mtask.engine.credentialsManager.RemoveCredentials(taskCredentialsID)
 	}
+	executionCredentialsID := mtask.GetExecutionCredentialsID()
+	if executionCredentialsID != "" {
+		mtask.engine.credentialsManager.RemoveCredentials(executionCredentialsID)
+	}
 }
 
 // waitEvent waits for any event to occur. If an event occurs, the appropriate
@@ -309,11 +365,14 @@ func (mtask *managedTask) handleContainerChange(containerChange dockerContainerC
 		container.SetKnownExitCode(event.ExitCode)
 	}
 	if event.PortBindings != nil {
-		container.KnownPortBindings = event.PortBindings
+		container.SetKnownPortBindings(event.PortBindings)
 	}
 	if event.Volumes != nil {
 		mtask.UpdateMountPoints(container, event.Volumes)
 	}
+	if event.IPAddresses != nil {
+		container.SetIPAddresses(event.IPAddresses)
+	}
 
 	mtask.engine.emitContainerEvent(mtask.Task, container, "")
 	if mtask.UpdateStatus() {
@@ -348,8 +407,8 @@ func (mtask *managedTask) handleStoppedToRunningContainerTransition(status api.C
 func (mtask *managedTask) handleEventError(containerChange dockerContainerChange, currentKnownStatus api.ContainerStatus) bool {
 	container := containerChange.container
 	event := containerChange.event
-	if container.ApplyingError == nil {
-		container.ApplyingError = api.NewNamedError(event.Error)
+	if container.GetApplyingError() == nil {
+		container.SetApplyingError(api.NewNamedError(event.Error))
 	}
 	if event.Status == api.ContainerStopped {
 		// If we were trying to transition to stopped and had a timeout error
@@ -22,14 +22,18 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/testdata"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/logger/audit/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/statechange"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ttime/mocks"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/golang/mock/gomock"
 	"golang.org/x/net/context"
@@ -472,6 +476,131 @@ func TestOnContainersUnableToTransitionStateForDesiredRunningTask(t *testing.T)
 	assert.Equal(t, task.Containers[0].GetDesiredStatus(), api.ContainerStopped)
 }
 
+func TestEnforceImageAdmissionPolicyStopsTaskWithDeniedImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+
+	admittedContainer := &api.Container{
+		Name:                "admitted",
+		Image:               "busybox:1.27",
+		DesiredStatusUnsafe: api.ContainerRunning,
+	}
+	deniedContainer := &api.Container{
+		Name:                "denied",
+		Image:               "busybox",
+		DesiredStatusUnsafe: api.ContainerRunning,
+	}
+	task := &managedTask{
+		Task: &api.Task{
+			Arn:                 "task-arn",
+			Containers:          []*api.Container{admittedContainer, deniedContainer},
+			DesiredStatusUnsafe: api.TaskRunning,
+		},
+		engine: &DockerTaskEngine{
+			imageAdmission: newImageAdmission(&config.ImageAdmissionPolicy{DenyLatestTag: true}),
+			auditLogger:    auditLogger,
+		},
+	}
+
+	auditLogger.EXPECT().LogImageAdmissionDenied("task-arn", "busybox", "the latest tag is denied")
+	task.enforceImageAdmissionPolicy()
+
+	assert.Equal(t, api.TaskStopped, task.GetDesiredStatus())
+	assert.Nil(t, admittedContainer.ApplyingError)
+	assert.Equal(t, api.ContainerStopped, admittedContainer.GetDesiredStatus())
+	require.NotNil(t, deniedContainer.ApplyingError)
+	assert.Equal(t, "ImageAdmissionDeniedError", deniedContainer.ApplyingError.ErrorName())
+	assert.Equal(t, api.ContainerStopped, deniedContainer.GetDesiredStatus())
+}
+
+func TestEnforceImageAdmissionPolicyChecksRewrittenImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+
+	container := &api.Container{
+		Name:                "rewritten",
+		Image:               "registry.example.com/app:1.0",
+		DesiredStatusUnsafe: api.ContainerRunning,
+	}
+	task := &managedTask{
+		Task: &api.Task{
+			Arn:                 "task-arn",
+			Containers:          []*api.Container{container},
+			DesiredStatusUnsafe: api.TaskRunning,
+		},
+		engine: &DockerTaskEngine{
+			imageAdmission: newImageAdmission(&config.ImageAdmissionPolicy{Denied: []string{"untrusted.example.com"}}),
+			imageRewriter: newImageRewriter([]config.ImagePullRewriteRule{
+				{Match: "registry.example.com/*", Replace: "untrusted.example.com/*"},
+			}),
+			auditLogger: auditLogger,
+		},
+	}
+
+	auditLogger.EXPECT().LogImageAdmissionDenied("task-arn", "untrusted.example.com/app:1.0",
+		`repository untrusted.example.com/app is denied by pattern "untrusted.example.com"`)
+	task.enforceImageAdmissionPolicy()
+
+	assert.Equal(t, api.TaskStopped, task.GetDesiredStatus())
+	require.NotNil(t, container.ApplyingError)
+	assert.Equal(t, "ImageAdmissionDeniedError", container.ApplyingError.ErrorName())
+}
+
+func TestEnforceImageAdmissionPolicyIgnoresPulledContainers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	auditLogger := mock_audit.NewMockAuditLogger(ctrl)
+
+	task := &managedTask{
+		Task: &api.Task{
+			Arn: "task-arn",
+			Containers: []*api.Container{
+				{
+					Name:                "running",
+					Image:               "busybox",
+					KnownStatusUnsafe:   api.ContainerRunning,
+					DesiredStatusUnsafe: api.ContainerRunning,
+				},
+				{
+					Name:                "internal",
+					Image:               "amazon/amazon-ecs-emptyvolume-base:autogenerated",
+					IsInternal:          true,
+					DesiredStatusUnsafe: api.ContainerRunning,
+				},
+			},
+			DesiredStatusUnsafe: api.TaskRunning,
+		},
+		engine: &DockerTaskEngine{
+			imageAdmission: newImageAdmission(&config.ImageAdmissionPolicy{RequireDigest: true}),
+			auditLogger:    auditLogger,
+		},
+	}
+
+	task.enforceImageAdmissionPolicy()
+	assert.Equal(t, api.TaskRunning, task.GetDesiredStatus())
+}
+
+func TestCleanupCredentialsRemovesExecutionRoleCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialsManager := mock_credentials.NewMockManager(ctrl)
+
+	task := &managedTask{
+		Task: &api.Task{Arn: "task-arn"},
+		engine: &DockerTaskEngine{
+			credentialsManager: credentialsManager,
+		},
+	}
+	task.SetCredentialsID("taskCredsID")
+	task.SetExecutionCredentialsID("execCredsID")
+
+	credentialsManager.EXPECT().RemoveCredentials("taskCredsID")
+	credentialsManager.EXPECT().RemoveCredentials("execCredsID")
+	task.cleanupCredentials()
+}
+
 // TODO: Test progressContainers workflow
 // TODO: Test handleStoppedToRunningContainerTransition
 
@@ -40,6 +40,9 @@ type DockerContainerMetadata struct {
 	PortBindings []api.PortBinding
 	Error        engineError
 	Volumes      map[string]string
+	// IPAddresses are the addresses of the container on the docker networks
+	// it is attached to
+	IPAddresses []string
 }
 
 // ListContainersResponse encapsulates the response from the docker client for the
@@ -0,0 +1,195 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// subscriberBufferSize is the number of events buffered for a slow
+	// subscriber before events are dropped for it
+	subscriberBufferSize = 100
+
+	// TaskEventType is the type of messages for task state changes
+	TaskEventType = "task"
+	// ContainerEventType is the type of messages for container state changes
+	ContainerEventType = "container"
+)
+
+// EventMessage is the representation of a state change sent to local
+// subscribers.
+type EventMessage struct {
+	// Sequence increases by one with every event published, subscribers can
+	// use it to detect dropped events
+	Sequence      uint64
+	Type          string
+	Timestamp     time.Time
+	TaskArn       string
+	ContainerName string `json:",omitempty"`
+	Status        string
+	Reason        string            `json:",omitempty"`
+	ReasonCode    string            `json:",omitempty"`
+	ExitCode      *int              `json:",omitempty"`
+	PortBindings  []api.PortBinding `json:",omitempty"`
+	ImageDigest   string            `json:",omitempty"`
+	// Containers holds the container state changes submitted along with a
+	// task state change
+	Containers []*EventMessage `json:",omitempty"`
+}
+
+func newContainerEventMessage(change api.ContainerStateChange) *EventMessage {
+	return &EventMessage{
+		Type:          ContainerEventType,
+		TaskArn:       change.TaskArn,
+		ContainerName: change.ContainerName,
+		Status:        change.Status.String(),
+		Reason:        change.Reason,
+		ExitCode:      change.ExitCode,
+		PortBindings:  change.PortBindings,
+		ImageDigest:   change.ImageDigest,
+	}
+}
+
+// NewEventMessage converts a state change emitted by the engine.
+func NewEventMessage(change statechange.Event) (*EventMessage, error) {
+	switch change.GetEventType() {
+	case statechange.TaskEvent:
+		event, ok := change.(api.TaskStateChange)
+		if !ok {
+			return nil, errors.New("eventhandler: unable to get task event from state change event")
+		}
+		message := &EventMessage{
+			Type:       TaskEventType,
+			TaskArn:    event.TaskArn,
+			Status:     event.Status.String(),
+			Reason:     event.Reason,
+			ReasonCode: event.ReasonCode,
+		}
+		for _, containerChange := range event.Containers {
+			message.Containers = append(message.Containers, newContainerEventMessage(containerChange))
+		}
+		return message, nil
+
+	case statechange.ContainerEvent:
+		event, ok := change.(api.ContainerStateChange)
+		if !ok {
+			return nil, errors.New("eventhandler: unable to get container event from state change event")
+		}
+		return newContainerEventMessage(event), nil
+
+	default:
+		return nil, errors.New("eventhandler: unable to determine event type from state change event")
+	}
+}
+
+// Broadcaster fans out the state changes emitted by the engine to local
+// subscribers. Every subscriber gets its own buffered channel; events are
+// dropped for subscribers that do not keep up, so that a slow subscriber
+// never holds up the submission of state changes to the backend.
+type Broadcaster struct {
+	subscribers  map[string]chan *EventMessage
+	listeners    []Listener
+	nextSequence uint64
+	lock         sync.Mutex
+}
+
+// Listener is called with every state change, before the state change is
+// delivered to the subscribers. Unlike subscribers, listeners never miss a
+// state change, so they must return quickly.
+type Listener func(change statechange.Event)
+
+// NewBroadcaster returns a pointer to a Broadcaster without subscribers.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers:  make(map[string]chan *EventMessage),
+		nextSequence: 1,
+	}
+}
+
+// Subscribe returns the channel on which events are delivered to the
+// subscriber called name. Messages are shared between subscribers and must
+// not be modified.
+func (broadcaster *Broadcaster) Subscribe(name string) (<-chan *EventMessage, error) {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+
+	if _, ok := broadcaster.subscribers[name]; ok {
+		return nil, fmt.Errorf("subscriber %s already exists", name)
+	}
+	events := make(chan *EventMessage, subscriberBufferSize)
+	broadcaster.subscribers[name] = events
+	seelog.Debugf("Broadcaster, added subscriber %s", name)
+	return events, nil
+}
+
+// AddListener registers a listener called with every state change.
+func (broadcaster *Broadcaster) AddListener(listener Listener) {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+
+	broadcaster.listeners = append(broadcaster.listeners, listener)
+}
+
+// Unsubscribe removes the subscriber called name and closes its channel.
+func (broadcaster *Broadcaster) Unsubscribe(name string) {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+
+	events, ok := broadcaster.subscribers[name]
+	if !ok {
+		return
+	}
+	delete(broadcaster.subscribers, name)
+	close(events)
+	seelog.Debugf("Broadcaster, removed subscriber %s", name)
+}
+
+// Publish calls the listeners with a state change and delivers it to every
+// subscriber.
+func (broadcaster *Broadcaster) Publish(change statechange.Event) error {
+	broadcaster.lock.Lock()
+	listeners := broadcaster.listeners
+	broadcaster.lock.Unlock()
+	for _, listener := range listeners {
+		listener(change)
+	}
+
+	message, err := NewEventMessage(change)
+	if err != nil {
+		return err
+	}
+
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+
+	message.Sequence = broadcaster.nextSequence
+	message.Timestamp = time.Now()
+	broadcaster.nextSequence++
+	for name, events := range broadcaster.subscribers {
+		select {
+		case events <- message:
+		default:
+			seelog.Warnf("Broadcaster, subscriber %s is not keeping up, dropping event %d", name, message.Sequence)
+		}
+	}
+	return nil
+}
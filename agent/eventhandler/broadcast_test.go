@@ -0,0 +1,105 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcasterPublish(t *testing.T) {
+	broadcaster := NewBroadcaster()
+	first, err := broadcaster.Subscribe("first")
+	require.NoError(t, err)
+	second, err := broadcaster.Subscribe("second")
+	require.NoError(t, err)
+	_, err = broadcaster.Subscribe("first")
+	assert.Error(t, err, "Expected duplicate subscriber to be rejected")
+
+	exitCode := 1
+	require.NoError(t, broadcaster.Publish(api.ContainerStateChange{
+		TaskArn:       "t1",
+		ContainerName: "c1",
+		Status:        api.ContainerStopped,
+		ExitCode:      &exitCode,
+		ImageDigest:   "sha256:abc",
+	}))
+	require.NoError(t, broadcaster.Publish(api.TaskStateChange{
+		TaskArn: "t1",
+		Status:  api.TaskStopped,
+		Containers: []api.ContainerStateChange{
+			{TaskArn: "t1", ContainerName: "c2", Status: api.ContainerStopped},
+		},
+	}))
+
+	for _, events := range []<-chan *EventMessage{first, second} {
+		message := <-events
+		assert.Equal(t, uint64(1), message.Sequence)
+		assert.Equal(t, ContainerEventType, message.Type)
+		assert.Equal(t, "c1", message.ContainerName)
+		assert.Equal(t, "STOPPED", message.Status)
+		assert.Equal(t, 1, *message.ExitCode)
+		assert.Equal(t, "sha256:abc", message.ImageDigest)
+
+		message = <-events
+		assert.Equal(t, uint64(2), message.Sequence)
+		assert.Equal(t, TaskEventType, message.Type)
+		assert.Equal(t, "t1", message.TaskArn)
+		require.Len(t, message.Containers, 1)
+		assert.Equal(t, "c2", message.Containers[0].ContainerName)
+	}
+}
+
+func TestBroadcasterUnsubscribe(t *testing.T) {
+	broadcaster := NewBroadcaster()
+	events, err := broadcaster.Subscribe("subscriber")
+	require.NoError(t, err)
+
+	broadcaster.Unsubscribe("subscriber")
+	_, ok := <-events
+	assert.False(t, ok, "Expected channel to be closed")
+	// Unsubscribing twice is a no-op
+	broadcaster.Unsubscribe("subscriber")
+	assert.NoError(t, broadcaster.Publish(api.TaskStateChange{TaskArn: "t1", Status: api.TaskRunning}))
+}
+
+func TestBroadcasterDropsEventsForSlowSubscribers(t *testing.T) {
+	broadcaster := NewBroadcaster()
+	events, err := broadcaster.Subscribe("slow")
+	require.NoError(t, err)
+
+	for i := 0; i < subscriberBufferSize+1; i++ {
+		require.NoError(t, broadcaster.Publish(api.TaskStateChange{TaskArn: "t1", Status: api.TaskRunning}))
+	}
+	assert.Len(t, events, subscriberBufferSize)
+}
+
+func TestBroadcasterListenersGetEveryEvent(t *testing.T) {
+	broadcaster := NewBroadcaster()
+	_, err := broadcaster.Subscribe("slow")
+	require.NoError(t, err)
+	var changes []statechange.Event
+	broadcaster.AddListener(func(change statechange.Event) {
+		changes = append(changes, change)
+	})
+
+	for i := 0; i < subscriberBufferSize+1; i++ {
+		require.NoError(t, broadcaster.Publish(api.TaskStateChange{TaskArn: "t1", Status: api.TaskRunning}))
+	}
+	assert.Len(t, changes, subscriberBufferSize+1)
+}
@@ -26,7 +26,10 @@ var log = logger.ForModule("eventhandler")
 // changes to a task or container's SentStatus
 var statesaver statemanager.Saver = statemanager.NewNoopStateManager()
 
-func HandleEngineEvents(taskEngine engine.TaskEngine, client api.ECSClient, saver statemanager.Saver, eventhandler *TaskHandler) {
+// HandleEngineEvents submits the state changes emitted by the engine to the
+// backend, publishing them to local subscribers first if a broadcaster is set.
+func HandleEngineEvents(taskEngine engine.TaskEngine, client api.ECSClient, saver statemanager.Saver,
+	eventhandler *TaskHandler, broadcaster *Broadcaster) {
 	statesaver = saver
 
 	for {
@@ -40,6 +43,12 @@ func HandleEngineEvents(taskEngine engine.TaskEngine, client api.ECSClient, save
 					log.Error("Unable to handle state change event. The events channel is closed")
 					break
 				}
+				if broadcaster != nil {
+					err := broadcaster.Publish(event)
+					if err != nil {
+						log.Warn("Unable to publish state change event", "err", err, "event", event)
+					}
+				}
 				err := eventhandler.AddStateChangeEvent(event, client)
 				if err != nil {
 					log.Error("Handler unable to add state change event", "err", err, "event", event)
@@ -18,6 +18,7 @@ import (
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/api/mocks"
@@ -25,6 +26,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
 )
 
 func containerEvent(arn string) statechange.Event {
@@ -264,3 +266,68 @@ func TestShouldBeSent(t *testing.T) {
 		t.Error("Container should be sent if it's the first try")
 	}
 }
+
+func TestLocalTaskEventsNotSubmitted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// No calls are expected on the client
+	client := mock_api.NewMockECSClient(ctrl)
+
+	handler := NewTaskHandler()
+	task := &api.Task{Arn: "local/task", Local: true}
+	container := &api.Container{}
+
+	handler.AddStateChangeEvent(api.ContainerStateChange{
+		TaskArn:   task.Arn,
+		Status:    api.ContainerStopped,
+		Container: container,
+	}, client)
+	handler.AddStateChangeEvent(api.TaskStateChange{TaskArn: task.Arn, Status: api.TaskStopped, Task: task}, client)
+
+	assert.Equal(t, api.TaskStopped, task.GetSentStatus())
+	assert.Equal(t, api.ContainerStopped, container.GetSentStatus())
+	assert.Equal(t, QueueStats{}, handler.QueueStats())
+}
+
+func TestDrainSubmitsBatchedContainerEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_api.NewMockECSClient(ctrl)
+
+	handler := NewTaskHandler()
+	client.EXPECT().SubmitContainerStateChange(gomock.Any()).Return(nil).Times(2)
+
+	// Container events are batched until the task changes state
+	handler.AddStateChangeEvent(containerEvent("taskarn1"), client)
+	handler.AddStateChangeEvent(containerEvent("taskarn2"), client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Empty(t, handler.Drain(ctx, client))
+	assert.Equal(t, QueueStats{}, handler.QueueStats())
+}
+
+func TestDrainReturnsPendingEventsWhenDone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_api.NewMockECSClient(ctrl)
+
+	handler := NewTaskHandler()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	retriable := utils.NewRetriableError(utils.NewRetriable(true), errors.New("test"))
+	gomock.InOrder(
+		client.EXPECT().SubmitTaskStateChange(gomock.Any()).Return(retriable),
+		client.EXPECT().SubmitTaskStateChange(gomock.Any()).Return(nil).Do(func(interface{}) { wg.Done() }),
+	)
+
+	handler.AddStateChangeEvent(taskEvent("taskarn"), client)
+
+	// The event is retried after a backoff longer than the drain timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	pending := handler.Drain(ctx, client)
+	assert.Len(t, pending, 1)
+	assert.Contains(t, pending[0], "TaskChange")
+	wg.Wait()
+}
@@ -0,0 +1,277 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+)
+
+const (
+	// JournalDirName is the directory under the agent's data directory that
+	// holds the state changes waiting to be submitted.
+	JournalDirName = "state_changes"
+
+	journalFileSuffix = ".json"
+	journalTempPrefix = "tmp_state_changes"
+)
+
+// journalContainerChange is the persisted form of api.ContainerStateChange,
+// without the pointer into the engine state.
+type journalContainerChange struct {
+	TaskArn       string
+	ContainerName string
+	Status        api.ContainerStatus
+	Reason        string
+	ExitCode      *int
+	PortBindings  []api.PortBinding
+	ImageDigest   string `json:",omitempty"`
+}
+
+// journalTaskChange is the persisted form of api.TaskStateChange, without the
+// pointer into the engine state.
+type journalTaskChange struct {
+	TaskArn    string
+	Status     api.TaskStatus
+	Reason     string
+	ReasonCode string `json:",omitempty"`
+	Containers []journalContainerChange
+}
+
+// journalRecord is a state change waiting to be submitted.
+type journalRecord struct {
+	Sequence        uint64
+	Created         time.Time
+	ContainerChange *journalContainerChange `json:",omitempty"`
+	TaskChange      *journalTaskChange      `json:",omitempty"`
+}
+
+// journalTaskFile is the content of the journal file of a task.
+type journalTaskFile struct {
+	TaskArn string
+	Records []journalRecord
+}
+
+// journal is a write-ahead log of the state changes that have not been
+// submitted yet. Every task with pending changes has its own file, which is
+// rewritten each time the list of pending changes of the task is modified and
+// removed once the list is empty.
+type journal struct {
+	dir string
+}
+
+// newJournal creates the journal directory if it doesn't exist.
+func newJournal(dir string) (*journal, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{dir: dir}, nil
+}
+
+// taskFile returns the path of the journal file of a task. Arns contain
+// characters that are not valid in file names on every platform, so they
+// are hashed.
+func (j *journal) taskFile(taskArn string) string {
+	sum := sha256.Sum256([]byte(taskArn))
+	return filepath.Join(j.dir, hex.EncodeToString(sum[:])+journalFileSuffix)
+}
+
+// sync writes the pending events of a task to its journal file, or removes
+// the file if there are none. The events list must be locked by the caller.
+func (j *journal) sync(taskArn string, events *list.List) error {
+	if events.Len() == 0 {
+		return j.remove(taskArn)
+	}
+	taskFile := journalTaskFile{TaskArn: taskArn}
+	for element := events.Front(); element != nil; element = element.Next() {
+		taskFile.Records = append(taskFile.Records, element.Value.(*sendableEvent).toRecord())
+	}
+	data, err := json.Marshal(&taskFile)
+	if err != nil {
+		return err
+	}
+	return j.writeFile(j.taskFile(taskArn), data)
+}
+
+// writeFile replaces the content of path by writing to a temporary file on
+// the same volume and renaming it.
+func (j *journal) writeFile(path string, data []byte) error {
+	tmpfile, err := ioutil.TempFile(j.dir, journalTempPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmpfile.Write(data)
+	if err == nil {
+		err = tmpfile.Sync()
+	}
+	closeErr := tmpfile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpfile.Name())
+		return err
+	}
+	return os.Rename(tmpfile.Name(), path)
+}
+
+// remove deletes the journal file of a task.
+func (j *journal) remove(taskArn string) error {
+	err := os.Remove(j.taskFile(taskArn))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// load reads every record in the journal, ordered by sequence number.
+// Files that cannot be read are logged and skipped.
+func (j *journal) load() ([]journalRecord, error) {
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+	var records []journalRecord
+	for _, file := range files {
+		path := filepath.Join(j.dir, file.Name())
+		if strings.HasPrefix(file.Name(), journalTempPrefix) {
+			// Left over from an interrupted write
+			os.Remove(path)
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(file.Name(), journalFileSuffix) {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Warn("Unable to read state change journal file", "file", path, "err", err)
+			continue
+		}
+		var taskFile journalTaskFile
+		err = json.Unmarshal(data, &taskFile)
+		if err != nil {
+			log.Warn("Unable to parse state change journal file", "file", path, "err", err)
+			continue
+		}
+		records = append(records, taskFile.Records...)
+	}
+	sort.Sort(bySequence(records))
+	return records, nil
+}
+
+type bySequence []journalRecord
+
+func (r bySequence) Len() int           { return len(r) }
+func (r bySequence) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r bySequence) Less(i, j int) bool { return r[i].Sequence < r[j].Sequence }
+
+func newJournalContainerChange(change api.ContainerStateChange) journalContainerChange {
+	return journalContainerChange{
+		TaskArn:       change.TaskArn,
+		ContainerName: change.ContainerName,
+		Status:        change.Status,
+		Reason:        change.Reason,
+		ExitCode:      change.ExitCode,
+		PortBindings:  change.PortBindings,
+		ImageDigest:   change.ImageDigest,
+	}
+}
+
+// toStateChange rebuilds the container state change, pointing it back to the
+// container in the engine state if it is still known.
+func (change journalContainerChange) toStateChange(task *api.Task) api.ContainerStateChange {
+	stateChange := api.ContainerStateChange{
+		TaskArn:       change.TaskArn,
+		ContainerName: change.ContainerName,
+		Status:        change.Status,
+		Reason:        change.Reason,
+		ExitCode:      change.ExitCode,
+		PortBindings:  change.PortBindings,
+		ImageDigest:   change.ImageDigest,
+	}
+	if task != nil {
+		stateChange.Container, _ = task.ContainerByName(change.ContainerName)
+	}
+	return stateChange
+}
+
+// toRecord returns the persisted form of the event.
+func (event *sendableEvent) toRecord() journalRecord {
+	event.lock.RLock()
+	defer event.lock.RUnlock()
+
+	record := journalRecord{
+		Sequence: event.sequence,
+		Created:  event.created,
+	}
+	if event.isContainerEvent {
+		containerChange := newJournalContainerChange(event.containerChange)
+		record.ContainerChange = &containerChange
+		return record
+	}
+	taskChange := &journalTaskChange{
+		TaskArn:    event.taskChange.TaskArn,
+		Status:     event.taskChange.Status,
+		Reason:     event.taskChange.Reason,
+		ReasonCode: event.taskChange.ReasonCode,
+	}
+	for _, containerChange := range event.taskChange.Containers {
+		taskChange.Containers = append(taskChange.Containers, newJournalContainerChange(containerChange))
+	}
+	record.TaskChange = taskChange
+	return record
+}
+
+// newSendableEventFromRecord rebuilds an event from the journal. The state
+// changes point back to the task and containers in the engine state, so that
+// changes already submitted according to the state are not sent again.
+func newSendableEventFromRecord(record journalRecord, state dockerstate.TaskEngineState) *sendableEvent {
+	var event *sendableEvent
+	if record.ContainerChange != nil {
+		task, _ := state.TaskByArn(record.ContainerChange.TaskArn)
+		event = newSendableContainerEvent(record.ContainerChange.toStateChange(task))
+	} else if record.TaskChange != nil {
+		task, found := state.TaskByArn(record.TaskChange.TaskArn)
+		taskChange := api.TaskStateChange{
+			TaskArn:    record.TaskChange.TaskArn,
+			Status:     record.TaskChange.Status,
+			Reason:     record.TaskChange.Reason,
+			ReasonCode: record.TaskChange.ReasonCode,
+		}
+		if found {
+			taskChange.Task = task
+		}
+		for _, containerChange := range record.TaskChange.Containers {
+			taskChange.Containers = append(taskChange.Containers, containerChange.toStateChange(taskChange.Task))
+		}
+		event = newSendableTaskEvent(taskChange)
+	} else {
+		return nil
+	}
+	event.sequence = record.Sequence
+	event.created = record.Created
+	return event
+}
@@ -0,0 +1,224 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestJournal(t *testing.T) (*journal, func()) {
+	dir, err := ioutil.TempDir("", "state_changes")
+	require.NoError(t, err)
+	j, err := newJournal(filepath.Join(dir, JournalDirName))
+	require.NoError(t, err)
+	return j, func() { os.RemoveAll(dir) }
+}
+
+func journalEvent(sequence uint64, change *sendableEvent) *sendableEvent {
+	change.sequence = sequence
+	change.created = time.Now()
+	return change
+}
+
+func TestJournalSyncAndLoad(t *testing.T) {
+	j, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	exitCode := 1
+	events := list.New()
+	events.PushBack(journalEvent(3, newSendableContainerEvent(api.ContainerStateChange{
+		TaskArn:       "t1",
+		ContainerName: "c1",
+		Status:        api.ContainerStopped,
+		ExitCode:      &exitCode,
+		PortBindings:  []api.PortBinding{{ContainerPort: 80, HostPort: 8080, Protocol: api.TransportProtocolUDP}},
+	})))
+	events.PushBack(journalEvent(5, newSendableTaskEvent(api.TaskStateChange{
+		TaskArn:    "t1",
+		Status:     api.TaskStopped,
+		Reason:     "essential container exited",
+		ReasonCode: "EssentialContainerExited",
+		Containers: []api.ContainerStateChange{
+			{TaskArn: "t1", ContainerName: "c2", Status: api.ContainerStopped},
+		},
+	})))
+	require.NoError(t, j.sync("t1", events))
+
+	otherEvents := list.New()
+	otherEvents.PushBack(journalEvent(4, newSendableTaskEvent(api.TaskStateChange{TaskArn: "t2", Status: api.TaskRunning})))
+	require.NoError(t, j.sync("t2", otherEvents))
+
+	records, err := j.load()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, uint64(3), records[0].Sequence)
+	assert.Equal(t, uint64(4), records[1].Sequence)
+	assert.Equal(t, uint64(5), records[2].Sequence)
+
+	containerChange := records[0].ContainerChange
+	require.NotNil(t, containerChange)
+	assert.Equal(t, api.ContainerStopped, containerChange.Status)
+	assert.Equal(t, 1, *containerChange.ExitCode)
+	assert.Equal(t, api.TransportProtocolUDP, containerChange.PortBindings[0].Protocol)
+
+	taskChange := records[2].TaskChange
+	require.NotNil(t, taskChange)
+	assert.Equal(t, api.TaskStopped, taskChange.Status)
+	assert.Equal(t, "essential container exited", taskChange.Reason)
+	assert.Equal(t, "EssentialContainerExited", taskChange.ReasonCode)
+	replayed := newSendableEventFromRecord(records[2], dockerstate.NewTaskEngineState())
+	assert.Equal(t, "EssentialContainerExited", replayed.taskChange.ReasonCode)
+	require.Len(t, taskChange.Containers, 1)
+	assert.Equal(t, "c2", taskChange.Containers[0].ContainerName)
+
+	// Syncing an empty list removes the task's file
+	require.NoError(t, j.sync("t1", list.New()))
+	records, err = j.load()
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestJournalLoadSkipsInvalidFiles(t *testing.T) {
+	j, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(j.dir, "invalid"+journalFileSuffix), []byte("{"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(j.dir, journalTempPrefix+"123"), []byte("{}"), 0600))
+
+	records, err := j.load()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	_, err = os.Stat(filepath.Join(j.dir, journalTempPrefix+"123"))
+	assert.True(t, os.IsNotExist(err), "Expected temporary file to be removed")
+}
+
+func TestReplayJournal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_api.NewMockECSClient(ctrl)
+
+	j, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	// t1 is still known to the engine and its RUNNING transition has been
+	// submitted, t2 is not known anymore.
+	task := &api.Task{
+		Arn:              "t1",
+		SentStatusUnsafe: api.TaskRunning,
+		Containers:       []*api.Container{{Name: "c1"}},
+	}
+	state := dockerstate.NewTaskEngineState()
+	state.AddTask(task)
+
+	t1Events := list.New()
+	t1Events.PushBack(journalEvent(1, newSendableTaskEvent(api.TaskStateChange{TaskArn: "t1", Status: api.TaskRunning})))
+	t1Events.PushBack(journalEvent(2, newSendableTaskEvent(api.TaskStateChange{TaskArn: "t1", Status: api.TaskStopped})))
+	require.NoError(t, j.sync("t1", t1Events))
+	t2Events := list.New()
+	t2Events.PushBack(journalEvent(7, newSendableTaskEvent(api.TaskStateChange{TaskArn: "t2", Status: api.TaskStopped})))
+	require.NoError(t, j.sync("t2", t2Events))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	client.EXPECT().SubmitTaskStateChange(gomock.Any()).Times(2).Do(func(change api.TaskStateChange) {
+		assert.Equal(t, api.TaskStopped, change.Status)
+		if change.TaskArn == "t1" {
+			assert.Equal(t, task, change.Task)
+		} else {
+			assert.Nil(t, change.Task)
+		}
+		wg.Done()
+	})
+
+	handler := NewTaskHandler()
+	handler.journal = j
+	require.NoError(t, handler.ReplayJournal(state, client))
+	wg.Wait()
+
+	assert.Equal(t, uint64(8), handler.nextSequence)
+	waitForQueueEmpty(t, handler)
+	records, err := j.load()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestTaskEventListRemovedWhenStopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_api.NewMockECSClient(ctrl)
+
+	j, cleanup := newTestJournal(t)
+	defer cleanup()
+	handler := NewTaskHandler()
+	handler.journal = j
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	client.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(interface{}) { wg.Done() })
+	handler.AddStateChangeEvent(taskEventStopped("taskarn"), client)
+	wg.Wait()
+
+	waitForQueueEmpty(t, handler)
+	handler.taskHandlerLock.RLock()
+	_, exists := handler.tasksToEvents["taskarn"]
+	handler.taskHandlerLock.RUnlock()
+	assert.False(t, exists, "Expected events of stopped task to be removed")
+	_, err := os.Stat(j.taskFile("taskarn"))
+	assert.True(t, os.IsNotExist(err), "Expected journal file of stopped task to be removed")
+}
+
+func TestQueueStats(t *testing.T) {
+	handler := NewTaskHandler()
+	assert.Equal(t, QueueStats{}, handler.QueueStats())
+
+	oldest := newSendableTaskEvent(api.TaskStateChange{TaskArn: "t1", Status: api.TaskRunning})
+	handler.getTaskEventList(oldest).events.PushBack(oldest)
+	oldest.created = time.Now().Add(-time.Minute)
+	for _, change := range []*sendableEvent{
+		newSendableTaskEvent(api.TaskStateChange{TaskArn: "t1", Status: api.TaskStopped}),
+		newSendableTaskEvent(api.TaskStateChange{TaskArn: "t2", Status: api.TaskRunning}),
+	} {
+		handler.getTaskEventList(change).events.PushBack(change)
+	}
+
+	stats := handler.QueueStats()
+	assert.Equal(t, 3, stats.Depth)
+	assert.Equal(t, 2, stats.Tasks)
+	assert.True(t, stats.OldestAge >= time.Minute, "Unexpected oldest age %v", stats.OldestAge)
+}
+
+// waitForQueueEmpty waits for the handler to finish processing submitted
+// events, which happens right after the client call returns.
+func waitForQueueEmpty(t *testing.T, handler *TaskHandler) {
+	for i := 0; i < 100; i++ {
+		if handler.QueueStats().Depth == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the state change queue to drain")
+}
@@ -20,39 +20,69 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/statechange"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/cihub/seelog"
+	"golang.org/x/net/context"
 )
 
-// Maximum number of tasks that may be handled at once by the TaskHandler
-const concurrentEventCalls = 3
+const (
+	// Maximum number of tasks that may be handled at once by the TaskHandler
+	concurrentEventCalls = 3
+	// drainPollInterval is how often Drain checks whether the pending state
+	// changes have been submitted
+	drainPollInterval = 100 * time.Millisecond
+)
 
 type eventList struct {
+	// taskArn is the task the events belong to
+	taskArn string
 	// events is a list of *sendableEvents
 	events *list.List
 	// sending will check whether the list is already being handlerd
 	sending bool
-	//eventsListLock locks both the list and sending bool
+	// removed is set once the list has been removed from tasksToEvents, after
+	// the task has been acknowledged as stopped
+	removed bool
+	//eventsListLock locks the list, sending and removed bools
 	eventListLock sync.Mutex
 }
 
+// QueueStats describes the state changes waiting to be submitted.
+type QueueStats struct {
+	// Depth is the number of pending state changes
+	Depth int
+	// Tasks is the number of tasks with pending state changes
+	Tasks int
+	// OldestAge is the time since the oldest pending state change was queued
+	OldestAge time.Duration
+}
+
 // TaskHandler encapsulates the the map of a task arn to task and container events
 // associated with said task
 type TaskHandler struct {
 	// submitSemaphore for the number of tasks that may be handled at once
 	submitSemaphore utils.Semaphore
-	// taskToEvents is arn:*eventList map so events may be serialized per task
-	//TODO: fix leak, currently items are never removed from this map
+	// taskToEvents is arn:*eventList map so events may be serialized per task.
+	// Items are removed once the task is acknowledged as stopped
 	tasksToEvents map[string]*eventList
 	// tasksToContainerStates is used to collect container events
 	// between task transitions
 	tasksToContainerStates map[string][]api.ContainerStateChange
 
-	//  taskHandlerLock is used to safely access the following maps:
+	// nextSequence is the sequence number of the next event queued
+	nextSequence uint64
+
+	//  taskHandlerLock is used to safely access the following fields:
 	// * taskToEvents
 	// * tasksToContainerStates
+	// * nextSequence
 	taskHandlerLock sync.RWMutex
+
+	// journal records the pending events on disk, it is nil if the events
+	// are only kept in memory
+	journal *journal
 }
 
 // NewTaskHandler returns a pointer to TaskHandler
@@ -64,6 +94,124 @@ func NewTaskHandler() *TaskHandler {
 	}
 }
 
+// NewTaskHandlerWithJournal returns a pointer to a TaskHandler which records
+// the state changes waiting to be submitted under journalDir, so that they
+// can be replayed with ReplayJournal after a restart.
+func NewTaskHandlerWithJournal(journalDir string) (*TaskHandler, error) {
+	journal, err := newJournal(journalDir)
+	if err != nil {
+		return nil, err
+	}
+	handler := NewTaskHandler()
+	handler.journal = journal
+	return handler, nil
+}
+
+// ReplayJournal queues up the state changes recorded in the journal, in the
+// order they were originally queued. It must be called before any new event
+// is added to the handler.
+func (handler *TaskHandler) ReplayJournal(state dockerstate.TaskEngineState, client api.ECSClient) error {
+	if handler.journal == nil {
+		return nil
+	}
+	records, err := handler.journal.load()
+	if err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		seelog.Infof("TaskHandler, replaying %d pending state changes from the journal", len(records))
+	}
+	for _, record := range records {
+		event := newSendableEventFromRecord(record, state)
+		if event == nil {
+			seelog.Warnf("TaskHandler, ignoring empty journal record %d", record.Sequence)
+			continue
+		}
+		handler.taskHandlerLock.Lock()
+		if event.sequence >= handler.nextSequence {
+			handler.nextSequence = event.sequence + 1
+		}
+		handler.taskHandlerLock.Unlock()
+		handler.addEvent(event, client)
+	}
+	return nil
+}
+
+// QueueStats returns the number and age of the state changes waiting to be
+// submitted.
+func (handler *TaskHandler) QueueStats() QueueStats {
+	handler.taskHandlerLock.RLock()
+	taskEventLists := make([]*eventList, 0, len(handler.tasksToEvents))
+	for _, taskEvents := range handler.tasksToEvents {
+		taskEventLists = append(taskEventLists, taskEvents)
+	}
+	handler.taskHandlerLock.RUnlock()
+
+	stats := QueueStats{}
+	now := time.Now()
+	for _, taskEvents := range taskEventLists {
+		taskEvents.eventListLock.Lock()
+		if taskEvents.events.Len() > 0 {
+			stats.Tasks++
+			stats.Depth += taskEvents.events.Len()
+			oldest := taskEvents.events.Front().Value.(*sendableEvent)
+			if age := now.Sub(oldest.created); age > stats.OldestAge {
+				stats.OldestAge = age
+			}
+		}
+		taskEvents.eventListLock.Unlock()
+	}
+	return stats
+}
+
+// Drain queues up the container state changes that are still batched and
+// waits until all pending state changes are submitted or the context is done.
+// It returns a description of each state change that was not submitted.
+func (handler *TaskHandler) Drain(ctx context.Context, client api.ECSClient) []string {
+	handler.taskHandlerLock.Lock()
+	var batched []api.ContainerStateChange
+	for taskArn, containerChanges := range handler.tasksToContainerStates {
+		batched = append(batched, containerChanges...)
+		delete(handler.tasksToContainerStates, taskArn)
+	}
+	handler.taskHandlerLock.Unlock()
+	for _, containerChange := range batched {
+		handler.addEvent(newSendableContainerEvent(containerChange), client)
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for handler.QueueStats().Depth > 0 {
+		select {
+		case <-ctx.Done():
+			return handler.pendingEvents()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// pendingEvents returns a description of each state change waiting to be
+// submitted.
+func (handler *TaskHandler) pendingEvents() []string {
+	handler.taskHandlerLock.RLock()
+	taskEventLists := make([]*eventList, 0, len(handler.tasksToEvents))
+	for _, taskEvents := range handler.tasksToEvents {
+		taskEventLists = append(taskEventLists, taskEvents)
+	}
+	handler.taskHandlerLock.RUnlock()
+
+	var pending []string
+	for _, taskEvents := range taskEventLists {
+		taskEvents.eventListLock.Lock()
+		for element := taskEvents.events.Front(); element != nil; element = element.Next() {
+			pending = append(pending, element.Value.(*sendableEvent).String())
+		}
+		taskEvents.eventListLock.Unlock()
+	}
+	return pending
+}
+
 // AddStateChangeEvent queues up a state change for sending using the given client.
 func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client api.ECSClient) error {
 	switch change.GetEventType() {
@@ -73,6 +221,10 @@ func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client
 			return errors.New("eventhandler: unable to get task event from state change event")
 		}
 		handler.flushBatch(&event)
+		if event.Task != nil && event.Task.Local {
+			handler.discardLocalTaskEvent(event)
+			return nil
+		}
 		handler.addEvent(newSendableTaskEvent(event), client)
 		return nil
 
@@ -89,6 +241,20 @@ func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client
 	}
 }
 
+// discardLocalTaskEvent records a state change of a task started through the
+// local control api as sent, without submitting it to the backend, so that the
+// engine can clean up the task once it has stopped.
+func (handler *TaskHandler) discardLocalTaskEvent(event api.TaskStateChange) {
+	seelog.Infof("TaskHandler, not submitting state change of local task: %s", event.String())
+	for _, containerChange := range event.Containers {
+		if containerChange.Container != nil {
+			containerChange.Container.SetSentStatus(containerChange.Status)
+		}
+	}
+	event.Task.SetSentStatus(event.Status)
+	statesaver.Save()
+}
+
 // batchContainerEvent collects container state change events for a given task arn
 func (handler *TaskHandler) batchContainerEvent(event api.ContainerStateChange) {
 	handler.taskHandlerLock.Lock()
@@ -116,10 +282,18 @@ func (handler *TaskHandler) addEvent(change *sendableEvent, client api.ECSClient
 	taskEvents := handler.getTaskEventList(change)
 
 	taskEvents.eventListLock.Lock()
+	for taskEvents.removed {
+		// The list was garbage collected after the task stopped; events that
+		// arrive later get a new list.
+		taskEvents.eventListLock.Unlock()
+		taskEvents = handler.getTaskEventList(change)
+		taskEvents.eventListLock.Lock()
+	}
 	defer taskEvents.eventListLock.Unlock()
 
 	// Update taskEvent
 	taskEvents.events.PushBack(change)
+	handler.syncJournal(taskEvents)
 
 	if !taskEvents.sending {
 		taskEvents.sending = true
@@ -133,16 +307,47 @@ func (handler *TaskHandler) getTaskEventList(change *sendableEvent) (taskEvents
 	handler.taskHandlerLock.Lock()
 	defer handler.taskHandlerLock.Unlock()
 
+	if change.created.IsZero() {
+		change.sequence = handler.nextSequence
+		change.created = time.Now()
+		handler.nextSequence++
+	}
+
 	taskEvents, ok := handler.tasksToEvents[change.taskArn()]
 	if !ok {
 		seelog.Debug("TaskHandler, collecting events for new task ", change)
-		taskEvents = &eventList{events: list.New(), sending: false}
+		taskEvents = &eventList{taskArn: change.taskArn(), events: list.New(), sending: false}
 		handler.tasksToEvents[change.taskArn()] = taskEvents
 	}
 
 	return taskEvents
 }
 
+// syncJournal records the pending events of a task in the journal. The
+// events list must be locked by the caller.
+func (handler *TaskHandler) syncJournal(taskEvents *eventList) {
+	if handler.journal == nil {
+		return
+	}
+	err := handler.journal.sync(taskEvents.taskArn, taskEvents.events)
+	if err != nil {
+		seelog.Warnf("TaskHandler, unable to record pending state changes of task %s: %v", taskEvents.taskArn, err)
+	}
+}
+
+// removeTaskEventList stops tracking the events of a task once it has been
+// acknowledged as stopped. The events list must be locked by the caller.
+func (handler *TaskHandler) removeTaskEventList(taskEvents *eventList) {
+	handler.taskHandlerLock.Lock()
+	defer handler.taskHandlerLock.Unlock()
+
+	if handler.tasksToEvents[taskEvents.taskArn] == taskEvents {
+		delete(handler.tasksToEvents, taskEvents.taskArn)
+	}
+	taskEvents.removed = true
+	seelog.Debug("TaskHandler, stopped tracking events of stopped task ", taskEvents.taskArn)
+}
+
 // Continuously retries sending an event until it succeeds, sleeping between each
 // attempt
 func (handler *TaskHandler) SubmitTaskEvents(taskEvents *eventList, client api.ECSClient) {
@@ -151,6 +356,8 @@ func (handler *TaskHandler) SubmitTaskEvents(taskEvents *eventList, client api.E
 	// Mirror events.sending, but without the need to lock since this is local
 	// to our goroutine
 	done := false
+	// taskStopped is set once the task's STOPPED transition has left the list
+	taskStopped := false
 
 	for !done {
 		// If we looped back up here, we successfully submitted an event, but
@@ -194,6 +401,7 @@ func (handler *TaskHandler) SubmitTaskEvents(taskEvents *eventList, client api.E
 					seelog.Debug("TaskHandler, Submitted container state change")
 					backoff.Reset()
 					taskEvents.events.Remove(eventToSubmit)
+					handler.syncJournal(taskEvents)
 				} else {
 					seelog.Error("TaskHandler, Unretriable error submitting container state change ", err)
 				}
@@ -210,6 +418,8 @@ func (handler *TaskHandler) SubmitTaskEvents(taskEvents *eventList, client api.E
 					seelog.Debug("TaskHandler, Submitted task state change")
 					backoff.Reset()
 					taskEvents.events.Remove(eventToSubmit)
+					handler.syncJournal(taskEvents)
+					taskStopped = taskStopped || event.taskStopped()
 				} else {
 					seelog.Error("TaskHandler, Unretriable error submitting container state change: ", err)
 				}
@@ -217,12 +427,17 @@ func (handler *TaskHandler) SubmitTaskEvents(taskEvents *eventList, client api.E
 				// Shouldn't be sent as either a task or container change event; must have been already sent
 				seelog.Info("TaskHandler, Not submitting redundant event; just removing")
 				taskEvents.events.Remove(eventToSubmit)
+				handler.syncJournal(taskEvents)
+				taskStopped = taskStopped || event.taskStopped()
 			}
 
 			if taskEvents.events.Len() == 0 {
 				seelog.Debug("TaskHandler, Removed the last element, no longer sending")
 				taskEvents.sending = false
 				done = true
+				if taskStopped {
+					handler.removeTaskEventList(taskEvents)
+				}
 				return nil
 			}
 
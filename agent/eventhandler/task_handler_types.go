@@ -14,8 +14,10 @@
 package eventhandler
 
 import (
-	"github.com/aws/amazon-ecs-agent/agent/api"
 	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
 )
 
 // a state change that may have a container and, optionally, a task event to
@@ -30,6 +32,11 @@ type sendableEvent struct {
 	taskSent   bool
 	taskChange api.TaskStateChange
 
+	// sequence orders the event across tasks when the journal is replayed
+	sequence uint64
+	// created is the time the event was first queued
+	created time.Time
+
 	lock sync.RWMutex
 }
 
@@ -105,3 +112,8 @@ func (event *sendableEvent) setSent() {
 		event.taskSent = true
 	}
 }
+
+// taskStopped returns true if the event is the STOPPED transition of a task.
+func (event *sendableEvent) taskStopped() bool {
+	return !event.isContainerEvent && event.taskChange.Status == api.TaskStopped
+}
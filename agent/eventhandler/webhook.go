@@ -0,0 +1,167 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/cihub/seelog"
+	"golang.org/x/net/context"
+)
+
+const (
+	webhookSubscriberPrefix = "webhook-"
+	webhookRequestTimeout   = 5 * time.Second
+	webhookRetries          = 5
+	webhookMinBackoff       = 500 * time.Millisecond
+	webhookMaxBackoff       = 10 * time.Second
+	webhookBackoffJitter    = 0.2
+	webhookBackoffMultiple  = 2
+
+	// unixScheme is the scheme of webhook targets that are reached through a
+	// unix socket, as in unix:///var/run/controller.sock?path=/events
+	unixScheme = "unix"
+	// unixPathQueryField is the http path requested on unix socket targets
+	unixPathQueryField = "path"
+)
+
+// webhook posts every state change, as a json EventMessage, to a local
+// http endpoint or unix socket.
+type webhook struct {
+	target   string
+	endpoint string
+	client   *http.Client
+}
+
+// newWebhook parses a webhook target, which is either an http(s) url or a
+// unix socket url.
+func newWebhook(target string) (*webhook, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook target %s: %v", target, err)
+	}
+
+	switch targetURL.Scheme {
+	case "http", "https":
+		return &webhook{
+			target:   target,
+			endpoint: target,
+			client:   &http.Client{Timeout: webhookRequestTimeout},
+		}, nil
+
+	case unixScheme:
+		if targetURL.Path == "" {
+			return nil, fmt.Errorf("invalid webhook target %s: missing socket path", target)
+		}
+		socketPath := targetURL.Path
+		requestPath := targetURL.Query().Get(unixPathQueryField)
+		if requestPath == "" {
+			requestPath = "/"
+		}
+		dialer := &net.Dialer{Timeout: webhookRequestTimeout}
+		return &webhook{
+			target: target,
+			// The host is ignored when dialing the socket
+			endpoint: "http://localhost" + requestPath,
+			client: &http.Client{
+				Timeout: webhookRequestTimeout,
+				Transport: &http.Transport{
+					Dial: func(network, addr string) (net.Conn, error) {
+						return dialer.Dial(unixScheme, socketPath)
+					},
+				},
+			},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("invalid webhook target %s: unsupported scheme %q", target, targetURL.Scheme)
+	}
+}
+
+// post sends a message to the webhook, retrying with backoff on connection
+// errors and server errors.
+func (hook *webhook) post(message *EventMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	backoff := utils.NewSimpleBackoff(webhookMinBackoff, webhookMaxBackoff, webhookBackoffJitter, webhookBackoffMultiple)
+	return utils.RetryNWithBackoff(backoff, webhookRetries, func() error {
+		resp, err := hook.client.Post(hook.endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+		default:
+			// The target rejected the event, sending it again won't help
+			return utils.NewRetriableError(utils.NewRetriable(false),
+				fmt.Errorf("webhook responded with status %d", resp.StatusCode))
+		}
+	})
+}
+
+// run posts the events from the broadcaster, in order, until the context is
+// cancelled.
+func (hook *webhook) run(ctx context.Context, events <-chan *EventMessage) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-events:
+			if !ok {
+				return
+			}
+			err := hook.post(message)
+			if err != nil {
+				seelog.Warnf("Unable to deliver state change %d to webhook %s: %v", message.Sequence, hook.target, err)
+			}
+		}
+	}
+}
+
+// StartWebhooks subscribes every webhook target to the broadcaster and
+// delivers state changes to them until the context is cancelled. Invalid
+// targets are logged and skipped.
+func StartWebhooks(ctx context.Context, broadcaster *Broadcaster, targets []string) {
+	for _, target := range targets {
+		hook, err := newWebhook(target)
+		if err != nil {
+			seelog.Errorf("Not delivering state changes to webhook: %v", err)
+			continue
+		}
+		name := webhookSubscriberPrefix + target
+		events, err := broadcaster.Subscribe(name)
+		if err != nil {
+			seelog.Errorf("Not delivering state changes to webhook %s: %v", target, err)
+			continue
+		}
+		seelog.Infof("Delivering state changes to webhook %s", target)
+		go func() {
+			defer broadcaster.Unsubscribe(name)
+			hook.run(ctx, events)
+		}()
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestNewWebhookInvalidTargets(t *testing.T) {
+	for _, target := range []string{"ftp://localhost/events", "unix://", "localhost:8080"} {
+		_, err := newWebhook(target)
+		assert.Error(t, err, "Expected target %s to be rejected", target)
+	}
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	requests := 0
+	received := make(chan EventMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var message EventMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		received <- message
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	broadcaster := NewBroadcaster()
+	StartWebhooks(ctx, broadcaster, []string{server.URL})
+	require.NoError(t, broadcaster.Publish(api.TaskStateChange{TaskArn: "t1", Status: api.TaskRunning}))
+
+	select {
+	case message := <-received:
+		assert.Equal(t, "t1", message.TaskArn)
+		assert.Equal(t, "RUNNING", message.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the webhook to be retried")
+	}
+	assert.Equal(t, 2, requests)
+}
+
+func TestWebhookDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	hook, err := newWebhook(server.URL)
+	require.NoError(t, err)
+	assert.Error(t, hook.post(&EventMessage{TaskArn: "t1"}))
+	assert.Equal(t, 1, requests)
+}
+
+func TestWebhookUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "events.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	paths := make(chan string, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	hook, err := newWebhook("unix://" + socketPath + "?path=/events")
+	require.NoError(t, err)
+	require.NoError(t, hook.post(&EventMessage{TaskArn: "t1"}))
+	assert.Equal(t, "/events", <-paths)
+}
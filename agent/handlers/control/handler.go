@@ -0,0 +1,368 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package control serves the local control api, which runs and stops tasks
+// outside of ECS for development and break-glass operations.
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dependencygraph"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/handlers"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	readTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	// maxRequestSize bounds the size of task definitions
+	maxRequestSize = 1 << 20
+
+	// TasksPath runs a task
+	TasksPath = "/v1/tasks"
+	// StopTaskPath stops a task
+	StopTaskPath = "/v1/tasks/stop"
+
+	taskArnQueryField = "taskarn"
+
+	// LocalArnPrefix prefixes the arns of the tasks started through the local
+	// control api, so that they never collide with tasks from the backend
+	LocalArnPrefix = "local/"
+
+	// TokenFileName is the file, in the data directory, holding the token
+	// generated when none is configured
+	TokenFileName = "local_control_token"
+	tokenSize     = 32
+
+	// Error Types
+
+	// Unauthorized is the error code indicating a missing or invalid token
+	Unauthorized = "Unauthorized"
+	// InvalidTask is the error code indicating that the task definition
+	// could not be parsed
+	InvalidTask = "InvalidTask"
+	// TaskExists is the error code indicating that a task with the same arn
+	// is already managed by the agent
+	TaskExists = "TaskExists"
+	// NoTaskArnInRequest is the error code indicating that no task arn was
+	// specified
+	NoTaskArnInRequest = "NoTaskArnInRequest"
+	// TaskNotFound is the error code indicating that the task is not managed
+	// by the agent
+	TaskNotFound = "TaskNotFound"
+	// NotLocalTask is the error code indicating that the task was not started
+	// through the local control api
+	NotLocalTask = "NotLocalTask"
+	// InternalServerError is the error indicating something generic went wrong
+	InternalServerError = "InternalServerError"
+)
+
+// errorMessage is used to store the human-readable error Code and a
+// descriptive Message that describes the error. This struct is marshalled and
+// returned in the HTTP response.
+type errorMessage struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// TaskResponse describes a task run or stopped through the local control api.
+type TaskResponse struct {
+	TaskArn       string
+	DesiredStatus string
+}
+
+// ServeHTTP serves the local control api on the configured endpoint.
+func ServeHTTP(taskEngine engine.TaskEngine, cfg *config.Config) {
+	token, err := loadToken(cfg)
+	if err != nil {
+		log.Errorf("Not serving the local control api, unable to set up its token: %v", err)
+		return
+	}
+	server := setupServer(taskEngine, token, cfg.AvailableLoggingDrivers)
+
+	for {
+		utils.RetryWithBackoff(utils.NewSimpleBackoff(time.Second, time.Minute, 0.2, 2), func() error {
+			listener, err := listen(cfg.LocalControlEndpoint)
+			if err != nil {
+				log.Errorf("Error listening on the local control endpoint %s: %v", cfg.LocalControlEndpoint, err)
+				return err
+			}
+			log.Infof("Serving the local control api on %s", cfg.LocalControlEndpoint)
+			err = server.Serve(listener)
+			if err != nil {
+				log.Errorf("Error running the local control api: %v", err)
+			}
+			return err
+		})
+	}
+}
+
+// loadToken returns the configured token, or the token in the data directory,
+// generating it on first use.
+func loadToken(cfg *config.Config) (string, error) {
+	if cfg.LocalControlToken != "" {
+		return cfg.LocalControlToken, nil
+	}
+	tokenFile := filepath.Join(cfg.DataDir, TokenFileName)
+	data, err := ioutil.ReadFile(tokenFile)
+	if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	tokenBytes := make([]byte, tokenSize)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	err = os.MkdirAll(cfg.DataDir, 0700)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(tokenFile, []byte(token), 0600)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Generated the local control api token in %s", tokenFile)
+	return token, nil
+}
+
+// listen opens the listener of a unix:// or tcp:// endpoint. Stale unix
+// sockets are removed and new ones are only accessible to the owner.
+func listen(endpoint string) (net.Listener, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	switch endpointURL.Scheme {
+	case "unix":
+		socketPath := endpointURL.Path
+		err = os.MkdirAll(filepath.Dir(socketPath), 0700)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Remove(socketPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Chmod(socketPath, 0600)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	case "tcp":
+		return net.Listen("tcp", endpointURL.Host)
+	default:
+		return nil, fmt.Errorf("unsupported local control endpoint scheme %q", endpointURL.Scheme)
+	}
+}
+
+// setupServer creates the HTTP server of the local control api.
+// availableLoggingDrivers are the log drivers local tasks may use.
+func setupServer(taskEngine engine.TaskEngine, token string, availableLoggingDrivers []dockerclient.LoggingDriver) *http.Server {
+	serverMux := http.NewServeMux()
+	serverMux.HandleFunc(TasksPath, runTaskHandler(taskEngine, availableLoggingDrivers))
+	serverMux.HandleFunc(StopTaskPath, stopTaskHandler(taskEngine))
+
+	// Log all requests and then pass through to serverMux
+	loggingServeMux := http.NewServeMux()
+	loggingServeMux.Handle("/", handlers.NewLoggingHandler(authHandler{token: token, next: serverMux}))
+
+	return &http.Server{
+		Handler:      loggingServeMux,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+}
+
+// authHandler rejects the requests that don't carry the bearer token.
+type authHandler struct {
+	token string
+	next  http.Handler
+}
+
+func (handler authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, "Bearer ")), []byte(handler.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, Unauthorized, "missing or invalid bearer token")
+		return
+	}
+	handler.next.ServeHTTP(w, r)
+}
+
+// runTaskHandler creates the handler of POST /v1/tasks, which runs the task
+// definition in the request body. The body has the shape of the tasks sent by
+// ACS; the arn is generated if it is not set. The task is validated the same
+// way as the tasks in ACS payloads.
+func runTaskHandler(taskEngine engine.TaskEngine, availableLoggingDrivers []dockerclient.LoggingDriver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		task, err := parseTask(io.LimitReader(r.Body, maxRequestSize))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, InvalidTask, err.Error())
+			return
+		}
+		if err := validateTask(task, availableLoggingDrivers); err != nil {
+			writeError(w, http.StatusBadRequest, InvalidTask, err.Error())
+			return
+		}
+		if _, exists := taskEngine.GetTaskByArn(task.Arn); exists {
+			writeError(w, http.StatusConflict, TaskExists, "task "+task.Arn+" already exists")
+			return
+		}
+
+		log.Infof("Local control, running task %s", task.Arn)
+		err = taskEngine.AddTask(task)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, InternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, &TaskResponse{
+			TaskArn:       task.Arn,
+			DesiredStatus: api.TaskRunning.String(),
+		})
+	}
+}
+
+// stopTaskHandler creates the handler of POST /v1/tasks/stop?taskarn=, which
+// sets the desired status of a local task to STOPPED. Tasks from the backend
+// are left alone.
+func stopTaskHandler(taskEngine engine.TaskEngine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		taskArn, ok := handlers.ValueFromRequest(r, taskArnQueryField)
+		if !ok || taskArn == "" {
+			writeError(w, http.StatusBadRequest, NoTaskArnInRequest, "no task arn in the request")
+			return
+		}
+		task, ok := taskEngine.GetTaskByArn(taskArn)
+		if !ok {
+			writeError(w, http.StatusNotFound, TaskNotFound, "task "+taskArn+" not found")
+			return
+		}
+		if !task.Local {
+			writeError(w, http.StatusForbidden, NotLocalTask, "task "+taskArn+" is managed by ECS")
+			return
+		}
+
+		log.Infof("Local control, stopping task %s", taskArn)
+		err := taskEngine.AddTask(&api.Task{
+			Arn:                 taskArn,
+			DesiredStatusUnsafe: api.TaskStopped,
+			Local:               true,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, InternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, &TaskResponse{
+			TaskArn:       taskArn,
+			DesiredStatus: api.TaskStopped.String(),
+		})
+	}
+}
+
+// parseTask builds a local task from its definition.
+func parseTask(body io.Reader) (*api.Task, error) {
+	acsTask := &ecsacs.Task{}
+	err := jsonutil.UnmarshalJSON(acsTask, body)
+	if err != nil {
+		return nil, err
+	}
+	arn := aws.StringValue(acsTask.Arn)
+	if arn == "" {
+		suffix := make([]byte, 8)
+		_, err = rand.Read(suffix)
+		if err != nil {
+			return nil, err
+		}
+		arn = LocalArnPrefix + aws.StringValue(acsTask.Family) + "-" + hex.EncodeToString(suffix)
+	} else if !strings.HasPrefix(arn, LocalArnPrefix) {
+		return nil, fmt.Errorf("task arn must start with %s", LocalArnPrefix)
+	}
+	acsTask.Arn = aws.String(arn)
+	acsTask.DesiredStatus = aws.String(api.TaskRunning.String())
+
+	task, err := api.TaskFromACS(acsTask, &ecsacs.PayloadMessage{})
+	if err != nil {
+		return nil, err
+	}
+	task.Local = true
+	return task, nil
+}
+
+// validateTask checks that the task can be started on this instance
+func validateTask(task *api.Task, availableLoggingDrivers []dockerclient.LoggingDriver) api.NamedError {
+	if err := task.Validate(availableLoggingDrivers); err != nil {
+		return err
+	}
+	if !dependencygraph.ValidDependencies(task) {
+		return &api.DefaultNamedError{
+			Name: api.CircularDependencyErrorName,
+			Err:  "the links and volumes of the containers form a cycle",
+		}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, &errorMessage{Code: code, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
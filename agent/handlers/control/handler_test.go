@@ -0,0 +1,193 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package control
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testToken      = "token"
+	testDefinition = `{
+		"family": "debug",
+		"version": "1",
+		"containers": [{"name": "shell", "image": "busybox", "essential": true}]
+	}`
+)
+
+func performRequest(t *testing.T, taskEngine engine.TaskEngine, path string, body string, token string) *httptest.ResponseRecorder {
+	server := setupServer(taskEngine, testToken, []dockerclient.LoggingDriver{dockerclient.JSONFileDriver})
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", path, strings.NewReader(body))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	server.Handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	var message errorMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &message))
+	return message.Code
+}
+
+func TestUnauthorizedRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+
+	for _, token := range []string{"", "invalid"} {
+		recorder := performRequest(t, taskEngine, TasksPath, testDefinition, token)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Equal(t, Unauthorized, errorCode(t, recorder))
+	}
+}
+
+func TestRunTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+
+	var addedTask *api.Task
+	taskEngine.EXPECT().GetTaskByArn(gomock.Any()).Return(nil, false)
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		addedTask = task
+	})
+	recorder := performRequest(t, taskEngine, TasksPath, testDefinition, testToken)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	require.NotNil(t, addedTask)
+	assert.True(t, addedTask.Local, "Expected task to be marked as local")
+	assert.True(t, strings.HasPrefix(addedTask.Arn, LocalArnPrefix+"debug-"), "Unexpected arn %s", addedTask.Arn)
+	assert.Equal(t, api.TaskRunning, addedTask.GetDesiredStatus())
+	require.Len(t, addedTask.Containers, 1)
+	assert.Equal(t, "busybox", addedTask.Containers[0].Image)
+
+	var response TaskResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, TaskResponse{TaskArn: addedTask.Arn, DesiredStatus: "RUNNING"}, response)
+}
+
+func TestRunTaskInvalidRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+
+	recorder := performRequest(t, taskEngine, TasksPath, `{`, testToken)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, InvalidTask, errorCode(t, recorder))
+
+	recorder = performRequest(t, taskEngine, TasksPath, `{"arn": "arn:aws:ecs:us-west-2:123456789012:task/t1"}`, testToken)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, InvalidTask, errorCode(t, recorder))
+
+	taskEngine.EXPECT().GetTaskByArn("local/t1").Return(&api.Task{Arn: "local/t1"}, true)
+	recorder = performRequest(t, taskEngine, TasksPath, `{"arn": "local/t1"}`, testToken)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, TaskExists, errorCode(t, recorder))
+}
+
+func TestRunTaskFailsValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+
+	for _, definition := range []string{
+		`{"family": "debug", "containers": [{"name": "shell", "image": "busybox"}, {"name": "shell", "image": "busybox"}]}`,
+		`{"family": "debug", "containers": [{"name": "shell", "image": "busybox", "links": ["missing"]}]}`,
+		`{"family": "debug", "containers": [{"name": "shell", "image": "busybox", "memory": 1}]}`,
+	} {
+		recorder := performRequest(t, taskEngine, TasksPath, definition, testToken)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, definition)
+		assert.Equal(t, InvalidTask, errorCode(t, recorder), definition)
+	}
+}
+
+func TestStopTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+
+	gomock.InOrder(
+		taskEngine.EXPECT().GetTaskByArn("local/t1").Return(&api.Task{Arn: "local/t1", Local: true}, true),
+		taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+			assert.Equal(t, "local/t1", task.Arn)
+			assert.Equal(t, api.TaskStopped, task.GetDesiredStatus())
+		}),
+	)
+	recorder := performRequest(t, taskEngine, StopTaskPath+"?taskarn=local/t1", "", testToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response TaskResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, TaskResponse{TaskArn: "local/t1", DesiredStatus: "STOPPED"}, response)
+}
+
+func TestStopTaskInvalidRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+
+	recorder := performRequest(t, taskEngine, StopTaskPath, "", testToken)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, NoTaskArnInRequest, errorCode(t, recorder))
+
+	taskEngine.EXPECT().GetTaskByArn("unknown").Return(nil, false)
+	recorder = performRequest(t, taskEngine, StopTaskPath+"?taskarn=unknown", "", testToken)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, TaskNotFound, errorCode(t, recorder))
+
+	taskEngine.EXPECT().GetTaskByArn("ecs").Return(&api.Task{Arn: "ecs"}, true)
+	recorder = performRequest(t, taskEngine, StopTaskPath+"?taskarn=ecs", "", testToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, NotLocalTask, errorCode(t, recorder))
+}
+
+func TestLoadToken(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "control")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	token, err := loadToken(&config.Config{LocalControlToken: "configured", DataDir: dataDir})
+	require.NoError(t, err)
+	assert.Equal(t, "configured", token)
+
+	token, err = loadToken(&config.Config{DataDir: dataDir})
+	require.NoError(t, err)
+	assert.Len(t, token, 2*tokenSize)
+	info, err := os.Stat(filepath.Join(dataDir, TokenFileName))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The generated token is reused
+	reloaded, err := loadToken(&config.Config{DataDir: dataDir})
+	require.NoError(t, err)
+	assert.Equal(t, token, reloaded)
+}
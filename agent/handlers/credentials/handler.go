@@ -17,11 +17,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/handlers"
@@ -56,6 +58,12 @@ const (
 	// not properly initialized.  This may happen immediately after the agent is
 	// started, before it has completed state reconciliation.
 	CredentialsUninitialized = "CredentialsUninitialized"
+	// CredentialsExpired is the error code indicating that the credentials
+	// associated with the specified ID have expired without being refreshed
+	CredentialsExpired = "CredentialsExpired"
+	// RequestNotFromTask is the error code indicating that the request does
+	// not come from a container of the task owning the credentials
+	RequestNotFromTask = "RequestNotFromTask"
 	// InternalServerError is the error indicating something generic went wrong
 	InternalServerError = "InternalServerError"
 )
@@ -68,20 +76,16 @@ type errorMessage struct {
 	httpErrorCode int
 }
 
-// ServeHTTP serves IAM Role Credentials for Tasks being managed by the agent.
-func ServeHTTP(credentialsManager credentials.Manager, containerInstanceArn string, cfg *config.Config) {
-	// Create and initialize the audit log
-	// TODO Use seelog's programmatic configuration instead of xml.
-	logger, err := log.LoggerFromConfigAsString(audit.AuditLoggerConfig(cfg))
-	if err != nil {
-		log.Errorf("Error initializing the audit log: %v", err)
-		// If the logger cannot be initialized, use the provided dummy seelog.LoggerInterface, seelog.Disabled.
-		logger = log.Disabled
-	}
-
-	auditLogger := audit.NewAuditLog(containerInstanceArn, cfg, logger)
+// TaskResolver resolves the task of the container a request comes from
+type TaskResolver interface {
+	TaskByIPAddress(ipAddress string) (*api.Task, bool)
+}
 
-	server := setupServer(credentialsManager, auditLogger)
+// ServeHTTP serves IAM Role Credentials for Tasks being managed by the agent.
+// Requests are recorded in the audit log. When taskResolver is not nil, only
+// the containers of the task owning the credentials are served them.
+func ServeHTTP(credentialsManager credentials.Manager, auditLogger audit.AuditLogger, taskResolver TaskResolver) {
+	server := setupServer(credentialsManager, auditLogger, taskResolver)
 
 	for {
 		utils.RetryWithBackoff(utils.NewSimpleBackoff(time.Second, time.Minute, 0.2, 2), func() error {
@@ -96,10 +100,10 @@ func ServeHTTP(credentialsManager credentials.Manager, containerInstanceArn stri
 }
 
 // setupServer starts the HTTP server for serving IAM Role Credentials for Tasks.
-func setupServer(credentialsManager credentials.Manager, auditLogger audit.AuditLogger) *http.Server {
+func setupServer(credentialsManager credentials.Manager, auditLogger audit.AuditLogger, taskResolver TaskResolver) *http.Server {
 	serverMux := http.NewServeMux()
-	serverMux.HandleFunc(credentials.V1CredentialsPath, credentialsV1V2RequestHandler(credentialsManager, auditLogger, getV1CredentialsID, apiVersion1))
-	serverMux.HandleFunc(credentials.V2CredentialsPath+"/", credentialsV1V2RequestHandler(credentialsManager, auditLogger, getV2CredentialsID, apiVersion2))
+	serverMux.HandleFunc(credentials.V1CredentialsPath, credentialsV1V2RequestHandler(credentialsManager, auditLogger, taskResolver, getV1CredentialsID, apiVersion1))
+	serverMux.HandleFunc(credentials.V2CredentialsPath+"/", credentialsV1V2RequestHandler(credentialsManager, auditLogger, taskResolver, getV2CredentialsID, apiVersion2))
 
 	// Log all requests and then pass through to serverMux
 	loggingServeMux := http.NewServeMux()
@@ -117,17 +121,27 @@ func setupServer(credentialsManager credentials.Manager, auditLogger audit.Audit
 
 // credentialsV1V2RequestHandler creates response for the 'v1/credentials' and 'v2/credentials' APIs. It returns a JSON response
 // containing credentials when found. The HTTP status code of 400 is returned otherwise.
-func credentialsV1V2RequestHandler(credentialsManager credentials.Manager, auditLogger audit.AuditLogger, idFunc func(*http.Request) string, apiVersion int) func(http.ResponseWriter, *http.Request) {
+func credentialsV1V2RequestHandler(credentialsManager credentials.Manager, auditLogger audit.AuditLogger, taskResolver TaskResolver, idFunc func(*http.Request) string, apiVersion int) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		credentialsID := idFunc(r)
-		jsonResponse, arn, errorMessage, err := processCredentialsV1V2Request(credentialsManager, r, credentialsID, apiVersion)
+		jsonResponse, taskCredentials, errorMessage, err := processCredentialsV1V2Request(credentialsManager, taskResolver, r, credentialsID, apiVersion)
+		logRequest := request.LogRequest{
+			Request:       r,
+			ARN:           taskCredentials.ARN,
+			RoleARN:       taskCredentials.IAMRoleCredentials.RoleArn,
+			CredentialsID: credentialsID,
+		}
 		if err != nil {
+			eventType := audit.GetCredentialsEventType()
+			if errorMessage.Code == RequestNotFromTask {
+				eventType = audit.GetCredentialsRejectedEventType()
+			}
 			jsonMsg, _ := json.Marshal(errorMessage)
-			writeCredentialsV1V2RequestResponse(w, r, errorMessage.httpErrorCode, audit.GetCredentialsEventType(), arn, auditLogger, jsonMsg)
+			writeCredentialsV1V2RequestResponse(w, logRequest, errorMessage.httpErrorCode, eventType, auditLogger, jsonMsg)
 			return
 		}
 
-		writeCredentialsV1V2RequestResponse(w, r, http.StatusOK, audit.GetCredentialsEventType(), arn, auditLogger, jsonResponse)
+		writeCredentialsV1V2RequestResponse(w, logRequest, http.StatusOK, audit.GetCredentialsEventType(), auditLogger, jsonResponse)
 	}
 }
 
@@ -146,14 +160,15 @@ func getV2CredentialsID(r *http.Request) string {
 	return ""
 }
 
-func writeCredentialsV1V2RequestResponse(w http.ResponseWriter, r *http.Request, httpStatusCode int, eventType string, arn string, auditLogger audit.AuditLogger, message []byte) {
-	auditLogger.Log(request.LogRequest{Request: r, ARN: arn}, httpStatusCode, eventType)
+func writeCredentialsV1V2RequestResponse(w http.ResponseWriter, logRequest request.LogRequest, httpStatusCode int, eventType string, auditLogger audit.AuditLogger, message []byte) {
+	auditLogger.Log(logRequest, httpStatusCode, eventType)
 
 	writeJSONToResponse(w, httpStatusCode, message)
 }
 
-// processCredentialsV1V2Request returns the response json containing credentials for the credentials id in the request
-func processCredentialsV1V2Request(credentialsManager credentials.Manager, r *http.Request, credentialsID string, apiVersion int) ([]byte, string, *errorMessage, error) {
+// processCredentialsV1V2Request returns the response json containing credentials for the credentials id in the request,
+// along with the credentials found for the audit log
+func processCredentialsV1V2Request(credentialsManager credentials.Manager, taskResolver TaskResolver, r *http.Request, credentialsID string, apiVersion int) ([]byte, credentials.TaskIAMRoleCredentials, *errorMessage, error) {
 	errPrefix := fmt.Sprintf("CredentialsV%dRequest: ", apiVersion)
 	if credentialsID == "" {
 		errText := errPrefix + "No ID in the request"
@@ -163,7 +178,7 @@ func processCredentialsV1V2Request(credentialsManager credentials.Manager, r *ht
 			Message:       errText,
 			httpErrorCode: http.StatusBadRequest,
 		}
-		return nil, "", msg, errors.New(errText)
+		return nil, credentials.TaskIAMRoleCredentials{}, msg, errors.New(errText)
 	}
 
 	credentials, ok := credentialsManager.GetTaskCredentials(credentialsID)
@@ -175,7 +190,7 @@ func processCredentialsV1V2Request(credentialsManager credentials.Manager, r *ht
 			Message:       errText,
 			httpErrorCode: http.StatusBadRequest,
 		}
-		return nil, "", msg, errors.New(errText)
+		return nil, credentials, msg, errors.New(errText)
 	}
 
 	if utils.ZeroOrNil(credentials) {
@@ -187,7 +202,31 @@ func processCredentialsV1V2Request(credentialsManager credentials.Manager, r *ht
 			Message:       errText,
 			httpErrorCode: http.StatusServiceUnavailable,
 		}
-		return nil, "", msg, errors.New(errText)
+		return nil, credentials, msg, errors.New(errText)
+	}
+
+	if taskResolver != nil && !requestFromTask(taskResolver, r, credentials.ARN) {
+		errText := errPrefix + "Request does not come from the task of the credentials"
+		log.Warnf("%s. Request IP Address: %s", errText, r.RemoteAddr)
+		msg := &errorMessage{
+			Code:          RequestNotFromTask,
+			Message:       errText,
+			httpErrorCode: http.StatusForbidden,
+		}
+		return nil, credentials, msg, errors.New(errText)
+	}
+
+	if credentials.IAMRoleCredentials.Expired(time.Now()) {
+		// ACS has not refreshed the credentials in time, handing them out
+		// would only make the requests of the task fail
+		errText := errPrefix + "Credentials expired for ID"
+		log.Warnf("%s. Request IP Address: %s", errText, r.RemoteAddr)
+		msg := &errorMessage{
+			Code:          CredentialsExpired,
+			Message:       errText,
+			httpErrorCode: http.StatusServiceUnavailable,
+		}
+		return nil, credentials, msg, errors.New(errText)
 	}
 
 	credentialsJSON, err := json.Marshal(credentials.IAMRoleCredentials)
@@ -199,11 +238,22 @@ func processCredentialsV1V2Request(credentialsManager credentials.Manager, r *ht
 			Message:       "Internal server error",
 			httpErrorCode: http.StatusInternalServerError,
 		}
-		return nil, "", msg, errors.New(errText)
+		return nil, credentials, msg, errors.New(errText)
 	}
 
 	//Success
-	return credentialsJSON, credentials.ARN, nil, nil
+	return credentialsJSON, credentials, nil, nil
+}
+
+// requestFromTask returns true if the request comes from the address of a
+// running container of the task taskArn
+func requestFromTask(taskResolver TaskResolver, r *http.Request, taskArn string) bool {
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	task, ok := taskResolver.TaskByIPAddress(ipAddress)
+	return ok && task.Arn == taskArn
 }
 
 func writeJSONToResponse(w http.ResponseWriter, httpStatusCode int, jsonMessage []byte) {
@@ -22,9 +22,12 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	mock_credentials "github.com/aws/amazon-ecs-agent/agent/credentials/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/logger/audit"
 	mock_audit "github.com/aws/amazon-ecs-agent/agent/logger/audit/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -168,13 +171,116 @@ func TestCredentialsV2RequestWhenCredentialsFound(t *testing.T) {
 	assert.Equal(t, secretAccessKey, credentials.SecretAccessKey, "Incorrect credentials received: secret access key")
 }
 
+// TestCredentialsV2RequestWhenCredentialsExpired tests if HTTP status code 503 is returned when
+// the credentials have expired without being refreshed.
+func TestCredentialsV2RequestWhenCredentialsExpired(t *testing.T) {
+	creds := credentials.TaskIAMRoleCredentials{
+		ARN: "arn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			RoleArn:         roleArn,
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			Expiration:      time.Now().Add(-time.Minute).Format(time.RFC3339),
+		},
+	}
+	expectedErrorMessage := &errorMessage{
+		Code:          CredentialsExpired,
+		Message:       "CredentialsV2Request: Credentials expired for ID",
+		httpErrorCode: http.StatusServiceUnavailable,
+	}
+	path := credentials.V2CredentialsPath + "/" + credentialsID
+	_, err := getResponseForCredentialsRequest(t, expectedErrorMessage.httpErrorCode,
+		expectedErrorMessage, path, func() (credentials.TaskIAMRoleCredentials, bool) { return creds, true })
+	assert.NoError(t, err, "Error getting response body")
+}
+
+// TestCredentialsV2RequestWhenCredentialsNotYetExpired tests if HTTP status code 200 is returned
+// for credentials that expire in the future.
+func TestCredentialsV2RequestWhenCredentialsNotYetExpired(t *testing.T) {
+	creds := credentials.TaskIAMRoleCredentials{
+		ARN: "arn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			RoleArn:         roleArn,
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			Expiration:      time.Now().Add(time.Hour).Format(time.RFC3339),
+		},
+	}
+	path := credentials.V2CredentialsPath + "/" + credentialsID
+	body, err := getResponseForCredentialsRequest(t, http.StatusOK, nil, path, func() (credentials.TaskIAMRoleCredentials, bool) { return creds, true })
+	assert.NoError(t, err)
+
+	credentials, err := parseResponseBody(body)
+	assert.NoError(t, err, "Error retrieving credentials")
+	assert.Equal(t, creds.IAMRoleCredentials.Expiration, credentials.Expiration)
+}
+
+type testTaskResolver map[string]*api.Task
+
+func (resolver testTaskResolver) TaskByIPAddress(ipAddress string) (*api.Task, bool) {
+	task, ok := resolver[ipAddress]
+	return task, ok
+}
+
+// TestCredentialsV2RequestVerification tests that, with request verification,
+// only the containers of the task owning the credentials are served them and
+// rejections are recorded in the audit log with their own event type.
+func TestCredentialsV2RequestVerification(t *testing.T) {
+	creds := credentials.TaskIAMRoleCredentials{
+		ARN: "arn",
+		IAMRoleCredentials: credentials.IAMRoleCredentials{
+			RoleArn:         roleArn,
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+		},
+	}
+	taskResolver := testTaskResolver{
+		"172.17.0.2": {Arn: "arn"},
+		"172.17.0.3": {Arn: "otherArn"},
+	}
+	testCases := []struct {
+		name              string
+		remoteAddr        string
+		expectedStatus    int
+		expectedEventType string
+	}{
+		{"same task", "172.17.0.2:41000", http.StatusOK, audit.GetCredentialsEventType()},
+		{"other task", "172.17.0.3:41000", http.StatusForbidden, audit.GetCredentialsRejectedEventType()},
+		{"unknown container", "10.0.0.1:41000", http.StatusForbidden, audit.GetCredentialsRejectedEventType()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			credentialsManager := mock_credentials.NewMockManager(ctrl)
+			auditLog := mock_audit.NewMockAuditLogger(ctrl)
+			server := setupServer(credentialsManager, auditLog, taskResolver)
+
+			credentialsManager.EXPECT().GetTaskCredentials(credentialsID).Return(creds, true)
+			auditLog.EXPECT().Log(gomock.Any(), tc.expectedStatus, tc.expectedEventType)
+
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", credentials.V2CredentialsPath+"/"+credentialsID, nil)
+			req.RemoteAddr = tc.remoteAddr
+			server.Handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			if tc.expectedStatus != http.StatusOK {
+				errorMessage := &errorMessage{}
+				json.Unmarshal(recorder.Body.Bytes(), errorMessage)
+				assert.Equal(t, RequestNotFromTask, errorMessage.Code)
+			}
+		})
+	}
+}
+
 func testErrorResponsesFromServer(t *testing.T, path string, expectedErrorMessage *errorMessage) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	credentialsManager := mock_credentials.NewMockManager(ctrl)
 	auditLog := mock_audit.NewMockAuditLogger(ctrl)
-	server := setupServer(credentialsManager, auditLog)
+	server := setupServer(credentialsManager, auditLog, nil)
 
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", path, nil)
@@ -207,7 +313,7 @@ func getResponseForCredentialsRequest(t *testing.T, expectedStatus int,
 	defer ctrl.Finish()
 	credentialsManager := mock_credentials.NewMockManager(ctrl)
 	auditLog := mock_audit.NewMockAuditLogger(ctrl)
-	server := setupServer(credentialsManager, auditLog)
+	server := setupServer(credentialsManager, auditLog, nil)
 	recorder := httptest.NewRecorder()
 
 	creds, ok := getCredentials()
@@ -12,12 +12,14 @@
 // permissions and limitations under the License.
 
 // Automatically generated by MockGen. DO NOT EDIT!
-// Source: github.com/aws/amazon-ecs-agent/agent/handlers (interfaces: DockerStateResolver)
+// Source: github.com/aws/amazon-ecs-agent/agent/handlers (interfaces: DockerStateResolver,StateChangeQueueResolver,StateChangeSubscriber,TaskUsageResolver)
 
 package mock_handlers
 
 import (
 	dockerstate "github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	eventhandler "github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	stats "github.com/aws/amazon-ecs-agent/agent/stats"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -51,3 +53,116 @@ func (_m *MockDockerStateResolver) State() dockerstate.TaskEngineState {
 func (_mr *_MockDockerStateResolverRecorder) State() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "State")
 }
+
+// Mock of StateChangeQueueResolver interface
+type MockStateChangeQueueResolver struct {
+	ctrl     *gomock.Controller
+	recorder *_MockStateChangeQueueResolverRecorder
+}
+
+// Recorder for MockStateChangeQueueResolver (not exported)
+type _MockStateChangeQueueResolverRecorder struct {
+	mock *MockStateChangeQueueResolver
+}
+
+func NewMockStateChangeQueueResolver(ctrl *gomock.Controller) *MockStateChangeQueueResolver {
+	mock := &MockStateChangeQueueResolver{ctrl: ctrl}
+	mock.recorder = &_MockStateChangeQueueResolverRecorder{mock}
+	return mock
+}
+
+func (_m *MockStateChangeQueueResolver) EXPECT() *_MockStateChangeQueueResolverRecorder {
+	return _m.recorder
+}
+
+func (_m *MockStateChangeQueueResolver) QueueStats() eventhandler.QueueStats {
+	ret := _m.ctrl.Call(_m, "QueueStats")
+	ret0, _ := ret[0].(eventhandler.QueueStats)
+	return ret0
+}
+
+func (_mr *_MockStateChangeQueueResolverRecorder) QueueStats() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueueStats")
+}
+
+// Mock of StateChangeSubscriber interface
+type MockStateChangeSubscriber struct {
+	ctrl     *gomock.Controller
+	recorder *_MockStateChangeSubscriberRecorder
+}
+
+// Recorder for MockStateChangeSubscriber (not exported)
+type _MockStateChangeSubscriberRecorder struct {
+	mock *MockStateChangeSubscriber
+}
+
+func NewMockStateChangeSubscriber(ctrl *gomock.Controller) *MockStateChangeSubscriber {
+	mock := &MockStateChangeSubscriber{ctrl: ctrl}
+	mock.recorder = &_MockStateChangeSubscriberRecorder{mock}
+	return mock
+}
+
+func (_m *MockStateChangeSubscriber) EXPECT() *_MockStateChangeSubscriberRecorder {
+	return _m.recorder
+}
+
+func (_m *MockStateChangeSubscriber) Subscribe(_param0 string) (<-chan *eventhandler.EventMessage, error) {
+	ret := _m.ctrl.Call(_m, "Subscribe", _param0)
+	ret0, _ := ret[0].(<-chan *eventhandler.EventMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockStateChangeSubscriberRecorder) Subscribe(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Subscribe", arg0)
+}
+
+func (_m *MockStateChangeSubscriber) Unsubscribe(_param0 string) {
+	_m.ctrl.Call(_m, "Unsubscribe", _param0)
+}
+
+func (_mr *_MockStateChangeSubscriberRecorder) Unsubscribe(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Unsubscribe", arg0)
+}
+
+// Mock of TaskUsageResolver interface
+type MockTaskUsageResolver struct {
+	ctrl     *gomock.Controller
+	recorder *_MockTaskUsageResolverRecorder
+}
+
+// Recorder for MockTaskUsageResolver (not exported)
+type _MockTaskUsageResolverRecorder struct {
+	mock *MockTaskUsageResolver
+}
+
+func NewMockTaskUsageResolver(ctrl *gomock.Controller) *MockTaskUsageResolver {
+	mock := &MockTaskUsageResolver{ctrl: ctrl}
+	mock.recorder = &_MockTaskUsageResolverRecorder{mock}
+	return mock
+}
+
+func (_m *MockTaskUsageResolver) EXPECT() *_MockTaskUsageResolverRecorder {
+	return _m.recorder
+}
+
+func (_m *MockTaskUsageResolver) TaskUsageReport(_param0 string) (*stats.TaskUsageReport, bool) {
+	ret := _m.ctrl.Call(_m, "TaskUsageReport", _param0)
+	ret0, _ := ret[0].(*stats.TaskUsageReport)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+func (_mr *_MockTaskUsageResolverRecorder) TaskUsageReport(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TaskUsageReport", arg0)
+}
+
+func (_m *MockTaskUsageResolver) TaskUsageReports() []*stats.TaskUsageReport {
+	ret := _m.ctrl.Call(_m, "TaskUsageReports")
+	ret0, _ := ret[0].([]*stats.TaskUsageReport)
+	return ret0
+}
+
+func (_mr *_MockTaskUsageResolverRecorder) TaskUsageReports() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TaskUsageReports")
+}
@@ -13,7 +13,18 @@
 
 package handlers
 
-import "github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/ecr"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	tcsclient "github.com/aws/amazon-ecs-agent/agent/tcs/client"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+)
 
 type MetadataResponse struct {
 	Cluster              string
@@ -27,6 +38,7 @@ type TaskResponse struct {
 	KnownStatus   string
 	Family        string
 	Version       string
+	Local         bool `json:",omitempty"`
 	Containers    []ContainerResponse
 }
 
@@ -43,3 +55,146 @@ type ContainerResponse struct {
 type DockerStateResolver interface {
 	State() dockerstate.TaskEngineState
 }
+
+type TaskUsageResponse struct {
+	Tasks []*stats.TaskUsageReport
+}
+
+// StateChangeQueueResponse describes the state changes waiting to be
+// submitted to the backend.
+type StateChangeQueueResponse struct {
+	Depth            int
+	Tasks            int
+	OldestAgeSeconds float64
+}
+
+// StateChangeQueueResolver returns the state of the state change submission
+// queue.
+type StateChangeQueueResolver interface {
+	QueueStats() eventhandler.QueueStats
+}
+
+// StateChangeSubscriber registers local consumers of the task and container
+// state changes emitted by the engine.
+type StateChangeSubscriber interface {
+	Subscribe(name string) (<-chan *eventhandler.EventMessage, error)
+	Unsubscribe(name string)
+}
+
+// ConnectionsResponse describes the health of the websocket connections to
+// the backend.
+type ConnectionsResponse struct {
+	Connections []wsclient.ConnectionSnapshot
+}
+
+// ConnectionsResolver returns the health of the websocket connections to the
+// backend.
+type ConnectionsResolver interface {
+	Connections() []wsclient.ConnectionSnapshot
+}
+
+// MetricsBufferResponse describes the metrics waiting to be published to the
+// backend.
+type MetricsBufferResponse struct {
+	Pending                   int
+	Dropped                   uint64
+	Replayed                  uint64
+	LastPublishLatencySeconds float64
+}
+
+// MetricsBufferResolver returns the state of the buffer of metrics that could
+// not be published yet.
+type MetricsBufferResolver interface {
+	Stats() tcsclient.MetricsBufferStats
+}
+
+// CredentialsExpiryResolver returns when the credentials of the tasks expire
+// and whether ACS is late refreshing them.
+type CredentialsExpiryResolver interface {
+	Stats() credentials.ExpiryStats
+}
+
+// ECRTokensResolver returns the ECR authorization tokens kept by the agent
+// and how often they were reused.
+type ECRTokensResolver interface {
+	Stats() ecr.TokenStats
+}
+
+// TaskUsageResolver returns the resource usage of stopped tasks.
+type TaskUsageResolver interface {
+	TaskUsageReports() []*stats.TaskUsageReport
+	TaskUsageReport(taskArn string) (*stats.TaskUsageReport, bool)
+}
+
+// Dependencies are the components the introspection api reports on besides
+// the task engine. Any of them may be nil when the component isn't running;
+// its endpoint then serves an empty response.
+type Dependencies struct {
+	TaskUsage             TaskUsageResolver
+	StateChangeQueue      StateChangeQueueResolver
+	StateChangeSubscriber StateChangeSubscriber
+	Connections           ConnectionsResolver
+	MetricsBuffer         MetricsBufferResolver
+	CredentialsExpiry     CredentialsExpiryResolver
+	ECRTokens             ECRTokensResolver
+}
+
+// TaskV2Response is the v2 introspection representation of a task.
+type TaskV2Response struct {
+	Arn                 string
+	DesiredStatus       string `json:",omitempty"`
+	KnownStatus         string
+	KnownStatusTime     *time.Time `json:",omitempty"`
+	Family              string
+	Version             string
+	StartSequenceNumber int64
+	StopSequenceNumber  int64
+	Local               bool `json:",omitempty"`
+	Volumes             []VolumeResponse
+	Containers          []ContainerV2Response
+}
+
+// TasksV2Response is the response of the 'v2/tasks' API.
+type TasksV2Response struct {
+	Tasks []*TaskV2Response
+}
+
+// ContainerV2Response is the v2 introspection representation of a container.
+type ContainerV2Response struct {
+	DockerId        string
+	DockerName      string
+	Name            string
+	Image           string
+	ImageID         string
+	ImageDigest     string `json:",omitempty"`
+	DesiredStatus   string
+	KnownStatus     string
+	KnownStatusTime *time.Time `json:",omitempty"`
+	CPU             uint
+	Memory          uint
+	Ports           []PortResponse
+	MountPoints     []MountPointResponse
+	ExitCode        *int                   `json:",omitempty"`
+	ApplyingError   *api.DefaultNamedError `json:",omitempty"`
+}
+
+// PortResponse is a port binding of a container on the host.
+type PortResponse struct {
+	ContainerPort uint16
+	HostPort      uint16
+	BindIP        string `json:"BindIp"`
+	Protocol      string
+}
+
+// VolumeResponse is a volume of a task and where it is on the host.
+type VolumeResponse struct {
+	Name       string
+	SourcePath string
+}
+
+// MountPointResponse is a volume of a task mounted in a container.
+type MountPointResponse struct {
+	SourceVolume  string
+	ContainerPath string
+	ReadOnly      bool
+}
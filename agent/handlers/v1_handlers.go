@@ -16,18 +16,24 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/ecr"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/amazon-ecs-agent/agent/version"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 )
 
 var log = logger.ForModule("Handlers")
@@ -36,8 +42,19 @@ const (
 	dockerIdQueryField = "dockerid"
 	taskArnQueryField  = "taskarn"
 	dockerShortIdLen   = 12
+
+	// requestTimeout bounds the time spent writing the response of every
+	// request but event streams
+	requestTimeout = 5 * time.Second
+	// eventsKeepAliveInterval is the interval between comments sent on idle
+	// event streams, so that proxies and clients don't drop the connection
+	eventsKeepAliveInterval = 15 * time.Second
+	eventsSubscriberPrefix  = "introspection-events-"
 )
 
+// eventsSubscriberCount is used to name event stream subscribers uniquely
+var eventsSubscriberCount uint64
+
 type rootResponse struct {
 	AvailableCommands []string
 }
@@ -87,6 +104,7 @@ func newTaskResponse(task *api.Task, containerMap map[string]*api.DockerContaine
 		KnownStatus:   knownBackendStatus,
 		Family:        task.Family,
 		Version:       task.Version,
+		Local:         task.Local,
 		Containers:    containers,
 	}
 }
@@ -169,6 +187,160 @@ func tasksV1RequestHandlerMaker(taskEngine DockerStateResolver) func(http.Respon
 	}
 }
 
+// Creates response for the 'v1/usage' API. Lists the resource usage of all
+// tasks stopped within the task cleanup wait duration, or of the task given
+// by 'taskarn'.
+func usageV1RequestHandlerMaker(taskUsage TaskUsageResolver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var responseJSON []byte
+		taskArn, taskArnExists := ValueFromRequest(r, taskArnQueryField)
+		if !taskArnExists {
+			resp := &TaskUsageResponse{Tasks: []*stats.TaskUsageReport{}}
+			if taskUsage != nil {
+				resp.Tasks = append(resp.Tasks, taskUsage.TaskUsageReports()...)
+			}
+			responseJSON, _ = json.Marshal(resp)
+			w.Write(responseJSON)
+			return
+		}
+
+		var report *stats.TaskUsageReport
+		found := false
+		if taskUsage != nil {
+			report, found = taskUsage.TaskUsageReport(taskArn)
+		}
+		if !found {
+			log.Warn("Could not find usage report for task: " + taskArn)
+			responseJSON, _ = json.Marshal(&stats.TaskUsageReport{})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(responseJSON)
+			return
+		}
+		responseJSON, _ = json.Marshal(report)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/statechanges' API, which reports the number
+// and age of the state changes waiting to be submitted to the backend.
+func stateChangesV1RequestHandlerMaker(stateChangeQueue StateChangeQueueResolver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := &StateChangeQueueResponse{}
+		if stateChangeQueue != nil {
+			stats := stateChangeQueue.QueueStats()
+			resp.Depth = stats.Depth
+			resp.Tasks = stats.Tasks
+			resp.OldestAgeSeconds = stats.OldestAge.Seconds()
+		}
+		responseJSON, _ := json.Marshal(resp)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/connections' API, which reports the health of
+// the websocket connections to the backend.
+func connectionsV1RequestHandlerMaker(connections ConnectionsResolver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := &ConnectionsResponse{Connections: []wsclient.ConnectionSnapshot{}}
+		if connections != nil {
+			resp.Connections = append(resp.Connections, connections.Connections()...)
+		}
+		responseJSON, _ := json.Marshal(resp)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/metricsbuffer' API, which reports the metrics
+// waiting to be published to the backend and how many were dropped or
+// replayed.
+func metricsBufferV1RequestHandlerMaker(metricsBuffer MetricsBufferResolver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := &MetricsBufferResponse{}
+		if metricsBuffer != nil {
+			stats := metricsBuffer.Stats()
+			resp.Pending = stats.Pending
+			resp.Dropped = stats.Dropped
+			resp.Replayed = stats.Replayed
+			resp.LastPublishLatencySeconds = stats.LastPublishLatency.Seconds()
+		}
+		responseJSON, _ := json.Marshal(resp)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/credentialsexpiry' API, which reports when the
+// credentials of the tasks expire and whether ACS is late refreshing them.
+func credentialsExpiryV1RequestHandlerMaker(credentialsExpiry CredentialsExpiryResolver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := credentials.ExpiryStats{Credentials: []credentials.CredentialsExpiry{}}
+		if credentialsExpiry != nil {
+			resp = credentialsExpiry.Stats()
+		}
+		responseJSON, _ := json.Marshal(resp)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/ecrtokens' API, which reports the age of the
+// ECR authorization tokens kept by the agent and how often they were reused.
+func ecrTokensV1RequestHandlerMaker(ecrTokens ECRTokensResolver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := ecr.TokenStats{Tokens: []ecr.TokenInfo{}}
+		if ecrTokens != nil {
+			resp = ecrTokens.Stats()
+		}
+		responseJSON, _ := json.Marshal(resp)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates the 'v1/events' API, a Server-Sent Events stream of the task and
+// container state changes emitted by the engine. Every event is sent with its
+// type as the event name and its json representation as data.
+func eventsV1RequestHandlerMaker(subscriber StateChangeSubscriber) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if subscriber == nil || !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		name := eventsSubscriberPrefix + strconv.FormatUint(atomic.AddUint64(&eventsSubscriberCount, 1), 10)
+		events, err := subscriber.Subscribe(name)
+		if err != nil {
+			log.Warn("Unable to subscribe to state changes", "err", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		defer subscriber.Unsubscribe(name)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				_, err = fmt.Fprint(w, ": keepalive\n\n")
+			case message, ok := <-events:
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(message)
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", message.Sequence, message.Type, data)
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 var licenseProvider = utils.NewLicenseProvider()
 
 func licenseHandler(w http.ResponseWriter, h *http.Request) {
@@ -180,17 +352,31 @@ func licenseHandler(w http.ResponseWriter, h *http.Request) {
 	}
 }
 
-func setupServer(containerInstanceArn *string, taskEngine DockerStateResolver, cfg *config.Config) *http.Server {
+func setupServer(containerInstanceArn *string, taskEngine DockerStateResolver, deps Dependencies, cfg *config.Config) *http.Server {
 	serverFunctions := map[string]func(w http.ResponseWriter, r *http.Request){
-		"/v1/metadata": metadataV1RequestHandlerMaker(containerInstanceArn, cfg),
-		"/v1/tasks":    tasksV1RequestHandlerMaker(taskEngine),
-		"/license":     licenseHandler,
+		"/v1/metadata":          metadataV1RequestHandlerMaker(containerInstanceArn, cfg),
+		"/v1/tasks":             tasksV1RequestHandlerMaker(taskEngine),
+		"/v1/usage":             usageV1RequestHandlerMaker(deps.TaskUsage),
+		"/v1/statechanges":      stateChangesV1RequestHandlerMaker(deps.StateChangeQueue),
+		"/v1/connections":       connectionsV1RequestHandlerMaker(deps.Connections),
+		"/v1/metricsbuffer":     metricsBufferV1RequestHandlerMaker(deps.MetricsBuffer),
+		"/v1/credentialsexpiry": credentialsExpiryV1RequestHandlerMaker(deps.CredentialsExpiry),
+		"/v1/ecrtokens":         ecrTokensV1RequestHandlerMaker(deps.ECRTokens),
+		"/v2/tasks":             tasksV2RequestHandlerMaker(taskEngine),
+		"/license":              licenseHandler,
+	}
+	// Streaming functions are not bound by the request timeout
+	streamingFunctions := map[string]func(w http.ResponseWriter, r *http.Request){
+		"/v1/events": eventsV1RequestHandlerMaker(deps.StateChangeSubscriber),
 	}
 
-	paths := make([]string, 0, len(serverFunctions))
+	paths := make([]string, 0, len(serverFunctions)+len(streamingFunctions))
 	for path := range serverFunctions {
 		paths = append(paths, path)
 	}
+	for path := range streamingFunctions {
+		paths = append(paths, path)
+	}
 	availableCommands := &rootResponse{paths}
 	// Autogenerated list of the above serverFunctions paths
 	availableCommandResponse, _ := json.Marshal(&availableCommands)
@@ -202,6 +388,9 @@ func setupServer(containerInstanceArn *string, taskEngine DockerStateResolver, c
 	serverMux := http.NewServeMux()
 	serverMux.HandleFunc("/", defaultHandler)
 	for key, fn := range serverFunctions {
+		serverMux.Handle(key, http.TimeoutHandler(http.HandlerFunc(fn), requestTimeout, ""))
+	}
+	for key, fn := range streamingFunctions {
 		serverMux.HandleFunc(key, fn)
 	}
 
@@ -210,10 +399,9 @@ func setupServer(containerInstanceArn *string, taskEngine DockerStateResolver, c
 	loggingServeMux.Handle("/", LoggingHandler{serverMux})
 
 	server := &http.Server{
-		Addr:         ":" + strconv.Itoa(config.AgentIntrospectionPort),
-		Handler:      loggingServeMux,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
+		Addr:        ":" + strconv.Itoa(config.AgentIntrospectionPort),
+		Handler:     loggingServeMux,
+		ReadTimeout: 5 * time.Second,
 	}
 
 	return server
@@ -221,12 +409,12 @@ func setupServer(containerInstanceArn *string, taskEngine DockerStateResolver, c
 
 // ServeHttp serves information about this agent / containerInstance and tasks
 // running on it.
-func ServeHttp(containerInstanceArn *string, taskEngine engine.TaskEngine, cfg *config.Config) {
+func ServeHttp(containerInstanceArn *string, taskEngine engine.TaskEngine, deps Dependencies, cfg *config.Config) {
 	// Is this the right level to type assert, assuming we'd abstract multiple taskengines here?
 	// Revisit if we ever add another type..
 	dockerTaskEngine := taskEngine.(*engine.DockerTaskEngine)
 
-	server := setupServer(containerInstanceArn, dockerTaskEngine, cfg)
+	server := setupServer(containerInstanceArn, dockerTaskEngine, deps, cfg)
 	for {
 		once := sync.Once{}
 		utils.RetryWithBackoff(utils.NewSimpleBackoff(time.Second, time.Minute, 0.2, 2), func() error {
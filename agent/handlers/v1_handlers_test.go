@@ -20,14 +20,21 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/ecr"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/handlers/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/handlers/mocks/http"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	tcsclient "github.com/aws/amazon-ecs-agent/agent/tcs/client"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/amazon-ecs-agent/agent/utils/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -140,6 +147,77 @@ func TestGetTaskByTaskArnAndDockerIDBadRequest(t *testing.T) {
 	}
 }
 
+func TestListTaskUsage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskUsage := mock_handlers.NewMockTaskUsageResolver(ctrl)
+	taskUsage.EXPECT().TaskUsageReports().Return([]*stats.TaskUsageReport{
+		{TaskArn: "t1", CPUSeconds: 1.5},
+	})
+	recorder := performUsageRequest(t, taskUsage, "/v1/usage")
+
+	var usageResponse TaskUsageResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &usageResponse))
+	require.Len(t, usageResponse.Tasks, 1)
+	assert.Equal(t, "t1", usageResponse.Tasks[0].TaskArn)
+	assert.Equal(t, 1.5, usageResponse.Tasks[0].CPUSeconds)
+}
+
+func TestListTaskUsageWithoutStatsEngine(t *testing.T) {
+	recorder := performUsageRequest(t, nil, "/v1/usage")
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"Tasks":[]}`, recorder.Body.String())
+}
+
+func TestGetTaskUsageByTaskArn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskUsage := mock_handlers.NewMockTaskUsageResolver(ctrl)
+	taskUsage.EXPECT().TaskUsageReport("t1").Return(&stats.TaskUsageReport{TaskArn: "t1", PeakMemoryBytes: 1024}, true)
+	recorder := performUsageRequest(t, taskUsage, "/v1/usage?taskarn=t1")
+
+	var report stats.TaskUsageReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, "t1", report.TaskArn)
+	assert.Equal(t, uint64(1024), report.PeakMemoryBytes)
+}
+
+func TestGetTaskUsageByTaskArnNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskUsage := mock_handlers.NewMockTaskUsageResolver(ctrl)
+	taskUsage.EXPECT().TaskUsageReport("t2").Return(nil, false)
+	recorder := performUsageRequest(t, taskUsage, "/v1/usage?taskarn=t2")
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestStateChangeQueueHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stateChangeQueue := mock_handlers.NewMockStateChangeQueueResolver(ctrl)
+	stateChangeQueue.EXPECT().QueueStats().Return(eventhandler.QueueStats{
+		Depth:     3,
+		Tasks:     2,
+		OldestAge: 90 * time.Second,
+	})
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{StateChangeQueue: stateChangeQueue}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/statechanges", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	var resp StateChangeQueueResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Equal(t, StateChangeQueueResponse{Depth: 3, Tasks: 2, OldestAgeSeconds: 90}, resp)
+}
+
 func TestBackendMismatchMapping(t *testing.T) {
 	// Test that a KnownStatus past a DesiredStatus suppresses the DesiredStatus output
 	ctrl := gomock.NewController(t)
@@ -327,7 +405,7 @@ func performMockRequest(t *testing.T, path string) *httptest.ResponseRecorder {
 	stateSetupHelper(state, testTasks)
 
 	mockStateResolver.EXPECT().State().Return(state)
-	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, &config.Config{Cluster: testClusterArn})
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{}, &config.Config{Cluster: testClusterArn})
 
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", path, nil)
@@ -335,3 +413,222 @@ func performMockRequest(t *testing.T, path string) *httptest.ResponseRecorder {
 
 	return recorder
 }
+
+func performUsageRequest(t *testing.T, taskUsage TaskUsageResolver, path string) *httptest.ResponseRecorder {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{TaskUsage: taskUsage}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestEventsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	events := make(chan *eventhandler.EventMessage, 1)
+	events <- &eventhandler.EventMessage{
+		Sequence: 4,
+		Type:     eventhandler.TaskEventType,
+		TaskArn:  "t1",
+		Status:   "RUNNING",
+	}
+	close(events)
+	subscriber := mock_handlers.NewMockStateChangeSubscriber(ctrl)
+	gomock.InOrder(
+		subscriber.EXPECT().Subscribe(gomock.Any()).Return((<-chan *eventhandler.EventMessage)(events), nil),
+		subscriber.EXPECT().Unsubscribe(gomock.Any()),
+	)
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{StateChangeSubscriber: subscriber}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/events", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "id: 4\nevent: task\ndata: {\"Sequence\":4,\"Type\":\"task\",\"Timestamp\":\"0001-01-01T00:00:00Z\",\"TaskArn\":\"t1\",\"Status\":\"RUNNING\"}\n\n", recorder.Body.String())
+	assert.True(t, recorder.Flushed)
+}
+
+type testConnectionsResolver []wsclient.ConnectionSnapshot
+
+func (connections testConnectionsResolver) Connections() []wsclient.ConnectionSnapshot {
+	return connections
+}
+
+func TestConnectionsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	connectedAt := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	connections := testConnectionsResolver{
+		{
+			Name:             "ACS",
+			Connected:        true,
+			ConnectedAt:      &connectedAt,
+			MessagesReceived: map[string]uint64{"HeartbeatMessage": 2},
+			Reconnects:       1,
+			ReconnectReasons: map[string]uint64{wsclient.DisconnectReasonHeartbeatTimeout: 1},
+		},
+	}
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{Connections: connections}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/connections", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var resp ConnectionsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Equal(t, ConnectionsResponse{Connections: connections}, resp)
+}
+
+func TestConnectionsHandlerWithoutSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/connections", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `{"Connections":[]}`, recorder.Body.String())
+}
+
+type testMetricsBufferResolver tcsclient.MetricsBufferStats
+
+func (resolver testMetricsBufferResolver) Stats() tcsclient.MetricsBufferStats {
+	return tcsclient.MetricsBufferStats(resolver)
+}
+
+func TestMetricsBufferHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	resolver := testMetricsBufferResolver{
+		Pending:            3,
+		Dropped:            2,
+		Replayed:           5,
+		LastPublishLatency: 1500 * time.Millisecond,
+	}
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{MetricsBuffer: resolver}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/metricsbuffer", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var resp MetricsBufferResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Equal(t, MetricsBufferResponse{
+		Pending:                   3,
+		Dropped:                   2,
+		Replayed:                  5,
+		LastPublishLatencySeconds: 1.5,
+	}, resp)
+}
+
+type testCredentialsExpiryResolver credentials.ExpiryStats
+
+func (resolver testCredentialsExpiryResolver) Stats() credentials.ExpiryStats {
+	return credentials.ExpiryStats(resolver)
+}
+
+func TestCredentialsExpiryHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	expiration := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	resolver := testCredentialsExpiryResolver{
+		RefreshesOverdue: 1,
+		Overdue:          1,
+		Credentials: []credentials.CredentialsExpiry{
+			{
+				TaskARN:         "taskArn",
+				RoleType:        credentials.ApplicationRoleType,
+				RoleArn:         "roleArn",
+				Expiration:      expiration,
+				SecondsToExpiry: 60,
+				RefreshOverdue:  true,
+			},
+		},
+	}
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{CredentialsExpiry: resolver}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/credentialsexpiry", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var resp credentials.ExpiryStats
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Equal(t, credentials.ExpiryStats(resolver), resp)
+}
+
+type testECRTokensResolver ecr.TokenStats
+
+func (resolver testECRTokensResolver) Stats() ecr.TokenStats {
+	return ecr.TokenStats(resolver)
+}
+
+func TestECRTokensHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fetchedAt := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	resolver := testECRTokensResolver{
+		Hits:   3,
+		Misses: 1,
+		Tokens: []ecr.TokenInfo{
+			{
+				Region:     "us-west-2",
+				RegistryID: "123456789012",
+				FetchedAt:  fetchedAt,
+				ExpiresAt:  fetchedAt.Add(12 * time.Hour),
+				AgeSeconds: 600,
+				Hits:       3,
+				Misses:     1,
+			},
+		},
+	}
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{ECRTokens: resolver}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/ecrtokens", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "AuthorizationToken")
+	var resp ecr.TokenStats
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Equal(t, ecr.TokenStats(resolver), resp)
+}
+
+func TestEventsHandlerUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/events", nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
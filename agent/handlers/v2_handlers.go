@@ -0,0 +1,189 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+)
+
+const (
+	familyQueryField = "family"
+	statusQueryField = "status"
+)
+
+// taskV2Filter selects the tasks returned by the 'v2/tasks' API. Empty
+// fields match every task.
+type taskV2Filter struct {
+	taskArn  string
+	family   string
+	status   string
+	dockerID string
+}
+
+func newTaskV2Filter(r *http.Request) taskV2Filter {
+	taskArn, _ := ValueFromRequest(r, taskArnQueryField)
+	family, _ := ValueFromRequest(r, familyQueryField)
+	status, _ := ValueFromRequest(r, statusQueryField)
+	dockerID, _ := ValueFromRequest(r, dockerIdQueryField)
+	return taskV2Filter{
+		taskArn:  taskArn,
+		family:   family,
+		status:   status,
+		dockerID: dockerID,
+	}
+}
+
+func (filter taskV2Filter) matches(task *api.Task, containerMap map[string]*api.DockerContainer) bool {
+	if filter.taskArn != "" && task.Arn != filter.taskArn {
+		return false
+	}
+	if filter.family != "" && task.Family != filter.family {
+		return false
+	}
+	if filter.status != "" {
+		knownStatus := task.GetKnownStatus()
+		if !strings.EqualFold(knownStatus.BackendStatus(), filter.status) {
+			return false
+		}
+	}
+	if filter.dockerID == "" {
+		return true
+	}
+	// Docker ids may be given in their short form.
+	for _, container := range containerMap {
+		if strings.HasPrefix(container.DockerID, filter.dockerID) {
+			return true
+		}
+	}
+	return false
+}
+
+func newContainerV2Response(containerName string, dockerContainer *api.DockerContainer) ContainerV2Response {
+	container := dockerContainer.Container
+	knownStatus := container.GetKnownStatus()
+	desiredStatus := container.GetDesiredStatus()
+
+	ports := []PortResponse{}
+	for _, binding := range container.GetKnownPortBindings() {
+		ports = append(ports, PortResponse{
+			ContainerPort: binding.ContainerPort,
+			HostPort:      binding.HostPort,
+			BindIP:        binding.BindIP,
+			Protocol:      binding.Protocol.String(),
+		})
+	}
+	mountPoints := []MountPointResponse{}
+	for _, mountPoint := range container.MountPoints {
+		mountPoints = append(mountPoints, MountPointResponse{
+			SourceVolume:  mountPoint.SourceVolume,
+			ContainerPath: mountPoint.ContainerPath,
+			ReadOnly:      mountPoint.ReadOnly,
+		})
+	}
+
+	response := ContainerV2Response{
+		DockerId:      dockerContainer.DockerID,
+		DockerName:    dockerContainer.DockerName,
+		Name:          containerName,
+		Image:         container.Image,
+		ImageID:       container.ImageID,
+		ImageDigest:   container.GetImageDigest(),
+		DesiredStatus: desiredStatus.String(),
+		KnownStatus:   knownStatus.String(),
+		CPU:           container.CPU,
+		Memory:        container.Memory,
+		Ports:         ports,
+		MountPoints:   mountPoints,
+		ExitCode:      container.GetKnownExitCode(),
+		ApplyingError: container.GetApplyingError(),
+	}
+	if knownStatusTime := container.GetKnownStatusTime(); !knownStatusTime.IsZero() {
+		response.KnownStatusTime = &knownStatusTime
+	}
+	return response
+}
+
+func newTaskV2Response(task *api.Task, containerMap map[string]*api.DockerContainer) *TaskV2Response {
+	// The v2 response keeps the status semantics of v1
+	v1Response := newTaskResponse(task, containerMap)
+
+	containers := []ContainerV2Response{}
+	for containerName, container := range containerMap {
+		if container.Container.IsInternal {
+			continue
+		}
+		containers = append(containers, newContainerV2Response(containerName, container))
+	}
+	// The container map has no order; keep responses stable across calls
+	sort.Sort(byContainerV2Name(containers))
+	volumes := []VolumeResponse{}
+	for _, volume := range task.Volumes {
+		volumeResponse := VolumeResponse{Name: volume.Name}
+		if volume.Volume != nil {
+			volumeResponse.SourcePath = volume.Volume.SourcePath()
+		}
+		volumes = append(volumes, volumeResponse)
+	}
+
+	response := &TaskV2Response{
+		Arn:                 task.Arn,
+		DesiredStatus:       v1Response.DesiredStatus,
+		KnownStatus:         v1Response.KnownStatus,
+		Family:              task.Family,
+		Version:             task.Version,
+		StartSequenceNumber: task.StartSequenceNumber,
+		StopSequenceNumber:  task.StopSequenceNumber,
+		Local:               task.Local,
+		Volumes:             volumes,
+		Containers:          containers,
+	}
+	if knownStatusTime := task.GetKnownStatusTime(); !knownStatusTime.IsZero() {
+		response.KnownStatusTime = &knownStatusTime
+	}
+	return response
+}
+
+type byContainerV2Name []ContainerV2Response
+
+func (r byContainerV2Name) Len() int           { return len(r) }
+func (r byContainerV2Name) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byContainerV2Name) Less(i, j int) bool { return r[i].Name < r[j].Name }
+
+func newTasksV2Response(state dockerstate.TaskEngineState, filter taskV2Filter) *TasksV2Response {
+	taskResponses := []*TaskV2Response{}
+	for _, task := range state.AllTasks() {
+		containerMap, _ := state.ContainerMapByArn(task.Arn)
+		if !filter.matches(task, containerMap) {
+			continue
+		}
+		taskResponses = append(taskResponses, newTaskV2Response(task, containerMap))
+	}
+	return &TasksV2Response{Tasks: taskResponses}
+}
+
+// Creates response for the 'v2/tasks' API. Lists all tasks matching the
+// 'taskarn', 'family', 'status' and 'dockerid' fields of the request, with
+// more details about their containers than the 'v1/tasks' API.
+func tasksV2RequestHandlerMaker(taskEngine DockerStateResolver) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, _ := json.Marshal(newTasksV2Response(taskEngine.State(), newTaskV2Filter(r)))
+		w.Write(responseJSON)
+	}
+}
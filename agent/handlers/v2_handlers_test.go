@@ -0,0 +1,204 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/handlers/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testV2KnownStatusTime = time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func testV2Tasks() []*api.Task {
+	return []*api.Task{
+		{
+			Arn:                   "web-task",
+			DesiredStatusUnsafe:   api.TaskRunning,
+			KnownStatusUnsafe:     api.TaskRunning,
+			KnownStatusTimeUnsafe: testV2KnownStatusTime,
+			Family:                "web",
+			Version:               "3",
+			StartSequenceNumber:   7,
+			Volumes: []api.TaskVolume{
+				{Name: "data", Volume: &api.FSHostVolume{FSSourcePath: "/ecs/data"}},
+			},
+			Containers: []*api.Container{
+				{
+					Name:                  "nginx",
+					Image:                 "nginx:latest",
+					ImageID:               "sha256:1234",
+					ImageDigestUnsafe:     "sha256:5678",
+					CPU:                   256,
+					Memory:                512,
+					KnownStatusUnsafe:     api.ContainerRunning,
+					KnownStatusTimeUnsafe: testV2KnownStatusTime,
+					KnownPortBindings: []api.PortBinding{
+						{ContainerPort: 80, HostPort: 32768, BindIP: "0.0.0.0", Protocol: api.TransportProtocolTCP},
+					},
+					MountPoints: []api.MountPoint{
+						{SourceVolume: "data", ContainerPath: "/data", ReadOnly: true},
+					},
+				},
+			},
+		},
+		{
+			Arn:                 "batch-task",
+			DesiredStatusUnsafe: api.TaskStopped,
+			Local:               true,
+			KnownStatusUnsafe:   api.TaskStopped,
+			Family:              "batch",
+			Version:             "1",
+			StopSequenceNumber:  9,
+			Containers: []*api.Container{
+				{
+					Name:              "worker",
+					Image:             "worker:1",
+					KnownStatusUnsafe: api.ContainerStopped,
+					ApplyingError:     &api.DefaultNamedError{Name: "OutOfMemoryError", Err: "killed"},
+				},
+			},
+		},
+	}
+}
+
+func performV2Request(t *testing.T, path string) TasksV2Response {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tasks := testV2Tasks()
+	exitCode := 137
+	tasks[1].Containers[0].SetKnownExitCode(&exitCode)
+	state := dockerstate.NewTaskEngineState()
+	stateSetupHelper(state, tasks)
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	mockStateResolver.EXPECT().State().Return(state)
+	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, Dependencies{}, &config.Config{Cluster: testClusterArn})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	requestHandler.Handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response TasksV2Response
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response
+}
+
+func TestV2ListTasks(t *testing.T) {
+	response := performV2Request(t, "/v2/tasks")
+	assert.Len(t, response.Tasks, 2)
+}
+
+func TestV2TaskDetails(t *testing.T) {
+	response := performV2Request(t, "/v2/tasks?taskarn=web-task")
+	require.Len(t, response.Tasks, 1)
+
+	task := response.Tasks[0]
+	assert.Equal(t, "web-task", task.Arn)
+	assert.Equal(t, "RUNNING", task.KnownStatus)
+	require.NotNil(t, task.KnownStatusTime)
+	assert.True(t, testV2KnownStatusTime.Equal(*task.KnownStatusTime))
+	assert.Equal(t, int64(7), task.StartSequenceNumber)
+	assert.Equal(t, []VolumeResponse{{Name: "data", SourcePath: "/ecs/data"}}, task.Volumes)
+
+	require.Len(t, task.Containers, 1)
+	container := task.Containers[0]
+	assert.Equal(t, "nginx", container.Name)
+	assert.Equal(t, "dockerid-web-task-nginx", container.DockerId)
+	assert.Equal(t, "nginx:latest", container.Image)
+	assert.Equal(t, "sha256:1234", container.ImageID)
+	assert.Equal(t, "sha256:5678", container.ImageDigest)
+	assert.Equal(t, uint(256), container.CPU)
+	assert.Equal(t, uint(512), container.Memory)
+	assert.Equal(t, "RUNNING", container.KnownStatus)
+	require.NotNil(t, container.KnownStatusTime)
+	assert.True(t, testV2KnownStatusTime.Equal(*container.KnownStatusTime))
+	assert.Equal(t, []PortResponse{{ContainerPort: 80, HostPort: 32768, BindIP: "0.0.0.0", Protocol: "tcp"}}, container.Ports)
+	assert.Equal(t, []MountPointResponse{{SourceVolume: "data", ContainerPath: "/data", ReadOnly: true}}, container.MountPoints)
+	assert.Nil(t, container.ExitCode)
+	assert.Nil(t, container.ApplyingError)
+}
+
+func TestV2ContainersSortedByName(t *testing.T) {
+	task := &api.Task{Arn: "multi-task"}
+	containerMap := make(map[string]*api.DockerContainer)
+	for _, name := range []string{"web", "app", "sidecar", "log"} {
+		container := &api.Container{Name: name}
+		task.Containers = append(task.Containers, container)
+		containerMap[name] = &api.DockerContainer{DockerID: "dockerid-" + name, DockerName: name, Container: container}
+	}
+
+	for i := 0; i < 5; i++ {
+		response := newTaskV2Response(task, containerMap)
+		var names []string
+		for _, container := range response.Containers {
+			names = append(names, container.Name)
+		}
+		assert.Equal(t, []string{"app", "log", "sidecar", "web"}, names)
+	}
+}
+
+func TestV2StoppedTaskDetails(t *testing.T) {
+	response := performV2Request(t, "/v2/tasks?taskarn=batch-task")
+	require.Len(t, response.Tasks, 1)
+
+	task := response.Tasks[0]
+	assert.Nil(t, task.KnownStatusTime)
+	assert.Equal(t, int64(9), task.StopSequenceNumber)
+	assert.True(t, task.Local, "Expected task to be marked as local")
+	require.Len(t, task.Containers, 1)
+	container := task.Containers[0]
+	assert.Nil(t, container.KnownStatusTime)
+	require.NotNil(t, container.ExitCode)
+	assert.Equal(t, 137, *container.ExitCode)
+	require.NotNil(t, container.ApplyingError)
+	assert.Equal(t, "OutOfMemoryError", container.ApplyingError.Name)
+}
+
+func TestV2FilterTasks(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"family=web", []string{"web-task"}},
+		{"status=stopped", []string{"batch-task"}},
+		{"status=RUNNING&family=batch", []string{}},
+		{"dockerid=dockerid-batch-task-worker", []string{"batch-task"}},
+		{"dockerid=dockerid-web", []string{"web-task"}},
+		{"family=unknown", []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			response := performV2Request(t, "/v2/tasks?"+tc.query)
+			arns := []string{}
+			for _, task := range response.Tasks {
+				arns = append(arns, task.Arn)
+			}
+			assert.Equal(t, tc.expected, arns)
+		})
+	}
+}
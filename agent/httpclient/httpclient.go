@@ -16,14 +16,16 @@
 package httpclient
 
 import (
-	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/version"
+	"github.com/cihub/seelog"
 )
 
 const defaultTimeout = 10 * time.Minute
@@ -37,6 +39,7 @@ const defaultDialKeepalive = 30 * time.Second
 type ecsRoundTripper struct {
 	insecureSkipVerify bool
 	transport          http.RoundTripper
+	proxy              func(*http.Request) (*url.URL, error)
 }
 
 func userAgent() string {
@@ -45,7 +48,13 @@ func userAgent() string {
 
 func (client *ecsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Set("User-Agent", userAgent())
-	return client.transport.RoundTrip(req)
+	resp, err := client.transport.RoundTrip(req)
+	if err != nil && client.proxy != nil {
+		if proxyURL, proxyErr := client.proxy(req); proxyErr == nil && proxyURL != nil {
+			seelog.Warnf("Request to %s through proxy %s failed: %v", req.URL.Host, ProxyDisplayName(proxyURL), err)
+		}
+	}
+	return resp, err
 }
 
 func (client *ecsRoundTripper) CancelRequest(req *http.Request) {
@@ -54,30 +63,56 @@ func (client *ecsRoundTripper) CancelRequest(req *http.Request) {
 	}
 }
 
-// New returns an ECS httpClient with a roundtrip timeout of the given duration
-func New(timeout time.Duration, insecureSkipVerify bool) *http.Client {
+// New returns an ECS httpClient with a roundtrip timeout of the given duration.
+// Requests go through the proxy, and trust the CA bundle, of the config; cfg
+// may be nil to only use the proxy from the environment.
+func New(timeout time.Duration, insecureSkipVerify bool, cfg *config.Config) *http.Client {
+	proxy := ProxyFunc(cfg)
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: defaultDialKeepalive,
+	}
 	// Transport is the transport requests will be made over
 	// Note, these defaults are taken from the golang http library. We do not
 	// explicitly do not use theirs to avoid changing their behavior.
 	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		Dial: (&net.Dialer{
-			Timeout:   defaultDialTimeout,
-			KeepAlive: defaultDialKeepalive,
-		}).Dial,
+		Proxy:               proxy,
+		Dial:                proxyLoggingDial(dialer, cfg),
 		TLSHandshakeTimeout: 10 * time.Second,
-	}
-	if insecureSkipVerify {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		TLSClientConfig:     TLSConfig(cfg, insecureSkipVerify),
 	}
 	client := &http.Client{
-		Transport: &ecsRoundTripper{insecureSkipVerify, transport},
+		Transport: &ecsRoundTripper{insecureSkipVerify, transport, proxy},
 		Timeout:   timeout,
 	}
 
 	return client
 }
 
+// proxyLoggingDial logs the connections made to the configured proxy.
+func proxyLoggingDial(dialer *net.Dialer, cfg *config.Config) func(network, addr string) (net.Conn, error) {
+	proxyURL := configuredProxyURL(cfg)
+	if proxyURL == nil {
+		return dialer.Dial
+	}
+	proxyAddr := proxyURL.Host
+	if _, _, err := net.SplitHostPort(proxyAddr); err != nil {
+		// The default port of http proxies
+		proxyAddr = net.JoinHostPort(proxyAddr, "80")
+	}
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := dialer.Dial(network, addr)
+		if addr == proxyAddr {
+			if err != nil {
+				seelog.Warnf("Unable to connect to proxy %s: %v", ProxyDisplayName(proxyURL), err)
+			} else {
+				seelog.Debugf("Connected to proxy %s", ProxyDisplayName(proxyURL))
+			}
+		}
+		return conn, err
+	}
+}
+
 // OverridableTransport is a transport that provides an override for testing purposes.
 type OverridableTransport interface {
 	SetTransport(http.RoundTripper)
@@ -0,0 +1,173 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/cihub/seelog"
+)
+
+// defaultNoProxyHosts are always reached directly: the instance metadata and
+// the task credentials endpoints
+var defaultNoProxyHosts = []string{"169.254.169.254", "169.254.170.2"}
+
+// ProxyFunc returns the proxy function of the connections to AWS. Requests go
+// through the proxy in the config, with its credentials, or through the proxy
+// from the environment when none is configured. Hosts in the no-proxy list of
+// the config, the metadata endpoints and the docker host are reached directly.
+// The environment is never modified.
+func ProxyFunc(cfg *config.Config) func(*http.Request) (*url.URL, error) {
+	noProxy := newNoProxyMatcher(cfg)
+	proxyURL := configuredProxyURL(cfg)
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy.matches(req.URL.Host) {
+			return nil, nil
+		}
+		if proxyURL != nil {
+			return proxyURL, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+}
+
+// ProxyDisplayName returns the proxy url without its credentials, for logging.
+func ProxyDisplayName(proxyURL *url.URL) string {
+	return proxyURL.Scheme + "://" + proxyURL.Host
+}
+
+// TLSConfig returns the tls configuration of the connections to AWS, which
+// trusts the system certificate authorities and the ones in the CA bundle of
+// the config.
+func TLSConfig(cfg *config.Config, insecureSkipVerify bool) *tls.Config {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if cfg == nil || cfg.ProxyCABundle == "" {
+		return tlsConfig
+	}
+	bundle, err := ioutil.ReadFile(cfg.ProxyCABundle)
+	if err != nil {
+		seelog.Errorf("Unable to read the CA bundle %s, only trusting the system certificate authorities: %v", cfg.ProxyCABundle, err)
+		return tlsConfig
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		seelog.Warnf("Unable to load the system certificate authorities, only trusting the CA bundle %s: %v", cfg.ProxyCABundle, err)
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(bundle) {
+		seelog.Errorf("No certificates found in the CA bundle %s", cfg.ProxyCABundle)
+	}
+	tlsConfig.RootCAs = roots
+	return tlsConfig
+}
+
+// configuredProxyURL returns the proxy of the config, with its credentials,
+// or nil if there is none.
+func configuredProxyURL(cfg *config.Config) *url.URL {
+	if cfg == nil || cfg.ProxyURL == "" {
+		return nil
+	}
+	proxyURL, err := url.Parse(cfg.ProxyURL)
+	if err != nil {
+		// The url is validated along with the rest of the config
+		seelog.Errorf("Invalid proxy url, not using it: %v", err)
+		return nil
+	}
+	if cfg.ProxyUsername != "" {
+		proxyURL.User = url.UserPassword(cfg.ProxyUsername, cfg.ProxyPassword)
+	}
+	return proxyURL
+}
+
+// noProxyMatcher matches the hosts that are reached directly. Entries are
+// hosts, optionally with a port, domains, which also match their subdomains,
+// CIDR blocks or "*" for every host.
+type noProxyMatcher struct {
+	all     bool
+	hosts   []string
+	domains []string
+	blocks  []*net.IPNet
+}
+
+func newNoProxyMatcher(cfg *config.Config) *noProxyMatcher {
+	entries := append([]string{}, defaultNoProxyHosts...)
+	if cfg != nil {
+		entries = append(entries, cfg.NoProxy...)
+		dockerHost, err := url.Parse(cfg.DockerEndpoint)
+		if err == nil && dockerHost.Host != "" {
+			entries = append(entries, dockerHost.Host)
+		}
+	}
+
+	matcher := &noProxyMatcher{}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			matcher.all = true
+		case strings.Contains(entry, "/"):
+			_, block, err := net.ParseCIDR(entry)
+			if err != nil {
+				seelog.Warnf("Ignoring invalid no-proxy entry %s: %v", entry, err)
+				continue
+			}
+			matcher.blocks = append(matcher.blocks, block)
+		case net.ParseIP(entry) != nil:
+			matcher.hosts = append(matcher.hosts, entry)
+		default:
+			matcher.hosts = append(matcher.hosts, entry)
+			matcher.domains = append(matcher.domains, "."+strings.TrimPrefix(entry, "."))
+		}
+	}
+	return matcher
+}
+
+// matches returns true if the host, with an optional port, is reached
+// directly.
+func (matcher *noProxyMatcher) matches(hostPort string) bool {
+	if matcher.all {
+		return true
+	}
+	hostPort = strings.ToLower(hostPort)
+	host := hostPort
+	if splitHost, _, err := net.SplitHostPort(hostPort); err == nil {
+		host = splitHost
+	}
+	for _, entry := range matcher.hosts {
+		if entry == host || entry == hostPort {
+			return true
+		}
+	}
+	for _, domain := range matcher.domains {
+		if strings.HasSuffix(host, domain) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, block := range matcher.blocks {
+			if block.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
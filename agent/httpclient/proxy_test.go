@@ -0,0 +1,139 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package httpclient
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyFor(t *testing.T, cfg *config.Config, target string) *url.URL {
+	req, err := http.NewRequest("GET", target, nil)
+	require.NoError(t, err)
+	proxyURL, err := ProxyFunc(cfg)(req)
+	require.NoError(t, err)
+	return proxyURL
+}
+
+func TestProxyFunc(t *testing.T) {
+	cfg := &config.Config{
+		ProxyURL:       "http://proxy.example.com:3128",
+		ProxyUsername:  "user",
+		ProxyPassword:  "password",
+		NoProxy:        []string{"internal.example.com", "10.0.0.0/8", "localhost:8080"},
+		DockerEndpoint: "tcp://docker.example.com:2375",
+	}
+
+	proxyURL := proxyFor(t, cfg, "https://ecs.us-west-2.amazonaws.com")
+	require.NotNil(t, proxyURL)
+	assert.Equal(t, "proxy.example.com:3128", proxyURL.Host)
+	password, _ := proxyURL.User.Password()
+	assert.Equal(t, "user", proxyURL.User.Username())
+	assert.Equal(t, "password", password)
+	assert.Equal(t, "http://proxy.example.com:3128", ProxyDisplayName(proxyURL))
+
+	for _, target := range []string{
+		"http://169.254.169.254/latest/meta-data",
+		"http://169.254.170.2/v2/credentials",
+		"http://docker.example.com:2375/version",
+		"https://internal.example.com",
+		"https://api.internal.example.com",
+		"http://10.1.2.3",
+		"http://localhost:8080",
+	} {
+		assert.Nil(t, proxyFor(t, cfg, target), "Expected %s to be reached directly", target)
+	}
+	for _, target := range []string{
+		"https://notinternal.example.com",
+		"http://11.1.2.3",
+		"http://localhost:8081",
+	} {
+		assert.NotNil(t, proxyFor(t, cfg, target), "Expected %s to be reached through the proxy", target)
+	}
+
+	cfg.NoProxy = []string{"*"}
+	assert.Nil(t, proxyFor(t, cfg, "https://ecs.us-west-2.amazonaws.com"))
+}
+
+func TestProxyFuncFromEnvironment(t *testing.T) {
+	// Without a configured proxy, only the default hosts bypass the
+	// environment, which is left alone
+	noProxy, noProxySet := os.LookupEnv("NO_PROXY")
+	os.Unsetenv("NO_PROXY")
+	if noProxySet {
+		defer os.Setenv("NO_PROXY", noProxy)
+	}
+	assert.Nil(t, proxyFor(t, nil, "http://169.254.169.254/latest/meta-data"))
+	_, noProxySet = os.LookupEnv("NO_PROXY")
+	assert.False(t, noProxySet, "NO_PROXY should not be set")
+}
+
+func TestNewThroughProxy(t *testing.T) {
+	proxied := make(chan *http.Request, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	client := New(defaultTimeout, false, &config.Config{
+		ProxyURL:      proxy.URL,
+		ProxyUsername: "user",
+		ProxyPassword: "password",
+	})
+	resp, err := client.Get("http://ecs.example.com/path")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	r := <-proxied
+	assert.Equal(t, "ecs.example.com", r.Host)
+	assert.NotEmpty(t, r.Header.Get("Proxy-Authorization"))
+}
+
+func TestTLSConfigWithCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "httpclient")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "bundle.pem")
+	require.NoError(t, ioutil.WriteFile(bundle, testCertificatePEM(t, server), 0600))
+
+	// The self-signed certificate of the server is only trusted through the
+	// bundle
+	_, err = New(defaultTimeout, false, &config.Config{}).Get(server.URL)
+	assert.Error(t, err)
+	resp, err := New(defaultTimeout, false, &config.Config{ProxyCABundle: bundle}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func testCertificatePEM(t *testing.T, server *httptest.Server) []byte {
+	require.Len(t, server.TLS.Certificates, 1)
+	require.NotEmpty(t, server.TLS.Certificates[0].Certificate)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+}
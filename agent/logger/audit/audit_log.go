@@ -40,8 +40,29 @@ func NewAuditLog(containerInstanceArn string, cfg *config.Config, logger InfoLog
 // using the underlying logger (which implements the audit.InfoLogger interface).
 func (a *auditLog) Log(r request.LogRequest, httpResponseCode int, eventType string) {
 	if !a.cfg.CredentialsAuditLogDisabled {
-		auditLogEntry := constructAuditLogEntry(r, httpResponseCode, eventType, a.GetCluster(),
-			a.GetContainerInstanceArn())
+		var auditLogEntry string
+		if a.cfg.CredentialsAuditLogFormat == config.AuditLogFormatJSON {
+			auditLogEntry = constructJSONAuditLogEntry(r, httpResponseCode, eventType, a.GetCluster(),
+				a.GetContainerInstanceArn())
+		} else {
+			auditLogEntry = constructAuditLogEntry(r, httpResponseCode, eventType, a.GetCluster(),
+				a.GetContainerInstanceArn())
+		}
+
+		a.logger.Info(auditLogEntry)
+	}
+}
+
+func (a *auditLog) LogImageAdmissionDenied(taskArn string, image string, reason string) {
+	if !a.cfg.CredentialsAuditLogDisabled {
+		var auditLogEntry string
+		if a.cfg.CredentialsAuditLogFormat == config.AuditLogFormatJSON {
+			auditLogEntry = constructJSONImageAdmissionDeniedAuditLogEntry(taskArn, image, reason, a.GetCluster(),
+				a.GetContainerInstanceArn())
+		} else {
+			auditLogEntry = constructImageAdmissionDeniedAuditLogEntry(taskArn, image, reason, a.GetCluster(),
+				a.GetContainerInstanceArn())
+		}
 
 		a.logger.Info(auditLogEntry)
 	}
@@ -14,19 +14,26 @@
 package audit
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	mock_infologger "github.com/aws/amazon-ecs-agent/agent/logger/audit/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/logger/audit/request"
+	"github.com/cihub/seelog"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -182,6 +189,16 @@ func TestConstructAuditLogEntryByTypeGetCredentials(t *testing.T) {
 	verifyConstructAuditLogEntryGetCredentialsResult(result, t)
 }
 
+func TestConstructAuditLogEntryByTypeGetCredentialsRejected(t *testing.T) {
+	result := constructAuditLogEntryByType(GetCredentialsRejectedEventType(), dummyCluster,
+		dummyContainerInstanceArn)
+	tokens := strings.Split(result, " ")
+	assert.Equal(t, getCredentialsEntryFieldCount, len(tokens), "Incorrect number of tokens in GetCredentialsRejected audit log entry")
+	assert.Equal(t, GetCredentialsRejectedEventType(), tokens[0], "event type does not match")
+	assert.Equal(t, dummyCluster, tokens[2], "cluster does not match")
+	assert.Equal(t, dummyContainerInstanceArn, tokens[3], "containerInstanceArn does not match")
+}
+
 func verifyAuditLogEntryResult(logLine string, expectedTaskArn string, expectedURLPath string, t *testing.T) {
 	tokens := strings.Split(logLine, " ")
 	assert.Equal(t, commonAuditLogEntryFieldCount+getCredentialsEntryFieldCount, len(tokens), "Incorrect number of tokens in audit log entry")
@@ -217,3 +234,188 @@ func TestConstructAuditLogEntryByTypeUnknownType(t *testing.T) {
 	result := constructAuditLogEntryByType("unknownEvent", dummyCluster, dummyContainerInstanceArn)
 	assert.Equal(t, "", result, "unknown event type should not return an entry")
 }
+
+func TestWritingImageAdmissionDeniedToAuditLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockInfoLogger := mock_infologger.NewMockInfoLogger(ctrl)
+
+	cfg := &config.Config{
+		Cluster:                 dummyCluster,
+		CredentialsAuditLogFile: "foo.txt",
+	}
+
+	auditLogger := NewAuditLog(dummyContainerInstanceArn, cfg, mockInfoLogger)
+
+	mockInfoLogger.EXPECT().Info(gomock.Any()).Do(func(logLine string) {
+		tokens := strings.SplitN(logLine, " ", 8)
+		assert.Equal(t, 8, len(tokens), "Incorrect number of tokens in audit log entry")
+		assert.Equal(t, taskARN, tokens[1], "task arn does not match")
+		assert.Equal(t, "busybox:latest", tokens[2], "image does not match")
+		assert.Equal(t, imageAdmissionDeniedEventType, tokens[3], "event type does not match")
+		version, _ := strconv.Atoi(tokens[4])
+		assert.Equal(t, imageAdmissionDeniedAuditLogVersion, version, "version does not match")
+		assert.Equal(t, dummyCluster, tokens[5], "cluster does not match")
+		assert.Equal(t, dummyContainerInstanceArn, tokens[6], "container instance arn does not match")
+		assert.Equal(t, `"the latest tag is denied"`, tokens[7], "reason does not match")
+	})
+
+	auditLogger.LogImageAdmissionDenied(taskARN, "busybox:latest", "the latest tag is denied")
+}
+
+func TestWritingImageAdmissionDeniedToAuditLogWhenDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockInfoLogger := mock_infologger.NewMockInfoLogger(ctrl)
+
+	cfg := &config.Config{
+		Cluster:                     dummyCluster,
+		CredentialsAuditLogDisabled: true,
+	}
+
+	auditLogger := NewAuditLog(dummyContainerInstanceArn, cfg, mockInfoLogger)
+
+	mockInfoLogger.EXPECT().Info(gomock.Any()).Times(0)
+
+	auditLogger.LogImageAdmissionDenied(taskARN, "busybox:latest", "the latest tag is denied")
+}
+
+func TestWritingJSONToAuditLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockInfoLogger := mock_infologger.NewMockInfoLogger(ctrl)
+
+	req, _ := http.NewRequest("GET", dummyURLV2, nil)
+	req.RemoteAddr = "172.17.0.2:41000"
+	req.Header.Set("User-Agent", dummyUserAgent)
+
+	cfg := &config.Config{
+		Cluster:                   dummyCluster,
+		CredentialsAuditLogFile:   "foo.txt",
+		CredentialsAuditLogFormat: config.AuditLogFormatJSON,
+	}
+	auditLogger := NewAuditLog(dummyContainerInstanceArn, cfg, mockInfoLogger)
+
+	mockInfoLogger.EXPECT().Info(gomock.Any()).Do(func(logLine string) {
+		assert.NotContains(t, logLine, "\n")
+		entry := jsonAuditLogEntry{}
+		require.NoError(t, json.Unmarshal([]byte(logLine), &entry))
+		assert.NotEmpty(t, entry.Timestamp)
+		entry.Timestamp = ""
+		assert.Equal(t, jsonAuditLogEntry{
+			EventType:            GetCredentialsEventType(),
+			Version:              jsonAuditLogVersion,
+			TaskARN:              taskARN,
+			RoleARN:              "role-arn",
+			CredentialsID:        "credentials-id",
+			SourceIP:             "172.17.0.2",
+			SourcePort:           41000,
+			URL:                  credentials.V2CredentialsPath,
+			UserAgent:            dummyUserAgent,
+			HTTPStatus:           dummyResponseCode,
+			Cluster:              dummyCluster,
+			ContainerInstanceARN: dummyContainerInstanceArn,
+		}, entry)
+	})
+
+	auditLogger.Log(request.LogRequest{
+		Request:       req,
+		ARN:           taskARN,
+		RoleARN:       "role-arn",
+		CredentialsID: "credentials-id",
+	}, dummyResponseCode, GetCredentialsEventType())
+}
+
+func TestWritingImageAdmissionDeniedJSONToAuditLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockInfoLogger := mock_infologger.NewMockInfoLogger(ctrl)
+
+	cfg := &config.Config{
+		Cluster:                   dummyCluster,
+		CredentialsAuditLogFile:   "foo.txt",
+		CredentialsAuditLogFormat: config.AuditLogFormatJSON,
+	}
+	auditLogger := NewAuditLog(dummyContainerInstanceArn, cfg, mockInfoLogger)
+
+	mockInfoLogger.EXPECT().Info(gomock.Any()).Do(func(logLine string) {
+		entry := jsonAuditLogEntry{}
+		require.NoError(t, json.Unmarshal([]byte(logLine), &entry))
+		assert.Equal(t, imageAdmissionDeniedEventType, entry.EventType)
+		assert.Equal(t, taskARN, entry.TaskARN)
+		assert.Equal(t, "busybox:latest", entry.Image)
+		assert.Equal(t, "the latest tag is denied", entry.Reason)
+		assert.Equal(t, dummyCluster, entry.Cluster)
+	})
+
+	auditLogger.LogImageAdmissionDenied(taskARN, "busybox:latest", "the latest tag is denied")
+}
+
+func TestAuditLoggerConfig(t *testing.T) {
+	cfg := &config.Config{CredentialsAuditLogFile: "audit.log"}
+	seelogConfig := AuditLoggerConfig(cfg)
+	assert.Contains(t, seelogConfig, `type="date"`)
+	assert.Contains(t, seelogConfig, `maxrolls="24"`)
+	assert.NotContains(t, seelogConfig, "<conn")
+
+	cfg.CredentialsAuditLogMaxAge = 72 * time.Hour
+	assert.Contains(t, AuditLoggerConfig(cfg), `maxrolls="72"`)
+
+	cfg.CredentialsAuditLogMaxSizeMB = 10
+	cfg.CredentialsAuditLogMaxRolls = 5
+	cfg.CredentialsAuditLogSyslog = "udp://localhost:514"
+	seelogConfig = AuditLoggerConfig(cfg)
+	assert.Contains(t, seelogConfig, `type="size"`)
+	assert.Contains(t, seelogConfig, `maxsize="10485760"`)
+	assert.Contains(t, seelogConfig, `maxrolls="5"`)
+	assert.Contains(t, seelogConfig, `<conn formatid="syslog" net="udp" addr="localhost:514" />`)
+
+	logger, err := seelog.LoggerFromConfigAsString(seelogConfig)
+	require.NoError(t, err)
+	logger.Close()
+}
+
+func TestAuditLoggerConfigEscapesFilename(t *testing.T) {
+	cfg := &config.Config{CredentialsAuditLogFile: `/log/"audit"&<credentials>.log`}
+	escapedFilename := `filename="/log/&#34;audit&#34;&amp;&lt;credentials&gt;.log"`
+	assert.Contains(t, AuditLoggerConfig(cfg), escapedFilename)
+
+	cfg.CredentialsAuditLogMaxSizeMB = 10
+	assert.Contains(t, AuditLoggerConfig(cfg), escapedFilename)
+}
+
+func TestRemoveExpiredLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	files := map[string]time.Time{
+		"audit.log":   now.Add(-48 * time.Hour),
+		"audit.log.1": now.Add(-48 * time.Hour),
+		"audit.log.2": now.Add(-time.Hour),
+		"other.log.1": now.Add(-48 * time.Hour),
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte("entry"), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	removeExpiredLogs(filepath.Join(dir, "audit.log"), 24*time.Hour, now)
+
+	// Only the rotated audit logs past the max age are removed
+	for name, removed := range map[string]bool{
+		"audit.log":   false,
+		"audit.log.1": true,
+		"audit.log.2": false,
+		"other.log.1": false,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.Equal(t, removed, os.IsNotExist(err), name)
+	}
+}
@@ -39,6 +39,26 @@ const (
 	// 9. cluster
 	// 10. container instance arn
 	getCredentialsAuditLogVersion = 1
+
+	// getCredentialsRejectedEventType is the type of the requests for
+	// credentials rejected because they don't come from the task owning the
+	// credentials. Its entries have the same fields as 'GetCredentials'.
+	getCredentialsRejectedEventType = "GetCredentialsRejected"
+
+	imageAdmissionDeniedEventType = "ImageAdmissionDenied"
+
+	// imageAdmissionDeniedAuditLogVersion is the version of the audit log
+	// for images denied by the image admission policy
+	// For version '1', the fields are:
+	// 1. event time
+	// 2. task arn
+	// 3. image
+	// 4. event type ('ImageAdmissionDenied')
+	// 5. version
+	// 6. cluster
+	// 7. container instance arn
+	// 8. reason
+	imageAdmissionDeniedAuditLogVersion = 1
 )
 
 type commonAuditLogEntryFields struct {
@@ -55,6 +75,12 @@ func GetCredentialsEventType() string {
 	return getCredentialsEventType
 }
 
+// GetCredentialsRejectedEventType is the type for a GetCredentials request
+// rejected because it does not come from the task owning the credentials
+func GetCredentialsRejectedEventType() string {
+	return getCredentialsRejectedEventType
+}
+
 func (c *commonAuditLogEntryFields) string() string {
 	return fmt.Sprintf("%s %d %s %s %s %s", c.eventTime, c.responseCode, c.srcAddr, c.theURL, c.userAgent, c.arn)
 }
@@ -90,7 +116,7 @@ func constructCommonAuditLogEntryFields(r request.LogRequest, httpResponseCode i
 
 func constructAuditLogEntryByType(eventType string, cluster string, containerInstanceArn string) string {
 	switch eventType {
-	case getCredentialsEventType:
+	case getCredentialsEventType, getCredentialsRejectedEventType:
 		fields := &getCredentialsAuditLogEntryFields{
 			eventType:            eventType,
 			version:              getCredentialsAuditLogVersion,
@@ -104,6 +130,37 @@ func constructAuditLogEntryByType(eventType string, cluster string, containerIns
 	}
 }
 
+type imageAdmissionDeniedAuditLogEntryFields struct {
+	eventTime            string
+	taskArn              string
+	image                string
+	eventType            string
+	version              int
+	cluster              string
+	containerInstanceArn string
+	reason               string
+}
+
+func (i *imageAdmissionDeniedAuditLogEntryFields) string() string {
+	return fmt.Sprintf("%s %s %s %s %d %s %s %s", i.eventTime, i.taskArn, i.image, i.eventType, i.version,
+		i.cluster, i.containerInstanceArn, i.reason)
+}
+
+func constructImageAdmissionDeniedAuditLogEntry(taskArn string, image string, reason string,
+	cluster string, containerInstanceArn string) string {
+	fields := &imageAdmissionDeniedAuditLogEntryFields{
+		eventTime:            time.Now().UTC().Format(time.RFC3339),
+		taskArn:              populateField(taskArn),
+		image:                populateField(image),
+		eventType:            imageAdmissionDeniedEventType,
+		version:              imageAdmissionDeniedAuditLogVersion,
+		cluster:              populateField(cluster),
+		containerInstanceArn: populateField(containerInstanceArn),
+		reason:               fmt.Sprintf(`"%s"`, reason),
+	}
+	return fields.string()
+}
+
 func populateField(logField string) string {
 	if logField == "" {
 		logField = "-"
@@ -17,6 +17,7 @@ import "github.com/aws/amazon-ecs-agent/agent/logger/audit/request"
 
 type AuditLogger interface {
 	Log(r request.LogRequest, httpResponseCode int, eventType string)
+	LogImageAdmissionDenied(taskArn string, image string, reason string)
 	GetContainerInstanceArn() string
 	GetCluster() string
 }
@@ -0,0 +1,110 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/logger/audit/request"
+	log "github.com/cihub/seelog"
+)
+
+// jsonAuditLogVersion is the version of the json audit log entries. Fields
+// may be added to an entry without changing the version.
+const jsonAuditLogVersion = 1
+
+// jsonAuditLogEntry is an audit log entry in the json format, written as
+// a single line. Fields that don't apply to the event type are omitted.
+type jsonAuditLogEntry struct {
+	Timestamp            string `json:"timestamp"`
+	EventType            string `json:"eventType"`
+	Version              int    `json:"version"`
+	TaskARN              string `json:"taskArn,omitempty"`
+	RoleARN              string `json:"roleArn,omitempty"`
+	CredentialsID        string `json:"credentialsId,omitempty"`
+	SourceIP             string `json:"sourceIp,omitempty"`
+	SourcePort           int    `json:"sourcePort,omitempty"`
+	URL                  string `json:"url,omitempty"`
+	UserAgent            string `json:"userAgent,omitempty"`
+	HTTPStatus           int    `json:"httpStatus,omitempty"`
+	Image                string `json:"image,omitempty"`
+	Reason               string `json:"reason,omitempty"`
+	Cluster              string `json:"cluster"`
+	ContainerInstanceARN string `json:"containerInstanceArn"`
+}
+
+func constructJSONAuditLogEntry(r request.LogRequest, httpResponseCode int, eventType string,
+	cluster string, containerInstanceArn string) string {
+	httpRequest := r.Request
+	url := httpRequest.URL.Path
+	// The credentials ID has its own field
+	if strings.HasPrefix(url, credentials.V2CredentialsPath+"/") {
+		url = credentials.V2CredentialsPath
+	}
+	entry := &jsonAuditLogEntry{
+		Timestamp:            time.Now().UTC().Format(time.RFC3339),
+		EventType:            eventType,
+		Version:              jsonAuditLogVersion,
+		TaskARN:              r.ARN,
+		RoleARN:              r.RoleARN,
+		CredentialsID:        r.CredentialsID,
+		URL:                  url,
+		UserAgent:            httpRequest.UserAgent(),
+		HTTPStatus:           httpResponseCode,
+		Cluster:              cluster,
+		ContainerInstanceARN: containerInstanceArn,
+	}
+	entry.SourceIP, entry.SourcePort = splitRemoteAddr(httpRequest.RemoteAddr)
+	return entry.string()
+}
+
+func constructJSONImageAdmissionDeniedAuditLogEntry(taskArn string, image string, reason string,
+	cluster string, containerInstanceArn string) string {
+	entry := &jsonAuditLogEntry{
+		Timestamp:            time.Now().UTC().Format(time.RFC3339),
+		EventType:            imageAdmissionDeniedEventType,
+		Version:              jsonAuditLogVersion,
+		TaskARN:              taskArn,
+		Image:                image,
+		Reason:               reason,
+		Cluster:              cluster,
+		ContainerInstanceARN: containerInstanceArn,
+	}
+	return entry.string()
+}
+
+// splitRemoteAddr splits the remote address of a request into its ip and
+// port. An address that can't be split is returned whole as the ip.
+func splitRemoteAddr(remoteAddr string) (string, int) {
+	host, portString, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr, 0
+	}
+	port, _ := strconv.Atoi(portString)
+	return host, port
+}
+
+func (entry *jsonAuditLogEntry) string() string {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		log.Warnf("Error marshaling the audit log entry: %v", err)
+		return ""
+	}
+	return string(entryJSON)
+}
@@ -70,6 +70,14 @@ func (_mr *_MockAuditLoggerRecorder) Log(arg0, arg1, arg2 interface{}) *gomock.C
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Log", arg0, arg1, arg2)
 }
 
+func (_m *MockAuditLogger) LogImageAdmissionDenied(_param0 string, _param1 string, _param2 string) {
+	_m.ctrl.Call(_m, "LogImageAdmissionDenied", _param0, _param1, _param2)
+}
+
+func (_mr *_MockAuditLoggerRecorder) LogImageAdmissionDenied(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "LogImageAdmissionDenied", arg0, arg1, arg2)
+}
+
 // Mock of InfoLogger interface
 type MockInfoLogger struct {
 	ctrl     *gomock.Controller
@@ -18,4 +18,8 @@ import "net/http"
 type LogRequest struct {
 	Request *http.Request
 	ARN     string
+	// RoleARN and CredentialsID identify the credentials requested. They are
+	// only recorded in the json audit log format.
+	RoleARN       string
+	CredentialsID string
 }
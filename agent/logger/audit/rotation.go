@@ -0,0 +1,78 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	log "github.com/cihub/seelog"
+	"golang.org/x/net/context"
+)
+
+// rotatedLogCleanupInterval is how often the audit logs rotated by size are
+// checked for expiry
+const rotatedLogCleanupInterval = time.Hour
+
+// StartRotatedLogCleanup removes the audit logs rotated by size once they are
+// older than the configured age, until the context is done. Logs rotated
+// every hour are bounded by age through the number of logs kept.
+func StartRotatedLogCleanup(ctx context.Context, cfg *config.Config) {
+	if cfg.CredentialsAuditLogFile == "" || cfg.CredentialsAuditLogMaxSizeMB <= 0 ||
+		cfg.CredentialsAuditLogMaxAge <= 0 {
+		return
+	}
+	ticker := time.NewTicker(rotatedLogCleanupInterval)
+	defer ticker.Stop()
+	for {
+		removeExpiredLogs(cfg.CredentialsAuditLogFile, cfg.CredentialsAuditLogMaxAge, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// removeExpiredLogs removes the rotated copies of the log file, named after it
+// with a suffix, that were last written more than maxAge before now
+func removeExpiredLogs(filename string, maxAge time.Duration, now time.Time) {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Warnf("Error listing the rotated audit logs in %s: %v", dir, err)
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), base+".") {
+			continue
+		}
+		if now.Sub(file.ModTime()) <= maxAge {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		if err := os.Remove(path); err != nil {
+			log.Warnf("Error removing the expired audit log %s: %v", path, err)
+			continue
+		}
+		log.Debugf("Removed the expired audit log %s", path)
+	}
+}
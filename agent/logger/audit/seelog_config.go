@@ -13,23 +13,93 @@
 
 package audit
 
-import "github.com/aws/amazon-ecs-agent/agent/config"
+import (
+	"math"
+	"net/url"
+	"strconv"
 
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	bytesPerMB = 1024 * 1024
+
+	// syslogFormat formats the audit log entries sent to syslog as RFC 5424
+	// messages of the authpriv facility with the info severity. The '<' and
+	// '>' around the priority are escaped for the xml configuration.
+	syslogFormat = `&lt;86&gt;1 %UTCDate(2006-01-02T15:04:05Z) - ecs-agent - - - %Msg%n`
+)
+
+// NewAuditLogFromConfig creates the audit log writing to the audit log file
+// of the config
+func NewAuditLogFromConfig(containerInstanceArn string, cfg *config.Config) AuditLogger {
+	// TODO Use seelog's programmatic configuration instead of xml.
+	logger, err := log.LoggerFromConfigAsString(AuditLoggerConfig(cfg))
+	if err != nil {
+		log.Errorf("Error initializing the audit log: %v", err)
+		// If the logger cannot be initialized, use the provided dummy seelog.LoggerInterface, seelog.Disabled.
+		logger = log.Disabled
+	}
+
+	return NewAuditLog(containerInstanceArn, cfg, logger)
+}
+
+// AuditLoggerConfig returns the seelog configuration of the audit log. The
+// audit log file is rotated every hour, or by size when a maximum size is
+// set, and the entries are optionally sent to a syslog server.
 func AuditLoggerConfig(cfg *config.Config) string {
 	config := `
 	<seelog type="asyncloop" minlevel="info">
 		<outputs formatid="main">
 			<console />`
 	if cfg.CredentialsAuditLogFile != "" {
-		config += `<rollingfile filename="` + cfg.CredentialsAuditLogFile + `" type="date"
-			 datepattern="2006-01-02-15" archivetype="none" maxrolls="24" />`
+		filename := logger.EscapeAttribute(cfg.CredentialsAuditLogFile)
+		if cfg.CredentialsAuditLogMaxSizeMB > 0 {
+			config += `<rollingfile filename="` + filename + `" type="size"
+			 maxsize="` + strconv.Itoa(cfg.CredentialsAuditLogMaxSizeMB*bytesPerMB) + `" archivetype="none" maxrolls="` +
+				strconv.Itoa(maxRollsBySize(cfg)) + `" />`
+		} else {
+			config += `<rollingfile filename="` + filename + `" type="date"
+			 datepattern="2006-01-02-15" archivetype="none" maxrolls="` + strconv.Itoa(maxRollsByDate(cfg)) + `" />`
+		}
+	}
+	if cfg.CredentialsAuditLogSyslog != "" {
+		// The address was validated with the rest of the config
+		syslogURL, err := url.Parse(cfg.CredentialsAuditLogSyslog)
+		if err == nil {
+			config += `
+			<conn formatid="syslog" net="` + syslogURL.Scheme + `" addr="` + syslogURL.Host + `" />`
+		}
 	}
 	config += `
 		</outputs>
 		<formats>
 			<format id="main" format="%Msg%n" />
+			<format id="syslog" format="` + syslogFormat + `" />
 		</formats>
 	</seelog>
 `
 	return config
 }
+
+// maxRollsByDate returns the number of hourly audit logs to keep for the
+// configured age
+func maxRollsByDate(cfg *config.Config) int {
+	maxAge := cfg.CredentialsAuditLogMaxAge
+	if maxAge <= 0 {
+		maxAge = config.DefaultCredentialsAuditLogMaxAge
+	}
+	return int(math.Ceil(maxAge.Hours()))
+}
+
+// maxRollsBySize returns the number of audit logs rotated by size to keep,
+// those older than the configured age are removed by
+// StartRotatedLogCleanup
+func maxRollsBySize(cfg *config.Config) int {
+	if cfg.CredentialsAuditLogMaxRolls <= 0 {
+		return config.DefaultCredentialsAuditLogMaxRolls
+	}
+	return cfg.CredentialsAuditLogMaxRolls
+}
@@ -13,6 +13,11 @@
 
 package logger
 
+import (
+	"bytes"
+	"encoding/xml"
+)
+
 func loggerConfig() string {
 	config := `
 	<seelog type="asyncloop" minlevel="` + level + `">
@@ -31,3 +36,28 @@ func loggerConfig() string {
 `
 	return config
 }
+
+// MessageLoggerConfig returns the seelog configuration of a log of bare
+// messages written to filename. The log is rotated daily and a month of logs
+// is kept.
+func MessageLoggerConfig(filename string) string {
+	return `
+	<seelog type="asyncloop" minlevel="info">
+		<outputs formatid="main">
+			<rollingfile filename="` + EscapeAttribute(filename) + `" type="date"
+			 datepattern="2006-01-02" archivetype="none" maxrolls="31" />
+		</outputs>
+		<formats>
+			<format id="main" format="%Msg%n" />
+		</formats>
+	</seelog>
+`
+}
+
+// EscapeAttribute escapes a value, such as a file path, to be inserted as an
+// attribute value in a seelog xml configuration
+func EscapeAttribute(value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
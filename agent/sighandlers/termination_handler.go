@@ -13,7 +13,7 @@
 
 // sighandlers handle signals and behave appropriately.
 // SIGTERM:
-//   Flush state to disk and exit
+//   Drain pending work, flush state to disk and exit
 // SIGUSR1:
 //   Print a dump of goroutines to the logger and DON'T exit
 package sighandlers
@@ -30,17 +30,38 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers/exitcodes"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"golang.org/x/net/context"
 )
 
 var log = logger.ForModule("TerminationHandler")
 
-func StartTerminationHandler(saver statemanager.Saver, taskEngine engine.TaskEngine) {
+// Drainer is implemented by the components holding work that should be
+// delivered before the agent exits.
+type Drainer interface {
+	// Drain delivers the pending work until it is done or the context is
+	// done. It returns a description of the work that was not delivered.
+	Drain(ctx context.Context) []string
+}
+
+// DrainerFunc adapts a function to the Drainer interface.
+type DrainerFunc func(ctx context.Context) []string
+
+// Drain calls f(ctx).
+func (f DrainerFunc) Drain(ctx context.Context) []string {
+	return f(ctx)
+}
+
+// StartTerminationHandler waits for a termination signal. It then drains the
+// drainers in order, within drainTimeout overall, saves the state and exits.
+func StartTerminationHandler(saver statemanager.Saver, taskEngine engine.TaskEngine,
+	drainTimeout time.Duration, drainers ...Drainer) {
 	signalChannel := make(chan os.Signal, 2)
 	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
 
 	sig := <-signalChannel
 	log.Debug("Received termination signal", "signal", sig.String())
 
+	DrainAll(drainTimeout, drainers...)
 	err := FinalSave(saver, taskEngine)
 	if err != nil {
 		log.Crit("Error saving state before final shutdown", "err", err)
@@ -50,6 +71,23 @@ func StartTerminationHandler(saver statemanager.Saver, taskEngine engine.TaskEng
 	os.Exit(exitcodes.ExitSuccess)
 }
 
+// DrainAll drains each drainer in turn, sharing the timeout between them, and
+// logs the work that could not be delivered.
+func DrainAll(timeout time.Duration, drainers ...Drainer) {
+	if len(drainers) == 0 {
+		return
+	}
+	log.Info("Draining pending work before shutting down", "timeout", timeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, drainer := range drainers {
+		for _, undelivered := range drainer.Drain(ctx) {
+			log.Warn("Unable to deliver before shutting down", "pending", undelivered)
+		}
+	}
+}
+
 const engineDisableTimeout = 5 * time.Second
 const finalSaveTimeout = 3 * time.Second
 
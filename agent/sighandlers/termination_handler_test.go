@@ -0,0 +1,53 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sighandlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDrainAllDrainsInOrder(t *testing.T) {
+	var drained []string
+	drainer := func(name string) Drainer {
+		return DrainerFunc(func(ctx context.Context) []string {
+			drained = append(drained, name)
+			return nil
+		})
+	}
+
+	DrainAll(time.Second, drainer("acs"), drainer("events"), drainer("tcs"))
+	assert.Equal(t, []string{"acs", "events", "tcs"}, drained)
+}
+
+func TestDrainAllSharesTimeout(t *testing.T) {
+	var deadlines []time.Time
+	drainer := DrainerFunc(func(ctx context.Context) []string {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok, "Expected a deadline for draining")
+		deadlines = append(deadlines, deadline)
+		<-ctx.Done()
+		return []string{"pending"}
+	})
+
+	start := time.Now()
+	DrainAll(10*time.Millisecond, drainer, drainer)
+	assert.True(t, time.Since(start) < time.Second, "Expected the drainers to stop at the shared deadline")
+	if assert.Len(t, deadlines, 2) {
+		assert.Equal(t, deadlines[0], deadlines[1])
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ssm
+
+import (
+	"fmt"
+
+	ssmapi "github.com/aws/amazon-ecs-agent/agent/ssm/model/ssm"
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/cihub/seelog"
+)
+
+// SSMClient retrieves parameters from the SSM Parameter Store
+type SSMClient interface {
+	// GetParameter returns the decrypted value of the named parameter
+	GetParameter(name string) (string, error)
+}
+
+// SSMSDK is the subset of the SSM SDK used by the agent
+type SSMSDK interface {
+	GetParameter(*ssmapi.GetParameterInput) (*ssmapi.GetParameterOutput, error)
+}
+
+type ssmClient struct {
+	sdkClient SSMSDK
+}
+
+func NewSSMClient(sdkClient SSMSDK) SSMClient {
+	return &ssmClient{
+		sdkClient: sdkClient,
+	}
+}
+
+func (client *ssmClient) GetParameter(name string) (string, error) {
+	log.Debugf("Calling GetParameter for %q", name)
+
+	output, err := client.sdkClient.GetParameter(&ssmapi.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if output.Parameter == nil || output.Parameter.Value == nil {
+		return "", fmt.Errorf("No value returned for parameter %q", name)
+	}
+	return aws.StringValue(output.Parameter.Value), nil
+}
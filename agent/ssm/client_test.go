@@ -0,0 +1,65 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ssm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/ssm"
+	"github.com/aws/amazon-ecs-agent/agent/ssm/mocks"
+	ssmapi "github.com/aws/amazon-ecs-agent/agent/ssm/model/ssm"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetParameterDecryptsValue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sdkClient := mock_ssm.NewMockSSMSDK(ctrl)
+
+	sdkClient.EXPECT().GetParameter(&ssmapi.GetParameterInput{
+		Name:           aws.String("/registry/creds"),
+		WithDecryption: aws.Bool(true),
+	}).Return(&ssmapi.GetParameterOutput{
+		Parameter: &ssmapi.Parameter{Value: aws.String("value")},
+	}, nil)
+
+	value, err := ssm.NewSSMClient(sdkClient).GetParameter("/registry/creds")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestGetParameterMissingValue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sdkClient := mock_ssm.NewMockSSMSDK(ctrl)
+
+	sdkClient.EXPECT().GetParameter(gomock.Any()).Return(&ssmapi.GetParameterOutput{}, nil)
+
+	_, err := ssm.NewSSMClient(sdkClient).GetParameter("/registry/creds")
+	assert.Error(t, err)
+}
+
+func TestGetParameterError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sdkClient := mock_ssm.NewMockSSMSDK(ctrl)
+
+	sdkClient.EXPECT().GetParameter(gomock.Any()).Return(nil, errors.New("ParameterNotFound"))
+
+	_, err := ssm.NewSSMClient(sdkClient).GetParameter("/registry/creds")
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ssm
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	ssmapi "github.com/aws/amazon-ecs-agent/agent/ssm/model/ssm"
+	"github.com/aws/aws-sdk-go/aws"
+	awscreds "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// SSMFactory builds SSM clients that act on behalf of a task's IAM role
+type SSMFactory interface {
+	GetClient(region string, creds credentials.IAMRoleCredentials) SSMClient
+}
+
+type ssmFactory struct {
+	httpClient *http.Client
+}
+
+const roundtripTimeout = 5 * time.Second
+
+func NewSSMFactory(cfg *config.Config) SSMFactory {
+	return &ssmFactory{
+		httpClient: httpclient.New(roundtripTimeout, cfg.AcceptInsecureCert, cfg),
+	}
+}
+
+// GetClient returns a new client for every call. Clients are not cached
+// because the role credentials they are built with are short lived and
+// scoped to a single task.
+func (factory *ssmFactory) GetClient(region string, creds credentials.IAMRoleCredentials) SSMClient {
+	cfg := aws.NewConfig().
+		WithRegion(region).
+		WithHTTPClient(factory.httpClient).
+		WithCredentials(awscreds.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken))
+	return NewSSMClient(ssmapi.New(session.New(cfg)))
+}
@@ -0,0 +1,226 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ssm
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const opGetParameter = "GetParameter"
+
+// GetParameterRequest generates a "aws/request.Request" representing the
+// client's request for the GetParameter operation. The "output" return
+// value can be used to capture response data after the request's "Send" method
+// is called.
+//
+// See GetParameter for usage and error information.
+//
+// Creating a request object using this method should be used when you want to inject
+// custom logic into the request's lifecycle using a custom handler, or if you want to
+// access properties on the request object before or after sending the request. If
+// you just want the service response, call the GetParameter method directly
+// instead.
+//
+// Note: You must call the "Send" method on the returned request object in order
+// to execute the request.
+//
+//    // Example sending a request using the GetParameterRequest method.
+//    req, resp := client.GetParameterRequest(params)
+//
+//    err := req.Send()
+//    if err == nil { // resp is now filled
+//        fmt.Println(resp)
+//    }
+func (c *SSM) GetParameterRequest(input *GetParameterInput) (req *request.Request, output *GetParameterOutput) {
+	op := &request.Operation{
+		Name:       opGetParameter,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	if input == nil {
+		input = &GetParameterInput{}
+	}
+
+	output = &GetParameterOutput{}
+	req = c.newRequest(op, input, output)
+	return
+}
+
+// GetParameter API operation for Amazon Simple Systems Manager (SSM).
+//
+// Returns awserr.Error for service API and SDK errors. Use runtime type assertions
+// with awserr.Error's Code and Message methods to get detailed information about
+// the error.
+//
+// See the AWS API reference guide for Amazon Simple Systems Manager (SSM)'s
+// API operation GetParameter for usage and error information.
+//
+// Returned Error Codes:
+//   * ErrCodeInternalServerError "InternalServerError"
+//
+//   * ErrCodeInvalidKeyId "InvalidKeyId"
+//
+//   * ErrCodeParameterNotFound "ParameterNotFound"
+//
+//   * ErrCodeParameterVersionNotFound "ParameterVersionNotFound"
+//
+func (c *SSM) GetParameter(input *GetParameterInput) (*GetParameterOutput, error) {
+	req, out := c.GetParameterRequest(input)
+	return out, req.Send()
+}
+
+// GetParameterWithContext is the same as GetParameter with the addition of
+// the ability to pass a context and additional request options.
+//
+// See GetParameter for details on how to use this API operation.
+//
+// The context must be non-nil and will be used for request cancellation. If
+// the context is nil a panic will occur. In the future the SDK may create
+// sub-contexts for http.Requests. See https://golang.org/pkg/context/
+// for more information on using Contexts.
+func (c *SSM) GetParameterWithContext(ctx aws.Context, input *GetParameterInput, opts ...request.Option) (*GetParameterOutput, error) {
+	req, out := c.GetParameterRequest(input)
+	req.SetContext(ctx)
+	req.ApplyOptions(opts...)
+	return out, req.Send()
+}
+
+type GetParameterInput struct {
+	_ struct{} `type:"structure"`
+
+	// Name is a required field
+	Name *string `min:"1" type:"string" required:"true"`
+
+	WithDecryption *bool `type:"boolean"`
+}
+
+// String returns the string representation
+func (s GetParameterInput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s GetParameterInput) GoString() string {
+	return s.String()
+}
+
+// Validate inspects the fields of the type to determine if they are valid.
+func (s *GetParameterInput) Validate() error {
+	invalidParams := request.ErrInvalidParams{Context: "GetParameterInput"}
+	if s.Name == nil {
+		invalidParams.Add(request.NewErrParamRequired("Name"))
+	}
+	if s.Name != nil && len(*s.Name) < 1 {
+		invalidParams.Add(request.NewErrParamMinLen("Name", 1))
+	}
+
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+// SetName sets the Name field's value.
+func (s *GetParameterInput) SetName(v string) *GetParameterInput {
+	s.Name = &v
+	return s
+}
+
+// SetWithDecryption sets the WithDecryption field's value.
+func (s *GetParameterInput) SetWithDecryption(v bool) *GetParameterInput {
+	s.WithDecryption = &v
+	return s
+}
+
+type GetParameterOutput struct {
+	_ struct{} `type:"structure"`
+
+	Parameter *Parameter `type:"structure"`
+}
+
+// String returns the string representation
+func (s GetParameterOutput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s GetParameterOutput) GoString() string {
+	return s.String()
+}
+
+// SetParameter sets the Parameter field's value.
+func (s *GetParameterOutput) SetParameter(v *Parameter) *GetParameterOutput {
+	s.Parameter = v
+	return s
+}
+
+type Parameter struct {
+	_ struct{} `type:"structure"`
+
+	Name *string `min:"1" type:"string"`
+
+	Type *string `type:"string" enum:"ParameterType"`
+
+	Value *string `min:"1" type:"string"`
+
+	Version *int64 `type:"long"`
+}
+
+// String returns the string representation
+func (s Parameter) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s Parameter) GoString() string {
+	return s.String()
+}
+
+// SetName sets the Name field's value.
+func (s *Parameter) SetName(v string) *Parameter {
+	s.Name = &v
+	return s
+}
+
+// SetType sets the Type field's value.
+func (s *Parameter) SetType(v string) *Parameter {
+	s.Type = &v
+	return s
+}
+
+// SetValue sets the Value field's value.
+func (s *Parameter) SetValue(v string) *Parameter {
+	s.Value = &v
+	return s
+}
+
+// SetVersion sets the Version field's value.
+func (s *Parameter) SetVersion(v int64) *Parameter {
+	s.Version = &v
+	return s
+}
+
+const (
+	// ParameterTypeString is a ParameterType enum value
+	ParameterTypeString = "String"
+
+	// ParameterTypeStringList is a ParameterType enum value
+	ParameterTypeStringList = "StringList"
+
+	// ParameterTypeSecureString is a ParameterType enum value
+	ParameterTypeSecureString = "SecureString"
+)
@@ -0,0 +1,88 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package standalone
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	"github.com/cihub/seelog"
+)
+
+// errNoBackend is returned by the calls that need the ECS backend
+var errNoBackend = errors.New("standalone: the ECS backend is not used in standalone mode")
+
+// stateChangeLogClient is the api.ECSClient of standalone mode. State changes
+// are acknowledged right away and written, one json message per line, to the
+// state change log.
+type stateChangeLogClient struct {
+	logger stats.InfoLogger
+}
+
+// NewStateChangeLogClient returns the api.ECSClient of standalone mode. State
+// changes are written to the agent log if the state change log cannot be
+// created.
+func NewStateChangeLogClient(cfg *config.Config) api.ECSClient {
+	var stateChangeLog stats.InfoLogger = seelog.Current
+	if cfg.StandaloneStateChangeLogFile != "" {
+		stateChangeLogger, err := seelog.LoggerFromConfigAsString(logger.MessageLoggerConfig(cfg.StandaloneStateChangeLogFile))
+		if err != nil {
+			seelog.Errorf("Error creating state change logger, logging state changes to the agent log: %v", err)
+		} else {
+			stateChangeLog = stateChangeLogger
+		}
+	}
+	return &stateChangeLogClient{logger: stateChangeLog}
+}
+
+func (client *stateChangeLogClient) log(change statechange.Event) error {
+	message, err := eventhandler.NewEventMessage(change)
+	if err != nil {
+		return err
+	}
+	message.Timestamp = time.Now()
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	client.logger.Info(string(data))
+	return nil
+}
+
+func (client *stateChangeLogClient) SubmitTaskStateChange(change api.TaskStateChange) error {
+	return client.log(change)
+}
+
+func (client *stateChangeLogClient) SubmitContainerStateChange(change api.ContainerStateChange) error {
+	return client.log(change)
+}
+
+func (client *stateChangeLogClient) RegisterContainerInstance(string, []string) (string, error) {
+	return "", errNoBackend
+}
+
+func (client *stateChangeLogClient) DiscoverPollEndpoint(string) (string, error) {
+	return "", errNoBackend
+}
+
+func (client *stateChangeLogClient) DiscoverTelemetryEndpoint(string) (string, error) {
+	return "", errNoBackend
+}
@@ -0,0 +1,64 @@
+// +build !integration
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package standalone
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (logger *recordingLogger) Info(v ...interface{}) {
+	logger.lines = append(logger.lines, fmt.Sprint(v...))
+}
+
+func TestStateChangeLogClient(t *testing.T) {
+	logger := &recordingLogger{}
+	client := &stateChangeLogClient{logger: logger}
+
+	require.NoError(t, client.SubmitContainerStateChange(api.ContainerStateChange{
+		TaskArn:       "t1",
+		ContainerName: "c1",
+		Status:        api.ContainerRunning,
+	}))
+	require.NoError(t, client.SubmitTaskStateChange(api.TaskStateChange{
+		TaskArn: "t1",
+		Status:  api.TaskRunning,
+	}))
+	require.Len(t, logger.lines, 2)
+
+	var message eventhandler.EventMessage
+	require.NoError(t, json.Unmarshal([]byte(logger.lines[0]), &message))
+	assert.Equal(t, eventhandler.ContainerEventType, message.Type)
+	assert.Equal(t, "c1", message.ContainerName)
+	assert.Equal(t, "RUNNING", message.Status)
+	assert.False(t, message.Timestamp.IsZero())
+	require.NoError(t, json.Unmarshal([]byte(logger.lines[1]), &message))
+	assert.Equal(t, eventhandler.TaskEventType, message.Type)
+
+	_, err := client.RegisterContainerInstance("", nil)
+	assert.Equal(t, errNoBackend, err)
+	_, err = client.DiscoverPollEndpoint("")
+	assert.Equal(t, errNoBackend, err)
+}
@@ -0,0 +1,48 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package standalone
+
+import (
+	"bytes"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+)
+
+const (
+	manifestFileSuffix = ".json"
+	// defaultArnPrefix is prepended to the name of the manifests that don't
+	// set the task arn
+	defaultArnPrefix = "standalone/"
+)
+
+// parseManifest reads a task manifest, which has the same shape as the tasks
+// sent by ACS. The arn defaults to one derived from the manifest name and the
+// desired status defaults to RUNNING.
+func parseManifest(name string, data []byte) (*api.Task, error) {
+	acsTask := &ecsacs.Task{}
+	err := jsonutil.UnmarshalJSON(acsTask, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(acsTask.Arn) == "" {
+		acsTask.Arn = aws.String(defaultArnPrefix + name)
+	}
+	if aws.StringValue(acsTask.DesiredStatus) == "" {
+		acsTask.DesiredStatus = aws.String("RUNNING")
+	}
+	return api.TaskFromACS(acsTask, &ecsacs.PayloadMessage{})
+}
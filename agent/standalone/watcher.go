@@ -0,0 +1,204 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package standalone runs the agent without the ECS backend, taking tasks
+// from a directory of local manifests.
+package standalone
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/cihub/seelog"
+	"golang.org/x/net/context"
+)
+
+// manifestPollInterval is the interval between two scans of the manifest
+// directory
+const manifestPollInterval = 5 * time.Second
+
+// manifest is the last version of a task manifest seen by the watcher.
+type manifest struct {
+	modTime  time.Time
+	size     int64
+	checksum [sha256.Size]byte
+	// taskArn is the arn of the task started from the manifest, if any
+	taskArn string
+}
+
+// ManifestWatcher reconciles the tasks of the engine with the task manifests
+// in a directory. Adding a manifest starts its task, editing it updates the
+// desired status of the task and removing it stops the task.
+type ManifestWatcher struct {
+	dir          string
+	taskEngine   engine.TaskEngine
+	pollInterval time.Duration
+	// manifests maps the file names of the manifests to their last version
+	manifests map[string]*manifest
+}
+
+// NewManifestWatcher returns a watcher of the manifests in dir.
+func NewManifestWatcher(dir string, taskEngine engine.TaskEngine) *ManifestWatcher {
+	return &ManifestWatcher{
+		dir:          dir,
+		taskEngine:   taskEngine,
+		pollInterval: manifestPollInterval,
+		manifests:    make(map[string]*manifest),
+	}
+}
+
+// Start reconciles the tasks with the manifests until the context is
+// cancelled. Tasks left over from a previous run whose manifest has been
+// removed in the meantime are stopped. An error is returned if the manifest
+// directory cannot be read at startup.
+func (watcher *ManifestWatcher) Start(ctx context.Context) error {
+	err := watcher.reconcile()
+	if err != nil {
+		return err
+	}
+	watcher.stopUnknownTasks()
+
+	ticker := time.NewTicker(watcher.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := watcher.reconcile()
+			if err != nil {
+				seelog.Warnf("Standalone, unable to read task manifests in %s: %v", watcher.dir, err)
+			}
+		}
+	}
+}
+
+// reconcile scans the manifest directory once and applies the changes since
+// the previous scan.
+func (watcher *ManifestWatcher) reconcile() error {
+	files, err := ioutil.ReadDir(watcher.dir)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]struct{})
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), manifestFileSuffix) {
+			continue
+		}
+		found[file.Name()] = struct{}{}
+		watcher.reconcileManifest(file)
+	}
+
+	for name, previous := range watcher.manifests {
+		if _, ok := found[name]; ok {
+			continue
+		}
+		delete(watcher.manifests, name)
+		if previous.taskArn != "" {
+			seelog.Infof("Standalone, task manifest %s removed", name)
+			watcher.stopTask(previous.taskArn)
+		}
+	}
+	return nil
+}
+
+// reconcileManifest adds the task of a new or modified manifest to the
+// engine.
+func (watcher *ManifestWatcher) reconcileManifest(file os.FileInfo) {
+	name := file.Name()
+	previous, known := watcher.manifests[name]
+	if known && previous.modTime.Equal(file.ModTime()) && previous.size == file.Size() {
+		return
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(watcher.dir, name))
+	if err != nil {
+		seelog.Warnf("Standalone, unable to read task manifest %s: %v", name, err)
+		return
+	}
+	current := &manifest{
+		modTime:  file.ModTime(),
+		size:     file.Size(),
+		checksum: sha256.Sum256(data),
+	}
+	if known {
+		current.taskArn = previous.taskArn
+	}
+	watcher.manifests[name] = current
+	if known && previous.checksum == current.checksum {
+		return
+	}
+
+	task, err := parseManifest(strings.TrimSuffix(name, manifestFileSuffix), data)
+	if err != nil {
+		// The task of the previous version, if any, is left alone until the
+		// manifest is fixed
+		seelog.Errorf("Standalone, invalid task manifest %s: %v", name, err)
+		return
+	}
+	if current.taskArn != "" && current.taskArn != task.Arn {
+		watcher.stopTask(current.taskArn)
+	}
+	current.taskArn = task.Arn
+
+	seelog.Infof("Standalone, adding task %s from manifest %s, desired status: %s",
+		task.Arn, name, task.GetDesiredStatus().String())
+	err = watcher.taskEngine.AddTask(task)
+	if err != nil {
+		seelog.Errorf("Standalone, unable to add task %s: %v", task.Arn, err)
+	}
+}
+
+// stopTask sets the desired status of a task managed by the engine to
+// STOPPED.
+func (watcher *ManifestWatcher) stopTask(taskArn string) {
+	_, ok := watcher.taskEngine.GetTaskByArn(taskArn)
+	if !ok {
+		return
+	}
+	seelog.Infof("Standalone, stopping task %s", taskArn)
+	err := watcher.taskEngine.AddTask(&api.Task{
+		Arn:                 taskArn,
+		DesiredStatusUnsafe: api.TaskStopped,
+	})
+	if err != nil {
+		seelog.Errorf("Standalone, unable to stop task %s: %v", taskArn, err)
+	}
+}
+
+// stopUnknownTasks stops the tasks of the engine that aren't backed by a
+// manifest. Tasks started through the local control api are left running.
+func (watcher *ManifestWatcher) stopUnknownTasks() {
+	known := make(map[string]struct{})
+	for _, manifest := range watcher.manifests {
+		known[manifest.taskArn] = struct{}{}
+	}
+	tasks, err := watcher.taskEngine.ListTasks()
+	if err != nil {
+		seelog.Warnf("Standalone, unable to list tasks: %v", err)
+		return
+	}
+	for _, task := range tasks {
+		if _, ok := known[task.Arn]; ok || task.Local || task.GetDesiredStatus().Terminal() {
+			continue
+		}
+		watcher.stopTask(task.Arn)
+	}
+}
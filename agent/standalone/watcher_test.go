@@ -0,0 +1,155 @@
+// +build !integration
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package standalone
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+const testManifest = `{
+	"arn": "arn:aws:ecs:us-west-2:123456789012:task/web",
+	"family": "web",
+	"version": "1",
+	"desiredStatus": "%s",
+	"containers": [{
+		"name": "nginx",
+		"image": "nginx:latest",
+		"essential": true,
+		"portMappings": [{"containerPort": 80, "hostPort": 8080}]
+	}]
+}`
+
+const testTaskArn = "arn:aws:ecs:us-west-2:123456789012:task/web"
+
+func newTestWatcher(t *testing.T, ctrl *gomock.Controller) (*ManifestWatcher, *engine.MockTaskEngine, func()) {
+	dir, err := ioutil.TempDir("", "manifests")
+	require.NoError(t, err)
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	return NewManifestWatcher(dir, taskEngine), taskEngine, func() { os.RemoveAll(dir) }
+}
+
+func writeManifest(t *testing.T, watcher *ManifestWatcher, name string, content string, modTime time.Time) {
+	path := filepath.Join(watcher.dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestParseManifest(t *testing.T) {
+	task, err := parseManifest("web", []byte(`{"family": "web", "containers": [{"name": "nginx", "image": "nginx"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "standalone/web", task.Arn)
+	assert.Equal(t, api.TaskRunning, task.GetDesiredStatus())
+	require.Len(t, task.Containers, 1)
+	assert.Equal(t, "nginx", task.Containers[0].Image)
+
+	_, err = parseManifest("invalid", []byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestWatcherReconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	watcher, taskEngine, cleanup := newTestWatcher(t, ctrl)
+	defer cleanup()
+
+	// A new manifest starts its task
+	now := time.Now()
+	writeManifest(t, watcher, "web.json", fmtManifest("RUNNING"), now)
+	writeManifest(t, watcher, "README.md", "not a manifest", now)
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		assert.Equal(t, testTaskArn, task.Arn)
+		assert.Equal(t, api.TaskRunning, task.GetDesiredStatus())
+		require.Len(t, task.Containers, 1)
+		assert.Equal(t, uint16(8080), task.Containers[0].Ports[0].HostPort)
+	})
+	require.NoError(t, watcher.reconcile())
+
+	// Nothing happens while the manifest doesn't change
+	require.NoError(t, watcher.reconcile())
+	writeManifest(t, watcher, "web.json", fmtManifest("RUNNING"), now.Add(time.Second))
+	require.NoError(t, watcher.reconcile())
+
+	// An invalid manifest is ignored
+	writeManifest(t, watcher, "web.json", "{", now.Add(2*time.Second))
+	require.NoError(t, watcher.reconcile())
+
+	// Editing the desired status updates the task
+	writeManifest(t, watcher, "web.json", fmtManifest("STOPPED"), now.Add(3*time.Second))
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		assert.Equal(t, testTaskArn, task.Arn)
+		assert.Equal(t, api.TaskStopped, task.GetDesiredStatus())
+	})
+	require.NoError(t, watcher.reconcile())
+
+	// Removing the manifest stops the task
+	require.NoError(t, os.Remove(filepath.Join(watcher.dir, "web.json")))
+	gomock.InOrder(
+		taskEngine.EXPECT().GetTaskByArn(testTaskArn).Return(&api.Task{Arn: testTaskArn}, true),
+		taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+			assert.Equal(t, testTaskArn, task.Arn)
+			assert.Equal(t, api.TaskStopped, task.GetDesiredStatus())
+		}),
+	)
+	require.NoError(t, watcher.reconcile())
+	assert.Empty(t, watcher.manifests)
+}
+
+func TestWatcherStopsUnknownTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	watcher, taskEngine, cleanup := newTestWatcher(t, ctrl)
+	defer cleanup()
+
+	writeManifest(t, watcher, "web.json", fmtManifest("RUNNING"), time.Now())
+	taskEngine.EXPECT().AddTask(gomock.Any())
+	require.NoError(t, watcher.reconcile())
+
+	taskEngine.EXPECT().ListTasks().Return([]*api.Task{
+		{Arn: testTaskArn, DesiredStatusUnsafe: api.TaskRunning},
+		{Arn: "removed", DesiredStatusUnsafe: api.TaskRunning},
+		{Arn: "stopped", DesiredStatusUnsafe: api.TaskStopped},
+		{Arn: "local/web-1", DesiredStatusUnsafe: api.TaskRunning, Local: true},
+	}, nil)
+	taskEngine.EXPECT().GetTaskByArn("removed").Return(&api.Task{Arn: "removed"}, true)
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		assert.Equal(t, "removed", task.Arn)
+		assert.Equal(t, api.TaskStopped, task.GetDesiredStatus())
+	})
+	watcher.stopUnknownTasks()
+}
+
+func TestWatcherStartMissingDirectory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	watcher := NewManifestWatcher("/does/not/exist", engine.NewMockTaskEngine(ctrl))
+	assert.Error(t, watcher.Start(context.TODO()))
+}
+
+func fmtManifest(desiredStatus string) string {
+	return fmt.Sprintf(testManifest, desiredStatus)
+}
@@ -42,7 +42,15 @@ import (
 // 3) Add 'Protocol' field to 'portMappings' and 'KnownPortBindings'
 // 4) Add 'DockerConfig' struct
 // 5) Add 'ImageStates' struct as part of ImageManager
-const EcsDataVersion = 5
+// 6) Add 'PayloadLog' top level field with the ACS payloads that were applied
+//    (backwards compatible)
+// 7) Add 'ImageDigest' field to containers (backwards compatible)
+// 8) Add 'IPAddresses' field to containers (backwards compatible)
+// 9) Add 'ECRTokens' top level field with the encrypted ECR authorization
+//    tokens (backwards compatible)
+// 10) Add 'KnownTime' field to containers (backwards compatible)
+// 11) Add 'Local' field to tasks (backwards compatible)
+const EcsDataVersion = 11
 
 // Filename in the ECS_DATADIR
 const ecsDataFile = "ecs_agent_data.json"
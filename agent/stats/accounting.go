@@ -0,0 +1,243 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/cihub/seelog"
+)
+
+// ContainerUsageReport is the resource usage of a container over its lifetime,
+// computed from the samples collected by the stats engine.
+type ContainerUsageReport struct {
+	Name               string    `json:"name"`
+	DockerID           string    `json:"dockerId"`
+	Start              time.Time `json:"start"`
+	Stop               time.Time `json:"stop"`
+	DurationSeconds    float64   `json:"durationSeconds"`
+	CPUSeconds         float64   `json:"cpuSeconds"`
+	PeakMemoryBytes    uint64    `json:"peakMemoryBytes"`
+	AverageMemoryBytes uint64    `json:"averageMemoryBytes"`
+	NetworkRxBytes     uint64    `json:"networkRxBytes"`
+	NetworkTxBytes     uint64    `json:"networkTxBytes"`
+	Samples            int       `json:"samples"`
+}
+
+// TaskUsageReport is the resource usage of a stopped task. Memory figures are
+// the sums of the per container figures, so the peak is an upper bound of
+// the actual peak memory usage of the task.
+type TaskUsageReport struct {
+	TaskArn               string                 `json:"taskArn"`
+	TaskDefinitionFamily  string                 `json:"taskDefinitionFamily"`
+	TaskDefinitionVersion string                 `json:"taskDefinitionVersion"`
+	Start                 time.Time              `json:"start"`
+	Stop                  time.Time              `json:"stop"`
+	DurationSeconds       float64                `json:"durationSeconds"`
+	CPUSeconds            float64                `json:"cpuSeconds"`
+	PeakMemoryBytes       uint64                 `json:"peakMemoryBytes"`
+	AverageMemoryBytes    uint64                 `json:"averageMemoryBytes"`
+	NetworkRxBytes        uint64                 `json:"networkRxBytes"`
+	NetworkTxBytes        uint64                 `json:"networkTxBytes"`
+	Containers            []ContainerUsageReport `json:"containers"`
+}
+
+// usageAccumulator aggregates every sample of a container, unlike the stats
+// queue which only holds the samples of the current publish interval.
+type usageAccumulator struct {
+	lock        sync.Mutex
+	samples     int
+	first       *ContainerStats
+	last        *ContainerStats
+	peakMemory  uint64
+	totalMemory float64
+}
+
+// record adds a sample to the accumulator.
+func (usage *usageAccumulator) record(stat *ContainerStats) {
+	usage.lock.Lock()
+	defer usage.lock.Unlock()
+
+	if usage.first == nil {
+		usage.first = stat
+	}
+	usage.last = stat
+	usage.samples++
+	usage.totalMemory += float64(stat.memoryUsage)
+	if stat.memoryUsage > usage.peakMemory {
+		usage.peakMemory = stat.memoryUsage
+	}
+}
+
+// report returns the usage of the container from the samples recorded.
+func (usage *usageAccumulator) report(name string, dockerID string) ContainerUsageReport {
+	usage.lock.Lock()
+	defer usage.lock.Unlock()
+
+	report := ContainerUsageReport{
+		Name:     name,
+		DockerID: dockerID,
+		Samples:  usage.samples,
+	}
+	if usage.samples == 0 {
+		return report
+	}
+	report.Start = usage.first.timestamp
+	report.Stop = usage.last.timestamp
+	report.DurationSeconds = report.Stop.Sub(report.Start).Seconds()
+	// Docker reports cumulative cpu time and network bytes since the
+	// container started, and cpuUsage is stored per core.
+	report.CPUSeconds = float64(usage.last.cpuUsage*numCores) / float64(time.Second)
+	report.NetworkRxBytes = usage.last.networkRxBytes
+	report.NetworkTxBytes = usage.last.networkTxBytes
+	report.PeakMemoryBytes = usage.peakMemory
+	report.AverageMemoryBytes = uint64(usage.totalMemory / float64(usage.samples))
+	return report
+}
+
+// newTaskUsageReport sums up the container usage reports of a task.
+func newTaskUsageReport(taskArn string, taskDef *taskDefinition, containers []ContainerUsageReport) *TaskUsageReport {
+	report := &TaskUsageReport{
+		TaskArn:    taskArn,
+		Containers: containers,
+	}
+	if taskDef != nil {
+		report.TaskDefinitionFamily = taskDef.family
+		report.TaskDefinitionVersion = taskDef.version
+	}
+	sort.Sort(byContainerName(containers))
+	for _, container := range containers {
+		if container.Samples == 0 {
+			continue
+		}
+		if report.Start.IsZero() || container.Start.Before(report.Start) {
+			report.Start = container.Start
+		}
+		if container.Stop.After(report.Stop) {
+			report.Stop = container.Stop
+		}
+		report.CPUSeconds += container.CPUSeconds
+		report.PeakMemoryBytes += container.PeakMemoryBytes
+		report.AverageMemoryBytes += container.AverageMemoryBytes
+		report.NetworkRxBytes += container.NetworkRxBytes
+		report.NetworkTxBytes += container.NetworkTxBytes
+	}
+	report.DurationSeconds = report.Stop.Sub(report.Start).Seconds()
+	return report
+}
+
+type byContainerName []ContainerUsageReport
+
+func (r byContainerName) Len() int           { return len(r) }
+func (r byContainerName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byContainerName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+
+// InfoLogger writes a line to a log.
+type InfoLogger interface {
+	Info(v ...interface{})
+}
+
+// newAccountingLogger creates the logger for the task accounting log, which
+// gets one json document per stopped task.
+func newAccountingLogger(cfg *config.Config) InfoLogger {
+	if !cfg.TaskAccountingEnabled || cfg.TaskAccountingLogFile == "" {
+		return nil
+	}
+	accountingLogger, err := seelog.LoggerFromConfigAsString(logger.MessageLoggerConfig(cfg.TaskAccountingLogFile))
+	if err != nil {
+		seelog.Errorf("Error creating task accounting logger: %v", err)
+		return nil
+	}
+	return accountingLogger
+}
+
+// usageReports holds the usage reports of stopped tasks until the task
+// cleanup wait duration has elapsed.
+type usageReports struct {
+	lock      sync.RWMutex
+	reports   map[string]*TaskUsageReport
+	expiry    map[string]time.Time
+	retention time.Duration
+	logger    InfoLogger
+}
+
+func newUsageReports(cfg *config.Config) *usageReports {
+	return &usageReports{
+		reports:   make(map[string]*TaskUsageReport),
+		expiry:    make(map[string]time.Time),
+		retention: cfg.TaskCleanupWaitDuration,
+		logger:    newAccountingLogger(cfg),
+	}
+}
+
+// add stores the report and appends it to the accounting log.
+func (r *usageReports) add(report *TaskUsageReport) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.pruneLocked()
+	r.reports[report.TaskArn] = report
+	r.expiry[report.TaskArn] = time.Now().Add(r.retention)
+	seelog.Infof("Task %s used %.2f cpu seconds, %d bytes peak memory over %.0f seconds",
+		report.TaskArn, report.CPUSeconds, report.PeakMemoryBytes, report.DurationSeconds)
+	if r.logger == nil {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		seelog.Warnf("Unable to marshal usage report of task %s: %v", report.TaskArn, err)
+		return
+	}
+	r.logger.Info(string(data))
+}
+
+// get returns the report of a task, if it is still retained.
+func (r *usageReports) get(taskArn string) (*TaskUsageReport, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	report, ok := r.reports[taskArn]
+	if !ok || time.Now().After(r.expiry[taskArn]) {
+		return nil, false
+	}
+	return report, true
+}
+
+// all returns every report that is still retained.
+func (r *usageReports) all() []*TaskUsageReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.pruneLocked()
+	reports := make([]*TaskUsageReport, 0, len(r.reports))
+	for _, report := range r.reports {
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func (r *usageReports) pruneLocked() {
+	now := time.Now()
+	for taskArn, expiry := range r.expiry {
+		if now.After(expiry) {
+			delete(r.reports, taskArn)
+			delete(r.expiry, taskArn)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+//+build !integration
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	ecsengine "github.com/aws/amazon-ecs-agent/agent/engine"
+	mock_resolver "github.com/aws/amazon-ecs-agent/agent/stats/resolver/mock"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInfoLogger struct {
+	lines []string
+}
+
+func (logger *fakeInfoLogger) Info(v ...interface{}) {
+	logger.lines = append(logger.lines, v[0].(string))
+}
+
+func recordFakeUsage(container *StatsContainer, start time.Time, cpuSeconds uint64, memory []uint64) {
+	for i, memoryUsage := range memory {
+		container.usage.record(&ContainerStats{
+			cpuUsage:       cpuSeconds * uint64(time.Second) * uint64(i+1) / uint64(len(memory)) / numCores,
+			memoryUsage:    memoryUsage,
+			timestamp:      start.Add(time.Duration(i) * time.Second),
+			networkRxBytes: uint64(100 * (i + 1)),
+			networkTxBytes: uint64(10 * (i + 1)),
+		})
+	}
+}
+
+func TestUsageAccumulatorReport(t *testing.T) {
+	container := &StatsContainer{}
+	start := time.Now()
+	recordFakeUsage(container, start, 4, []uint64{100, 300, 200})
+
+	report := container.usage.report("web", "c1")
+	assert.Equal(t, "web", report.Name)
+	assert.Equal(t, "c1", report.DockerID)
+	assert.Equal(t, 3, report.Samples)
+	assert.InDelta(t, 4, report.CPUSeconds, 0.001)
+	assert.Equal(t, uint64(300), report.PeakMemoryBytes)
+	assert.Equal(t, uint64(200), report.AverageMemoryBytes)
+	assert.Equal(t, uint64(300), report.NetworkRxBytes)
+	assert.Equal(t, uint64(30), report.NetworkTxBytes)
+	assert.Equal(t, 2.0, report.DurationSeconds)
+}
+
+func TestUsageAccumulatorReportNoSamples(t *testing.T) {
+	container := &StatsContainer{}
+	report := container.usage.report("web", "c1")
+	assert.Equal(t, 0, report.Samples)
+	assert.True(t, report.Start.IsZero())
+}
+
+func TestStatsEngineTaskUsageReportOnTaskStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	resolver := mock_resolver.NewMockContainerMetadataResolver(ctrl)
+	mockDockerClient := ecsengine.NewMockDockerClient(ctrl)
+	t1 := &api.Task{Arn: "t1", Family: "f1", Version: "2"}
+	resolver.EXPECT().ResolveTask("c1").AnyTimes().Return(t1, nil)
+	resolver.EXPECT().ResolveTask("c2").AnyTimes().Return(t1, nil)
+	resolver.EXPECT().ResolveContainer("c1").AnyTimes().Return(&api.DockerContainer{
+		Container: &api.Container{Name: "web"},
+	}, nil)
+	resolver.EXPECT().ResolveContainer("c2").AnyTimes().Return(&api.DockerContainer{
+		Container: &api.Container{Name: "sidecar"},
+	}, nil)
+	mockStatsChannel := make(chan *docker.Stats)
+	defer close(mockStatsChannel)
+	mockDockerClient.EXPECT().Stats(gomock.Any(), gomock.Any()).Return(mockStatsChannel, nil).AnyTimes()
+
+	engine := NewDockerStatsEngine(&cfg, nil, eventStream("TestStatsEngineTaskUsageReportOnTaskStop"))
+	engine.resolver = resolver
+	engine.client = mockDockerClient
+	accountingLog := &fakeInfoLogger{}
+	engine.usageReports.logger = accountingLog
+	defer engine.removeAll()
+
+	engine.addContainer("c1")
+	engine.addContainer("c2")
+	start := time.Now()
+	recordFakeUsage(engine.tasksToContainers["t1"]["c1"], start, 3, []uint64{100, 200})
+	recordFakeUsage(engine.tasksToContainers["t1"]["c2"], start.Add(time.Second), 1, []uint64{50, 50, 50})
+
+	engine.removeContainer("c1")
+	_, found := engine.TaskUsageReport("t1")
+	assert.False(t, found, "Expected no report while the task has running containers")
+
+	engine.removeContainer("c2")
+	_, found = engine.TaskUsageReport("t1")
+	assert.False(t, found, "Expected no report before the task stops")
+
+	engine.taskStopped("t1")
+	report, found := engine.TaskUsageReport("t1")
+	require.True(t, found, "Expected report once the task stopped")
+	assert.Equal(t, "f1", report.TaskDefinitionFamily)
+	assert.Equal(t, "2", report.TaskDefinitionVersion)
+	assert.InDelta(t, 4, report.CPUSeconds, 0.001)
+	assert.Equal(t, uint64(250), report.PeakMemoryBytes)
+	assert.Equal(t, uint64(200), report.AverageMemoryBytes)
+	assert.Equal(t, uint64(500), report.NetworkRxBytes)
+	assert.Equal(t, uint64(50), report.NetworkTxBytes)
+	assert.Equal(t, start, report.Start)
+	assert.Equal(t, 3.0, report.DurationSeconds)
+	require.Len(t, report.Containers, 2)
+	assert.Equal(t, "sidecar", report.Containers[0].Name)
+	assert.Equal(t, "web", report.Containers[1].Name)
+	assert.Len(t, engine.TaskUsageReports(), 1)
+
+	require.Len(t, accountingLog.lines, 1)
+	var logged TaskUsageReport
+	require.NoError(t, json.Unmarshal([]byte(accountingLog.lines[0]), &logged))
+	assert.Equal(t, "t1", logged.TaskArn)
+	assert.Len(t, logged.Containers, 2)
+}
+
+func TestStatsEngineTaskUsageReportAfterEarlyContainerExit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	resolver := mock_resolver.NewMockContainerMetadataResolver(ctrl)
+	mockDockerClient := ecsengine.NewMockDockerClient(ctrl)
+	t1 := &api.Task{Arn: "t1", Family: "f1", Version: "2"}
+	for _, dockerID := range []string{"init", "web"} {
+		resolver.EXPECT().ResolveTask(dockerID).AnyTimes().Return(t1, nil)
+		resolver.EXPECT().ResolveContainer(dockerID).AnyTimes().Return(&api.DockerContainer{
+			Container: &api.Container{Name: dockerID},
+		}, nil)
+	}
+	mockStatsChannel := make(chan *docker.Stats)
+	defer close(mockStatsChannel)
+	mockDockerClient.EXPECT().Stats(gomock.Any(), gomock.Any()).Return(mockStatsChannel, nil).AnyTimes()
+
+	engine := NewDockerStatsEngine(&cfg, nil, eventStream("TestStatsEngineTaskUsageReportAfterEarlyContainerExit"))
+	engine.resolver = resolver
+	engine.client = mockDockerClient
+	defer engine.removeAll()
+
+	// The init container exits before the web container starts
+	engine.addContainer("init")
+	engine.removeContainer("init")
+	_, found := engine.TaskUsageReport("t1")
+	assert.False(t, found, "Expected no report while the task is running")
+	engine.addContainer("web")
+
+	engine.HandleStateChange(api.TaskStateChange{TaskArn: "t1", Status: api.TaskRunning})
+	_, found = engine.TaskUsageReport("t1")
+	assert.False(t, found, "Expected no report while the task is running")
+	engine.HandleStateChange(api.TaskStateChange{TaskArn: "t1", Status: api.TaskStopped})
+
+	report, found := engine.TaskUsageReport("t1")
+	require.True(t, found, "Expected report once the task stopped")
+	require.Len(t, report.Containers, 2)
+	assert.Equal(t, "init", report.Containers[0].Name)
+	assert.Equal(t, "web", report.Containers[1].Name)
+}
+
+func TestUsageReportsExpire(t *testing.T) {
+	reports := newUsageReports(&cfg)
+	reports.retention = -time.Second
+	reports.add(&TaskUsageReport{TaskArn: "t1"})
+
+	_, found := reports.get("t1")
+	assert.False(t, found)
+	assert.Empty(t, reports.all())
+}
+
+func TestAccountingLoggerDisabled(t *testing.T) {
+	testCfg := cfg
+	testCfg.TaskAccountingEnabled = false
+	assert.Nil(t, newAccountingLogger(&testCfg))
+
+	testCfg.TaskAccountingEnabled = true
+	testCfg.TaskAccountingLogFile = ""
+	assert.Nil(t, newAccountingLogger(&testCfg))
+}
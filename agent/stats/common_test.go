@@ -23,6 +23,7 @@ import (
 	ecsengine "github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/logger/audit"
 	"github.com/aws/amazon-ecs-agent/agent/statechange"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
@@ -63,7 +64,7 @@ var defaultContainerInstance = "ci"
 
 func init() {
 	cfg.EngineAuthData = config.NewSensitiveRawMessage([]byte{})
-	dockerClient, _ = ecsengine.NewDockerGoClient(clientFactory, &cfg)
+	dockerClient, _ = ecsengine.NewDockerGoClient(context.TODO(), clientFactory, &cfg, nil)
 }
 
 // eventStream returns the event stream used to receive container change events
@@ -173,8 +174,8 @@ func validateMetricsMetadata(metadata *ecstcs.MetricsMetadata) error {
 
 func createFakeContainerStats() []*ContainerStats {
 	return []*ContainerStats{
-		{22400432, 1839104, parseNanoTime("2015-02-12T21:22:05.131117533Z")},
-		{116499979, 3649536, parseNanoTime("2015-02-12T21:22:05.232291187Z")},
+		{cpuUsage: 22400432, memoryUsage: 1839104, timestamp: parseNanoTime("2015-02-12T21:22:05.131117533Z")},
+		{cpuUsage: 116499979, memoryUsage: 3649536, timestamp: parseNanoTime("2015-02-12T21:22:05.232291187Z")},
 	}
 }
 
@@ -194,6 +195,9 @@ func (engine *MockTaskEngine) StateChangeEvents() <-chan statechange.Event {
 func (engine *MockTaskEngine) SetSaver(statemanager.Saver) {
 }
 
+func (engine *MockTaskEngine) SetAuditLogger(audit.AuditLogger) {
+}
+
 func (engine *MockTaskEngine) AddTask(*api.Task) error {
 	return nil
 }
@@ -17,6 +17,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/cgroup"
 	ecsengine "github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/stats/resolver"
 	"github.com/cihub/seelog"
@@ -38,10 +39,11 @@ func newStatsContainer(dockerID string, client ecsengine.DockerClient, resolver
 		containerMetadata: &ContainerMetadata{
 			DockerID: dockerID,
 		},
-		ctx:      ctx,
-		cancel:   cancel,
-		client:   client,
-		resolver: resolver,
+		ctx:        ctx,
+		cancel:     cancel,
+		client:     client,
+		resolver:   resolver,
+		cgroupInfo: cgroup.Detect(),
 	}
 }
 
@@ -104,10 +106,15 @@ func (container *StatsContainer) processStatsStream() error {
 	if err != nil {
 		return err
 	}
+	unified := container.cgroupInfo.Unified()
 	for rawStat := range dockerStats {
-		stat, err := dockerStatsToContainerStats(rawStat)
+		stat, err := dockerStatsToContainerStats(rawStat, unified)
 		if err == nil {
+			if unified {
+				container.readUnifiedCPUUsage(stat)
+			}
 			container.statsQueue.Add(stat)
+			container.usage.record(stat)
 		} else {
 			seelog.Warnf("Error converting stats for container %s: %v", dockerID, err)
 		}
@@ -115,6 +122,18 @@ func (container *StatsContainer) processStatsStream() error {
 	return nil
 }
 
+// readUnifiedCPUUsage replaces the cpu usage reported by docker with the
+// value read from the container's cpu.stat, when the cgroup filesystem is
+// visible to the agent.
+func (container *StatsContainer) readUnifiedCPUUsage(stat *ContainerStats) {
+	cpuStat, err := cgroup.ContainerCPUStat(container.containerMetadata.DockerID)
+	if err != nil {
+		seelog.Tracef("Using docker reported cpu usage for container %s: %v", container.containerMetadata.DockerID, err)
+		return
+	}
+	stat.cpuUsage = cpuStat.UsageNanos() / numCores
+}
+
 func (container *StatsContainer) terminal() (bool, error) {
 	dockerContainer, err := container.resolver.ResolveContainer(container.containerMetadata.DockerID)
 	if err != nil {
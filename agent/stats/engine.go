@@ -28,6 +28,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	ecsengine "github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
 	"github.com/aws/amazon-ecs-agent/agent/stats/resolver"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
 	"github.com/aws/aws-sdk-go/aws"
@@ -64,6 +65,10 @@ type DockerStatsEngine struct {
 	tasksToContainers map[string]map[string]*StatsContainer
 	// tasksToDefinitions maps task arns to task definiton name and family metadata objects.
 	tasksToDefinitions map[string]*taskDefinition
+	// tasksToUsage maps task arns to the usage reports of their containers
+	// that have already stopped, until the task stops.
+	tasksToUsage map[string][]ContainerUsageReport
+	usageReports *usageReports
 }
 
 var EmptyMetricsError = errors.New("No task metrics to report")
@@ -102,6 +107,8 @@ func NewDockerStatsEngine(cfg *config.Config, client ecsengine.DockerClient, con
 		resolver:                   nil,
 		tasksToContainers:          make(map[string]map[string]*StatsContainer),
 		tasksToDefinitions:         make(map[string]*taskDefinition),
+		tasksToUsage:               make(map[string][]ContainerUsageReport),
+		usageReports:               newUsageReports(cfg),
 		containerChangeEventStream: containerChangeEventStream,
 	}
 }
@@ -292,6 +299,12 @@ func (engine *DockerStatsEngine) addContainer(dockerID string) {
 		return
 	}
 
+	// Local tasks are unknown to ECS, their metrics are not published
+	if task.Local {
+		seelog.Debugf("Task is local, ignoring, id: %s", dockerID)
+		return
+	}
+
 	if err != nil {
 		seelog.Debugf("Could not get name for container, ignoring, err: %v, id: %s", err, dockerID)
 		return
@@ -433,17 +446,73 @@ func (engine *DockerStatsEngine) doRemoveContainer(container *StatsContainer, ta
 	dockerID := container.containerMetadata.DockerID
 	delete(engine.tasksToContainers[taskArn], dockerID)
 	seelog.Debugf("Deleted container from tasks, id: %s", dockerID)
+	// The usage of the task is only final once the task stops, other
+	// containers of the task may still start
+	engine.tasksToUsage[taskArn] = append(engine.tasksToUsage[taskArn],
+		container.usage.report(engine.containerName(dockerID), dockerID))
 
 	if len(engine.tasksToContainers[taskArn]) == 0 {
 		// No containers in task, delete task arn from map.
 		delete(engine.tasksToContainers, taskArn)
-		// No need to verify if the key exists in tasksToDefinitions.
-		// Delete will do nothing if the specified key doesn't exist.
-		delete(engine.tasksToDefinitions, taskArn)
 		seelog.Debugf("Deleted task from tasks, arn: %s", taskArn)
 	}
 }
 
+// HandleStateChange finalizes the usage report of a task when the engine
+// emits its STOPPED state change.
+func (engine *DockerStatsEngine) HandleStateChange(change statechange.Event) {
+	taskChange, ok := change.(api.TaskStateChange)
+	if !ok || taskChange.Status != api.TaskStopped {
+		return
+	}
+	engine.taskStopped(taskChange.TaskArn)
+}
+
+// taskStopped adds the usage report of a stopped task. Containers of the task
+// that are still watched, because their stop wasn't handled yet, are removed
+// first.
+func (engine *DockerStatsEngine) taskStopped(taskArn string) {
+	engine.containersLock.Lock()
+	defer engine.containersLock.Unlock()
+
+	for _, container := range engine.tasksToContainers[taskArn] {
+		engine.doRemoveContainer(container, taskArn)
+	}
+	usage, ok := engine.tasksToUsage[taskArn]
+	if !ok {
+		// None of the containers of the task were watched
+		return
+	}
+	engine.usageReports.add(newTaskUsageReport(taskArn, engine.tasksToDefinitions[taskArn], usage))
+	delete(engine.tasksToUsage, taskArn)
+	// No need to verify if the key exists in tasksToDefinitions.
+	// Delete will do nothing if the specified key doesn't exist.
+	delete(engine.tasksToDefinitions, taskArn)
+}
+
+// containerName returns the name of the container in its task definition,
+// falling back to the docker id if the container is no longer known to the
+// task engine.
+func (engine *DockerStatsEngine) containerName(dockerID string) string {
+	dockerContainer, err := engine.resolver.ResolveContainer(dockerID)
+	if err != nil || dockerContainer.Container == nil || dockerContainer.Container.Name == "" {
+		return dockerID
+	}
+	return dockerContainer.Container.Name
+}
+
+// TaskUsageReports returns the usage reports of the tasks that stopped within
+// the task cleanup wait duration.
+func (engine *DockerStatsEngine) TaskUsageReports() []*TaskUsageReport {
+	return engine.usageReports.all()
+}
+
+// TaskUsageReport returns the usage report of a stopped task, if the task
+// stopped within the task cleanup wait duration.
+func (engine *DockerStatsEngine) TaskUsageReport(taskArn string) (*TaskUsageReport, bool) {
+	return engine.usageReports.get(taskArn)
+}
+
 // resetStats resets stats for all watched containers.
 func (engine *DockerStatsEngine) resetStats() {
 	engine.containersLock.Lock()
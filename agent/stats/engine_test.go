@@ -179,8 +179,8 @@ func TestStatsEngineMetadataInStatsSets(t *testing.T) {
 	engine.client = mockDockerClient
 	engine.addContainer("c1")
 	containerStats := []*ContainerStats{
-		{22400432, 1839104, parseNanoTime("2015-02-12T21:22:05.131117533Z")},
-		{116499979, 3649536, parseNanoTime("2015-02-12T21:22:05.232291187Z")},
+		{cpuUsage: 22400432, memoryUsage: 1839104, timestamp: parseNanoTime("2015-02-12T21:22:05.131117533Z")},
+		{cpuUsage: 116499979, memoryUsage: 3649536, timestamp: parseNanoTime("2015-02-12T21:22:05.232291187Z")},
 	}
 	containers, _ := engine.tasksToContainers["t1"]
 	for _, statsContainer := range containers {
@@ -259,3 +259,27 @@ func TestStatsEngineTerminalTask(t *testing.T) {
 		t.Fatalf("Error validating metadata: %v", err)
 	}
 }
+
+func TestStatsEngineLocalTask(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	resolver := mock_resolver.NewMockContainerMetadataResolver(mockCtrl)
+	resolver.EXPECT().ResolveTask("c1").Return(&api.Task{
+		Arn:               "local/t1",
+		KnownStatusUnsafe: api.TaskRunning,
+		Family:            "f1",
+		Local:             true,
+	}, nil)
+	engine := NewDockerStatsEngine(&cfg, nil, eventStream("TestStatsEngineLocalTask"))
+	defer engine.removeAll()
+
+	engine.cluster = defaultCluster
+	engine.containerInstanceArn = defaultContainerInstance
+	engine.resolver = resolver
+
+	engine.addContainer("c1")
+	err := validateIdleContainerMetrics(engine)
+	if err != nil {
+		t.Fatalf("Error validating metadata: %v", err)
+	}
+}
@@ -16,16 +16,21 @@ package stats
 import (
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/cgroup"
 	ecsengine "github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/stats/resolver"
 	"golang.org/x/net/context"
 )
 
 // ContainerStats encapsulates the raw CPU and memory utilization from cgroup fs.
+// cpuUsage is in nanoseconds per core, for both cgroup v1 and v2. Network
+// byte counts are cumulative across all interfaces of the container.
 type ContainerStats struct {
-	cpuUsage    uint64
-	memoryUsage uint64
-	timestamp   time.Time
+	cpuUsage       uint64
+	memoryUsage    uint64
+	timestamp      time.Time
+	networkRxBytes uint64
+	networkTxBytes uint64
 }
 
 // UsageStats abstracts the format in which the queue stores data.
@@ -49,6 +54,8 @@ type StatsContainer struct {
 	client            ecsengine.DockerClient
 	statsQueue        *Queue
 	resolver          resolver.ContainerMetadataResolver
+	cgroupInfo        cgroup.Info
+	usage             usageAccumulator
 }
 
 // taskDefinition encapsulates family and version strings for a task definition
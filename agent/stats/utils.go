@@ -36,7 +36,13 @@ func nan32() float32 {
 }
 
 // dockerStatsToContainerStats returns a new object of the ContainerStats object from docker stats.
-func dockerStatsToContainerStats(dockerStats *docker.Stats) (*ContainerStats, error) {
+// On a cgroup v2 (unified) hierarchy, docker does not report per-cpu usage and
+// memory usage has to exclude the inactive file cache rather than the v1
+// "cache" counter.
+func dockerStatsToContainerStats(dockerStats *docker.Stats, unified bool) (*ContainerStats, error) {
+	if unified {
+		return unifiedDockerStatsToContainerStats(dockerStats)
+	}
 	// The length of PercpuUsage represents the number of cores in an instance.
 	if len(dockerStats.CPUStats.CPUUsage.PercpuUsage) == 0 {
 		seelog.Debug("Invalid container statistics reported, invalid stats payload from docker")
@@ -45,13 +51,56 @@ func dockerStatsToContainerStats(dockerStats *docker.Stats) (*ContainerStats, er
 
 	cpuUsage := dockerStats.CPUStats.CPUUsage.TotalUsage / numCores
 	memoryUsage := dockerStats.MemoryStats.Usage - dockerStats.MemoryStats.Stats.Cache
+	rxBytes, txBytes := networkBytes(dockerStats)
 	return &ContainerStats{
-		cpuUsage:    cpuUsage,
-		memoryUsage: memoryUsage,
-		timestamp:   dockerStats.Read,
+		cpuUsage:       cpuUsage,
+		memoryUsage:    memoryUsage,
+		timestamp:      dockerStats.Read,
+		networkRxBytes: rxBytes,
+		networkTxBytes: txBytes,
 	}, nil
 }
 
+// unifiedDockerStatsToContainerStats converts docker stats gathered from a
+// cgroup v2 hierarchy. Docker derives total_usage from usage_usec in cpu.stat
+// there, and leaves percpu_usage empty.
+func unifiedDockerStatsToContainerStats(dockerStats *docker.Stats) (*ContainerStats, error) {
+	if dockerStats.CPUStats.CPUUsage.TotalUsage == 0 && dockerStats.MemoryStats.Usage == 0 {
+		seelog.Debug("Invalid container statistics reported, invalid stats payload from docker")
+		return nil, fmt.Errorf("Invalid container statistics reported")
+	}
+
+	cpuUsage := dockerStats.CPUStats.CPUUsage.TotalUsage / numCores
+	memoryUsage := dockerStats.MemoryStats.Usage
+	inactiveFile := dockerStats.MemoryStats.Stats.InactiveFile
+	if inactiveFile < memoryUsage {
+		memoryUsage -= inactiveFile
+	}
+	rxBytes, txBytes := networkBytes(dockerStats)
+	return &ContainerStats{
+		cpuUsage:       cpuUsage,
+		memoryUsage:    memoryUsage,
+		timestamp:      dockerStats.Read,
+		networkRxBytes: rxBytes,
+		networkTxBytes: txBytes,
+	}, nil
+}
+
+// networkBytes returns the bytes received and transmitted by the container,
+// summed over its interfaces. Older docker versions only report the stats of
+// a single interface.
+func networkBytes(dockerStats *docker.Stats) (uint64, uint64) {
+	if len(dockerStats.Networks) == 0 {
+		return dockerStats.Network.RxBytes, dockerStats.Network.TxBytes
+	}
+	var rxBytes, txBytes uint64
+	for _, network := range dockerStats.Networks {
+		rxBytes += network.RxBytes
+		txBytes += network.TxBytes
+	}
+	return rxBytes, txBytes
+}
+
 // parseNanoTime returns the time object from a string formatted with RFC3339Nano layout.
 func parseNanoTime(value string) time.Time {
 	ts, _ := time.Parse(time.RFC3339Nano, value)
@@ -54,7 +54,7 @@ func TestDockerStatsToContainerStatsCpuUsage(t *testing.T) {
 		}`, 1, 2, 3, 4, 100)
 	dockerStat := &docker.Stats{}
 	json.Unmarshal([]byte(jsonStat), dockerStat)
-	containerStats, err := dockerStatsToContainerStats(dockerStat)
+	containerStats, err := dockerStatsToContainerStats(dockerStat, false)
 	if err != nil {
 		t.Errorf("Error converting container stats: %v", err)
 	}
@@ -79,7 +79,7 @@ func TestDockerStatsToContainerStatsZeroCoresGeneratesError(t *testing.T) {
 		}`, 100)
 	dockerStat := &docker.Stats{}
 	json.Unmarshal([]byte(jsonStat), dockerStat)
-	_, err := dockerStatsToContainerStats(dockerStat)
+	_, err := dockerStatsToContainerStats(dockerStat, false)
 	if err == nil {
 		t.Error("Expected error converting container stats with empty PercpuUsage")
 	}
@@ -105,7 +105,7 @@ func TestDockerStatsToContainerStatsMemUsage(t *testing.T) {
 		}`, 1, 2, 3, 4, 100, 30, 100, 20, 10)
 	dockerStat := &docker.Stats{}
 	json.Unmarshal([]byte(jsonStat), dockerStat)
-	containerStats, err := dockerStatsToContainerStats(dockerStat)
+	containerStats, err := dockerStatsToContainerStats(dockerStat, false)
 	if err != nil {
 		t.Errorf("Error converting container stats: %v", err)
 	}
@@ -116,3 +116,44 @@ func TestDockerStatsToContainerStatsMemUsage(t *testing.T) {
 		t.Error("Unexpected value for memoryUsage", containerStats.memoryUsage)
 	}
 }
+
+func TestDockerStatsToContainerStatsUnified(t *testing.T) {
+	numCores = 4
+	// cgroup v2 stats carry no percpu_usage and no cache counter
+	jsonStat := fmt.Sprintf(`
+		{
+			"cpu_stats":{
+				"cpu_usage":{
+					"total_usage":%d
+				}
+			},
+			"memory_stats":{
+				"usage": %d,
+				"stats": {
+					"anon": %d,
+					"file": %d,
+					"inactive_file": %d
+				}
+			}
+		}`, 100, 100, 40, 60, 50)
+	dockerStat := &docker.Stats{}
+	json.Unmarshal([]byte(jsonStat), dockerStat)
+	containerStats, err := dockerStatsToContainerStats(dockerStat, true)
+	if err != nil {
+		t.Fatalf("Error converting container stats: %v", err)
+	}
+	if containerStats.cpuUsage != 25 {
+		t.Error("Unexpected value for cpuUsage", containerStats.cpuUsage)
+	}
+	if containerStats.memoryUsage != 50 {
+		t.Error("Unexpected value for memoryUsage", containerStats.memoryUsage)
+	}
+}
+
+func TestDockerStatsToContainerStatsUnifiedEmptyGeneratesError(t *testing.T) {
+	dockerStat := &docker.Stats{}
+	_, err := dockerStatsToContainerStats(dockerStat, true)
+	if err == nil {
+		t.Error("Expected error converting empty container stats")
+	}
+}
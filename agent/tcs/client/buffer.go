@@ -0,0 +1,167 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcsclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/cihub/seelog"
+)
+
+// DefaultMetricsBufferSize is the number of publish metrics requests kept
+// while the connection to the backend is down. With the default publish
+// interval of 20 seconds and up to a few requests per interval, this covers
+// a disconnection of well over half an hour.
+const DefaultMetricsBufferSize = 500
+
+// MetricsBufferStats reports the state of a MetricsBuffer.
+type MetricsBufferStats struct {
+	// Pending is the number of requests waiting to be sent
+	Pending int
+	// Dropped is the number of requests discarded because the buffer was full
+	Dropped uint64
+	// Replayed is the number of requests sent in a later publish cycle than
+	// the one they were collected in
+	Replayed uint64
+	// LastPublishLatency is the time the last publish cycle took to send all
+	// of its requests
+	LastPublishLatency time.Duration
+}
+
+// MetricsBuffer is a bounded ring of publish metrics requests that could not
+// be sent to the backend yet. It outlives individual telemetry sessions, so
+// that metrics collected while disconnected are replayed, in order and with
+// their original timestamps, once a new session is established. When full,
+// the oldest requests are dropped.
+type MetricsBuffer struct {
+	lock           sync.Mutex
+	requests       []*ecstcs.PublishMetricsRequest
+	maxSize        int
+	dropped        uint64
+	replayed       uint64
+	lastCollected  time.Time
+	publishLatency time.Duration
+}
+
+// NewMetricsBuffer returns a MetricsBuffer that holds at most maxSize requests.
+func NewMetricsBuffer(maxSize int) *MetricsBuffer {
+	return &MetricsBuffer{
+		maxSize: maxSize,
+	}
+}
+
+// add appends requests to the back of the buffer, dropping the oldest ones
+// if there is not enough room.
+func (buffer *MetricsBuffer) add(requests ...*ecstcs.PublishMetricsRequest) {
+	if len(requests) == 0 {
+		return
+	}
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	buffer.lastCollected = time.Now()
+	buffer.requests = append(buffer.requests, requests...)
+	if overflow := len(buffer.requests) - buffer.maxSize; overflow > 0 {
+		seelog.Warnf("Metrics buffer full, dropping %d oldest publish metrics requests", overflow)
+		buffer.requests = buffer.requests[overflow:]
+		buffer.dropped += uint64(overflow)
+	}
+}
+
+// front returns the oldest request in the buffer, or nil if it is empty.
+func (buffer *MetricsBuffer) front() *ecstcs.PublishMetricsRequest {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if len(buffer.requests) == 0 {
+		return nil
+	}
+	return buffer.requests[0]
+}
+
+// remove removes request from the front of the buffer after it has been
+// sent. It is a no-op if request has been dropped in the meantime.
+func (buffer *MetricsBuffer) remove(request *ecstcs.PublishMetricsRequest, replayed bool) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if len(buffer.requests) == 0 || buffer.requests[0] != request {
+		return
+	}
+	buffer.requests[0] = nil
+	buffer.requests = buffer.requests[1:]
+	if replayed {
+		buffer.replayed++
+	}
+}
+
+// len returns the number of requests in the buffer.
+func (buffer *MetricsBuffer) len() int {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	return len(buffer.requests)
+}
+
+// sinceLastCollection returns the time elapsed since requests were last
+// added to the buffer.
+func (buffer *MetricsBuffer) sinceLastCollection() time.Duration {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	return time.Since(buffer.lastCollected)
+}
+
+// recordPublishLatency records the duration of a publish cycle.
+func (buffer *MetricsBuffer) recordPublishLatency(latency time.Duration) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	buffer.publishLatency = latency
+	seelog.Debugf("Publish metrics cycle took %v", latency)
+}
+
+// Stats returns the number of pending, dropped and replayed requests, and
+// the latency of the last publish cycle.
+func (buffer *MetricsBuffer) Stats() MetricsBufferStats {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	return MetricsBufferStats{
+		Pending:            len(buffer.requests),
+		Dropped:            buffer.dropped,
+		Replayed:           buffer.replayed,
+		LastPublishLatency: buffer.publishLatency,
+	}
+}
+
+// BufferMetrics collects metrics from the stats engine into the buffer while
+// there is no connection to publish them on. Collection is skipped if the
+// last one happened less than interval ago, since the stats engine already
+// aggregates samples over that period.
+func BufferMetrics(statsEngine stats.Engine, buffer *MetricsBuffer, interval time.Duration) error {
+	if buffer.sinceLastCollection() < interval {
+		return nil
+	}
+	requests, err := metricsToPublishMetricRequests(statsEngine, maxTaskMetricsBytes)
+	if err != nil {
+		return err
+	}
+	buffer.add(requests...)
+	seelog.Debugf("Buffered %d publish metrics requests while disconnected, stats: %+v", len(requests), buffer.Stats())
+	return nil
+}
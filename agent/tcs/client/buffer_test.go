@@ -0,0 +1,56 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcsclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsBufferDropsOldest(t *testing.T) {
+	buffer := NewMetricsBuffer(2)
+	first := &ecstcs.PublishMetricsRequest{}
+	second := &ecstcs.PublishMetricsRequest{}
+	third := &ecstcs.PublishMetricsRequest{}
+
+	buffer.add(first, second)
+	buffer.add(third)
+
+	assert.Equal(t, second, buffer.front())
+	assert.Equal(t, MetricsBufferStats{Pending: 2, Dropped: 1}, buffer.Stats())
+
+	buffer.remove(second, true)
+	assert.Equal(t, third, buffer.front())
+	assert.Equal(t, MetricsBufferStats{Pending: 1, Dropped: 1, Replayed: 1}, buffer.Stats())
+
+	// Removing a request that is no longer at the front is a no-op
+	buffer.remove(second, true)
+	assert.Equal(t, MetricsBufferStats{Pending: 1, Dropped: 1, Replayed: 1}, buffer.Stats())
+}
+
+func TestBufferMetricsRespectsInterval(t *testing.T) {
+	buffer := NewMetricsBuffer(DefaultMetricsBufferSize)
+
+	err := BufferMetrics(newNonIdleStatsEngine(1), buffer, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, buffer.len())
+
+	// The last collection was less than an hour ago
+	err = BufferMetrics(newNonIdleStatsEngine(1), buffer, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, buffer.len())
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
@@ -27,32 +28,67 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
 	"github.com/cihub/seelog"
 )
 
-// tasksInMessage is the maximum number of tasks that can be sent in a message to the backend
-// This is a very conservative estimate assuming max allowed string lengths for all fields.
-const tasksInMessage = 10
+const (
+	// publishMetricsFrameLimit keeps each publish metrics request within a
+	// single frame of the websocket connection.
+	publishMetricsFrameLimit = wsclient.MaxFrameSize
+	// publishMetricsEnvelopeSize is the part of the frame reserved for the
+	// message type and the metrics metadata. The metadata holds the cluster
+	// and container instance arns and the message id, which stay well under
+	// 4 KiB.
+	publishMetricsEnvelopeSize = 4 * 1024
+	// maxTaskMetricsBytes is the budget for the serialized task metrics in a
+	// single publish metrics request.
+	maxTaskMetricsBytes = publishMetricsFrameLimit - publishMetricsEnvelopeSize
+
+	// publishRetries is the number of times a publish metrics request is
+	// attempted before it is left in the buffer for the next publish cycle.
+	publishRetries         = 3
+	publishRetryMinBackoff = 250 * time.Millisecond
+	publishRetryMaxBackoff = 1 * time.Second
+	publishRetryJitter     = 0.2
+	publishRetryMultiplier = 2
+)
 
 // clientServer implements wsclient.ClientServer interface for metrics backend.
 type clientServer struct {
-	statsEngine            stats.Engine
-	publishTicker          *time.Ticker
-	endPublish             chan struct{}
+	statsEngine   stats.Engine
+	publishTicker *time.Ticker
+	endPublish    chan struct{}
+	// publishLock guards stopping the publish ticker, which both Close and
+	// Shutdown may do
+	publishLock            sync.Mutex
 	publishMetricsInterval time.Duration
+	metricsBuffer          *MetricsBuffer
+	// maxTaskMetricsBytes is the budget for the task metrics in one request
+	maxTaskMetricsBytes int
 	wsclient.ClientServerImpl
 }
 
 // New returns a client/server to bidirectionally communicate with the backend.
 // The returned struct should have both 'Connect' and 'Serve' called upon it
-// before being used.
-func New(url string, cfg *config.Config, credentialProvider *credentials.Credentials, statsEngine stats.Engine, publishMetricsInterval time.Duration) wsclient.ClientServer {
+// before being used. Requests that cannot be sent are kept in metricsBuffer
+// and replayed on the next publish, which may happen on a later connection.
+// The health of the connection is recorded in connectionStats, which may be
+// nil.
+func New(url string, cfg *config.Config, credentialProvider *credentials.Credentials, statsEngine stats.Engine,
+	publishMetricsInterval time.Duration, metricsBuffer *MetricsBuffer, connectionStats *wsclient.ConnectionStats) wsclient.ClientServer {
+	if metricsBuffer == nil {
+		metricsBuffer = NewMetricsBuffer(DefaultMetricsBufferSize)
+	}
 	cs := &clientServer{
 		statsEngine:            statsEngine,
 		publishTicker:          nil,
 		publishMetricsInterval: publishMetricsInterval,
+		metricsBuffer:          metricsBuffer,
+		maxTaskMetricsBytes:    maxTaskMetricsBytes,
 	}
 	cs.URL = url
+	cs.Stats = connectionStats
 	cs.AgentConfig = cfg
 	cs.CredentialProvider = credentialProvider
 	cs.ServiceError = &tcsError{}
@@ -75,9 +111,11 @@ func (cs *clientServer) Serve() error {
 	}
 
 	// Start the timer function to publish metrics to the backend.
+	cs.publishLock.Lock()
 	cs.publishTicker = time.NewTicker(cs.publishMetricsInterval)
 	cs.endPublish = make(chan struct{})
-	go cs.publishMetrics()
+	go cs.publishMetrics(cs.publishTicker, cs.endPublish)
+	cs.publishLock.Unlock()
 
 	return cs.ConsumeMessages()
 }
@@ -118,17 +156,41 @@ func (cs *clientServer) signRequest(payload []byte) []byte {
 
 // Close closes the underlying connection.
 func (cs *clientServer) Close() error {
+	cs.stopPublishing()
+	return cs.Disconnect()
+}
+
+// Shutdown publishes the metrics collected since the last publish and then
+// closes the connection cleanly. Requests that cannot be sent are left in the
+// metrics buffer.
+func (cs *clientServer) Shutdown() error {
+	cs.stopPublishing()
+	if cs.statsEngine != nil && cs.IsReady() {
+		seelog.Info("Publishing metrics before closing the TCS connection")
+		err := cs.publishMetricsOnce()
+		if err != nil && err != stats.EmptyMetricsError {
+			seelog.Warnf("Error publishing metrics before closing the connection: %v", err)
+		}
+	}
+	return cs.ClientServerImpl.Shutdown()
+}
+
+// stopPublishing stops the periodic publishing of metrics and waits for an
+// in-flight publish to finish. It is safe to call more than once.
+func (cs *clientServer) stopPublishing() {
+	cs.publishLock.Lock()
+	defer cs.publishLock.Unlock()
+
 	if cs.publishTicker != nil {
 		cs.publishTicker.Stop()
 		cs.endPublish <- struct{}{}
+		cs.publishTicker = nil
 	}
-
-	return cs.Disconnect()
 }
 
 // publishMetrics invokes the PublishMetricsRequest on the clientserver object.
-func (cs *clientServer) publishMetrics() {
-	if cs.publishTicker == nil {
+func (cs *clientServer) publishMetrics(publishTicker *time.Ticker, endPublish chan struct{}) {
+	if publishTicker == nil {
 		seelog.Debug("Skipping publishing metrics. Publish ticker is uninitialized")
 		return
 	}
@@ -143,31 +205,64 @@ func (cs *clientServer) publishMetrics() {
 	// don't simply range over the ticker since its channel doesn't ever get closed
 	for {
 		select {
-		case <-cs.publishTicker.C:
+		case <-publishTicker.C:
 			err := cs.publishMetricsOnce()
 			if err != nil {
 				seelog.Warnf("Error publishing metrics: %v", err)
 			}
-		case <-cs.endPublish:
+		case <-endPublish:
 			return
 		}
 	}
 }
 
 // publishMetricsOnce is invoked by the ticker to periodically publish metrics to backend.
+// New requests are queued behind the ones that could not be sent earlier, so
+// that the backend receives them in the order they were collected.
 func (cs *clientServer) publishMetricsOnce() error {
+	start := time.Now()
+	defer func() {
+		cs.metricsBuffer.recordPublishLatency(time.Since(start))
+	}()
+	carriedOver := cs.metricsBuffer.len()
+
 	// Get the list of objects to send to backend.
-	requests, err := cs.metricsToPublishMetricRequests()
+	requests, metricsErr := cs.metricsToPublishMetricRequests()
+	cs.metricsBuffer.add(requests...)
+
+	// Make the publish metrics request to the backend.
+	err := cs.publishBufferedMetrics(carriedOver)
 	if err != nil {
 		return err
 	}
+	return metricsErr
+}
 
-	// Make the publish metrics request to the backend.
-	for _, request := range requests {
-		err = cs.MakeRequest(request)
+// publishBufferedMetrics sends all buffered requests, oldest first. The
+// first numReplayed requests were collected in earlier publish cycles. A
+// request is only removed from the buffer once it has been written.
+func (cs *clientServer) publishBufferedMetrics(numReplayed int) error {
+	sent := 0
+	for request := cs.metricsBuffer.front(); request != nil; request = cs.metricsBuffer.front() {
+		start := time.Now()
+		backoff := utils.NewSimpleBackoff(publishRetryMinBackoff, publishRetryMaxBackoff, publishRetryJitter, publishRetryMultiplier)
+		err := utils.RetryNWithBackoff(backoff, publishRetries, func() error {
+			err := cs.MakeRequest(request)
+			if err != nil {
+				seelog.Debugf("Error publishing metrics request %s, retrying: %v", aws.StringValue(request.Metadata.MessageId), err)
+			}
+			return err
+		})
 		if err != nil {
+			seelog.Warnf("Error publishing metrics, keeping %d requests for later, stats: %+v", cs.metricsBuffer.len(), cs.metricsBuffer.Stats())
 			return err
 		}
+		seelog.Debugf("Published metrics request with %d tasks in %v", len(request.TaskMetrics), time.Since(start))
+		cs.metricsBuffer.remove(request, sent < numReplayed)
+		sent++
+	}
+	if numReplayed > 0 {
+		seelog.Infof("Replayed buffered metrics, stats: %+v", cs.metricsBuffer.Stats())
 	}
 	return nil
 }
@@ -175,7 +270,14 @@ func (cs *clientServer) publishMetricsOnce() error {
 // metricsToPublishMetricRequests gets task metrics and converts them to a list of PublishMetricRequest
 // objects.
 func (cs *clientServer) metricsToPublishMetricRequests() ([]*ecstcs.PublishMetricsRequest, error) {
-	metadata, taskMetrics, err := cs.statsEngine.GetInstanceMetrics()
+	return metricsToPublishMetricRequests(cs.statsEngine, cs.maxTaskMetricsBytes)
+}
+
+// metricsToPublishMetricRequests packs the task metrics into as few requests as
+// possible, such that the serialized task metrics of each request fit in
+// maxBytes. A task whose metrics alone exceed maxBytes is sent on its own.
+func metricsToPublishMetricRequests(statsEngine stats.Engine, maxBytes int) ([]*ecstcs.PublishMetricsRequest, error) {
+	metadata, taskMetrics, err := statsEngine.GetInstanceMetrics()
 	if err != nil {
 		return nil, err
 	}
@@ -188,22 +290,21 @@ func (cs *clientServer) metricsToPublishMetricRequests() ([]*ecstcs.PublishMetri
 		return requests, nil
 	}
 	var messageTaskMetrics []*ecstcs.TaskMetric
-	numTasks := len(taskMetrics)
+	messageBytes := 0
 
-	for i, taskMetric := range taskMetrics {
-		messageTaskMetrics = append(messageTaskMetrics, taskMetric)
-		var requestMetadata *ecstcs.MetricsMetadata
-		if (i + 1) == numTasks {
-			// If this is the last task to send, set fin to true
-			requestMetadata = copyMetricsMetadata(metadata, true)
-		} else {
-			requestMetadata = copyMetricsMetadata(metadata, false)
-		}
-		if (i+1)%tasksInMessage == 0 {
-			// Construct payload with tasksInMessage number of task metrics and send to backend.
+	for _, taskMetric := range taskMetrics {
+		taskMetricBytes := taskMetricSize(taskMetric)
+		if len(messageTaskMetrics) > 0 && messageBytes+taskMetricBytes > maxBytes {
+			// The task doesn't fit in the current message; send what we have
+			// so far and start a new one.
+			requestMetadata := copyMetricsMetadata(metadata, false)
 			requests = append(requests, ecstcs.NewPublishMetricsRequest(requestMetadata, copyTaskMetrics(messageTaskMetrics)))
 			messageTaskMetrics = messageTaskMetrics[:0]
+			messageBytes = 0
 		}
+		messageTaskMetrics = append(messageTaskMetrics, taskMetric)
+		// Account for the separator between list elements
+		messageBytes += taskMetricBytes + 1
 	}
 
 	if len(messageTaskMetrics) > 0 {
@@ -215,6 +316,18 @@ func (cs *clientServer) metricsToPublishMetricRequests() ([]*ecstcs.PublishMetri
 	return requests, nil
 }
 
+// taskMetricSize returns the size of the task metric once serialized for the
+// wire.
+func taskMetricSize(taskMetric *ecstcs.TaskMetric) int {
+	data, err := jsonutil.BuildJSON(taskMetric)
+	if err != nil {
+		// Assume the worst, so that the task is sent in a message of its own
+		seelog.Warnf("Unable to determine size of task metric for task %s: %v", aws.StringValue(taskMetric.TaskArn), err)
+		return maxTaskMetricsBytes
+	}
+	return len(data)
+}
+
 // copyMetricsMetadata creates a new MetricsMetadata object from a given MetricsMetadata object.
 // It copies all the fields from the source object to the new object and sets the 'Fin' field
 // as specified by the argument.
@@ -20,6 +20,7 @@
 package tcsclient
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"testing"
@@ -134,7 +135,8 @@ func TestPublishMetricsRequest(t *testing.T) {
 }
 func TestPublishMetricsOnceEmptyStatsError(t *testing.T) {
 	cs := clientServer{
-		statsEngine: &emptyStatsEngine{},
+		statsEngine:   &emptyStatsEngine{},
+		metricsBuffer: NewMetricsBuffer(DefaultMetricsBufferSize),
 	}
 	err := cs.publishMetricsOnce()
 
@@ -160,11 +162,15 @@ func TestPublishOnceIdleStatsEngine(t *testing.T) {
 
 func TestPublishOnceNonIdleStatsEngine(t *testing.T) {
 	expectedRequests := 3
-	// Cretes 21 task metrics, which translate to 3 batches,
-	// {[Task1, Task2, ...Task10], [Task11, Task12, ...Task20], [Task21]}
-	numTasks := (tasksInMessage * (expectedRequests - 1)) + 1
+	tasksPerMessage := 10
+	// Cretes 21 task metrics, with a budget of 10 tasks per message, which
+	// translate to 3 batches, {[Task1, Task2, ...Task10], [Task11, Task12, ...Task20], [Task21]}
+	numTasks := (tasksPerMessage * (expectedRequests - 1)) + 1
+	taskArn := "task/00"
+	budget := tasksPerMessage * (taskMetricSize(&ecstcs.TaskMetric{TaskArn: &taskArn}) + 1)
 	cs := clientServer{
-		statsEngine: newNonIdleStatsEngine(numTasks),
+		statsEngine:         newNonIdleStatsEngine(numTasks),
+		maxTaskMetricsBytes: budget,
 	}
 	requests, err := cs.metricsToPublishMetricRequests()
 	if err != nil {
@@ -180,6 +186,9 @@ func TestPublishOnceNonIdleStatsEngine(t *testing.T) {
 			taskArns[*taskMetric.TaskArn] = true
 		}
 	}
+	if len(taskArns) != numTasks {
+		t.Errorf("Expected %d tasks, got %d", numTasks, len(taskArns))
+	}
 	if len(requests) != expectedRequests {
 		t.Errorf("Expected %d requests, got %d", expectedRequests, len(requests))
 	}
@@ -195,13 +204,84 @@ func TestPublishOnceNonIdleStatsEngine(t *testing.T) {
 	}
 }
 
+func TestPublishOnceDefaultBudgetSingleMessage(t *testing.T) {
+	requests, err := metricsToPublishMetricRequests(newNonIdleStatsEngine(50), maxTaskMetricsBytes)
+	assert.NoError(t, err)
+	assert.Len(t, requests, 1)
+	assert.Len(t, requests[0].TaskMetrics, 50)
+	assert.True(t, *requests[0].Metadata.Fin)
+}
+
+func TestPublishOnceOversizedTaskSentAlone(t *testing.T) {
+	// Every task exceeds the budget, so each one gets its own message
+	requests, err := metricsToPublishMetricRequests(newNonIdleStatsEngine(3), 1)
+	assert.NoError(t, err)
+	assert.Len(t, requests, 3)
+	for _, request := range requests {
+		assert.Len(t, request.TaskMetrics, 1)
+	}
+}
+
+func TestPublishMetricsOnceRetriesFailedRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsclient.NewMockWebsocketConn(ctrl)
+	cs := testCS(conn).(*clientServer)
+	cs.statsEngine = newNonIdleStatsEngine(1)
+
+	gomock.InOrder(
+		conn.EXPECT().WriteMessage(gomock.Any(), gomock.Any()).Return(errors.New("timeout")),
+		conn.EXPECT().WriteMessage(gomock.Any(), gomock.Any()).Return(nil),
+	)
+	err := cs.publishMetricsOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cs.metricsBuffer.Stats().Pending)
+	assert.NotZero(t, cs.metricsBuffer.Stats().LastPublishLatency)
+}
+
+func TestPublishMetricsOnceKeepsUnsentRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsclient.NewMockWebsocketConn(ctrl)
+	cs := testCS(conn).(*clientServer)
+	cs.statsEngine = newNonIdleStatsEngine(2)
+	// Each task is sent in a message of its own
+	cs.maxTaskMetricsBytes = 1
+
+	// The first request goes out, the second one fails on every attempt
+	gomock.InOrder(
+		conn.EXPECT().WriteMessage(gomock.Any(), gomock.Any()).Return(nil),
+		conn.EXPECT().WriteMessage(gomock.Any(), gomock.Any()).Times(publishRetries).Return(errors.New("broken pipe")),
+	)
+	err := cs.publishMetricsOnce()
+	assert.Error(t, err)
+	assert.Equal(t, 1, cs.metricsBuffer.Stats().Pending)
+	assert.Equal(t, uint64(0), cs.metricsBuffer.Stats().Replayed)
+	pending := cs.metricsBuffer.front()
+
+	// On the next cycle the pending request is sent ahead of the new ones
+	cs.statsEngine = newNonIdleStatsEngine(1)
+	sent := []string{}
+	conn.EXPECT().WriteMessage(gomock.Any(), gomock.Any()).Times(2).Do(func(_ int, data []byte) {
+		sent = append(sent, string(data))
+	}).Return(nil)
+	err = cs.publishMetricsOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cs.metricsBuffer.Stats().Pending)
+	assert.Equal(t, uint64(1), cs.metricsBuffer.Stats().Replayed)
+	assert.Len(t, sent, 2)
+	assert.Contains(t, sent[0], *pending.TaskMetrics[0].TaskArn)
+}
+
 func testCS(conn *mock_wsclient.MockWebsocketConn) wsclient.ClientServer {
 	testCreds := credentials.AnonymousCredentials
 	cfg := &config.Config{
 		AWSRegion:          "us-east-1",
 		AcceptInsecureCert: true,
 	}
-	cs := New("localhost:443", cfg, testCreds, &mockStatsEngine{}, testPublishMetricsInterval).(*clientServer)
+	cs := New("localhost:443", cfg, testCreds, &mockStatsEngine{}, testPublishMetricsInterval, nil, nil).(*clientServer)
 	cs.SetConnection(conn)
 	return cs
 }
@@ -0,0 +1,115 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcshandler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/tcs/client"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	log "github.com/cihub/seelog"
+	"golang.org/x/net/context"
+)
+
+// SessionDrainer shuts down the telemetry session when the agent exits. It
+// tracks the client of the current connection, so that a final publish can be
+// made on it, and stops the session from reconnecting afterwards.
+type SessionDrainer struct {
+	lock          sync.Mutex
+	draining      bool
+	client        wsclient.ClientServer
+	metricsBuffer *tcsclient.MetricsBuffer
+}
+
+// NewSessionDrainer returns a SessionDrainer to set in the session params.
+func NewSessionDrainer() *SessionDrainer {
+	return &SessionDrainer{}
+}
+
+// Drain publishes the metrics collected since the last publish on the current
+// connection and closes it cleanly. It returns a description of the metrics
+// that could not be published.
+func (drainer *SessionDrainer) Drain(ctx context.Context) []string {
+	drainer.lock.Lock()
+	drainer.draining = true
+	client, metricsBuffer := drainer.client, drainer.metricsBuffer
+	drainer.lock.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- client.Shutdown()
+	}()
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			log.Warnf("Error closing the connection to TCS: %v", err)
+		}
+	case <-ctx.Done():
+		log.Warn("Timed out publishing metrics before closing the connection to TCS")
+	}
+
+	if metricsBuffer == nil {
+		return nil
+	}
+	if pending := metricsBuffer.Stats().Pending; pending > 0 {
+		return []string{fmt.Sprintf("%d publish metrics requests to TCS", pending)}
+	}
+	return nil
+}
+
+// setClient records the client of the current connection and the buffer of
+// the metrics it publishes. It returns false if the session is being drained,
+// in which case the connection must be closed.
+func (drainer *SessionDrainer) setClient(client wsclient.ClientServer, metricsBuffer *tcsclient.MetricsBuffer) bool {
+	if drainer == nil {
+		return true
+	}
+	drainer.lock.Lock()
+	defer drainer.lock.Unlock()
+
+	if drainer.draining {
+		return false
+	}
+	drainer.client = client
+	drainer.metricsBuffer = metricsBuffer
+	return true
+}
+
+// clearClient forgets the client once its connection is closed.
+func (drainer *SessionDrainer) clearClient(client wsclient.ClientServer) {
+	if drainer == nil {
+		return
+	}
+	drainer.lock.Lock()
+	defer drainer.lock.Unlock()
+
+	if drainer.client == client {
+		drainer.client = nil
+	}
+}
+
+// isDraining returns true once Drain has been called.
+func (drainer *SessionDrainer) isDraining() bool {
+	if drainer == nil {
+		return false
+	}
+	drainer.lock.Lock()
+	defer drainer.lock.Unlock()
+
+	return drainer.draining
+}
@@ -14,6 +14,7 @@
 package tcshandler
 
 import (
+	"errors"
 	"io"
 	"net/url"
 	"strings"
@@ -25,6 +26,8 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/tcs/client"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	log "github.com/cihub/seelog"
 )
@@ -40,8 +43,12 @@ const (
 	deregisterContainerInstanceHandler = "TCSDeregisterContainerInstanceHandler"
 )
 
-// StartMetricsSession starts a metric session. It initializes the stats engine
-// and invokes StartSession.
+// errSessionDraining is returned instead of connecting once the agent has
+// started shutting down
+var errSessionDraining = errors.New("tcs session is being drained")
+
+// StartMetricsSession starts a metric session with the stats engine in the
+// session params and invokes StartSession.
 func StartMetricsSession(params TelemetrySessionParams) {
 	disabled, err := params.isTelemetryDisabled()
 	if err != nil {
@@ -49,20 +56,17 @@ func StartMetricsSession(params TelemetrySessionParams) {
 		return
 	}
 
-	if !disabled {
-		statsEngine := stats.NewDockerStatsEngine(params.Cfg, params.DockerClient, params.ContainerChangeEventStream)
-		err := statsEngine.MustInit(params.TaskEngine, params.Cfg.Cluster, params.ContainerInstanceArn)
-		if err != nil {
-			log.Warnf("Error initializing metrics engine: %v", err)
-			return
-		}
-		err = StartSession(params, statsEngine)
-		if err != nil {
-			log.Warnf("Error starting metrics session with backend: %v", err)
-			return
-		}
-	} else {
+	if disabled {
 		log.Info("Metric collection disabled")
+		return
+	}
+	if params.StatsEngine == nil {
+		log.Warn("Stats engine not initialized, not publishing metrics")
+		return
+	}
+	err = StartSession(params, params.StatsEngine)
+	if err != nil {
+		log.Warnf("Error starting metrics session with backend: %v", err)
 	}
 }
 
@@ -70,37 +74,77 @@ func StartMetricsSession(params TelemetrySessionParams) {
 // using the passed in arguments.
 // The engine is expected to initialized and gathering container metrics by
 // the time the websocket client starts using it.
+// Metrics that cannot be published are buffered across sessions and replayed
+// once a new session is established.
 func StartSession(params TelemetrySessionParams, statsEngine stats.Engine) error {
 	backoff := utils.NewSimpleBackoff(time.Second, 1*time.Minute, 0.2, 2)
+	metricsBuffer := params.MetricsBuffer
+	if metricsBuffer == nil {
+		metricsBuffer = tcsclient.NewMetricsBuffer(tcsclient.DefaultMetricsBufferSize)
+	}
 	for {
-		tcsError := startTelemetrySession(params, statsEngine)
+		tcsError := startTelemetrySession(params, statsEngine, metricsBuffer)
+		params.ConnectionStats.Disconnected(tcsError)
+		if params.Drainer.isDraining() {
+			log.Info("Not reconnecting to TCS, the agent is shutting down")
+			return nil
+		}
 		if tcsError == nil || tcsError == io.EOF {
 			backoff.Reset()
 		} else {
 			log.Infof("Error from tcs; backing off: %v", tcsError)
-			params.time().Sleep(backoff.Duration())
+			bufferMetricsWhileBackingOff(params.time(), statsEngine, metricsBuffer, backoff.Duration(), defaultPublishMetricsInterval)
 		}
 	}
 }
 
-func startTelemetrySession(params TelemetrySessionParams, statsEngine stats.Engine) error {
-	tcsEndpoint, err := params.ECSClient.DiscoverTelemetryEndpoint(params.ContainerInstanceArn)
-	if err != nil {
-		log.Errorf("Unable to discover poll endpoint: ", err)
-		return err
+// bufferMetricsWhileBackingOff waits for the backoff duration before the next
+// connection attempt. Metrics keep being collected at the publish interval in
+// the meantime, the stats engine only retains a limited window of samples.
+func bufferMetricsWhileBackingOff(clock ttime.Time, statsEngine stats.Engine, metricsBuffer *tcsclient.MetricsBuffer,
+	backoff time.Duration, publishMetricsInterval time.Duration) {
+	for remaining := backoff; ; remaining -= publishMetricsInterval {
+		err := tcsclient.BufferMetrics(statsEngine, metricsBuffer, publishMetricsInterval)
+		if err != nil && err != stats.EmptyMetricsError {
+			log.Debugf("Error buffering metrics while disconnected: %v", err)
+		}
+		if remaining <= publishMetricsInterval {
+			clock.Sleep(remaining)
+			return
+		}
+		clock.Sleep(publishMetricsInterval)
+	}
+}
+
+func startTelemetrySession(params TelemetrySessionParams, statsEngine stats.Engine, metricsBuffer *tcsclient.MetricsBuffer) error {
+	tcsEndpoint := params.Cfg.TCSEndpointOverride
+	if tcsEndpoint == "" {
+		var err error
+		tcsEndpoint, err = params.ECSClient.DiscoverTelemetryEndpoint(params.ContainerInstanceArn)
+		if err != nil {
+			log.Errorf("Unable to discover poll endpoint: ", err)
+			return err
+		}
 	}
 	log.Debugf("Connecting to TCS endpoint %v", tcsEndpoint)
 	url := formatURL(tcsEndpoint, params.Cfg.Cluster, params.ContainerInstanceArn)
-	return startSession(url, params.Cfg, params.CredentialProvider, statsEngine, defaultHeartbeatTimeout, defaultHeartbeatJitter, defaultPublishMetricsInterval, params.DeregisterInstanceEventStream)
+	return startSession(url, params.Cfg, params.CredentialProvider, statsEngine, defaultHeartbeatTimeout, defaultHeartbeatJitter, defaultPublishMetricsInterval, params.DeregisterInstanceEventStream, metricsBuffer, params.ConnectionStats, params.Drainer)
 }
 
 func startSession(url string, cfg *config.Config, credentialProvider *credentials.Credentials,
 	statsEngine stats.Engine, heartbeatTimeout, heartbeatJitter, publishMetricsInterval time.Duration,
-	deregisterInstanceEventStream *eventstream.EventStream) error {
-	client := tcsclient.New(url, cfg, credentialProvider, statsEngine, publishMetricsInterval)
+	deregisterInstanceEventStream *eventstream.EventStream, metricsBuffer *tcsclient.MetricsBuffer,
+	connectionStats *wsclient.ConnectionStats, drainer *SessionDrainer) error {
+	client := tcsclient.New(url, cfg, credentialProvider, statsEngine, publishMetricsInterval, metricsBuffer, connectionStats)
 	defer client.Close()
+	if drainer.isDraining() {
+		return errSessionDraining
+	}
 
-	err := deregisterInstanceEventStream.Subscribe(deregisterContainerInstanceHandler, client.Disconnect)
+	err := deregisterInstanceEventStream.Subscribe(deregisterContainerInstanceHandler, func(events ...interface{}) error {
+		connectionStats.SetDisconnectReason(wsclient.DisconnectReasonInactiveInstance)
+		return client.Disconnect(events...)
+	})
 	if err != nil {
 		return err
 	}
@@ -113,6 +157,7 @@ func startSession(url string, cfg *config.Config, credentialProvider *credential
 		// Close the connection if there haven't been any messages received from backend
 		// for a long time.
 		log.Debug("TCS Connection hasn't had a heartbeat or an ack message in too long of a timeout; disconnecting")
+		connectionStats.SetDisconnectReason(wsclient.DisconnectReasonHeartbeatTimeout)
 		client.Disconnect()
 	})
 	defer timer.Stop()
@@ -123,6 +168,12 @@ func startSession(url string, cfg *config.Config, credentialProvider *credential
 		log.Errorf("Error connecting to TCS: %v", err.Error())
 		return err
 	}
+	// The client is only drained once connected, there is nothing to
+	// publish or close before that
+	if !drainer.setClient(client, metricsBuffer) {
+		return errSessionDraining
+	}
+	defer drainer.clearClient(client)
 	return client.Serve()
 }
 
@@ -17,6 +17,7 @@ import (
 	"errors"
 	"io"
 	"math/rand"
+	"net"
 	"net/url"
 	"strings"
 	"sync"
@@ -28,12 +29,15 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/client"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient/fake"
 	wsmock "github.com/aws/amazon-ecs-agent/agent/wsclient/mock/utils"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 )
 
@@ -44,6 +48,8 @@ const (
 	testInstanceArn            = "arn:aws:ecs:us-east-1:123:container-instance/abc"
 	testMessageId              = "testMessageId"
 	testPublishMetricsInterval = 1 * time.Millisecond
+	// fakeTCSTimeout bounds the waits on the fake TCS
+	fakeTCSTimeout = 10 * time.Second
 )
 
 type mockStatsEngine struct{}
@@ -79,6 +85,23 @@ func TestFormatURL(t *testing.T) {
 	}
 }
 
+func TestBufferMetricsWhileBackingOff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockTime := mock_ttime.NewMockTime(ctrl)
+	sleep := func(d time.Duration) { time.Sleep(d) }
+	gomock.InOrder(
+		mockTime.EXPECT().Sleep(10*time.Millisecond).Do(sleep),
+		mockTime.EXPECT().Sleep(10*time.Millisecond).Do(sleep),
+		mockTime.EXPECT().Sleep(5*time.Millisecond).Do(sleep),
+	)
+
+	buffer := tcsclient.NewMetricsBuffer(tcsclient.DefaultMetricsBufferSize)
+	bufferMetricsWhileBackingOff(mockTime, &mockStatsEngine{}, buffer, 25*time.Millisecond, 10*time.Millisecond)
+	// Metrics are buffered at the start and after each publish interval
+	assert.Equal(t, 3, buffer.Stats().Pending)
+}
+
 func TestStartSession(t *testing.T) {
 	// Start test server.
 	closeWS := make(chan []byte)
@@ -106,7 +129,7 @@ func TestStartSession(t *testing.T) {
 
 	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", context.Background())
 	// Start a session with the test server.
-	go startSession(server.URL, testCfg, credentials.AnonymousCredentials, &mockStatsEngine{}, defaultHeartbeatTimeout, defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream)
+	go startSession(server.URL, testCfg, credentials.AnonymousCredentials, &mockStatsEngine{}, defaultHeartbeatTimeout, defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream, nil, nil, nil)
 
 	// startSession internally starts publishing metrics from the mockStatsEngine object.
 	time.Sleep(testPublishMetricsInterval)
@@ -168,7 +191,7 @@ func TestSessionConnectionClosedByRemote(t *testing.T) {
 	defer cancel()
 
 	// Start a session with the test server.
-	err = startSession(server.URL, testCfg, credentials.AnonymousCredentials, &mockStatsEngine{}, defaultHeartbeatTimeout, defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream)
+	err = startSession(server.URL, testCfg, credentials.AnonymousCredentials, &mockStatsEngine{}, defaultHeartbeatTimeout, defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream, nil, nil, nil)
 
 	if err == nil {
 		t.Error("Expected io.EOF on closed connection")
@@ -203,7 +226,7 @@ func TestConnectionInactiveTimeout(t *testing.T) {
 	deregisterInstanceEventStream.StartListening()
 	defer cancel()
 	// Start a session with the test server.
-	err = startSession(server.URL, testCfg, credentials.AnonymousCredentials, &mockStatsEngine{}, 50*time.Millisecond, 100*time.Millisecond, testPublishMetricsInterval, deregisterInstanceEventStream)
+	err = startSession(server.URL, testCfg, credentials.AnonymousCredentials, &mockStatsEngine{}, 50*time.Millisecond, 100*time.Millisecond, testPublishMetricsInterval, deregisterInstanceEventStream, nil, nil, nil)
 	// if we are not blocked here, then the test pass as it will reconnect in StartSession
 	assert.Error(t, err, "Close the connection should cause the tcs client return error")
 
@@ -219,12 +242,102 @@ func TestDiscoverEndpointAndStartSession(t *testing.T) {
 	mockEcs := mock_api.NewMockECSClient(ctrl)
 	mockEcs.EXPECT().DiscoverTelemetryEndpoint(gomock.Any()).Return("", errors.New("error"))
 
-	err := startTelemetrySession(TelemetrySessionParams{ECSClient: mockEcs}, nil)
+	err := startTelemetrySession(TelemetrySessionParams{ECSClient: mockEcs, Cfg: testCfg}, nil, nil)
 	if err == nil {
 		t.Error("Expected error from startTelemetrySession when DiscoverTelemetryEndpoint returns error")
 	}
 }
 
+func TestStartTelemetrySessionWithFakeTCS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// The telemetry endpoint is not discovered when it is overridden
+	mockEcs := mock_api.NewMockECSClient(ctrl)
+
+	tcs := fake.NewTCSServer()
+	defer tcs.Close()
+	creds := credentials.NewStaticCredentials("akid", "skid", "")
+	tcs.VerifySignatures(creds, "us-east-1")
+	cfg := &config.Config{
+		Cluster:             testClusterArn,
+		AWSRegion:           "us-east-1",
+		AcceptInsecureCert:  true,
+		TCSEndpointOverride: tcs.URL(),
+	}
+	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", context.Background())
+
+	ended := make(chan error, 1)
+	go func() {
+		ended <- startTelemetrySession(TelemetrySessionParams{
+			ContainerInstanceArn:          testInstanceArn,
+			CredentialProvider:            creds,
+			Cfg:                           cfg,
+			DeregisterInstanceEventStream: deregisterInstanceEventStream,
+			ECSClient:                     mockEcs,
+		}, &mockStatsEngine{}, nil)
+	}()
+
+	request, err := tcs.WaitForConnection(fakeTCSTimeout)
+	require.NoError(t, err, "Session did not connect to the fake TCS")
+	assert.Equal(t, testClusterArn, request.URL.Query().Get("cluster"))
+	assert.Equal(t, testInstanceArn, request.URL.Query().Get("containerInstance"))
+
+	// Closing the connection ends the session without an error to back off on
+	require.NoError(t, tcs.CloseConnection(websocket.CloseNormalClosure, ""))
+	select {
+	case err := <-ended:
+		assert.Equal(t, io.EOF, err)
+	case <-time.After(fakeTCSTimeout):
+		t.Fatal("Timed out waiting for the session to end")
+	}
+}
+
+func TestStartSessionPublishesMetricsToFakeTCS(t *testing.T) {
+	tcs := fake.NewTCSServer()
+	defer tcs.Close()
+	creds := credentials.NewStaticCredentials("akid", "skid", "")
+	tcs.VerifySignatures(creds, testCfg.AWSRegion)
+	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", context.Background())
+
+	ended := make(chan error, 1)
+	go func() {
+		ended <- startSession(formatURL(tcs.URL(), testClusterArn, testInstanceArn), testCfg, creds, &mockStatsEngine{},
+			defaultHeartbeatTimeout, defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream, nil, nil, nil)
+	}()
+
+	request, err := tcs.WaitForPublishMetrics(fakeTCSTimeout)
+	require.NoError(t, err, "No metrics were published to the fake TCS")
+	expected := createPublishMetricsRequest()
+	assert.Equal(t, *expected.Metadata.Cluster, *request.Metadata.Cluster)
+	assert.Equal(t, *expected.Metadata.ContainerInstance, *request.Metadata.ContainerInstance)
+	require.Len(t, request.TaskMetrics, len(expected.TaskMetrics))
+	assert.Equal(t, *expected.TaskMetrics[0].TaskArn, *request.TaskMetrics[0].TaskArn)
+	require.NoError(t, tcs.SendAck())
+	assert.Empty(t, tcs.DecodeErrors())
+
+	require.NoError(t, tcs.CloseConnection(websocket.CloseNormalClosure, ""))
+	select {
+	case <-ended:
+	case <-time.After(fakeTCSTimeout):
+		t.Fatal("Timed out waiting for the session to end")
+	}
+}
+
+func TestStartSessionRejectedByFakeTCS(t *testing.T) {
+	tcs := fake.NewTCSServer()
+	defer tcs.Close()
+	tcs.VerifySignatures(credentials.NewStaticCredentials("akid", "skid", ""), testCfg.AWSRegion)
+	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", context.Background())
+
+	// Requests signed with other credentials are rejected
+	err := startSession(formatURL(tcs.URL(), testClusterArn, testInstanceArn), testCfg,
+		credentials.NewStaticCredentials("otherakid", "otherskid", ""), &mockStatsEngine{},
+		defaultHeartbeatTimeout, defaultHeartbeatJitter, testPublishMetricsInterval, deregisterInstanceEventStream, nil, nil, nil)
+	assert.Error(t, err, "Expected the fake TCS to reject the connection")
+	_, err = tcs.WaitForConnection(10 * time.Millisecond)
+	assert.Equal(t, fake.ErrTimeout, err)
+}
+
 func getPayloadFromRequest(request string) (string, error) {
 	lines := strings.Split(request, "\r\n")
 	if len(lines) > 0 {
@@ -285,3 +398,79 @@ func createPublishMetricsRequest() *ecstcs.PublishMetricsRequest {
 		Timestamp: &ts,
 	}
 }
+
+func TestStartSessionDrainedByShutdown(t *testing.T) {
+	tcs := fake.NewTCSServer()
+	defer tcs.Close()
+	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", context.Background())
+	drainer := NewSessionDrainer()
+
+	ended := make(chan error, 1)
+	go func() {
+		// Only the first publish after connecting and the final one on
+		// shutdown happen within the test
+		ended <- startSession(formatURL(tcs.URL(), testClusterArn, testInstanceArn), testCfg,
+			credentials.AnonymousCredentials, &mockStatsEngine{}, defaultHeartbeatTimeout, defaultHeartbeatJitter,
+			time.Hour, deregisterInstanceEventStream, nil, nil, drainer)
+	}()
+	_, err := tcs.WaitForPublishMetrics(fakeTCSTimeout)
+	require.NoError(t, err, "No metrics were published to the fake TCS")
+
+	ctx, cancel := context.WithTimeout(context.Background(), fakeTCSTimeout)
+	defer cancel()
+	assert.Empty(t, drainer.Drain(ctx), "Expected all metrics to be published")
+	_, err = tcs.WaitForPublishMetrics(fakeTCSTimeout)
+	assert.NoError(t, err, "Expected a final publish before the connection was closed")
+	select {
+	case <-ended:
+	case <-time.After(fakeTCSTimeout):
+		t.Fatal("Timed out waiting for the session to end")
+	}
+	assert.NoError(t, tcs.WaitForDisconnection(fakeTCSTimeout))
+
+	// A drained session doesn't connect again
+	err = startSession(formatURL(tcs.URL(), testClusterArn, testInstanceArn), testCfg,
+		credentials.AnonymousCredentials, &mockStatsEngine{}, defaultHeartbeatTimeout, defaultHeartbeatJitter,
+		time.Hour, deregisterInstanceEventStream, nil, nil, drainer)
+	assert.Equal(t, errSessionDraining, err)
+}
+
+func TestStartSessionRegistersClientOnceConnected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", context.Background())
+	drainer := NewSessionDrainer()
+
+	ended := make(chan error, 1)
+	go func() {
+		ended <- startSession(formatURL("https://"+listener.Addr().String(), testClusterArn, testInstanceArn), testCfg,
+			credentials.AnonymousCredentials, &mockStatsEngine{}, defaultHeartbeatTimeout, defaultHeartbeatJitter,
+			time.Hour, deregisterInstanceEventStream, nil, nil, drainer)
+	}()
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(fakeTCSTimeout):
+		t.Fatal("Timed out waiting for the session to connect")
+	}
+
+	// The handshake never completes, there is no connection to drain yet
+	drainer.lock.Lock()
+	assert.Nil(t, drainer.client, "Expected the client to be registered once connected")
+	drainer.lock.Unlock()
+	conn.Close()
+	select {
+	case err = <-ended:
+		assert.Error(t, err)
+	case <-time.After(fakeTCSTimeout):
+		t.Fatal("Timed out waiting for the session to end")
+	}
+}
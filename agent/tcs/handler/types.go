@@ -21,7 +21,10 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	tcsclient "github.com/aws/amazon-ecs-agent/agent/tcs/client"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
@@ -35,8 +38,17 @@ type TelemetrySessionParams struct {
 	AcceptInvalidCert             bool
 	ECSClient                     api.ECSClient
 	TaskEngine                    engine.TaskEngine
-	_time                         ttime.Time
-	_timeOnce                     sync.Once
+	StatsEngine                   stats.Engine
+	// ConnectionStats tracks the health of the connections to the backend,
+	// it may be nil
+	ConnectionStats *wsclient.ConnectionStats
+	// Drainer closes the session when the agent shuts down, it may be nil
+	Drainer *SessionDrainer
+	// MetricsBuffer keeps the metrics that could not be published yet across
+	// sessions, a new one is created if it is nil
+	MetricsBuffer *tcsclient.MetricsBuffer
+	_time         ttime.Time
+	_timeOnce     sync.Once
 }
 
 func (params *TelemetrySessionParams) isTelemetryDisabled() (bool, error) {
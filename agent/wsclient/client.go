@@ -19,7 +19,6 @@
 package wsclient
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -27,12 +26,12 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"reflect"
 	"sync"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
@@ -54,8 +53,9 @@ const (
 	// writeBufSize is the size of the write buffer for the ws connection.
 	writeBufSize = 32768
 
-	// Default NO_PROXY env var IP addresses
-	defaultNoProxyIP = "169.254.169.254,169.254.170.2"
+	// MaxFrameSize is the largest websocket frame written to the backend. The
+	// connection splits longer messages into several frames.
+	MaxFrameSize = writeBufSize
 )
 
 // ReceivedMessage is the intermediate message used to unmarshal a
@@ -97,6 +97,9 @@ type ClientServer interface {
 	IsConnected() bool
 	SetConnection(conn WebsocketConn)
 	Disconnect(...interface{}) error
+	// Shutdown sends a close frame to the backend before closing the
+	// connection, so that the backend knows the client is going away
+	Shutdown() error
 	Serve() error
 	io.Closer
 }
@@ -121,6 +124,9 @@ type ClientServerImpl struct {
 	AnyRequestHandler RequestHandler
 	// URL is the full url to the backend, including path, querystring, and so on.
 	URL string
+	// Stats, if set, tracks the health of the connection. It is shared by the
+	// clients of a session across reconnects.
+	Stats *ConnectionStats
 	// writeLock needed to ensure that only one routine is writing to the socket
 	writeLock sync.Mutex
 	ClientServer
@@ -139,6 +145,7 @@ func (cs *ClientServerImpl) Connect() error {
 		return err
 	}
 
+	httpURL := *parsedURL
 	wsScheme, err := websocketScheme(parsedURL.Scheme)
 	if err != nil {
 		return err
@@ -153,26 +160,24 @@ func (cs *ClientServerImpl) Connect() error {
 	utils.SignHTTPRequest(request, cs.AgentConfig.AWSRegion, ServiceName, cs.CredentialProvider, nil)
 
 	timeoutDialer := &net.Dialer{Timeout: wsConnectTimeout}
-	tlsConfig := &tls.Config{ServerName: parsedURL.Host, InsecureSkipVerify: cs.AgentConfig.AcceptInsecureCert}
-
-	// Ensure that NO_PROXY gets set
-	noProxy := os.Getenv("NO_PROXY")
-	if noProxy == "" {
-		dockerHost, err := url.Parse(cs.AgentConfig.DockerEndpoint)
-		if err == nil {
-			dockerHost.Scheme = ""
-			os.Setenv("NO_PROXY", fmt.Sprintf("%s,%s", defaultNoProxyIP, dockerHost.String()))
-			seelog.Info("NO_PROXY set:", os.Getenv("NO_PROXY"))
-		} else {
-			seelog.Errorf("NO_PROXY unable to be set: the configured Docker endpoint is invalid.")
-		}
+	tlsConfig := httpclient.TLSConfig(cs.AgentConfig, cs.AgentConfig.AcceptInsecureCert)
+	tlsConfig.ServerName = parsedURL.Host
+
+	// The proxy is resolved here only to log it, the dialer resolves it again
+	proxy := httpclient.ProxyFunc(cs.AgentConfig)
+	proxyURL, err := proxy(&http.Request{URL: &httpURL})
+	if err != nil {
+		return err
+	}
+	if proxyURL != nil {
+		seelog.Infof("Connecting to %s through proxy %s", parsedURL.Host, httpclient.ProxyDisplayName(proxyURL))
 	}
 
 	dialer := websocket.Dialer{
 		ReadBufferSize:  readBufSize,
 		WriteBufferSize: writeBufSize,
 		TLSClientConfig: tlsConfig,
-		Proxy:           http.ProxyFromEnvironment,
+		Proxy:           proxy,
 		NetDial:         timeoutDialer.Dial,
 	}
 
@@ -181,6 +186,9 @@ func (cs *ClientServerImpl) Connect() error {
 		defer httpResponse.Body.Close()
 	}
 
+	if err != nil && proxyURL != nil {
+		seelog.Warnf("Error connecting to %s through proxy %s: %v", parsedURL.Host, httpclient.ProxyDisplayName(proxyURL), err)
+	}
 	if err != nil {
 		var resp []byte
 		if httpResponse != nil {
@@ -200,6 +208,7 @@ func (cs *ClientServerImpl) Connect() error {
 		return fmt.Errorf(string(resp) + ", " + err.Error())
 	}
 	cs.conn = websocketConn
+	cs.Stats.connected()
 	return nil
 }
 
@@ -225,6 +234,22 @@ func (cs *ClientServerImpl) Disconnect(...interface{}) error {
 	return fmt.Errorf("No Connection to close")
 }
 
+// Shutdown closes the connection cleanly by sending a normal closure frame
+// before closing the underlying connection
+func (cs *ClientServerImpl) Shutdown() error {
+	cs.writeLock.Lock()
+	defer cs.writeLock.Unlock()
+
+	if cs.conn == nil {
+		return fmt.Errorf("No Connection to close")
+	}
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := cs.conn.WriteMessage(websocket.CloseMessage, closeMessage); err != nil {
+		seelog.Warnf("Error sending close message to %s: %v", cs.URL, err)
+	}
+	return cs.conn.Close()
+}
+
 // AddRequestHandler adds a request handler to this client.
 // A request handler *must* be a function taking a single argument, and that
 // argument *must* be a pointer to a recognized 'ecsacs' struct.
@@ -288,6 +313,9 @@ func (cs *ClientServerImpl) ConsumeMessages() error {
 
 		case permissibleCloseCode(err):
 			seelog.Infof("Connection closed for a valid reason: %s", err)
+			if reason, ok := closeCodeReason(err); ok {
+				cs.Stats.SetDisconnectReason(reason)
+			}
 			return io.EOF
 
 		default:
@@ -334,10 +362,12 @@ func (cs *ClientServerImpl) handleMessage(data []byte) {
 	typedMessage, typeStr, err := DecodeData(data, cs.TypeDecoder)
 	if err != nil {
 		seelog.Warnf("Unable to handle message from backend: %v", err)
+		cs.Stats.RecordError(err)
 		return
 	}
 
 	seelog.Debugf("Received message of type: %s", typeStr)
+	cs.Stats.messageReceived(typeStr)
 
 	if cs.AnyRequestHandler != nil {
 		reflect.ValueOf(cs.AnyRequestHandler).Call([]reflect.Value{reflect.ValueOf(typedMessage)})
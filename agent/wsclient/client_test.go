@@ -14,7 +14,11 @@
 package wsclient
 
 import (
+	"encoding/base64"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -29,6 +33,7 @@ import (
 	"github.com/gorilla/websocket"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const dockerEndpoint = "/var/run/docker.sock"
@@ -66,9 +71,9 @@ func TestConcurrentWritesDontPanic(t *testing.T) {
 	}
 }
 
-// TestProxyVariableCustomValue ensures that a user is able to override the
-// proxy variable by setting an environment variable
-func TestProxyVariableCustomValue(t *testing.T) {
+// TestConnectDoesNotModifyNoProxy ensures that connecting leaves the NO_PROXY
+// environment variable alone
+func TestConnectDoesNotModifyNoProxy(t *testing.T) {
 	closeWS := make(chan []byte)
 	defer close(closeWS)
 
@@ -76,16 +81,20 @@ func TestProxyVariableCustomValue(t *testing.T) {
 	mockServer.StartTLS()
 	defer mockServer.Close()
 
-	testString := "Custom no proxy string"
-	os.Setenv("NO_PROXY", testString)
+	noProxy, noProxySet := os.LookupEnv("NO_PROXY")
+	os.Unsetenv("NO_PROXY")
+	if noProxySet {
+		defer os.Setenv("NO_PROXY", noProxy)
+	}
 	getClientServer(mockServer.URL).Connect()
 
-	assert.Equal(t, os.Getenv("NO_PROXY"), testString, "NO_PROXY should match user-supplied variable")
+	_, noProxySet = os.LookupEnv("NO_PROXY")
+	assert.False(t, noProxySet, "NO_PROXY should not be set when connecting")
 }
 
-// TestProxyVariableDefaultValue verifies that NO_PROXY gets overridden if it
-// isn't already set
-func TestProxyVariableDefaultValue(t *testing.T) {
+// TestConnectThroughProxy ensures that the connection is tunneled through the
+// configured proxy, with its credentials
+func TestConnectThroughProxy(t *testing.T) {
 	closeWS := make(chan []byte)
 	defer close(closeWS)
 
@@ -93,12 +102,43 @@ func TestProxyVariableDefaultValue(t *testing.T) {
 	mockServer.StartTLS()
 	defer mockServer.Close()
 
-	os.Unsetenv("NO_PROXY")
-	getClientServer(mockServer.URL).Connect()
-
-	expectedEnvVar := "169.254.169.254,169.254.170.2," + dockerEndpoint
+	authorizations := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		authorizations <- r.Header.Get("Proxy-Authorization")
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(target, conn)
+		go io.Copy(conn, target)
+	}))
+	defer proxy.Close()
 
-	assert.Equal(t, os.Getenv("NO_PROXY"), expectedEnvVar, "Variable NO_PROXY expected to be overwritten when no default value supplied")
+	cs := getClientServer(mockServer.URL)
+	cs.AgentConfig.ProxyURL = proxy.URL
+	cs.AgentConfig.ProxyUsername = "user"
+	cs.AgentConfig.ProxyPassword = "password"
+	err := cs.Connect()
+	require.NoError(t, err)
+	defer cs.Disconnect()
+
+	select {
+	case authorization := <-authorizations:
+		assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:password")), authorization)
+	default:
+		t.Fatal("Expected the connection to go through the proxy")
+	}
 }
 
 // TestHandleMessagePermissibleCloseCode ensures that permissible close codes
@@ -141,6 +181,23 @@ func TestHandleMessageUnexpectedCloseCode(t *testing.T) {
 	assert.True(t, websocket.IsCloseError(<-messageError, websocket.CloseTryAgainLater), "Expected error from websocket library")
 }
 
+// TestShutdownSendsNormalClosure checks that the backend receives a normal
+// closure frame when the client shuts down
+func TestShutdownSendsNormalClosure(t *testing.T) {
+	closeWS := make(chan []byte)
+	defer close(closeWS)
+
+	mockServer, _, _, serverErrors, _ := utils.GetMockServer(t, closeWS)
+	mockServer.StartTLS()
+	defer mockServer.Close()
+	cs := getClientServer(mockServer.URL)
+	require.NoError(t, cs.Connect())
+
+	assert.NoError(t, cs.Shutdown())
+	err := <-serverErrors
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "Expected a normal closure, got: %v", err)
+}
+
 // TestHandlNonHTTPSEndpoint verifies that the wsclient can handle communication over
 // an HTTP (so WS) connection
 func TestHandleNonHTTPSEndpoint(t *testing.T) {
@@ -0,0 +1,267 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DisconnectReasonInactiveInstance is recorded when the backend reports
+	// that the container instance is no longer active
+	DisconnectReasonInactiveInstance = "InactiveInstance"
+	// DisconnectReasonHeartbeatTimeout is recorded when the connection is
+	// closed by the agent because the backend stopped sending heartbeats
+	DisconnectReasonHeartbeatTimeout = "HeartbeatTimeout"
+	// DisconnectReasonConnectError is recorded when the connection could not
+	// be established
+	DisconnectReasonConnectError = "ConnectError"
+	// DisconnectReasonClosed is recorded when the connection ended without
+	// a close code or an error
+	DisconnectReasonClosed = "Closed"
+	// DisconnectReasonError is recorded when the connection ended with an
+	// error that is not a websocket close
+	DisconnectReasonError = "Error"
+
+	heartbeatMessageType = "HeartbeatMessage"
+)
+
+// ConnectionStats tracks the health of the websocket connections of a session
+// with the backend. A session creates a new client every time it reconnects,
+// the same ConnectionStats is shared by all of them.
+// All methods are safe to call on a nil ConnectionStats, which tracks nothing.
+type ConnectionStats struct {
+	name string
+
+	lock             sync.RWMutex
+	isConnected      bool
+	connectedAt      time.Time
+	lastHeartbeat    time.Time
+	messagesReceived map[string]uint64
+	lastError        string
+	lastErrorAt      time.Time
+	reconnects       uint64
+	reconnectReasons map[string]uint64
+	// disconnectReason is the reason of the ongoing disconnect, recorded by
+	// whoever closed the connection
+	disconnectReason string
+}
+
+// ConnectionSnapshot is the state of a ConnectionStats at a point in time.
+type ConnectionSnapshot struct {
+	Name             string
+	Connected        bool
+	ConnectedAt      *time.Time `json:",omitempty"`
+	LastHeartbeat    *time.Time `json:",omitempty"`
+	MessagesReceived map[string]uint64
+	LastError        string     `json:",omitempty"`
+	LastErrorAt      *time.Time `json:",omitempty"`
+	Reconnects       uint64
+	ReconnectReasons map[string]uint64
+}
+
+// NewConnectionStats returns the stats of the connections to the backend
+// named name, e.g. "ACS".
+func NewConnectionStats(name string) *ConnectionStats {
+	return &ConnectionStats{
+		name:             name,
+		messagesReceived: make(map[string]uint64),
+		reconnectReasons: make(map[string]uint64),
+	}
+}
+
+// connected records a successful connection
+func (stats *ConnectionStats) connected() {
+	if stats == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.isConnected = true
+	stats.connectedAt = time.Now()
+	stats.disconnectReason = ""
+}
+
+// messageReceived records a message of the given type, heartbeats included
+func (stats *ConnectionStats) messageReceived(messageType string) {
+	if stats == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.messagesReceived[messageType]++
+	if messageType == heartbeatMessageType {
+		stats.lastHeartbeat = time.Now()
+	}
+}
+
+// RecordError records the last error seen on the connection.
+func (stats *ConnectionStats) RecordError(err error) {
+	if stats == nil || err == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.lastError = err.Error()
+	stats.lastErrorAt = time.Now()
+}
+
+// SetDisconnectReason records why the current connection is being closed. The
+// first reason recorded for a connection wins, so that closing the connection
+// because of a heartbeat timeout isn't reported as a plain close.
+func (stats *ConnectionStats) SetDisconnectReason(reason string) {
+	if stats == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if stats.disconnectReason == "" {
+		stats.disconnectReason = reason
+	}
+}
+
+// Disconnected records the end of a connection, or of an attempt to connect,
+// and logs a summary of it. err is the error the connection ended with.
+func (stats *ConnectionStats) Disconnected(err error) {
+	if stats == nil {
+		return
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	reason := stats.disconnectReason
+	if reason == "" {
+		reason = disconnectReason(err, stats.isConnected)
+	}
+	if err != nil && err != io.EOF {
+		stats.lastError = err.Error()
+		stats.lastErrorAt = time.Now()
+	}
+	stats.reconnects++
+	stats.reconnectReasons[reason]++
+
+	summary := []string{fmt.Sprintf("reason: %s", reason)}
+	if stats.isConnected {
+		summary = append(summary, fmt.Sprintf("connected for: %s", time.Since(stats.connectedAt)))
+	}
+	if !stats.lastHeartbeat.IsZero() {
+		summary = append(summary, fmt.Sprintf("last heartbeat: %s ago", time.Since(stats.lastHeartbeat)))
+	}
+	summary = append(summary, fmt.Sprintf("messages received: %v", stats.messagesReceived),
+		fmt.Sprintf("reconnects: %d", stats.reconnects))
+	if err != nil {
+		summary = append(summary, fmt.Sprintf("error: %v", err))
+	}
+	seelog.Infof("Disconnected from %s; %s", stats.name, strings.Join(summary, ", "))
+
+	stats.isConnected = false
+	stats.disconnectReason = ""
+}
+
+// Snapshot returns the current state of the stats. The snapshot of a nil
+// ConnectionStats is empty.
+func (stats *ConnectionStats) Snapshot() ConnectionSnapshot {
+	if stats == nil {
+		return ConnectionSnapshot{}
+	}
+	stats.lock.RLock()
+	defer stats.lock.RUnlock()
+
+	snapshot := ConnectionSnapshot{
+		Name:             stats.name,
+		Connected:        stats.isConnected,
+		ConnectedAt:      timePtr(stats.connectedAt),
+		LastHeartbeat:    timePtr(stats.lastHeartbeat),
+		MessagesReceived: make(map[string]uint64, len(stats.messagesReceived)),
+		LastError:        stats.lastError,
+		LastErrorAt:      timePtr(stats.lastErrorAt),
+		Reconnects:       stats.reconnects,
+		ReconnectReasons: make(map[string]uint64, len(stats.reconnectReasons)),
+	}
+	for messageType, count := range stats.messagesReceived {
+		snapshot.MessagesReceived[messageType] = count
+	}
+	for reason, count := range stats.reconnectReasons {
+		snapshot.ReconnectReasons[reason] = count
+	}
+	return snapshot
+}
+
+// closeCodeReason returns the disconnect reason for a websocket close error,
+// e.g. "CloseCode1000"
+func closeCodeReason(err error) (string, bool) {
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("CloseCode%d", closeErr.Code), true
+}
+
+func disconnectReason(err error, wasConnected bool) string {
+	if !wasConnected {
+		return DisconnectReasonConnectError
+	}
+	if reason, ok := closeCodeReason(err); ok {
+		return reason
+	}
+	if err == nil || err == io.EOF {
+		return DisconnectReasonClosed
+	}
+	return DisconnectReasonError
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// ConnectionRegistry holds the ConnectionStats of every session of the agent.
+type ConnectionRegistry struct {
+	lock  sync.RWMutex
+	stats []*ConnectionStats
+}
+
+// NewConnectionRegistry returns an empty ConnectionRegistry.
+func NewConnectionRegistry() *ConnectionRegistry {
+	return &ConnectionRegistry{}
+}
+
+// Register creates the ConnectionStats of the session named name.
+func (registry *ConnectionRegistry) Register(name string) *ConnectionStats {
+	stats := NewConnectionStats(name)
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.stats = append(registry.stats, stats)
+	return stats
+}
+
+// Connections returns a snapshot of the stats of every registered session.
+func (registry *ConnectionRegistry) Connections() []ConnectionSnapshot {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	snapshots := make([]ConnectionSnapshot, 0, len(registry.stats))
+	for _, stats := range registry.stats {
+		snapshots = append(snapshots, stats.Snapshot())
+	}
+	return snapshots
+}
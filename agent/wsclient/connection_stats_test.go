@@ -0,0 +1,128 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient/mock/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConnectionStatsTracksConnection ensures that the client records its
+// connection, the messages it receives and the close code it was closed with
+func TestConnectionStatsTracksConnection(t *testing.T) {
+	closeWS := make(chan []byte)
+	defer close(closeWS)
+
+	mockServer, serverChan, _, _, _ := utils.GetMockServer(t, closeWS)
+	mockServer.StartTLS()
+	defer mockServer.Close()
+
+	stats := NewConnectionStats("ACS")
+	cs := getClientServer(mockServer.URL)
+	cs.TypeDecoder = BuildTypeDecoder([]interface{}{ecsacs.AckRequest{}, ecsacs.HeartbeatMessage{}})
+	cs.RequestHandlers = make(map[string]RequestHandler)
+	cs.Stats = stats
+	require.NoError(t, cs.Connect())
+
+	snapshot := stats.Snapshot()
+	assert.True(t, snapshot.Connected)
+	assert.NotNil(t, snapshot.ConnectedAt)
+	assert.Nil(t, snapshot.LastHeartbeat)
+
+	messageError := make(chan error)
+	go func() {
+		messageError <- cs.ConsumeMessages()
+	}()
+	serverChan <- `{"type":"HeartbeatMessage","message":{"healthy":true}}`
+	serverChan <- `{"type":"AckRequest","message":{"messageId":"id"}}`
+	close(serverChan)
+	closeWS <- websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	err := <-messageError
+	assert.Equal(t, io.EOF, err)
+	stats.Disconnected(err)
+
+	snapshot = stats.Snapshot()
+	assert.False(t, snapshot.Connected)
+	assert.NotNil(t, snapshot.LastHeartbeat)
+	assert.Equal(t, map[string]uint64{"HeartbeatMessage": 1, "AckRequest": 1}, snapshot.MessagesReceived)
+	assert.Equal(t, uint64(1), snapshot.Reconnects)
+	assert.Equal(t, map[string]uint64{"CloseCode1000": 1}, snapshot.ReconnectReasons)
+	assert.Empty(t, snapshot.LastError)
+}
+
+func TestConnectionStatsDisconnectReasons(t *testing.T) {
+	stats := NewConnectionStats("TCS")
+
+	// Failing to connect
+	stats.Disconnected(errors.New("dial error"))
+
+	// Closed by the agent after a heartbeat timeout, the close error seen
+	// afterwards doesn't override the reason
+	stats.connected()
+	stats.SetDisconnectReason(DisconnectReasonHeartbeatTimeout)
+	stats.SetDisconnectReason("CloseCode1006")
+	stats.Disconnected(io.EOF)
+
+	// Closed by the backend with an unexpected close code
+	stats.connected()
+	stats.Disconnected(&websocket.CloseError{Code: websocket.CloseTryAgainLater})
+
+	// Read error
+	stats.connected()
+	stats.Disconnected(errors.New("read error"))
+
+	snapshot := stats.Snapshot()
+	assert.Equal(t, "TCS", snapshot.Name)
+	assert.Equal(t, uint64(4), snapshot.Reconnects)
+	assert.Equal(t, map[string]uint64{
+		DisconnectReasonConnectError:     1,
+		DisconnectReasonHeartbeatTimeout: 1,
+		"CloseCode1013":                  1,
+		DisconnectReasonError:            1,
+	}, snapshot.ReconnectReasons)
+	assert.Equal(t, "read error", snapshot.LastError)
+	assert.NotNil(t, snapshot.LastErrorAt)
+}
+
+func TestNilConnectionStats(t *testing.T) {
+	var stats *ConnectionStats
+	stats.connected()
+	stats.messageReceived(heartbeatMessageType)
+	stats.RecordError(errors.New("error"))
+	stats.SetDisconnectReason(DisconnectReasonHeartbeatTimeout)
+	stats.Disconnected(io.EOF)
+	assert.Equal(t, ConnectionSnapshot{}, stats.Snapshot())
+}
+
+func TestConnectionRegistry(t *testing.T) {
+	registry := NewConnectionRegistry()
+	assert.Empty(t, registry.Connections())
+
+	registry.Register("ACS").connected()
+	registry.Register("TCS")
+
+	connections := registry.Connections()
+	require.Len(t, connections, 2)
+	assert.Equal(t, "ACS", connections[0].Name)
+	assert.True(t, connections[0].Connected)
+	assert.Equal(t, "TCS", connections[1].Name)
+	assert.False(t, connections[1].Connected)
+}
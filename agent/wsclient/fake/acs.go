@@ -0,0 +1,74 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fake
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ACSServer is a fake ACS. Tests script the payloads and credentials sent to
+// the agent and wait for its acks.
+type ACSServer struct {
+	*server
+}
+
+// NewACSServer starts a fake ACS.
+func NewACSServer() *ACSServer {
+	return &ACSServer{newServer(acsclient.NewACSDecoder())}
+}
+
+// SendPayload sends tasks to the agent.
+func (acs *ACSServer) SendPayload(payload *ecsacs.PayloadMessage) error {
+	return acs.Send(payload)
+}
+
+// SendRefreshCredentials sends task role credentials to the agent.
+func (acs *ACSServer) SendRefreshCredentials(message *ecsacs.IAMRoleCredentialsMessage) error {
+	return acs.Send(message)
+}
+
+// SendHeartbeat sends a heartbeat, which resets the disconnection timer of
+// the agent.
+func (acs *ACSServer) SendHeartbeat() error {
+	return acs.Send(&ecsacs.HeartbeatMessage{Healthy: aws.Bool(true)})
+}
+
+// RejectInactiveInstance makes the server reject connections with an
+// InactiveInstanceException, as ACS does for deregistered instances.
+func (acs *ACSServer) RejectInactiveInstance(message string) error {
+	return acs.RejectConnections(http.StatusBadRequest, &ecsacs.InactiveInstanceException{Message: aws.String(message)})
+}
+
+// WaitForAck returns the next payload ack sent by the agent.
+func (acs *ACSServer) WaitForAck(timeout time.Duration) (*ecsacs.AckRequest, error) {
+	message, err := acs.waitForMessage("AckRequest", timeout)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ecsacs.AckRequest), nil
+}
+
+// WaitForCredentialsAck returns the next credentials ack sent by the agent.
+func (acs *ACSServer) WaitForCredentialsAck(timeout time.Duration) (*ecsacs.IAMRoleCredentialsAckRequest, error) {
+	message, err := acs.waitForMessage("IAMRoleCredentialsAckRequest", timeout)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ecsacs.IAMRoleCredentialsAckRequest), nil
+}
@@ -0,0 +1,397 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fake runs local ACS and TCS websocket servers, so that tests can
+// exercise the websocket clients, request signing and message decoding end
+// to end without AWS. Point the agent at them with ACSEndpointOverride and
+// TCSEndpointOverride.
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/cihub/seelog"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsPath is the path the backend serves websockets on
+	wsPath = "/ws"
+	// signingService is the service name requests are signed for
+	signingService = "ecs"
+	// amzDateFormat is the format of the X-Amz-Date header
+	amzDateFormat = "20060102T150405Z"
+	writeTimeout  = 5 * time.Second
+)
+
+// ErrTimeout is returned when the awaited connection or message doesn't
+// arrive in time.
+var ErrTimeout = errors.New("fake: timed out")
+
+// errNotConnected is returned when sending while no client is connected.
+var errNotConnected = errors.New("fake: no client connected")
+
+// rejection is the response sent instead of upgrading connections.
+type rejection struct {
+	status int
+	body   []byte
+}
+
+// server is a TLS websocket server that frames messages like the ECS backend,
+// as in {"type":"AckRequest","message":{"messageId":"xyz"}}. It holds a single
+// client connection at a time, as the agent does.
+type server struct {
+	httpServer *httptest.Server
+	decoder    wsclient.TypeDecoder
+	upgrader   websocket.Upgrader
+
+	// lock guards the fields below, cond is signalled when they change
+	lock        sync.Mutex
+	cond        *sync.Cond
+	conn        *websocket.Conn
+	connections []*http.Request
+	// nextConnection is the index of the next connection returned by
+	// WaitForConnection
+	nextConnection int
+	received       []interface{}
+	// nextMessage maps message types to the number of messages of that type
+	// already returned by waitForMessage
+	nextMessage  map[string]int
+	decodeErrors []error
+	rejection    *rejection
+	credentials  *credentials.Credentials
+	region       string
+}
+
+func newServer(decoder wsclient.TypeDecoder) *server {
+	srv := &server{
+		decoder:     decoder,
+		upgrader:    websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024},
+		nextMessage: make(map[string]int),
+	}
+	srv.cond = sync.NewCond(&srv.lock)
+	mux := http.NewServeMux()
+	mux.HandleFunc(wsPath, srv.handleConnection)
+	srv.httpServer = httptest.NewTLSServer(mux)
+	return srv
+}
+
+// URL returns the endpoint of the server. Its certificate is self-signed, so
+// clients need AcceptInsecureCert.
+func (srv *server) URL() string {
+	return srv.httpServer.URL
+}
+
+// Close disconnects the client and stops the server.
+func (srv *server) Close() {
+	srv.lock.Lock()
+	if srv.conn != nil {
+		srv.conn.Close()
+	}
+	srv.lock.Unlock()
+	srv.httpServer.Close()
+}
+
+// VerifySignatures makes the server reject the connections that aren't
+// signed with the credentials for the region, the way the backend would.
+func (srv *server) VerifySignatures(creds *credentials.Credentials, region string) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.credentials = creds
+	srv.region = region
+}
+
+// RejectConnections makes the server answer connection attempts with the
+// status and the modeled error, e.g. &ecsacs.InactiveInstanceException{},
+// until AcceptConnections is called. Errors are sent in the unframed
+// {"InactiveInstanceException":"message"} form used by the backend.
+func (srv *server) RejectConnections(status int, modeledError interface{}) error {
+	body, err := errorBody(modeledError)
+	if err != nil {
+		return err
+	}
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.rejection = &rejection{status: status, body: body}
+	return nil
+}
+
+// AcceptConnections undoes RejectConnections.
+func (srv *server) AcceptConnections() {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.rejection = nil
+}
+
+// WaitForConnection returns the upgrade request of the next connection,
+// which carries the signed headers and the query string built by the client.
+func (srv *server) WaitForConnection(timeout time.Duration) (*http.Request, error) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	err := srv.wait(timeout, func() bool {
+		return srv.nextConnection < len(srv.connections)
+	})
+	if err != nil {
+		return nil, err
+	}
+	request := srv.connections[srv.nextConnection]
+	srv.nextConnection++
+	return request, nil
+}
+
+// WaitForDisconnection waits until no client is connected.
+func (srv *server) WaitForDisconnection(timeout time.Duration) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.wait(timeout, func() bool {
+		return srv.conn == nil
+	})
+}
+
+// Received returns all the messages received so far, decoded into their
+// model types, in order.
+func (srv *server) Received() []interface{} {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	received := make([]interface{}, len(srv.received))
+	copy(received, srv.received)
+	return received
+}
+
+// DecodeErrors returns the errors decoding the messages sent by clients.
+func (srv *server) DecodeErrors() []error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	decodeErrors := make([]error, len(srv.decodeErrors))
+	copy(decodeErrors, srv.decodeErrors)
+	return decodeErrors
+}
+
+// Send frames and sends a message of the model, e.g. &ecsacs.PayloadMessage{},
+// to the connected client.
+func (srv *server) Send(message interface{}) error {
+	messageData, err := jsonutil.BuildJSON(message)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&wsclient.RequestMessage{
+		Type:    typeName(message),
+		Message: json.RawMessage(messageData),
+	})
+	if err != nil {
+		return err
+	}
+	return srv.SendRaw(data)
+}
+
+// SendRaw sends data as is to the connected client.
+func (srv *server) SendRaw(data []byte) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if srv.conn == nil {
+		return errNotConnected
+	}
+	srv.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return srv.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// CloseConnection sends a close frame with the code, e.g.
+// websocket.CloseNormalClosure, to the connected client.
+func (srv *server) CloseConnection(code int, text string) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if srv.conn == nil {
+		return errNotConnected
+	}
+	return srv.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text),
+		time.Now().Add(writeTimeout))
+}
+
+// waitForMessage returns the next message of the type that wasn't returned
+// before.
+func (srv *server) waitForMessage(messageType string, timeout time.Duration) (interface{}, error) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	var message interface{}
+	err := srv.wait(timeout, func() bool {
+		seen := 0
+		for _, received := range srv.received {
+			if typeName(received) != messageType {
+				continue
+			}
+			if seen == srv.nextMessage[messageType] {
+				message = received
+				return true
+			}
+			seen++
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	srv.nextMessage[messageType]++
+	return message, nil
+}
+
+// wait blocks until ready returns true or the timeout elapses. It must be
+// called with the lock held.
+func (srv *server) wait(timeout time.Duration, ready func() bool) error {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		srv.lock.Lock()
+		defer srv.lock.Unlock()
+		srv.cond.Broadcast()
+	})
+	defer timer.Stop()
+	for !ready() {
+		if !time.Now().Before(deadline) {
+			return ErrTimeout
+		}
+		srv.cond.Wait()
+	}
+	return nil
+}
+
+func (srv *server) handleConnection(w http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	rejection := srv.rejection
+	creds, region := srv.credentials, srv.region
+	srv.lock.Unlock()
+
+	if rejection != nil {
+		w.WriteHeader(rejection.status)
+		w.Write(rejection.body)
+		return
+	}
+	if creds != nil {
+		err := verifySignature(r, creds, region)
+		if err != nil {
+			seelog.Warnf("Fake backend rejecting connection: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(fmt.Sprintf(`{"AccessDeniedException":%q}`, err.Error())))
+			return
+		}
+	}
+
+	conn, err := srv.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		seelog.Warnf("Fake backend unable to upgrade connection: %v", err)
+		return
+	}
+	srv.lock.Lock()
+	if srv.conn != nil {
+		srv.conn.Close()
+	}
+	srv.conn = conn
+	srv.connections = append(srv.connections, r)
+	srv.cond.Broadcast()
+	srv.lock.Unlock()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		message, err := srv.decode(data)
+		srv.lock.Lock()
+		if err != nil {
+			srv.decodeErrors = append(srv.decodeErrors, err)
+		} else {
+			srv.received = append(srv.received, message)
+		}
+		srv.cond.Broadcast()
+		srv.lock.Unlock()
+	}
+
+	srv.lock.Lock()
+	if srv.conn == conn {
+		srv.conn = nil
+	}
+	srv.cond.Broadcast()
+	srv.lock.Unlock()
+	conn.Close()
+}
+
+// decode decodes a message sent by the client. TCS clients prefix messages
+// with the headers of their signature, which are skipped.
+func (srv *server) decode(data []byte) (interface{}, error) {
+	if len(data) > 0 && data[0] != '{' {
+		headersEnd := bytes.Index(data, []byte("\r\n\r\n"))
+		if headersEnd < 0 {
+			return nil, fmt.Errorf("unable to find the end of the headers of message %q", data)
+		}
+		data = data[headersEnd+len("\r\n\r\n"):]
+	}
+	message, _, err := wsclient.DecodeData(data, srv.decoder)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// verifySignature signs the upgrade request again and compares the results.
+func verifySignature(r *http.Request, creds *credentials.Credentials, region string) error {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return errors.New("missing authorization header")
+	}
+	signTime, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date header: %v", err)
+	}
+	expected, err := http.NewRequest("GET", "wss://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return err
+	}
+	_, err = v4.NewSigner(creds).Sign(expected, nil, signingService, region, signTime)
+	if err != nil {
+		return err
+	}
+	if expected.Header.Get("Authorization") != authorization {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// errorBody formats a modeled error as {"ErrorType":"message"}.
+func errorBody(modeledError interface{}) ([]byte, error) {
+	value := reflect.ValueOf(modeledError)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("fake: %T is not a pointer to a modeled error", modeledError)
+	}
+	message := ""
+	messageField := value.Elem().FieldByName("Message")
+	if messageField.IsValid() && messageField.Kind() == reflect.Ptr && !messageField.IsNil() {
+		message, _ = messageField.Elem().Interface().(string)
+	}
+	return json.Marshal(map[string]string{typeName(modeledError): message})
+}
+
+// typeName returns the name of the model type of a message, which is also its
+// type on the wire.
+func typeName(message interface{}) string {
+	return reflect.TypeOf(message).Elem().Name()
+}
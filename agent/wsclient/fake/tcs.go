@@ -0,0 +1,63 @@
+// Copyright 2014-2017 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fake
+
+import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/tcs/client"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// TCSServer is a fake TCS. Tests wait for the metrics published by the agent
+// and script its acks and heartbeats.
+type TCSServer struct {
+	*server
+}
+
+// NewTCSServer starts a fake TCS.
+func NewTCSServer() *TCSServer {
+	return &TCSServer{newServer(tcsclient.NewTCSDecoder())}
+}
+
+// SendAck acknowledges published metrics, which resets the disconnection
+// timer of the agent.
+func (tcs *TCSServer) SendAck() error {
+	return tcs.Send(&ecstcs.AckPublishMetric{Message: aws.String("")})
+}
+
+// SendHeartbeat sends a heartbeat, which resets the disconnection timer of
+// the agent.
+func (tcs *TCSServer) SendHeartbeat() error {
+	return tcs.Send(&ecstcs.HeartbeatMessage{Healthy: aws.Bool(true)})
+}
+
+// WaitForPublishMetrics returns the next metrics published by the agent.
+func (tcs *TCSServer) WaitForPublishMetrics(timeout time.Duration) (*ecstcs.PublishMetricsRequest, error) {
+	message, err := tcs.waitForMessage("PublishMetricsRequest", timeout)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ecstcs.PublishMetricsRequest), nil
+}
+
+// WaitForHeartbeat returns the next heartbeat sent by the agent.
+func (tcs *TCSServer) WaitForHeartbeat(timeout time.Duration) (*ecstcs.HeartbeatMessage, error) {
+	message, err := tcs.waitForMessage("HeartbeatMessage", timeout)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ecstcs.HeartbeatMessage), nil
+}
@@ -130,6 +130,16 @@ func (_mr *_MockClientServerRecorder) SetConnection(arg0 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetConnection", arg0)
 }
 
+func (_m *MockClientServer) Shutdown() error {
+	ret := _m.ctrl.Call(_m, "Shutdown")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientServerRecorder) Shutdown() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Shutdown")
+}
+
 func (_m *MockClientServer) WriteMessage(_param0 []byte) error {
 	ret := _m.ctrl.Call(_m, "WriteMessage", _param0)
 	ret0, _ := ret[0].(error)